@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/request"
+)
+
+type (
+	// AccessRecord is an entry in a file's access log.
+	AccessRecord struct {
+		Time      time.Time
+		Action    AccessAction
+		UserID    blinkfile.UserID `json:",omitempty"`
+		IP        string           `json:",omitempty"`
+		UserAgent string           `json:",omitempty"`
+		RequestID string           `json:",omitempty"`
+		// BytesSent is how much of the file data was sent to the client.
+		BytesSent int64  `json:",omitempty"`
+		Detail    string `json:",omitempty"`
+	}
+
+	AccessAction string
+)
+
+// A download that ended before all the file data was sent is aborted. Failed attempts without their own action are
+// denied, with the reason in the detail.
+const (
+	AccessDownloaded    AccessAction = "downloaded"
+	AccessAborted       AccessAction = "aborted"
+	AccessPreviewed     AccessAction = "previewed"
+	AccessWrongPassword AccessAction = "wrong_password"
+	AccessLimitReached  AccessAction = "limit_reached"
+	AccessExpired       AccessAction = "expired"
+	AccessDenied        AccessAction = "denied"
+	AccessTermsAccepted AccessAction = "terms_accepted"
+	AccessLinkSigned    AccessAction = "link_signed"
+)
+
+// recordAccess appends to the file's access log with the details of the client's request. Failures are only logged so
+// they don't block the download.
+func (a *App) recordAccess(ctx context.Context, fileID blinkfile.FileID, record AccessRecord) {
+	record.Time = a.cfg.Now()
+	if ip := request.GetClientIP(ctx); ip.IsValid() {
+		record.IP = ip.String()
+	}
+	record.UserAgent = request.GetUserAgent(ctx)
+	record.RequestID = request.GetID(ctx)
+	err := a.cfg.FileRepo.RecordAccess(ctx, fileID, record)
+	if err != nil {
+		a.Errorf(ctx, "recording access %+v to file %q: %v", record, fileID, err)
+	}
+}
+
+// downloadFailed records a failed attempt to download or preview the file. Clients that are only being asked for the
+// password, a recipient email or to accept the terms haven't attempted the download yet, so they aren't recorded.
+func (a *App) downloadFailed(ctx context.Context, file blinkfile.FileHeader, userID blinkfile.UserID, err error) {
+	action := AccessDenied
+	switch {
+	case errors.Is(err, blinkfile.ErrFilePasswordRequired), errors.Is(err, blinkfile.ErrRecipientNotVerified),
+		errors.Is(err, blinkfile.ErrTermsNotAccepted), errors.Is(err, blinkfile.ErrPreviewUnavailable):
+		return
+	case errors.Is(err, blinkfile.ErrFilePasswordInvalid):
+		action = AccessWrongPassword
+	case errors.Is(err, blinkfile.ErrDownloadLimitReached):
+		action = AccessLimitReached
+	case errors.Is(err, blinkfile.ErrFileExpired):
+		action = AccessExpired
+	}
+	a.recordAccess(ctx, file.ID, AccessRecord{Action: action, UserID: userID, Detail: err.Error()})
+}
+
+// RecordDownload records a download in the file's access log and stats once its data has been sent, as aborted if less
+// than all of the data was sent. It must be called before FinishDownload, which can purge the file along with its
+// access log and stats.
+func (a *App) RecordDownload(ctx context.Context, userID blinkfile.UserID, fileID blinkfile.FileID, bytesSent int64) {
+	file, err := a.cfg.FileRepo.Get(ctx, fileID)
+	if err != nil {
+		a.Errorf(ctx, "recording download of file %q: %v", fileID, err)
+		return
+	}
+	completed := bytesSent >= file.Size
+	action := AccessDownloaded
+	if !completed {
+		action = AccessAborted
+	}
+	a.recordAccess(ctx, fileID, AccessRecord{Action: action, UserID: userID, BytesSent: bytesSent})
+	a.addDownloadStats(ctx, userID, fileID, bytesSent, completed)
+}
+
+// ListFileAccess returns the access log of one of the owner's files, newest first.
+func (a *App) ListFileAccess(ctx context.Context, owner blinkfile.UserID, fileID blinkfile.FileID) ([]AccessRecord, error) {
+	file, err := a.GetFile(ctx, owner, fileID)
+	if err != nil {
+		return nil, err
+	}
+	records, err := a.cfg.FileRepo.ListAccess(ctx, file.ID)
+	if err != nil {
+		return nil, Err(ErrRepo, fmt.Errorf("retrieving access log of file %q: %w", file.ID, err))
+	}
+	slices.Reverse(records)
+	return records, nil
+}
@@ -0,0 +1,128 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/request"
+)
+
+func TestApp_DownloadFile_AccessLog(t *testing.T) {
+	now := time.Unix(100, 0)
+	hasher := &StubPasswordHasher{MatchFunc: func(hash string, data []byte) (bool, error) {
+		return string(data) == "right", nil
+	}}
+	tests := []struct {
+		name       string
+		file       blinkfile.FileHeader
+		password   string
+		sent       int64
+		wantAccess []app.AccessRecord
+	}{
+		{
+			name:       "should record a wrong password",
+			file:       blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash"},
+			password:   "wrong",
+			wantAccess: []app.AccessRecord{{Action: app.AccessWrongPassword, Detail: blinkfile.ErrFilePasswordInvalid.Error()}},
+		},
+		{
+			name:       "should record a download after the limit was reached",
+			file:       blinkfile.FileHeader{ID: "file1", Owner: "user1", DownloadLimit: 1, Downloads: 1},
+			wantAccess: []app.AccessRecord{{Action: app.AccessLimitReached, Detail: blinkfile.ErrDownloadLimitReached.Error()}},
+		},
+		{
+			name:       "should record a download after the file expired",
+			file:       blinkfile.FileHeader{ID: "file1", Owner: "user1", Expires: now},
+			wantAccess: []app.AccessRecord{{Action: app.AccessExpired, Detail: blinkfile.ErrFileExpired.Error()}},
+		},
+		{
+			name:       "should record any other failure as denied",
+			file:       blinkfile.FileHeader{ID: "file1", Owner: "user1", AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+			wantAccess: []app.AccessRecord{{Action: app.AccessDenied, Detail: app.Err(app.ErrAuthzFailed, blinkfile.ErrNetworkNotAllowed).Error()}},
+		},
+		{
+			name: "should not record a client that is asked for the password",
+			file: blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash"},
+		},
+		{
+			name:       "should record the bytes sent once the download is done",
+			file:       blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash"},
+			password:   "right",
+			sent:       1024,
+			wantAccess: []app.AccessRecord{{Action: app.AccessDownloaded, BytesSent: 1024}},
+		},
+		{
+			name:       "should record a download that ended before all the data was sent as aborted",
+			file:       blinkfile.FileHeader{ID: "file1", Owner: "user1", Size: 2048},
+			sent:       1024,
+			wantAccess: []app.AccessRecord{{Action: app.AccessAborted, BytesSent: 1024}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := request.CtxWithNewID(context.Background())
+			ctx = request.CtxWithClientIP(ctx, netip.MustParseAddr("192.0.2.1"))
+			ctx = request.CtxWithUserAgent(ctx, "curl/8.0")
+			r := newMemFileRepo(tt.file)
+			var access []app.AccessRecord
+			r.RecordAccessFunc = func(_ context.Context, _ blinkfile.FileID, record app.AccessRecord) error {
+				access = append(access, record)
+				return nil
+			}
+			cfg := AppConfigDefaults(app.Config{
+				Clock:          &StaticClock{T: now},
+				FileRepo:       r,
+				PasswordHasher: hasher,
+			})
+			application := NewTestApp(ctx, t, cfg)
+			file, err := application.DownloadFile(ctx, "user2", tt.file.ID, tt.password)
+			if err == nil {
+				application.RecordDownload(ctx, "user2", file.ID, tt.sent)
+				application.FinishDownload(ctx, file.ID)
+			}
+			var want []app.AccessRecord
+			for _, record := range tt.wantAccess {
+				record.Time = now
+				record.UserID = "user2"
+				record.IP = "192.0.2.1"
+				record.UserAgent = "curl/8.0"
+				record.RequestID = request.GetID(ctx)
+				want = append(want, record)
+			}
+			if !reflect.DeepEqual(access, want) {
+				t.Errorf("access = %+v, want %+v", access, want)
+			}
+		})
+	}
+}
+
+func TestApp_ListFileAccess(t *testing.T) {
+	ctx := context.Background()
+	r := newMemFileRepo(blinkfile.FileHeader{ID: "file1", Owner: "user1"})
+	records := []app.AccessRecord{
+		{Time: time.Unix(100, 0), Action: app.AccessWrongPassword},
+		{Time: time.Unix(200, 0), Action: app.AccessDownloaded},
+	}
+	r.ListAccessFunc = func(_ context.Context, fileID blinkfile.FileID) ([]app.AccessRecord, error) {
+		return append([]app.AccessRecord(nil), records...), nil
+	}
+	application := NewTestApp(ctx, t, AppConfigDefaults(app.Config{FileRepo: r}))
+
+	got, err := application.ListFileAccess(ctx, "user1", "file1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []app.AccessRecord{records[1], records[0]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListFileAccess() = %+v, want %+v", got, want)
+	}
+	_, err = application.ListFileAccess(ctx, "user2", "file1")
+	if !errors.Is(err, app.ErrFileNotFound) {
+		t.Errorf("ListFileAccess() of another user's file error = %v, want %v", err, app.ErrFileNotFound)
+	}
+}
@@ -0,0 +1,237 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/longduration"
+)
+
+type (
+	APITokenID string
+
+	// APIToken lets scripts and other clients that aren't browsers act as the user that created it, limited to its
+	// scopes. Only a hash of its secret is stored, the token itself is only shown once when it's created.
+	APIToken struct {
+		ID     APITokenID
+		UserID blinkfile.UserID
+		Name   string
+		Hash   string
+		Scopes []APITokenScope
+		// Expires is zero if the token never expires.
+		Expires  time.Time
+		Created  time.Time
+		LastUsed time.Time
+	}
+
+	// APITokenScope is what an API token is allowed to do.
+	APITokenScope string
+
+	APITokenRepo interface {
+		Save(context.Context, APIToken) error
+		Get(context.Context, APITokenID) (APIToken, bool, error)
+		ListByUser(context.Context, blinkfile.UserID) ([]APIToken, error)
+		Delete(context.Context, APITokenID) error
+		DeleteAllUserTokens(context.Context, blinkfile.UserID) (int, error)
+		// Touch sets when the token was last used, if it still exists, so it can't restore a token that was just revoked.
+		Touch(context.Context, APITokenID, time.Time) error
+	}
+
+	CreateAPITokenArgs struct {
+		UserID    blinkfile.UserID
+		Name      string
+		Scopes    []APITokenScope
+		ExpiresIn longduration.LongDuration
+	}
+)
+
+const (
+	// APIScopeUpload allows uploading files.
+	APIScopeUpload APITokenScope = "upload"
+	// APIScopeDownload allows downloading and signing download links for the user's files without their passwords.
+	APIScopeDownload APITokenScope = "download"
+)
+
+// APITokenScopes are all the scopes an API token can have.
+var APITokenScopes = []APITokenScope{APIScopeUpload, APIScopeDownload}
+
+// IsExpired returns true if the token expired by the given time.
+func (t APIToken) IsExpired(now time.Time) bool {
+	return !t.Expires.IsZero() && !now.Before(t.Expires)
+}
+
+// HasScope returns true if the token is allowed to do what the scope allows.
+func (t APIToken) HasScope(scope APITokenScope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+const (
+	// apiTokenPrefix makes the tokens easy to recognize, such as by secret scanners.
+	apiTokenPrefix        = "bf_"
+	apiTokenIDLength      = 12
+	apiTokenSecretLength  = 32
+	apiTokenNameMaxLength = 100
+	// apiTokenLastUsedInterval is how often the time a token was last used is saved, so tokens used by every request of
+	// a busy script don't write to the repo each time.
+	apiTokenLastUsedInterval = time.Minute
+)
+
+var ErrAPITokenNotFound = fmt.Errorf("API token not found")
+
+// CreateAPIToken creates a named API token for the user and returns it, this is the only time the token is available.
+func (a *App) CreateAPIToken(ctx context.Context, args CreateAPITokenArgs) (string, APIToken, error) {
+	if args.UserID == "" {
+		return "", APIToken{}, Err(ErrBadRequest, fmt.Errorf("user ID is required"))
+	}
+	name := strings.TrimSpace(args.Name)
+	if name == "" {
+		return "", APIToken{}, ErrUser("Invalid token name", "Token name is required.", fmt.Errorf("API token name cannot be empty"))
+	}
+	if len(name) > apiTokenNameMaxLength {
+		return "", APIToken{}, ErrUser("Invalid token name", fmt.Sprintf("Token name can't be longer than %d characters.", apiTokenNameMaxLength), fmt.Errorf("API token name is %d characters", len(name)))
+	}
+	scopes, err := parseAPITokenScopes(args.Scopes)
+	if err != nil {
+		return "", APIToken{}, err
+	}
+	now := a.cfg.Now()
+	var expires time.Time
+	if args.ExpiresIn != "" {
+		expires, err = args.ExpiresIn.AddTo(now)
+		if err != nil {
+			return "", APIToken{}, ErrUser("Invalid token expiration", "Token expiration is not in a valid format.", err)
+		}
+		if !expires.After(now) {
+			return "", APIToken{}, ErrUser("Invalid token expiration", "Token expiration must be in the future.", fmt.Errorf("API token expiration %q is not positive", args.ExpiresIn))
+		}
+	}
+	id := make([]byte, apiTokenIDLength)
+	secret := make([]byte, apiTokenSecretLength)
+	if _, err := rand.Read(id); err != nil {
+		return "", APIToken{}, Err(ErrInternal, fmt.Errorf("generating API token ID: %w", err))
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", APIToken{}, Err(ErrInternal, fmt.Errorf("generating API token secret: %w", err))
+	}
+	token := APIToken{
+		ID:      APITokenID(hex.EncodeToString(id)),
+		UserID:  args.UserID,
+		Name:    name,
+		Scopes:  scopes,
+		Expires: expires,
+		Created: now,
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	token.Hash = hashAPITokenSecret(encodedSecret)
+	err = a.cfg.APITokenRepo.Save(ctx, token)
+	if err != nil {
+		return "", APIToken{}, Err(ErrRepo, fmt.Errorf("saving API token: %w", err))
+	}
+	a.audit(ctx, AuditRecord{Action: AuditAPITokenCreated, UserID: args.UserID, Detail: name})
+	return fmt.Sprintf("%s%s.%s", apiTokenPrefix, token.ID, encodedSecret), token, nil
+}
+
+// parseAPITokenScopes returns the known scopes in the order of APITokenScopes, without duplicates.
+func parseAPITokenScopes(in []APITokenScope) ([]APITokenScope, error) {
+	if len(in) == 0 {
+		return nil, ErrUser("Invalid token scopes", "Select at least one scope for the token.", fmt.Errorf("API token has no scopes"))
+	}
+	for _, scope := range in {
+		if !slices.Contains(APITokenScopes, scope) {
+			return nil, ErrUser("Invalid token scopes", fmt.Sprintf("Unknown scope %q.", scope), fmt.Errorf("unknown API token scope %q", scope))
+		}
+	}
+	scopes := make([]APITokenScope, 0, len(in))
+	for _, scope := range APITokenScopes {
+		if slices.Contains(in, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func hashAPITokenSecret(secret string) string {
+	// The secret is random, so a fast hash is enough to keep it from being used if the stored tokens leak
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// AuthenticateAPIToken returns the ID of the user that created the token, if it has the scope.
+func (a *App) AuthenticateAPIToken(ctx context.Context, token string, scope APITokenScope) (blinkfile.UserID, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(token, apiTokenPrefix), ".")
+	if !ok || !strings.HasPrefix(token, apiTokenPrefix) {
+		return "", Err(ErrAuthnFailed, fmt.Errorf("API token is malformed"))
+	}
+	apiToken, found, err := a.cfg.APITokenRepo.Get(ctx, APITokenID(id))
+	if err != nil {
+		return "", Err(ErrRepo, fmt.Errorf("getting API token %q: %w", id, err))
+	}
+	if !found || !stringsAreEqual(apiToken.Hash, hashAPITokenSecret(secret)) {
+		return "", Err(ErrAuthnFailed, fmt.Errorf("API token %q is invalid", id))
+	}
+	now := a.cfg.Now()
+	if apiToken.IsExpired(now) {
+		return "", Err(ErrAuthnFailed, fmt.Errorf("API token %q expired at %v", id, apiToken.Expires)).AddDetail("The API token has expired.")
+	}
+	if !a.userIsValid(ctx, apiToken.UserID) {
+		return "", Err(ErrAuthnFailed, fmt.Errorf("API token %q is valid but user ID %q isn't valid", id, apiToken.UserID))
+	}
+	if !apiToken.HasScope(scope) {
+		return "", Err(ErrAuthzFailed, fmt.Errorf("API token %q doesn't have scope %q", id, scope)).AddDetail(fmt.Sprintf("The API token doesn't have the %s scope.", scope))
+	}
+	if now.Sub(apiToken.LastUsed) >= apiTokenLastUsedInterval {
+		err = a.cfg.APITokenRepo.Touch(ctx, apiToken.ID, now)
+		if err != nil {
+			a.Errorf(ctx, "saving last use of API token %q: %v", id, err)
+		}
+	}
+	return apiToken.UserID, nil
+}
+
+// ListAPITokens returns the user's API tokens, oldest first.
+func (a *App) ListAPITokens(ctx context.Context, userID blinkfile.UserID) ([]APIToken, error) {
+	tokens, err := a.cfg.APITokenRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, Err(ErrRepo, fmt.Errorf("listing API tokens: %w", err))
+	}
+	slices.SortFunc(tokens, func(t1, t2 APIToken) int {
+		return t1.Created.Compare(t2.Created)
+	})
+	return tokens, nil
+}
+
+// RevokeAPIToken deletes one of the user's API tokens.
+func (a *App) RevokeAPIToken(ctx context.Context, userID blinkfile.UserID, id APITokenID) error {
+	token, found, err := a.cfg.APITokenRepo.Get(ctx, id)
+	if err != nil {
+		return Err(ErrRepo, fmt.Errorf("getting API token %q: %w", id, err))
+	}
+	if !found || token.UserID != userID {
+		return Err(ErrNotFound, ErrAPITokenNotFound)
+	}
+	err = a.cfg.APITokenRepo.Delete(ctx, id)
+	if err != nil {
+		return Err(ErrRepo, fmt.Errorf("deleting API token %q: %w", id, err))
+	}
+	a.audit(ctx, AuditRecord{Action: AuditAPITokenRevoked, UserID: userID, Detail: token.Name})
+	return nil
+}
+
+// revokeAllUserAPITokens deletes all the user's API tokens, so they can't be used once the user is deleted or their
+// password changes.
+func (a *App) revokeAllUserAPITokens(ctx context.Context, userID blinkfile.UserID) error {
+	count, err := a.cfg.APITokenRepo.DeleteAllUserTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+	a.Printf(ctx, "deleted %d API tokens for user ID %s", count, userID)
+	return nil
+}
@@ -0,0 +1,258 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/longduration"
+)
+
+// newMemAPITokenRepo stores API tokens in memory.
+func newMemAPITokenRepo() *StubAPITokenRepo {
+	tokens := make(map[app.APITokenID]app.APIToken)
+	return &StubAPITokenRepo{
+		SaveFunc: func(_ context.Context, token app.APIToken) error {
+			tokens[token.ID] = token
+			return nil
+		},
+		GetFunc: func(_ context.Context, id app.APITokenID) (app.APIToken, bool, error) {
+			token, found := tokens[id]
+			return token, found, nil
+		},
+		ListByUserFunc: func(_ context.Context, userID blinkfile.UserID) ([]app.APIToken, error) {
+			var out []app.APIToken
+			for _, token := range tokens {
+				if token.UserID == userID {
+					out = append(out, token)
+				}
+			}
+			return out, nil
+		},
+		DeleteFunc: func(_ context.Context, id app.APITokenID) error {
+			delete(tokens, id)
+			return nil
+		},
+		DeleteAllFunc: func(_ context.Context, userID blinkfile.UserID) (int, error) {
+			var count int
+			for id, token := range tokens {
+				if token.UserID == userID {
+					delete(tokens, id)
+					count++
+				}
+			}
+			return count, nil
+		},
+		TouchFunc: func(_ context.Context, id app.APITokenID, lastUsed time.Time) error {
+			if token, found := tokens[id]; found {
+				token.LastUsed = lastUsed
+				tokens[id] = token
+			}
+			return nil
+		},
+	}
+}
+
+// existingUsers is a user repo with the users.
+func existingUsers(userIDs ...blinkfile.UserID) *StubUserRepo {
+	return &StubUserRepo{GetFunc: func(_ context.Context, userID blinkfile.UserID) (blinkfile.User, bool, error) {
+		for _, id := range userIDs {
+			if id == userID {
+				return blinkfile.User{ID: userID, Username: blinkfile.Username(userID)}, true, nil
+			}
+		}
+		return blinkfile.User{}, false, nil
+	}}
+}
+
+func TestApp_CreateAPIToken(t *testing.T) {
+	now := time.Unix(100, 0).UTC()
+	tests := []struct {
+		name    string
+		args    app.CreateAPITokenArgs
+		want    app.APIToken
+		wantErr error
+	}{
+		{
+			name:    "should fail without a name",
+			args:    app.CreateAPITokenArgs{UserID: "user1", Name: "  ", Scopes: []app.APITokenScope{app.APIScopeUpload}},
+			wantErr: app.ErrUser("Invalid token name", "Token name is required.", errors.New("API token name cannot be empty")),
+		},
+		{
+			name:    "should fail with a name that is too long",
+			args:    app.CreateAPITokenArgs{UserID: "user1", Name: strings.Repeat("a", 101), Scopes: []app.APITokenScope{app.APIScopeUpload}},
+			wantErr: app.ErrUser("Invalid token name", "Token name can't be longer than 100 characters.", errors.New("API token name is 101 characters")),
+		},
+		{
+			name:    "should fail without scopes",
+			args:    app.CreateAPITokenArgs{UserID: "user1", Name: "backup"},
+			wantErr: app.ErrUser("Invalid token scopes", "Select at least one scope for the token.", errors.New("API token has no scopes")),
+		},
+		{
+			name:    "should fail with an unknown scope",
+			args:    app.CreateAPITokenArgs{UserID: "user1", Name: "backup", Scopes: []app.APITokenScope{"admin"}},
+			wantErr: app.ErrUser("Invalid token scopes", `Unknown scope "admin".`, errors.New(`unknown API token scope "admin"`)),
+		},
+		{
+			name:    "should fail with an expiration that isn't in the future",
+			args:    app.CreateAPITokenArgs{UserID: "user1", Name: "backup", Scopes: []app.APITokenScope{app.APIScopeUpload}, ExpiresIn: "-1d"},
+			wantErr: app.ErrUser("Invalid token expiration", "Token expiration must be in the future.", errors.New(`API token expiration "-1d" is not positive`)),
+		},
+		{
+			name: "should create a token that never expires",
+			args: app.CreateAPITokenArgs{UserID: "user1", Name: " backup script ", Scopes: []app.APITokenScope{app.APIScopeDownload, app.APIScopeUpload, app.APIScopeDownload}},
+			want: app.APIToken{UserID: "user1", Name: "backup script", Scopes: []app.APITokenScope{app.APIScopeUpload, app.APIScopeDownload}, Created: now},
+		},
+		{
+			name: "should create a token that expires",
+			args: app.CreateAPITokenArgs{UserID: "user1", Name: "ci", Scopes: []app.APITokenScope{app.APIScopeUpload}, ExpiresIn: "30d"},
+			want: app.APIToken{UserID: "user1", Name: "ci", Scopes: []app.APITokenScope{app.APIScopeUpload}, Expires: now.Add(30 * 24 * time.Hour), Created: now},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			application := NewTestApp(ctx, t, AppConfigDefaults(app.Config{
+				Clock:        &StaticClock{T: now},
+				APITokenRepo: newMemAPITokenRepo(),
+				UserRepo:     existingUsers("user1"),
+			}))
+			secret, token, err := application.CreateAPIToken(ctx, tt.args)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("CreateAPIToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if strings.Contains(token.Hash, secret) || strings.Contains(secret, token.Hash) {
+				t.Errorf("CreateAPIToken() token hash %q contains the secret %q", token.Hash, secret)
+			}
+			token.ID, token.Hash = "", ""
+			if !reflect.DeepEqual(token, tt.want) {
+				t.Errorf("CreateAPIToken() token = %+v, want %+v", token, tt.want)
+			}
+			userID, err := application.AuthenticateAPIToken(ctx, secret, tt.want.Scopes[0])
+			if err != nil || userID != tt.want.UserID {
+				t.Errorf("AuthenticateAPIToken() = %q, %v, want %q", userID, err, tt.want.UserID)
+			}
+		})
+	}
+}
+
+func TestApp_AuthenticateAPIToken(t *testing.T) {
+	ctx := context.Background()
+	clock := &StaticClock{T: time.Unix(100, 0).UTC()}
+	tokens := newMemAPITokenRepo()
+	application := NewTestApp(ctx, t, AppConfigDefaults(app.Config{Clock: clock, APITokenRepo: tokens, UserRepo: existingUsers("user1")}))
+	create := func(userID blinkfile.UserID, expiresIn longduration.LongDuration) (string, app.APIToken) {
+		secret, token, err := application.CreateAPIToken(ctx, app.CreateAPITokenArgs{UserID: userID, Name: "backup", Scopes: []app.APITokenScope{app.APIScopeUpload}, ExpiresIn: expiresIn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return secret, token
+	}
+	secret, token := create("user1", "")
+	expiringSecret, _ := create("user1", "1h")
+	deletedUserSecret, _ := create("user2", "")
+	tests := []struct {
+		name     string
+		token    string
+		scope    app.APITokenScope
+		later    time.Duration
+		wantType app.ErrorType
+	}{
+		{name: "should fail for an empty token", scope: app.APIScopeUpload, wantType: app.ErrAuthnFailed},
+		{name: "should fail for a malformed token", token: "not-a-token", scope: app.APIScopeUpload, wantType: app.ErrAuthnFailed},
+		{name: "should fail without the prefix", token: strings.TrimPrefix(secret, "bf_"), scope: app.APIScopeUpload, wantType: app.ErrAuthnFailed},
+		{name: "should fail for the wrong secret", token: secret[:strings.Index(secret, ".")] + ".wrong", scope: app.APIScopeUpload, wantType: app.ErrAuthnFailed},
+		{name: "should fail for an unknown token", token: "bf_unknown." + secret[strings.Index(secret, ".")+1:], scope: app.APIScopeUpload, wantType: app.ErrAuthnFailed},
+		{name: "should fail if the user no longer exists", token: deletedUserSecret, scope: app.APIScopeUpload, wantType: app.ErrAuthnFailed},
+		{name: "should fail once the token expires", token: expiringSecret, scope: app.APIScopeUpload, later: time.Hour, wantType: app.ErrAuthnFailed},
+		{name: "should fail without the scope", token: secret, scope: app.APIScopeDownload, wantType: app.ErrAuthzFailed},
+		{name: "should succeed before the token expires", token: expiringSecret, scope: app.APIScopeUpload, later: time.Hour - time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := clock.T
+			clock.T = clock.T.Add(tt.later)
+			defer func() { clock.T = prev }()
+			userID, err := application.AuthenticateAPIToken(ctx, tt.token, tt.scope)
+			if tt.wantType == "" {
+				if err != nil || userID != "user1" {
+					t.Errorf("AuthenticateAPIToken() = %q, %v, want %q", userID, err, "user1")
+				}
+				return
+			}
+			var appErr *app.Error
+			if !errors.As(err, &appErr) || appErr.Type != tt.wantType || userID != "" {
+				t.Errorf("AuthenticateAPIToken() = %q, %v, want a %s error", userID, err, tt.wantType)
+			}
+		})
+	}
+
+	t.Run("should track when the token was last used", func(t *testing.T) {
+		clock.T = clock.T.Add(time.Minute)
+		if _, err := application.AuthenticateAPIToken(ctx, secret, app.APIScopeUpload); err != nil {
+			t.Fatal(err)
+		}
+		got, _, _ := tokens.Get(ctx, token.ID)
+		if !got.LastUsed.Equal(clock.T) {
+			t.Errorf("LastUsed = %v, want %v", got.LastUsed, clock.T)
+		}
+	})
+
+	t.Run("should fail once the token is revoked", func(t *testing.T) {
+		err := application.RevokeAPIToken(ctx, "user2", token.ID)
+		if !errors.Is(err, app.ErrAPITokenNotFound) {
+			t.Errorf("RevokeAPIToken() by another user error = %v, want %v", err, app.ErrAPITokenNotFound)
+		}
+		err = application.RevokeAPIToken(ctx, "user1", token.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = application.AuthenticateAPIToken(ctx, secret, app.APIScopeUpload); err == nil {
+			t.Errorf("AuthenticateAPIToken() of a revoked token error = nil, want an error")
+		}
+		list, err := application.ListAPITokens(ctx, "user1")
+		if err != nil || len(list) != 1 {
+			t.Errorf("ListAPITokens() = %+v, %v, want only the expiring token", list, err)
+		}
+	})
+
+	t.Run("should revoke the user's tokens when they change their password", func(t *testing.T) {
+		_, err := application.ChangePassword(ctx, app.ChangePasswordArgs{ID: "user1", Password: "a-new-password-123"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := application.ListAPITokens(ctx, "user1")
+		if err != nil || len(list) != 0 {
+			t.Errorf("ListAPITokens() = %+v, %v, want none", list, err)
+		}
+	})
+
+	t.Run("should not restore a token that is revoked while it's being used", func(t *testing.T) {
+		secret, token := create("user1", "")
+		get := tokens.GetFunc
+		tokens.GetFunc = func(ctx context.Context, id app.APITokenID) (app.APIToken, bool, error) {
+			got, found, err := get(ctx, id)
+			// Revoke the token after it's read, the revocation reads it again itself
+			tokens.GetFunc = get
+			if revokeErr := application.RevokeAPIToken(ctx, "user1", id); revokeErr != nil {
+				t.Error(revokeErr)
+			}
+			return got, found, err
+		}
+		defer func() { tokens.GetFunc = get }()
+		if _, err := application.AuthenticateAPIToken(ctx, secret, app.APIScopeUpload); err != nil {
+			t.Fatal(err)
+		}
+		if _, found, _ := tokens.Get(ctx, token.ID); found {
+			t.Errorf("Get() after revoking the token found = true, want false")
+		}
+	})
+}
@@ -5,9 +5,13 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/signedurl"
+	"github.com/benjohns1/blinkfile/thumbnail"
 )
 
 type (
@@ -20,11 +24,48 @@ type (
 		FileRepo
 		UserRepo
 		CredentialRepo
+		PolicyRepo
+		AuditRepo
+		APITokenRepo
 		GenerateToken func() (Token, error)
 		Clock
 		PasswordHasher
 		GenerateFileID func() (blinkfile.FileID, error)
 		GenerateUserID func() (blinkfile.UserID, error)
+		// GenerateThumbnail returns an encoded thumbnail image, it is run in the background after an image upload.
+		GenerateThumbnail func(io.Reader) ([]byte, error)
+		// StripImageMetadata removes EXIF and XMP metadata from all uploaded images, otherwise the uploader can choose
+		// to remove it.
+		StripImageMetadata bool
+		// Processors are run in order on each upload before it is saved, after the built-in content type detection and
+		// image metadata removal.
+		Processors []Processor
+		// AsyncProcessors are run in order in the background after an upload is saved, before thumbnail generation.
+		AsyncProcessors []AsyncProcessor
+		// Scanner scans uploads for viruses, infected uploads are rejected.
+		Scanner
+		// ScanAsync scans uploads in the background after they are saved instead, infected files are quarantined and
+		// downloads are blocked until the scan is done.
+		ScanAsync bool
+		// TrashRetention is how long deleted files are kept in the trash, where the owner can restore them, before they
+		// are purged. Files are deleted immediately if it's zero.
+		TrashRetention time.Duration
+		// PreviewCountsAsDownload counts viewing an inline file preview against the download count and limit.
+		PreviewCountsAsDownload bool
+		// PasswordBackoff is how long to wait before a file's password can be attempted again after a wrong one,
+		// doubling after each failure in a row.
+		PasswordBackoff time.Duration
+		// PasswordLockoutAttempts locks a file's password after this many failures in a row, until the owner unlocks it.
+		PasswordLockoutAttempts int64
+		// Mailer sends the codes that verify recipient email addresses, files can't be restricted to recipients
+		// without it.
+		Mailer
+		GenerateVerificationCode func() (string, error)
+		// SignedURLSecret signs download URLs, a random secret is used if it's empty so signed URLs don't survive a
+		// restart.
+		SignedURLSecret []byte
+		// SignedURLMaxTTL is the longest time a signed download URL can be used for.
+		SignedURLMaxTTL time.Duration
 	}
 
 	SessionRepo interface {
@@ -37,10 +78,24 @@ type (
 	FileRepo interface {
 		Save(context.Context, blinkfile.File) error
 		ListByUser(context.Context, blinkfile.UserID) ([]blinkfile.FileHeader, error)
+		ListAll(context.Context) ([]blinkfile.FileHeader, error)
 		DeleteExpiredBefore(context.Context, time.Time) (int, error)
 		Get(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error)
 		Delete(context.Context, blinkfile.UserID, []blinkfile.FileID) error
 		PutHeader(context.Context, blinkfile.FileHeader) error
+		// UpdateHeader changes the file's header with the update function atomically, so concurrent changes to other
+		// fields aren't lost. Nothing is saved if the update returns an error.
+		UpdateHeader(ctx context.Context, fileID blinkfile.FileID, update func(*blinkfile.FileHeader) error) (blinkfile.FileHeader, error)
+		Open(context.Context, blinkfile.FileID) (io.ReadCloser, error)
+		SaveThumbnail(context.Context, blinkfile.FileID, io.Reader) error
+		// RecordAccess appends to the file's access log, which is deleted along with the file.
+		RecordAccess(context.Context, blinkfile.FileID, AccessRecord) error
+		// ListAccess returns the file's access log, oldest first.
+		ListAccess(context.Context, blinkfile.FileID) ([]AccessRecord, error)
+		// AddDownloadStats adds the download to the file's stats rollup, which is deleted along with the file.
+		AddDownloadStats(context.Context, blinkfile.FileID, blinkfile.DownloadEvent) error
+		// GetDownloadStats returns the file's stats rollup.
+		GetDownloadStats(context.Context, blinkfile.FileID) (blinkfile.DownloadStats, error)
 	}
 
 	UserRepo interface {
@@ -68,6 +123,13 @@ type (
 		cfg              Config
 		adminCredentials map[blinkfile.Username]Credentials
 		Log
+		previews   *previewGrants
+		policyMu   *sync.Mutex
+		downloads  *activeDownloads
+		expiry     *expiryScheduler
+		recipients *recipientVerifications
+		signer     *signedurl.Signer
+		scans      *activeScans
 	}
 
 	Log interface {
@@ -102,6 +164,15 @@ func New(ctx context.Context, cfg Config) (*App, error) {
 	if cfg.FileRepo == nil {
 		return nil, fmt.Errorf("file repo is required")
 	}
+	if cfg.PolicyRepo == nil {
+		return nil, fmt.Errorf("policy repo is required")
+	}
+	if cfg.AuditRepo == nil {
+		return nil, fmt.Errorf("audit repo is required")
+	}
+	if cfg.APITokenRepo == nil {
+		return nil, fmt.Errorf("API token repo is required")
+	}
 	if cfg.PasswordHasher == nil {
 		return nil, fmt.Errorf("password hasher is required")
 	}
@@ -111,10 +182,28 @@ func New(ctx context.Context, cfg Config) (*App, error) {
 	if cfg.GenerateUserID == nil {
 		cfg.GenerateUserID = generateUserID
 	}
+	if cfg.GenerateVerificationCode == nil {
+		cfg.GenerateVerificationCode = generateVerificationCode
+	}
+	if cfg.GenerateThumbnail == nil {
+		cfg.GenerateThumbnail = thumbnail.Default.Generate
+	}
+	if cfg.SignedURLMaxTTL <= 0 {
+		cfg.SignedURLMaxTTL = DefaultSignedURLMaxTTL
+	}
+	signer, err := signedurl.New(signedurl.Config{Secret: cfg.SignedURLSecret, Now: cfg.Now})
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := newExpiryScheduler(func(file blinkfile.FileHeader) time.Time {
+		return deletionTime(file, cfg.TrashRetention)
+	})
+	cfg.FileRepo = &schedulingFileRepo{cfg.FileRepo, expiry}
 
-	a := &App{cfg, make(map[blinkfile.Username]Credentials, 1), cfg.Log}
+	a := &App{cfg, make(map[blinkfile.Username]Credentials, 1), cfg.Log, newPreviewGrants(), &sync.Mutex{}, newActiveDownloads(), expiry, newRecipientVerifications(), signer, newActiveScans()}
 
-	err := a.registerAdminUser(ctx, blinkfile.Username(cfg.AdminUsername), cfg.AdminPassword)
+	err = a.registerAdminUser(ctx, blinkfile.Username(cfg.AdminUsername), cfg.AdminPassword)
 	if err != nil {
 		return nil, err
 	}
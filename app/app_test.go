@@ -3,7 +3,9 @@ package app_test
 import (
 	"context"
 	"fmt"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -31,6 +33,18 @@ func AppConfigDefaults(cfg app.Config) app.Config {
 		out.CredentialRepo = &StubCredentialRepo{}
 	}
 
+	if cfg.PolicyRepo == nil {
+		out.PolicyRepo = &StubPolicyRepo{}
+	}
+
+	if cfg.AuditRepo == nil {
+		out.AuditRepo = &StubAuditRepo{}
+	}
+
+	if cfg.APITokenRepo == nil {
+		out.APITokenRepo = &StubAPITokenRepo{}
+	}
+
 	if cfg.Log == nil {
 		out.Log = log.New(log.Config{})
 	}
@@ -109,10 +123,18 @@ func (_ *StubSessionRepo) DeleteAllUserSessions(context.Context, blinkfile.UserI
 type StubFileRepo struct {
 	SaveFunc                func(context.Context, blinkfile.File) error
 	ListByUserFunc          func(context.Context, blinkfile.UserID) ([]blinkfile.FileHeader, error)
+	ListAllFunc             func(context.Context) ([]blinkfile.FileHeader, error)
 	DeleteExpiredBeforeFunc func(context.Context, time.Time) (int, error)
 	GetFunc                 func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error)
 	DeleteFunc              func(context.Context, blinkfile.UserID, []blinkfile.FileID) error
 	PutHeaderFunc           func(context.Context, blinkfile.FileHeader) error
+	UpdateHeaderFunc        func(context.Context, blinkfile.FileID, func(*blinkfile.FileHeader) error) (blinkfile.FileHeader, error)
+	OpenFunc                func(context.Context, blinkfile.FileID) (io.ReadCloser, error)
+	SaveThumbnailFunc       func(context.Context, blinkfile.FileID, io.Reader) error
+	RecordAccessFunc        func(context.Context, blinkfile.FileID, app.AccessRecord) error
+	ListAccessFunc          func(context.Context, blinkfile.FileID) ([]app.AccessRecord, error)
+	AddDownloadStatsFunc    func(context.Context, blinkfile.FileID, blinkfile.DownloadEvent) error
+	GetDownloadStatsFunc    func(context.Context, blinkfile.FileID) (blinkfile.DownloadStats, error)
 }
 
 func (fr *StubFileRepo) Save(ctx context.Context, f blinkfile.File) error {
@@ -127,6 +149,12 @@ func (fr *StubFileRepo) ListByUser(ctx context.Context, uID blinkfile.UserID) ([
 	}
 	return nil, nil
 }
+func (fr *StubFileRepo) ListAll(ctx context.Context) ([]blinkfile.FileHeader, error) {
+	if fr.ListAllFunc != nil {
+		return fr.ListAllFunc(ctx)
+	}
+	return nil, nil
+}
 func (fr *StubFileRepo) DeleteExpiredBefore(ctx context.Context, t time.Time) (int, error) {
 	if fr.DeleteExpiredBeforeFunc != nil {
 		return fr.DeleteExpiredBeforeFunc(ctx, t)
@@ -153,6 +181,64 @@ func (fr *StubFileRepo) PutHeader(ctx context.Context, putHeader blinkfile.FileH
 	return nil
 }
 
+// UpdateHeader gets the header and puts the updated header with the other stubs, unless it's stubbed itself.
+func (fr *StubFileRepo) UpdateHeader(ctx context.Context, fID blinkfile.FileID, update func(*blinkfile.FileHeader) error) (blinkfile.FileHeader, error) {
+	if fr.UpdateHeaderFunc != nil {
+		return fr.UpdateHeaderFunc(ctx, fID, update)
+	}
+	header, err := fr.Get(ctx, fID)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	err = update(&header)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	return header, fr.PutHeader(ctx, header)
+}
+
+func (fr *StubFileRepo) Open(ctx context.Context, fID blinkfile.FileID) (io.ReadCloser, error) {
+	if fr.OpenFunc != nil {
+		return fr.OpenFunc(ctx, fID)
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (fr *StubFileRepo) SaveThumbnail(ctx context.Context, fID blinkfile.FileID, data io.Reader) error {
+	if fr.SaveThumbnailFunc != nil {
+		return fr.SaveThumbnailFunc(ctx, fID, data)
+	}
+	return nil
+}
+
+func (fr *StubFileRepo) RecordAccess(ctx context.Context, fID blinkfile.FileID, record app.AccessRecord) error {
+	if fr.RecordAccessFunc != nil {
+		return fr.RecordAccessFunc(ctx, fID, record)
+	}
+	return nil
+}
+
+func (fr *StubFileRepo) ListAccess(ctx context.Context, fID blinkfile.FileID) ([]app.AccessRecord, error) {
+	if fr.ListAccessFunc != nil {
+		return fr.ListAccessFunc(ctx, fID)
+	}
+	return nil, nil
+}
+
+func (fr *StubFileRepo) AddDownloadStats(ctx context.Context, fID blinkfile.FileID, event blinkfile.DownloadEvent) error {
+	if fr.AddDownloadStatsFunc != nil {
+		return fr.AddDownloadStatsFunc(ctx, fID, event)
+	}
+	return nil
+}
+
+func (fr *StubFileRepo) GetDownloadStats(ctx context.Context, fID blinkfile.FileID) (blinkfile.DownloadStats, error) {
+	if fr.GetDownloadStatsFunc != nil {
+		return fr.GetDownloadStatsFunc(ctx, fID)
+	}
+	return blinkfile.DownloadStats{}, nil
+}
+
 type StubUserRepo struct {
 	CreateFunc  func(context.Context, blinkfile.User) error
 	UpdateFunc  func(context.Context, blinkfile.User) error
@@ -231,6 +317,88 @@ func (cr *StubCredentialRepo) Remove(ctx context.Context, userID blinkfile.UserI
 	return nil
 }
 
+type StubPolicyRepo struct {
+	GetFunc  func(context.Context) (app.Policy, error)
+	SaveFunc func(context.Context, app.Policy) error
+}
+
+func (pr *StubPolicyRepo) Get(ctx context.Context) (app.Policy, error) {
+	if pr.GetFunc != nil {
+		return pr.GetFunc(ctx)
+	}
+	return app.Policy{}, nil
+}
+func (pr *StubPolicyRepo) Save(ctx context.Context, policy app.Policy) error {
+	if pr.SaveFunc != nil {
+		return pr.SaveFunc(ctx, policy)
+	}
+	return nil
+}
+
+type StubAuditRepo struct {
+	RecordFunc func(context.Context, app.AuditRecord) error
+	ListFunc   func(context.Context, int) ([]app.AuditRecord, error)
+}
+
+func (ar *StubAuditRepo) Record(ctx context.Context, record app.AuditRecord) error {
+	if ar.RecordFunc != nil {
+		return ar.RecordFunc(ctx, record)
+	}
+	return nil
+}
+func (ar *StubAuditRepo) List(ctx context.Context, limit int) ([]app.AuditRecord, error) {
+	if ar.ListFunc != nil {
+		return ar.ListFunc(ctx, limit)
+	}
+	return nil, nil
+}
+
+type StubAPITokenRepo struct {
+	SaveFunc       func(context.Context, app.APIToken) error
+	GetFunc        func(context.Context, app.APITokenID) (app.APIToken, bool, error)
+	ListByUserFunc func(context.Context, blinkfile.UserID) ([]app.APIToken, error)
+	DeleteFunc     func(context.Context, app.APITokenID) error
+	DeleteAllFunc  func(context.Context, blinkfile.UserID) (int, error)
+	TouchFunc      func(context.Context, app.APITokenID, time.Time) error
+}
+
+func (tr *StubAPITokenRepo) Save(ctx context.Context, token app.APIToken) error {
+	if tr.SaveFunc != nil {
+		return tr.SaveFunc(ctx, token)
+	}
+	return nil
+}
+func (tr *StubAPITokenRepo) Get(ctx context.Context, id app.APITokenID) (app.APIToken, bool, error) {
+	if tr.GetFunc != nil {
+		return tr.GetFunc(ctx, id)
+	}
+	return app.APIToken{}, false, nil
+}
+func (tr *StubAPITokenRepo) ListByUser(ctx context.Context, userID blinkfile.UserID) ([]app.APIToken, error) {
+	if tr.ListByUserFunc != nil {
+		return tr.ListByUserFunc(ctx, userID)
+	}
+	return nil, nil
+}
+func (tr *StubAPITokenRepo) Delete(ctx context.Context, id app.APITokenID) error {
+	if tr.DeleteFunc != nil {
+		return tr.DeleteFunc(ctx, id)
+	}
+	return nil
+}
+func (tr *StubAPITokenRepo) DeleteAllUserTokens(ctx context.Context, userID blinkfile.UserID) (int, error) {
+	if tr.DeleteAllFunc != nil {
+		return tr.DeleteAllFunc(ctx, userID)
+	}
+	return 0, nil
+}
+func (tr *StubAPITokenRepo) Touch(ctx context.Context, id app.APITokenID, lastUsed time.Time) error {
+	if tr.TouchFunc != nil {
+		return tr.TouchFunc(ctx, id, lastUsed)
+	}
+	return nil
+}
+
 func TestNew(t *testing.T) {
 	ctx := context.Background()
 	type args struct {
@@ -272,6 +440,45 @@ func TestNew(t *testing.T) {
 			},
 			wantErr: fmt.Errorf("file repo is required"),
 		},
+		{
+			name: "should fail with a nil policy repo",
+			args: args{
+				cfg: app.Config{
+					Log:         log.New(log.Config{}),
+					SessionRepo: &StubSessionRepo{},
+					FileRepo:    &StubFileRepo{},
+					PolicyRepo:  nil,
+				},
+			},
+			wantErr: fmt.Errorf("policy repo is required"),
+		},
+		{
+			name: "should fail with a nil audit repo",
+			args: args{
+				cfg: app.Config{
+					Log:         log.New(log.Config{}),
+					SessionRepo: &StubSessionRepo{},
+					FileRepo:    &StubFileRepo{},
+					PolicyRepo:  &StubPolicyRepo{},
+					AuditRepo:   nil,
+				},
+			},
+			wantErr: fmt.Errorf("audit repo is required"),
+		},
+		{
+			name: "should fail with a nil API token repo",
+			args: args{
+				cfg: app.Config{
+					Log:          log.New(log.Config{}),
+					SessionRepo:  &StubSessionRepo{},
+					FileRepo:     &StubFileRepo{},
+					PolicyRepo:   &StubPolicyRepo{},
+					AuditRepo:    &StubAuditRepo{},
+					APITokenRepo: nil,
+				},
+			},
+			wantErr: fmt.Errorf("API token repo is required"),
+		},
 		{
 			name: "should fail with a nil password hasher",
 			args: args{
@@ -279,6 +486,9 @@ func TestNew(t *testing.T) {
 					Log:            log.New(log.Config{}),
 					SessionRepo:    &StubSessionRepo{},
 					FileRepo:       &StubFileRepo{},
+					PolicyRepo:     &StubPolicyRepo{},
+					AuditRepo:      &StubAuditRepo{},
+					APITokenRepo:   &StubAPITokenRepo{},
 					PasswordHasher: nil,
 				},
 			},
@@ -291,6 +501,9 @@ func TestNew(t *testing.T) {
 					Log:            log.New(log.Config{}),
 					SessionRepo:    &StubSessionRepo{},
 					FileRepo:       &StubFileRepo{},
+					PolicyRepo:     &StubPolicyRepo{},
+					AuditRepo:      &StubAuditRepo{},
+					APITokenRepo:   &StubAPITokenRepo{},
 					PasswordHasher: &hash.Argon2idDefault,
 					AdminUsername:  "",
 				},
@@ -303,6 +516,9 @@ func TestNew(t *testing.T) {
 					Log:            log.New(log.Config{}),
 					SessionRepo:    &StubSessionRepo{},
 					FileRepo:       &StubFileRepo{},
+					PolicyRepo:     &StubPolicyRepo{},
+					AuditRepo:      &StubAuditRepo{},
+					APITokenRepo:   &StubAPITokenRepo{},
 					PasswordHasher: &hash.Argon2idDefault,
 					AdminUsername:  "admin",
 					AdminPassword:  "123456781234567",
@@ -317,6 +533,9 @@ func TestNew(t *testing.T) {
 					Log:            log.New(log.Config{}),
 					SessionRepo:    &StubSessionRepo{},
 					FileRepo:       &StubFileRepo{},
+					PolicyRepo:     &StubPolicyRepo{},
+					AuditRepo:      &StubAuditRepo{},
+					APITokenRepo:   &StubAPITokenRepo{},
 					PasswordHasher: &hash.Argon2idDefault,
 					AdminUsername:  "admin",
 					AdminPassword:  "1234567812345678",
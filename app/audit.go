@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+type (
+	AuditRecord struct {
+		Time     time.Time
+		Action   AuditAction
+		UserID   blinkfile.UserID
+		FileID   blinkfile.FileID `json:",omitempty"`
+		FileName string           `json:",omitempty"`
+		Detail   string
+	}
+
+	AuditAction string
+
+	AuditRepo interface {
+		Record(context.Context, AuditRecord) error
+		// List returns up to limit of the most recent records, newest first.
+		List(ctx context.Context, limit int) ([]AuditRecord, error)
+	}
+)
+
+const (
+	AuditUploadRejected AuditAction = "upload_rejected"
+	AuditPolicyChanged  AuditAction = "policy_changed"
+	AuditHoldPlaced     AuditAction = "hold_placed"
+	AuditHoldReleased   AuditAction = "hold_released"
+
+	AuditRecipientVerified   AuditAction = "recipient_verified"
+	AuditRecipientDownloaded AuditAction = "recipient_downloaded"
+
+	AuditAPITokenCreated AuditAction = "api_token_created"
+	AuditAPITokenRevoked AuditAction = "api_token_revoked"
+)
+
+// audit records an action, failures are only logged so they don't block the action being audited.
+func (a *App) audit(ctx context.Context, record AuditRecord) {
+	record.Time = a.cfg.Now()
+	err := a.cfg.AuditRepo.Record(ctx, record)
+	if err != nil {
+		a.Errorf(ctx, "recording audit %+v: %v", record, err)
+	}
+}
+
+func (a *App) ListAuditRecords(ctx context.Context, limit int) ([]AuditRecord, error) {
+	if limit <= 0 {
+		return nil, Err(ErrBadRequest, fmt.Errorf("limit must be positive"))
+	}
+	records, err := a.cfg.AuditRepo.List(ctx, limit)
+	if err != nil {
+		return nil, Err(ErrRepo, fmt.Errorf("retrieving audit records: %w", err))
+	}
+	return records, nil
+}
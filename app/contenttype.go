@@ -0,0 +1,72 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/benjohns1/blinkfile/imagemeta"
+)
+
+const sniffLen = 512
+
+// executableMagic lists executable and script formats that http.DetectContentType doesn't recognize, so file type
+// policies can block them even if they're renamed.
+var executableMagic = []struct{ prefix, contentType string }{
+	{"MZ", "application/vnd.microsoft.portable-executable"},
+	{"\x7fELF", "application/x-executable"},
+	{"\xfe\xed\xfa\xce", "application/x-mach-binary"},
+	{"\xfe\xed\xfa\xcf", "application/x-mach-binary"},
+	{"\xce\xfa\xed\xfe", "application/x-mach-binary"},
+	{"\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+	{"#!", "text/x-shellscript"},
+}
+
+type sniffedReader struct {
+	io.Reader
+	io.Closer
+}
+
+// detectContentType is an upload processor that sets the file content type.
+func detectContentType(_ context.Context, upload *Upload) error {
+	if upload.Data == nil {
+		return nil
+	}
+	var err error
+	upload.ContentType, upload.Data, err = sniffContentType(upload.Name, upload.Data)
+	if err != nil {
+		return ErrUser("Error uploading file", "Could not read the uploaded file data.", err)
+	}
+	return nil
+}
+
+// sniffContentType detects the content type from the first bytes of the file data, falling back to the filename
+// extension if the data isn't recognized. The returned reader replays the sniffed bytes.
+func sniffContentType(filename string, r io.ReadCloser) (string, io.ReadCloser, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", r, err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if heif, ok := imagemeta.DetectHEIF(head); ok {
+		contentType = heif
+	}
+	for _, magic := range executableMagic {
+		if bytes.HasPrefix(head, []byte(magic.prefix)) {
+			contentType = magic.contentType
+			break
+		}
+	}
+	if contentType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(filepath.Ext(filename)); byExt != "" {
+			contentType = byExt
+		}
+	}
+	return contentType, sniffedReader{io.MultiReader(bytes.NewReader(head), r), r}, nil
+}
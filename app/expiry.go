@@ -0,0 +1,233 @@
+package app
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+type (
+	// expiryScheduler keeps a min-heap of the times files are due to be deleted, when they expire or are purged from the
+	// trash, so each file can be deleted on time without scanning every file.
+	expiryScheduler struct {
+		mu       sync.Mutex
+		queue    expiryQueue
+		index    map[blinkfile.FileID]*expiryItem
+		wake     chan struct{}
+		deadline func(blinkfile.FileHeader) time.Time
+	}
+
+	expiryItem struct {
+		fileID  blinkfile.FileID
+		expires time.Time
+		pos     int
+	}
+
+	expiryQueue []*expiryItem
+
+	// schedulingFileRepo keeps the expiry schedule up to date as file headers are saved and deleted.
+	schedulingFileRepo struct {
+		FileRepo
+		expiry *expiryScheduler
+	}
+)
+
+// maxExpiryWait is how long the scheduler sleeps when no files are due to expire.
+const maxExpiryWait = 24 * time.Hour
+
+func newExpiryScheduler(deadline func(blinkfile.FileHeader) time.Time) *expiryScheduler {
+	return &expiryScheduler{
+		index:    make(map[blinkfile.FileID]*expiryItem),
+		wake:     make(chan struct{}, 1),
+		deadline: deadline,
+	}
+}
+
+// deletionTime returns when the file is due to be deleted, or zero if it never is.
+func deletionTime(file blinkfile.FileHeader, trashRetention time.Duration) time.Time {
+	if file.LegalHold {
+		return time.Time{}
+	}
+	deadline := file.ExpiresAt()
+	if file.IsTrashed() && trashRetention > 0 {
+		purge := file.Trashed.Add(trashRetention)
+		if deadline.IsZero() || purge.Before(deadline) {
+			deadline = purge
+		}
+	}
+	return deadline
+}
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].expires.Before(q[j].expires) }
+func (q expiryQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].pos, q[j].pos = i, j
+}
+func (q *expiryQueue) Push(x any) {
+	item := x.(*expiryItem)
+	item.pos = len(*q)
+	*q = append(*q, item)
+}
+func (q *expiryQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return item
+}
+
+// schedule adds, moves or removes the file's deletion time.
+func (s *expiryScheduler) schedule(file blinkfile.FileHeader) {
+	deadline := s.deadline(file)
+	if deadline.IsZero() {
+		s.remove(file.ID)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if item, ok := s.index[file.ID]; ok {
+		item.expires = deadline
+		heap.Fix(&s.queue, item.pos)
+	} else {
+		item = &expiryItem{fileID: file.ID, expires: deadline}
+		heap.Push(&s.queue, item)
+		s.index[file.ID] = item
+	}
+	if s.queue[0].fileID == file.ID {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *expiryScheduler) remove(fileID blinkfile.FileID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.index[fileID]
+	if !ok {
+		return
+	}
+	heap.Remove(&s.queue, item.pos)
+	delete(s.index, fileID)
+}
+
+// popDue removes and returns the files that expire at or before now, and how long until the next file expires.
+func (s *expiryScheduler) popDue(now time.Time) ([]blinkfile.FileID, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []blinkfile.FileID
+	for len(s.queue) > 0 && !s.queue[0].expires.After(now) {
+		item := heap.Pop(&s.queue).(*expiryItem)
+		delete(s.index, item.fileID)
+		due = append(due, item.fileID)
+	}
+	if len(s.queue) == 0 {
+		return due, maxExpiryWait
+	}
+	return due, min(s.queue[0].expires.Sub(now), maxExpiryWait)
+}
+
+func (r *schedulingFileRepo) Save(ctx context.Context, file blinkfile.File) error {
+	err := r.FileRepo.Save(ctx, file)
+	if err == nil {
+		r.expiry.schedule(file.FileHeader)
+	}
+	return err
+}
+
+func (r *schedulingFileRepo) PutHeader(ctx context.Context, file blinkfile.FileHeader) error {
+	err := r.FileRepo.PutHeader(ctx, file)
+	if err == nil {
+		r.expiry.schedule(file)
+	}
+	return err
+}
+
+func (r *schedulingFileRepo) UpdateHeader(ctx context.Context, fileID blinkfile.FileID, update func(*blinkfile.FileHeader) error) (blinkfile.FileHeader, error) {
+	file, err := r.FileRepo.UpdateHeader(ctx, fileID, update)
+	if err == nil {
+		r.expiry.schedule(file)
+	}
+	return file, err
+}
+
+func (r *schedulingFileRepo) Delete(ctx context.Context, owner blinkfile.UserID, fileIDs []blinkfile.FileID) error {
+	err := r.FileRepo.Delete(ctx, owner, fileIDs)
+	for _, fileID := range fileIDs {
+		if _, getErr := r.FileRepo.Get(ctx, fileID); errors.Is(getErr, ErrFileNotFound) {
+			r.expiry.remove(fileID)
+		}
+	}
+	return err
+}
+
+// StartExpiryScheduler loads the expiration times of all files and deletes each file as soon as it expires or its trash
+// retention has passed, until the context is cancelled. DeleteExpiredFiles should still be run occasionally as a safety
+// net.
+func (a *App) StartExpiryScheduler(ctx context.Context) error {
+	files, err := a.cfg.FileRepo.ListAll(ctx)
+	if err != nil {
+		return Err(ErrRepo, fmt.Errorf("loading file expiration times: %w", err))
+	}
+	for _, file := range files {
+		a.expiry.schedule(file)
+	}
+	go a.runExpiryScheduler(ctx)
+	return nil
+}
+
+func (a *App) runExpiryScheduler(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		due, wait := a.expiry.popDue(a.cfg.Now())
+		for _, fileID := range due {
+			a.deleteDueFile(ctx, fileID)
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-a.expiry.wake:
+		}
+	}
+}
+
+func (a *App) deleteDueFile(ctx context.Context, fileID blinkfile.FileID) {
+	file, err := a.cfg.FileRepo.Get(ctx, fileID)
+	if errors.Is(err, ErrFileNotFound) {
+		return
+	}
+	if err != nil {
+		a.Errorf(ctx, "retrieving file %q due for deletion: %v", fileID, err)
+		return
+	}
+	deadline := a.expiry.deadline(file)
+	if deadline.IsZero() || deadline.After(a.cfg.Now()) {
+		// The file changed since it was scheduled
+		a.expiry.schedule(file)
+		return
+	}
+	err = a.cfg.FileRepo.Delete(ctx, file.Owner, []blinkfile.FileID{file.ID})
+	if err != nil {
+		a.Errorf(ctx, "deleting file %q: %v", file.ID, err)
+		return
+	}
+	if file.IsTrashed() {
+		a.Printf(ctx, "Purged file %q from the trash", file.ID)
+		return
+	}
+	a.Printf(ctx, "Deleted expired file %q", file.ID)
+	fileChanged(ctx, file.Owner, FileEvent{
+		FileHeader: blinkfile.FileHeader{ID: file.ID},
+		Change:     FileDeleted,
+	})
+}
@@ -0,0 +1,187 @@
+package app_test
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+// memFileRepo is a minimal in-memory file repo for tests that need files to change over time.
+type memFileRepo struct {
+	StubFileRepo
+	mu      sync.Mutex
+	files   map[blinkfile.FileID]blinkfile.FileHeader
+	deleted chan blinkfile.FileID
+}
+
+func newMemFileRepo(files ...blinkfile.FileHeader) *memFileRepo {
+	r := &memFileRepo{files: make(map[blinkfile.FileID]blinkfile.FileHeader), deleted: make(chan blinkfile.FileID, 10)}
+	for _, file := range files {
+		r.files[file.ID] = file
+	}
+	return r
+}
+
+func (r *memFileRepo) Save(_ context.Context, file blinkfile.File) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files[file.ID] = file.FileHeader
+	return nil
+}
+
+func (r *memFileRepo) PutHeader(_ context.Context, file blinkfile.FileHeader) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.files[file.ID]; !ok {
+		return app.ErrFileNotFound
+	}
+	r.files[file.ID] = file
+	return nil
+}
+
+func (r *memFileRepo) UpdateHeader(_ context.Context, fileID blinkfile.FileID, update func(*blinkfile.FileHeader) error) (blinkfile.FileHeader, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, ok := r.files[fileID]
+	if !ok {
+		return blinkfile.FileHeader{}, app.ErrFileNotFound
+	}
+	err := update(&file)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	r.files[fileID] = file
+	return file, nil
+}
+
+func (r *memFileRepo) Get(_ context.Context, fileID blinkfile.FileID) (blinkfile.FileHeader, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, ok := r.files[fileID]
+	if !ok {
+		return blinkfile.FileHeader{}, app.ErrFileNotFound
+	}
+	return file, nil
+}
+
+func (r *memFileRepo) ListAll(context.Context) ([]blinkfile.FileHeader, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]blinkfile.FileHeader, 0, len(r.files))
+	for _, file := range r.files {
+		out = append(out, file)
+	}
+	return out, nil
+}
+
+func (r *memFileRepo) Delete(_ context.Context, _ blinkfile.UserID, fileIDs []blinkfile.FileID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, fileID := range fileIDs {
+		delete(r.files, fileID)
+		r.deleted <- fileID
+	}
+	return nil
+}
+
+func TestApp_StartExpiryScheduler(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    func(now time.Time) []blinkfile.FileHeader
+		act         func(*testing.T, time.Time, *app.App, *memFileRepo)
+		wantDeleted []blinkfile.FileID
+	}{
+		{
+			name: "should delete existing files as they expire",
+			existing: func(now time.Time) []blinkfile.FileHeader {
+				return []blinkfile.FileHeader{
+					{ID: "later", Owner: "user1", Expires: now.Add(50 * time.Millisecond)},
+					{ID: "expired", Owner: "user1", Expires: now.Add(-time.Minute)},
+					{ID: "never", Owner: "user1"},
+					{ID: "much-later", Owner: "user1", Expires: now.Add(time.Hour)},
+				}
+			},
+			wantDeleted: []blinkfile.FileID{"expired", "later"},
+		},
+		{
+			name: "should delete a file uploaded after starting when it expires",
+			act: func(t *testing.T, now time.Time, a *app.App, _ *memFileRepo) {
+				_, err := a.UploadFile(context.Background(), app.UploadFileArgs{
+					Filename: "file1",
+					Owner:    "user1",
+					Reader:   io.NopCloser(strings.NewReader("file-data")),
+					Expires:  now.Add(50 * time.Millisecond),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantDeleted: []blinkfile.FileID{"file1"},
+		},
+		{
+			name: "should reschedule a file if its expiration is extended",
+			existing: func(now time.Time) []blinkfile.FileHeader {
+				return []blinkfile.FileHeader{
+					{ID: "extended", Owner: "user1", Expires: now.Add(50 * time.Millisecond)},
+					{ID: "file2", Owner: "user1", Expires: now.Add(100 * time.Millisecond)},
+				}
+			},
+			act: func(t *testing.T, now time.Time, _ *app.App, r *memFileRepo) {
+				file, _ := r.Get(context.Background(), "extended")
+				file.Expires = now.Add(150 * time.Millisecond)
+				// Change the header outside the app, so the scheduler must re-check it when it fires
+				if err := r.PutHeader(context.Background(), file); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantDeleted: []blinkfile.FileID{"file2", "extended"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			now := time.Now()
+			var existing []blinkfile.FileHeader
+			if tt.existing != nil {
+				existing = tt.existing(now)
+			}
+			r := newMemFileRepo(existing...)
+			cfg := AppConfigDefaults(app.Config{
+				FileRepo:       r,
+				GenerateFileID: func() (blinkfile.FileID, error) { return "file1", nil },
+			})
+			application := NewTestApp(ctx, t, cfg)
+			if err := application.StartExpiryScheduler(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if tt.act != nil {
+				tt.act(t, now, application, r)
+			}
+			var deleted []blinkfile.FileID
+			for len(deleted) < len(tt.wantDeleted) {
+				select {
+				case fileID := <-r.deleted:
+					deleted = append(deleted, fileID)
+				case <-time.After(time.Second):
+					t.Fatalf("StartExpiryScheduler() deleted %v, want %v", deleted, tt.wantDeleted)
+				}
+			}
+			select {
+			case fileID := <-r.deleted:
+				t.Errorf("StartExpiryScheduler() unexpectedly deleted %q", fileID)
+			case <-time.After(100 * time.Millisecond):
+			}
+			if !reflect.DeepEqual(deleted, tt.wantDeleted) {
+				t.Errorf("StartExpiryScheduler() deleted %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/netip"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,6 +23,7 @@ func (a *App) ListFiles(ctx context.Context, owner blinkfile.UserID) ([]blinkfil
 	if err != nil {
 		return nil, Err(ErrRepo, fmt.Errorf("retrieving file list: %w", err))
 	}
+	files = filterTrashed(files, false)
 	files = a.filterExpired(files)
 	files = filterDownloaded(files)
 	sortFilesByCreatedTimeDesc(files)
@@ -30,7 +33,7 @@ func (a *App) ListFiles(ctx context.Context, owner blinkfile.UserID) ([]blinkfil
 func (a *App) filterExpired(files []blinkfile.FileHeader) []blinkfile.FileHeader {
 	out := make([]blinkfile.FileHeader, 0, len(files))
 	for _, file := range files {
-		if !file.Expires.IsZero() && !a.cfg.Now().Before(file.Expires) {
+		if file.IsExpired(a.cfg.Now()) {
 			continue
 		}
 		out = append(out, file)
@@ -63,61 +66,223 @@ func sortFilesByCreatedTimeDesc(files []blinkfile.FileHeader) {
 }
 
 type UploadFileArgs struct {
-	Filename      string
-	Owner         blinkfile.UserID
-	Reader        io.ReadCloser
-	Size          int64
-	Password      string
-	ExpiresIn     longduration.LongDuration
-	Expires       time.Time
-	DownloadLimit int64
+	Filename         string
+	Owner            blinkfile.UserID
+	Reader           io.ReadCloser
+	Size             int64
+	Password         string
+	ExpiresIn        longduration.LongDuration
+	Expires          time.Time
+	DownloadLimit    int64
+	AllowPreview     bool
+	ShowThumbnail    bool
+	StripMetadata    bool
+	InactivityExpiry longduration.LongDuration
+	AvailableIn      longduration.LongDuration
+	AvailableFrom    time.Time
+	// AllowedNetworks are IP addresses and CIDR ranges that clients must download the file from.
+	AllowedNetworks []string
+	// RecipientEmails are the email addresses that clients must verify to download the file.
+	RecipientEmails []string
+	// Terms must be accepted by clients before they download the file.
+	Terms string
 }
 
-func (a *App) UploadFile(ctx context.Context, args UploadFileArgs) error {
+// UploadFile saves the uploaded file and returns its header as stored, which can differ from the upload if image
+// metadata was removed.
+func (a *App) UploadFile(ctx context.Context, args UploadFileArgs) (blinkfile.FileHeader, error) {
 	fileID, err := a.cfg.GenerateFileID()
 	if err != nil {
-		return Err(ErrInternal, fmt.Errorf("generating file ID: %w", err))
+		return blinkfile.FileHeader{}, Err(ErrInternal, fmt.Errorf("generating file ID: %w", err))
 	}
 	hashFunc := func(password string) (hash string) {
 		return a.cfg.PasswordHasher.Hash([]byte(password))
 	}
 	if args.ExpiresIn != "" {
 		if !args.Expires.IsZero() {
-			return ErrUser("Error validating file expiration", "Can only set one of the expiration fields at a time.", nil)
+			return blinkfile.FileHeader{}, ErrUser("Error validating file expiration", "Can only set one of the expiration fields at a time.", nil)
 		}
 		args.Expires, err = args.ExpiresIn.AddTo(a.cfg.Now())
 		if err != nil {
-			return ErrUser("Error calculating file expiration", "Expires In field is not in a valid format.", err)
+			return blinkfile.FileHeader{}, ErrUser("Error calculating file expiration", "Expires In field is not in a valid format.", err)
 		}
 	}
+	if args.AvailableIn != "" {
+		if !args.AvailableFrom.IsZero() {
+			return blinkfile.FileHeader{}, ErrUser("Error validating file availability", "Can only set one of the availability fields at a time.", nil)
+		}
+		args.AvailableFrom, err = args.AvailableIn.AddTo(a.cfg.Now())
+		if err != nil {
+			return blinkfile.FileHeader{}, ErrUser("Error calculating file availability", "Available In field is not in a valid format.", err)
+		}
+	}
+	inactivityExpiry, err := parseInactivityExpiry(args.InactivityExpiry)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	allowedNetworks, err := parseAllowedNetworks(args.AllowedNetworks)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	recipientEmails, err := a.parseRecipientEmails(args.RecipientEmails)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
 	file, err := blinkfile.UploadFile(blinkfile.UploadFileArgs{
-		ID:            fileID,
-		Name:          args.Filename,
-		Owner:         args.Owner,
-		Reader:        args.Reader,
-		Size:          args.Size,
-		Now:           a.cfg.Now,
-		Password:      args.Password,
-		HashFunc:      hashFunc,
-		Expires:       args.Expires,
-		DownloadLimit: args.DownloadLimit,
+		ID:               fileID,
+		Name:             args.Filename,
+		Owner:            args.Owner,
+		Reader:           args.Reader,
+		Size:             args.Size,
+		Now:              a.cfg.Now,
+		Password:         args.Password,
+		HashFunc:         hashFunc,
+		Expires:          args.Expires,
+		DownloadLimit:    args.DownloadLimit,
+		AllowPreview:     args.AllowPreview,
+		ShowThumbnail:    args.ShowThumbnail,
+		InactivityExpiry: inactivityExpiry,
+		AvailableFrom:    args.AvailableFrom,
+		AllowedNetworks:  allowedNetworks,
+		RecipientEmails:  recipientEmails,
+		Terms:            strings.TrimSpace(args.Terms),
 	})
 	if err != nil {
 		if errors.Is(err, blinkfile.ErrExpirationInPast) {
-			return ErrUser("Error uploading file", "Cannot upload a file that expires in the past.", err)
+			return blinkfile.FileHeader{}, ErrUser("Error uploading file", "Cannot upload a file that expires in the past.", err)
+		}
+		if errors.Is(err, blinkfile.ErrAvailableAfterExpiration) {
+			return blinkfile.FileHeader{}, ErrUser("Error uploading file", "The file must become available before it expires.", err)
 		}
-		return Err(ErrBadRequest, err)
+		return blinkfile.FileHeader{}, Err(ErrBadRequest, err)
 	}
-	err = a.cfg.FileRepo.Save(ctx, file)
+	err = a.applySharingPolicy(ctx, &file.FileHeader)
 	if err != nil {
-		return Err(ErrRepo, err)
+		return blinkfile.FileHeader{}, err
 	}
-	fileChanged(ctx, file.Owner, FileEvent{FileHeader: file.FileHeader, Change: FileUploaded})
-	return nil
+	upload := Upload{File: file, StripMetadata: args.StripMetadata}
+	defer func() { _ = upload.Data.Close() }()
+	err = a.processUpload(ctx, &upload)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	err = a.cfg.FileRepo.Save(ctx, upload.File)
+	if err != nil {
+		return blinkfile.FileHeader{}, Err(ErrRepo, err)
+	}
+	// The repo records the stored size and checksum
+	stored, err := a.cfg.FileRepo.Get(ctx, file.ID)
+	if err != nil {
+		a.Errorf(ctx, "retrieving uploaded file %q: %v", file.ID, err)
+		stored = upload.FileHeader
+	}
+	fileChanged(ctx, stored.Owner, FileEvent{FileHeader: stored, Change: FileUploaded})
+	go a.processSaved(context.WithoutCancel(ctx), stored.ID)
+	return stored, nil
+}
+
+func parseInactivityExpiry(in longduration.LongDuration) (time.Duration, error) {
+	d, err := in.Duration()
+	if err != nil {
+		return 0, ErrUser("Error calculating file expiration", "Expires After Inactivity field is not in a valid format.", err)
+	}
+	if d < 0 {
+		return 0, ErrUser("Error calculating file expiration", "Expires After Inactivity cannot be negative.", nil)
+	}
+	return d, nil
+}
+
+func parseAllowedNetworks(in []string) ([]netip.Prefix, error) {
+	networks, err := blinkfile.ParseNetworks(in)
+	if err != nil {
+		return nil, ErrUser("Invalid allowed networks", "Allowed networks must be IP addresses or CIDR ranges, such as 192.0.2.1 or 10.0.0.0/8.", err)
+	}
+	return networks, nil
+}
+
+// GetFile retrieves one of the owner's files that isn't in the trash.
+func (a *App) GetFile(ctx context.Context, owner blinkfile.UserID, fileID blinkfile.FileID) (blinkfile.FileHeader, error) {
+	if owner == "" {
+		return blinkfile.FileHeader{}, Err(ErrBadRequest, fmt.Errorf("owner is required"))
+	}
+	files, err := a.getOwnedFiles(ctx, owner, []blinkfile.FileID{fileID}, false)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	return files[0], nil
+}
+
+type UpdateFileArgs struct {
+	ID               blinkfile.FileID
+	Owner            blinkfile.UserID
+	InactivityExpiry longduration.LongDuration
+	// DownloadRateLimit caps the combined bandwidth of all downloads of the file in bytes per second, zero is unlimited.
+	DownloadRateLimit int64
+	// UnlockPassword clears the failed password attempts, unlocking the file's password if it was locked.
+	UnlockPassword bool
+	// AllowedNetworks are IP addresses and CIDR ranges that clients must download the file from.
+	AllowedNetworks []string
+	// RecipientEmails are the email addresses that clients must verify to download the file.
+	RecipientEmails []string
+	// Terms must be accepted by clients before they download the file.
+	Terms string
+}
+
+// UpdateFile changes the settings of one of the owner's files and returns the updated header.
+func (a *App) UpdateFile(ctx context.Context, args UpdateFileArgs) (blinkfile.FileHeader, error) {
+	if _, err := a.GetFile(ctx, args.Owner, args.ID); err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	inactivityExpiry, err := parseInactivityExpiry(args.InactivityExpiry)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	if args.DownloadRateLimit < 0 {
+		return blinkfile.FileHeader{}, ErrUser("Error updating file", "Download speed limit cannot be negative.", fmt.Errorf("download rate limit cannot be negative"))
+	}
+	allowedNetworks, err := parseAllowedNetworks(args.AllowedNetworks)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	recipientEmails, err := a.parseRecipientEmails(args.RecipientEmails)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	sharing, err := a.GetSharingPolicy(ctx, args.Owner)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	now := a.cfg.Now()
+	// The fields are set on the current header, so concurrent downloads, holds and password attempts aren't undone
+	var denied error
+	file, err := a.cfg.FileRepo.UpdateHeader(ctx, args.ID, func(current *blinkfile.FileHeader) error {
+		if denied = ownedFileErr(*current, args.Owner, false); denied != nil {
+			return denied
+		}
+		before := *current
+		current.InactivityExpiry = inactivityExpiry
+		current.DownloadRateLimit = args.DownloadRateLimit
+		current.AllowedNetworks = allowedNetworks
+		current.RecipientEmails = recipientEmails
+		current.Terms = strings.TrimSpace(args.Terms)
+		if args.UnlockPassword {
+			current.ResetPasswordAttempts()
+		}
+		denied = sharingPolicyErr(sharing, sharing.Update(before, current, now))
+		return denied
+	})
+	if denied != nil {
+		return blinkfile.FileHeader{}, denied
+	}
+	if err != nil {
+		return blinkfile.FileHeader{}, Err(ErrRepo, fmt.Errorf("updating file %q: %w", args.ID, err))
+	}
+	return file, nil
 }
 
 func (a *App) mimicErr(ctx context.Context, password string, err error) error {
-	if errors.Is(err, ErrFileNotFound) || errors.Is(err, blinkfile.ErrFileExpired) {
+	if errors.Is(err, ErrFileNotFound) || errors.Is(err, blinkfile.ErrFileExpired) || errors.Is(err, blinkfile.ErrFileQuarantined) || errors.Is(err, blinkfile.ErrFileTrashed) ||
+		errors.Is(err, blinkfile.ErrFilePasswordLocked) || errors.Is(err, blinkfile.ErrFilePasswordBackoff) || errors.Is(err, blinkfile.ErrNetworkNotAllowed) {
 		a.Errorf(ctx, fmt.Sprintf("mimicking a valid response for security, but real error was: %s", err))
 		if password == "" {
 			return Err(ErrAuthzFailed, blinkfile.ErrFilePasswordRequired)
@@ -131,46 +296,76 @@ func (a *App) DownloadFile(ctx context.Context, userID blinkfile.UserID, fileID
 	if fileID == "" {
 		return blinkfile.FileHeader{}, Err(ErrBadRequest, fmt.Errorf("file ID is required"))
 	}
-	matchFunc := func(hashedPassword string, checkPassword string) (matched bool, err error) {
-		return a.cfg.PasswordHasher.Match(hashedPassword, []byte(checkPassword))
-	}
+	matchFunc := a.matchPassword()
 	file, err := a.cfg.FileRepo.Get(ctx, fileID)
 	if err != nil {
 		// Mimic responses for files that don't exist
 		err = a.mimicErr(ctx, password, Err(ErrRepo, err))
 		return blinkfile.FileHeader{}, err
 	}
-	err = file.Download(userID, password, matchFunc, a.cfg.Now)
+	err = checkClientNetwork(ctx, file, userID)
+	if err == nil {
+		err = a.checkPasswordAttempt(file, userID, password)
+	}
+	var conditions downloadConditions
+	if err == nil {
+		conditions, err = a.checkDownloadConditions(ctx, file, userID, password, matchFunc)
+	}
+	if err == nil {
+		err = file.Download(userID, password, matchFunc, a.cfg.Now)
+	}
+	if err == nil {
+		// Count the download on the current header, so it can't go over the limit or undo concurrent changes
+		var downloaded blinkfile.FileHeader
+		downloaded, err = a.acceptPassword(ctx, file, userID, password, func(current *blinkfile.FileHeader) error {
+			return current.Download(userID, password, matchedPassword(file.PasswordHash), a.cfg.Now)
+		})
+		if err == nil {
+			file = downloaded
+		}
+	}
 	if err != nil {
+		a.downloadFailed(ctx, file, userID, err)
+		if notAvailable := a.notAvailableErr(file, err); notAvailable != nil {
+			return blinkfile.FileHeader{}, notAvailable
+		}
 		if errors.Is(err, blinkfile.ErrFilePasswordInvalid) {
+			a.recordFailedPassword(ctx, file.ID)
 			err = Err(ErrAuthzFailed, err)
 		}
 		err = a.mimicErr(ctx, password, err)
 		return blinkfile.FileHeader{}, err
 	}
-	err = a.cfg.FileRepo.PutHeader(ctx, file)
-	if err != nil {
-		return blinkfile.FileHeader{}, Err(ErrRepo, err)
-	}
+	a.conditionsMet(ctx, file, userID, conditions)
+	a.downloads.start(file.ID)
 	fileChanged(ctx, file.Owner, FileEvent{FileHeader: file, Change: FileDownloaded})
 	return file, nil
 }
 
-func (a *App) DeleteFiles(ctx context.Context, owner blinkfile.UserID, deleteFiles []blinkfile.FileID) error {
-	if owner == "" {
-		return Err(ErrRepo, fmt.Errorf("owner is required"))
+// notAvailableErr explains why a file can't be accessed yet, or returns nil if the error isn't about availability.
+func (a *App) notAvailableErr(file blinkfile.FileHeader, err error) error {
+	switch {
+	case errors.Is(err, blinkfile.ErrFileNotScanned):
+		return ErrUser("File not available yet", "The file is still being scanned for viruses, please try again shortly.", err)
+	case errors.Is(err, blinkfile.ErrFileNotAvailable):
+		return ErrUser("File not available yet", fmt.Sprintf("The file will be available in %s.", formatDuration(file.AvailableFrom.Sub(a.cfg.Now()))), err)
 	}
-	err := a.cfg.FileRepo.Delete(ctx, owner, deleteFiles)
-	if err != nil {
-		return Err(ErrRepo, err)
+	return nil
+}
+
+// formatDuration rounds the duration up to whole days, hours or minutes, e.g. "3 days" or "1 minute".
+func formatDuration(d time.Duration) string {
+	unit, name := time.Minute, "minute"
+	if d >= 24*time.Hour {
+		unit, name = 24*time.Hour, "day"
+	} else if d >= time.Hour {
+		unit, name = time.Hour, "hour"
 	}
-	for _, fileID := range deleteFiles {
-		fileChanged(ctx, owner, FileEvent{
-			FileHeader: blinkfile.FileHeader{ID: fileID},
-			Change:     FileDeleted,
-		})
+	n := (d + unit - 1) / unit
+	if n == 1 {
+		return fmt.Sprintf("1 %s", name)
 	}
-	return nil
+	return fmt.Sprintf("%d %ss", n, name)
 }
 
 func (a *App) DeleteExpiredFiles(ctx context.Context) error {
@@ -182,7 +377,7 @@ func (a *App) DeleteExpiredFiles(ctx context.Context) error {
 	if err != nil {
 		return Err(ErrRepo, err)
 	}
-	return nil
+	return a.purgeExpiredTrash(ctx)
 }
 
 var (
@@ -224,9 +419,14 @@ type (
 )
 
 const (
-	FileDownloaded EventType = "downloaded"
-	FileUploaded   EventType = "uploaded"
-	FileDeleted    EventType = "deleted"
+	FileDownloaded       EventType = "downloaded"
+	FileUploaded         EventType = "uploaded"
+	FileDeleted          EventType = "deleted"
+	FileThumbnailCreated EventType = "thumbnail_created"
+	FileQuarantined      EventType = "quarantined"
+	FileProcessed        EventType = "processed"
+	FilePasswordFailed   EventType = "password_failed"
+	FilePasswordLocked   EventType = "password_locked"
 )
 
 func fileChanged(_ context.Context, user blinkfile.UserID, file FileEvent) {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/netip"
 	"reflect"
 	"strings"
 	"testing"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/benjohns1/blinkfile"
 	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/imagemeta"
 )
 
 func TestApp_ListFiles(t *testing.T) {
@@ -165,6 +167,40 @@ func TestApp_ListFiles(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "should not return files that have not been downloaded within their inactivity expiry",
+			cfg: app.Config{
+				Clock: &StaticClock{T: time.Unix(3, 0)},
+				FileRepo: &StubFileRepo{
+					ListByUserFunc: func(context.Context, blinkfile.UserID) ([]blinkfile.FileHeader, error) {
+						return []blinkfile.FileHeader{
+							{
+								ID:               "1",
+								Name:             "File1",
+								InactivityExpiry: 2 * time.Second,
+							},
+							{
+								ID:               "2",
+								Name:             "File2",
+								LastDownloaded:   time.Unix(2, 0),
+								InactivityExpiry: 2 * time.Second,
+							},
+						}, nil
+					},
+				},
+			},
+			args: args{
+				"user1",
+			},
+			want: []blinkfile.FileHeader{
+				{
+					ID:               "2",
+					Name:             "File2",
+					LastDownloaded:   time.Unix(2, 0),
+					InactivityExpiry: 2 * time.Second,
+				},
+			},
+		},
 		{
 			name: "should not return files downloaded up to their limit",
 			cfg: app.Config{
@@ -228,12 +264,18 @@ func TestApp_ListFiles(t *testing.T) {
 	}
 }
 
+const (
+	jpegWithExif    = "\xff\xd8\xff\xe1\x00\x0aExif\x00\x00MM\xff\xda\x00\x02scan-data"
+	jpegWithoutExif = "\xff\xd8\xff\xda\x00\x02scan-data"
+)
+
 func TestApp_UploadFile(t *testing.T) {
 	ctx := context.Background()
 	tests := []struct {
 		name    string
 		cfg     app.Config
 		args    app.UploadFileArgs
+		want    blinkfile.FileHeader
 		wantErr error
 	}{
 		{
@@ -269,7 +311,65 @@ func TestApp_UploadFile(t *testing.T) {
 				Type:   app.ErrBadRequest,
 				Title:  "Error calculating file expiration",
 				Detail: "Expires In field is not in a valid format.",
-				Err:    fmt.Errorf(`time: invalid duration "invalid-duration"`),
+				Err: func() error {
+					_, err := time.ParseDuration("invalid-duration")
+					return err
+				}(),
+			},
+		},
+		{
+			name: "should fail if available-in and available-from fields are both set",
+			args: app.UploadFileArgs{
+				AvailableIn:   "1d",
+				AvailableFrom: time.Unix(0, 0),
+			},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error validating file availability",
+				Detail: "Can only set one of the availability fields at a time.",
+			},
+		},
+		{
+			name: "should fail if the file becomes available after it expires",
+			cfg:  app.Config{Clock: &StaticClock{T: time.Unix(0, 0)}},
+			args: app.UploadFileArgs{
+				Filename:    "file1",
+				Owner:       "user1",
+				Reader:      io.NopCloser(strings.NewReader("file-data")),
+				ExpiresIn:   "1d",
+				AvailableIn: "2d",
+			},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error uploading file",
+				Detail: "The file must become available before it expires.",
+				Err:    blinkfile.ErrAvailableAfterExpiration,
+			},
+		},
+		{
+			name: "should fail if the inactivity expiry is not valid",
+			args: app.UploadFileArgs{
+				InactivityExpiry: "invalid-duration",
+			},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error calculating file expiration",
+				Detail: "Expires After Inactivity field is not in a valid format.",
+				Err: func() error {
+					_, err := time.ParseDuration("invalid-duration")
+					return err
+				}(),
+			},
+		},
+		{
+			name: "should fail if the inactivity expiry is negative",
+			args: app.UploadFileArgs{
+				InactivityExpiry: "-1d",
+			},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error calculating file expiration",
+				Detail: "Expires After Inactivity cannot be negative.",
 			},
 		},
 		{
@@ -307,6 +407,185 @@ func TestApp_UploadFile(t *testing.T) {
 				Reader:   io.NopCloser(strings.NewReader("file-data")),
 			},
 		},
+		{
+			name: "should upload a file that expires after a period of inactivity",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{SaveFunc: func(_ context.Context, f blinkfile.File) error {
+					if f.InactivityExpiry != 30*24*time.Hour {
+						return fmt.Errorf("unexpected inactivity expiry %v", f.InactivityExpiry)
+					}
+					return nil
+				}},
+			},
+			args: app.UploadFileArgs{
+				Filename:         "file1",
+				Owner:            "user1",
+				Reader:           io.NopCloser(strings.NewReader("file-data")),
+				InactivityExpiry: "30d",
+			},
+		},
+		{
+			name: "should upload a file that becomes available later",
+			cfg: app.Config{
+				Clock: &StaticClock{T: time.Unix(0, 0)},
+				FileRepo: &StubFileRepo{SaveFunc: func(_ context.Context, f blinkfile.File) error {
+					if !f.AvailableFrom.Equal(time.Unix(0, 0).Add(36 * time.Hour)) {
+						return fmt.Errorf("unexpected available from time %v", f.AvailableFrom)
+					}
+					return nil
+				}},
+			},
+			args: app.UploadFileArgs{
+				Filename:    "file1",
+				Owner:       "user1",
+				Reader:      io.NopCloser(strings.NewReader("file-data")),
+				AvailableIn: "1.5d",
+			},
+		},
+		{
+			name: "should detect the content type from the file data",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{SaveFunc: func(_ context.Context, f blinkfile.File) error {
+					if f.ContentType != "application/pdf" {
+						return fmt.Errorf("unexpected content type %q", f.ContentType)
+					}
+					data, err := io.ReadAll(f.Data)
+					if err != nil {
+						return err
+					}
+					if string(data) != "%PDF-1.7 file-data" {
+						return fmt.Errorf("unexpected file data %q", data)
+					}
+					return nil
+				}},
+			},
+			args: app.UploadFileArgs{
+				Filename: "file1.txt",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader("%PDF-1.7 file-data")),
+			},
+		},
+		{
+			name: "should fall back to the file extension if the content type can't be detected",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{SaveFunc: func(_ context.Context, f blinkfile.File) error {
+					if f.ContentType != "image/png" {
+						return fmt.Errorf("unexpected content type %q", f.ContentType)
+					}
+					return nil
+				}},
+			},
+			args: app.UploadFileArgs{
+				Filename: "file1.png",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader("\x00\x01\x02")),
+			},
+		},
+		{
+			name: "should fail if image metadata must be removed but the image is malformed",
+			cfg:  app.Config{StripImageMetadata: true},
+			args: app.UploadFileArgs{
+				Filename: "file1.jpg",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader("\xff\xd8\xff\xe1\x00")),
+			},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error uploading file",
+				Detail: "The image metadata could not be removed because the image data is not valid.",
+				Err:    imagemeta.ErrMalformed,
+			},
+		},
+		{
+			name: "should remove image metadata from all uploads if it is enforced",
+			cfg: app.Config{
+				StripImageMetadata: true,
+				FileRepo: &StubFileRepo{SaveFunc: func(_ context.Context, f blinkfile.File) error {
+					data, err := io.ReadAll(f.Data)
+					if err != nil {
+						return err
+					}
+					if string(data) != jpegWithoutExif || f.Size != int64(len(jpegWithoutExif)) || !f.MetadataStripped {
+						return fmt.Errorf("unexpected stripped file %q, size %d, stripped %v", data, f.Size, f.MetadataStripped)
+					}
+					return nil
+				}},
+			},
+			args: app.UploadFileArgs{
+				Filename: "file1.jpg",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader(jpegWithExif)),
+				Size:     int64(len(jpegWithExif)),
+			},
+		},
+		{
+			name: "should remove image metadata if the uploader chose to",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{SaveFunc: func(_ context.Context, f blinkfile.File) error {
+					if !f.MetadataStripped {
+						return fmt.Errorf("expected metadata to be stripped")
+					}
+					return nil
+				}},
+			},
+			args: app.UploadFileArgs{
+				Filename:      "file1.jpg",
+				Owner:         "user1",
+				Reader:        io.NopCloser(strings.NewReader(jpegWithExif)),
+				StripMetadata: true,
+			},
+		},
+		{
+			name: "should keep image metadata by default",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{SaveFunc: func(_ context.Context, f blinkfile.File) error {
+					data, err := io.ReadAll(f.Data)
+					if err != nil {
+						return err
+					}
+					if string(data) != jpegWithExif || f.MetadataStripped {
+						return fmt.Errorf("unexpected file %q, stripped %v", data, f.MetadataStripped)
+					}
+					return nil
+				}},
+			},
+			args: app.UploadFileArgs{
+				Filename: "file1.jpg",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader(jpegWithExif)),
+			},
+		},
+		{
+			name: "should detect the content type of HEIC images",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{SaveFunc: func(_ context.Context, f blinkfile.File) error {
+					if f.ContentType != "image/heic" {
+						return fmt.Errorf("unexpected content type %q", f.ContentType)
+					}
+					return nil
+				}},
+			},
+			args: app.UploadFileArgs{
+				Filename: "file1",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")),
+			},
+		},
+		{
+			name: "should return the stored file header",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{GetFunc: func(_ context.Context, fileID blinkfile.FileID) (blinkfile.FileHeader, error) {
+					return blinkfile.FileHeader{ID: fileID, Size: 9, Checksum: "checksum"}, nil
+				}},
+				GenerateFileID: func() (blinkfile.FileID, error) { return "file1", nil },
+			},
+			args: app.UploadFileArgs{
+				Filename: "file1",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader("file-data")),
+			},
+			want: blinkfile.FileHeader{ID: "file1", Size: 9, Checksum: "checksum"},
+		},
 		{
 			name: "should successfully upload a file with a password",
 			args: app.UploadFileArgs{
@@ -321,11 +600,14 @@ func TestApp_UploadFile(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := AppConfigDefaults(tt.cfg)
 			application := NewTestApp(ctx, t, cfg)
-			err := application.UploadFile(ctx, tt.args)
+			got, err := application.UploadFile(ctx, tt.args)
 			if !reflect.DeepEqual(err, tt.wantErr) {
 				t.Errorf("UploadFile() error = \n\t%v\n, wantErr \n\t%v", err, tt.wantErr)
 				return
 			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UploadFile() got:\n\t%+v\nwant:\n\t%+v", got, tt.want)
+			}
 		})
 	}
 }
@@ -458,6 +740,48 @@ func TestApp_DownloadFile(t *testing.T) {
 				Err:  blinkfile.ErrFilePasswordInvalid,
 			},
 		},
+		{
+			name: "should fail with the time left if the file is not available yet",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+					return blinkfile.FileHeader{
+						ID:            "file1",
+						AvailableFrom: time.Unix(0, 0).Add(25 * time.Hour),
+					}, nil
+				}},
+				Clock: &StaticClock{T: time.Unix(0, 0)},
+			},
+			args: args{
+				fileID: "file1",
+			},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "File not available yet",
+				Detail: "The file will be available in 2 days.",
+				Err:    blinkfile.ErrFileNotAvailable,
+			},
+		},
+		{
+			name: "should round the time left up to the minute",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+					return blinkfile.FileHeader{
+						ID:            "file1",
+						AvailableFrom: time.Unix(0, 0).Add(30 * time.Second),
+					}, nil
+				}},
+				Clock: &StaticClock{T: time.Unix(0, 0)},
+			},
+			args: args{
+				fileID: "file1",
+			},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "File not available yet",
+				Detail: "The file will be available in 1 minute.",
+				Err:    blinkfile.ErrFileNotAvailable,
+			},
+		},
 		{
 			name: "should download a public file with minimal fields",
 			cfg: app.Config{
@@ -466,13 +790,15 @@ func TestApp_DownloadFile(t *testing.T) {
 						ID: "file1",
 					}, nil
 				}},
+				Clock: &StaticClock{T: time.Unix(1, 0).UTC()},
 			},
 			args: args{
 				fileID: "file1",
 			},
 			want: blinkfile.FileHeader{
-				ID:        "file1",
-				Downloads: 1,
+				ID:             "file1",
+				Downloads:      1,
+				LastDownloaded: time.Unix(1, 0).UTC(),
 			},
 		},
 		{
@@ -489,15 +815,17 @@ func TestApp_DownloadFile(t *testing.T) {
 						return true, nil
 					},
 				},
+				Clock: &StaticClock{T: time.Unix(1, 0).UTC()},
 			},
 			args: args{
 				fileID:   "file1",
 				password: "correct-password",
 			},
 			want: blinkfile.FileHeader{
-				ID:           "file1",
-				PasswordHash: "password-hash",
-				Downloads:    1,
+				ID:             "file1",
+				PasswordHash:   "password-hash",
+				Downloads:      1,
+				LastDownloaded: time.Unix(1, 0).UTC(),
 			},
 		},
 		{
@@ -527,15 +855,16 @@ func TestApp_DownloadFile(t *testing.T) {
 				password: "correct-password",
 			},
 			want: blinkfile.FileHeader{
-				ID:           "file1",
-				Name:         "filename",
-				Location:     "location",
-				Owner:        "user1",
-				Created:      time.Unix(1, 0).UTC(),
-				Expires:      time.Unix(2, 0).UTC(),
-				Downloads:    1,
-				Size:         3,
-				PasswordHash: "password-hash",
+				ID:             "file1",
+				Name:           "filename",
+				Location:       "location",
+				Owner:          "user1",
+				Created:        time.Unix(1, 0).UTC(),
+				Expires:        time.Unix(2, 0).UTC(),
+				Downloads:      1,
+				LastDownloaded: time.Unix(1, 0).UTC(),
+				Size:           3,
+				PasswordHash:   "password-hash",
 			},
 		},
 	}
@@ -651,3 +980,172 @@ func TestApp_DeleteExpiredFiles(t *testing.T) {
 		})
 	}
 }
+
+func TestApp_UpdateFile(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		files     []blinkfile.FileHeader
+		mailer    app.Mailer
+		args      app.UpdateFileArgs
+		want      blinkfile.FileHeader
+		wantErr   error
+		wantFiles map[blinkfile.FileID]blinkfile.FileHeader
+	}{
+		{
+			name:    "should fail if the file isn't owned by the user",
+			files:   []blinkfile.FileHeader{{ID: "file1", Owner: "user2"}},
+			args:    app.UpdateFileArgs{ID: "file1", Owner: "user1", InactivityExpiry: "1d"},
+			wantErr: app.Err(app.ErrRepo, fmt.Errorf("file %q not found for user %q: %w", "file1", "user1", app.ErrFileNotFound)),
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user2"},
+			},
+		},
+		{
+			name:  "should fail if the inactivity expiry is not valid",
+			files: []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}},
+			args:  app.UpdateFileArgs{ID: "file1", Owner: "user1", InactivityExpiry: "-1d"},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error calculating file expiration",
+				Detail: "Expires After Inactivity cannot be negative.",
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1"},
+			},
+		},
+		{
+			name:  "should set the inactivity expiry",
+			files: []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}},
+			args:  app.UpdateFileArgs{ID: "file1", Owner: "user1", InactivityExpiry: "2w"},
+			want:  blinkfile.FileHeader{ID: "file1", Owner: "user1", InactivityExpiry: 14 * 24 * time.Hour},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", InactivityExpiry: 14 * 24 * time.Hour},
+			},
+		},
+		{
+			name:  "should fail if the download rate limit is negative",
+			files: []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}},
+			args:  app.UpdateFileArgs{ID: "file1", Owner: "user1", DownloadRateLimit: -1},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error updating file",
+				Detail: "Download speed limit cannot be negative.",
+				Err:    fmt.Errorf("download rate limit cannot be negative"),
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1"},
+			},
+		},
+		{
+			name:  "should set the download rate limit",
+			files: []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}},
+			args:  app.UpdateFileArgs{ID: "file1", Owner: "user1", DownloadRateLimit: 1024},
+			want:  blinkfile.FileHeader{ID: "file1", Owner: "user1", DownloadRateLimit: 1024},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", DownloadRateLimit: 1024},
+			},
+		},
+		{
+			name:  "should fail if an allowed network is not valid",
+			files: []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}},
+			args:  app.UpdateFileArgs{ID: "file1", Owner: "user1", AllowedNetworks: []string{"10.0.0.0/33"}},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Invalid allowed networks",
+				Detail: "Allowed networks must be IP addresses or CIDR ranges, such as 192.0.2.1 or 10.0.0.0/8.",
+				Err:    fmt.Errorf("%w %q", blinkfile.ErrInvalidNetwork, "10.0.0.0/33"),
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1"},
+			},
+		},
+		{
+			name:  "should set the allowed networks",
+			files: []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}},
+			args:  app.UpdateFileArgs{ID: "file1", Owner: "user1", AllowedNetworks: []string{"10.0.0.0/8", "192.0.2.1"}},
+			want: blinkfile.FileHeader{ID: "file1", Owner: "user1", AllowedNetworks: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.1/32"),
+			}},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", AllowedNetworks: []netip.Prefix{
+					netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.1/32"),
+				}},
+			},
+		},
+		{
+			name:  "should fail to set recipient emails without a mailer",
+			files: []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}},
+			args:  app.UpdateFileArgs{ID: "file1", Owner: "user1", RecipientEmails: []string{"alice@example.com"}},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Invalid recipient emails",
+				Detail: "Recipient emails can't be set because sending email isn't configured.",
+				Err:    fmt.Errorf("mailer is not configured"),
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1"},
+			},
+		},
+		{
+			name:   "should fail if a recipient email is not valid",
+			files:  []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}},
+			mailer: &StubMailer{},
+			args:   app.UpdateFileArgs{ID: "file1", Owner: "user1", RecipientEmails: []string{"alice"}},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Invalid recipient emails",
+				Detail: "Recipient emails must be email addresses, such as alice@example.com.",
+				Err:    fmt.Errorf("%w %q", blinkfile.ErrInvalidEmail, "alice"),
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1"},
+			},
+		},
+		{
+			name:   "should set the recipient emails",
+			files:  []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}},
+			mailer: &StubMailer{},
+			args:   app.UpdateFileArgs{ID: "file1", Owner: "user1", RecipientEmails: []string{"Alice@Example.com", "bob@example.com"}},
+			want:   blinkfile.FileHeader{ID: "file1", Owner: "user1", RecipientEmails: []string{"alice@example.com", "bob@example.com"}},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", RecipientEmails: []string{"alice@example.com", "bob@example.com"}},
+			},
+		},
+		{
+			name:  "should unlock the password",
+			files: []blinkfile.FileHeader{{ID: "file1", Owner: "user1", FailedPasswordAttempts: 5, LastFailedPassword: time.Unix(100, 0)}},
+			args:  app.UpdateFileArgs{ID: "file1", Owner: "user1", UnlockPassword: true},
+			want:  blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1"},
+			},
+		},
+		{
+			name:  "should clear the inactivity expiry",
+			files: []blinkfile.FileHeader{{ID: "file1", Owner: "user1", InactivityExpiry: time.Hour}},
+			args:  app.UpdateFileArgs{ID: "file1", Owner: "user1"},
+			want:  blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMemFileRepo(tt.files...)
+			cfg := AppConfigDefaults(app.Config{FileRepo: r, Mailer: tt.mailer})
+			application := NewTestApp(ctx, t, cfg)
+			got, err := application.UpdateFile(ctx, tt.args)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("UpdateFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UpdateFile() got = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(r.files, tt.wantFiles) {
+				t.Errorf("UpdateFile() files = %+v, want %+v", r.files, tt.wantFiles)
+			}
+		})
+	}
+}
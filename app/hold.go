@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+var (
+	ErrFileOnHold = fmt.Errorf("file is on legal hold")
+
+	errHoldUnchanged = fmt.Errorf("legal hold is unchanged")
+)
+
+// ListAllFiles returns every user's files, including trashed and expired files, so holds can be placed on any of them.
+func (a *App) ListAllFiles(ctx context.Context) ([]blinkfile.FileHeader, error) {
+	files, err := a.cfg.FileRepo.ListAll(ctx)
+	if err != nil {
+		return nil, Err(ErrRepo, fmt.Errorf("retrieving file list: %w", err))
+	}
+	return files, nil
+}
+
+// SetLegalHold places or releases a legal hold on the files. A held file isn't deleted for any reason until the hold is
+// released.
+func (a *App) SetLegalHold(ctx context.Context, admin blinkfile.UserID, fileIDs []blinkfile.FileID, hold bool) error {
+	files := make([]blinkfile.FileHeader, 0, len(fileIDs))
+	for _, fileID := range fileIDs {
+		file, err := a.cfg.FileRepo.Get(ctx, fileID)
+		if errors.Is(err, ErrFileNotFound) {
+			return ErrUser("Error updating legal hold", "File not found.", err)
+		}
+		if err != nil {
+			return Err(ErrRepo, fmt.Errorf("retrieving file %q: %w", fileID, err))
+		}
+		files = append(files, file)
+	}
+	for _, file := range files {
+		// The hold is set on the current header, so concurrent downloads and edits aren't undone
+		var denied error
+		updated, err := a.cfg.FileRepo.UpdateHeader(ctx, file.ID, func(current *blinkfile.FileHeader) error {
+			if current.LegalHold == hold {
+				denied = errHoldUnchanged
+				return denied
+			}
+			current.LegalHold = hold
+			return nil
+		})
+		if errors.Is(denied, errHoldUnchanged) {
+			continue
+		}
+		if err != nil {
+			return Err(ErrRepo, fmt.Errorf("updating legal hold on file %q: %w", file.ID, err))
+		}
+		file = updated
+		action, detail := AuditHoldPlaced, fmt.Sprintf("placed legal hold on file owned by user %q", file.Owner)
+		if !hold {
+			action, detail = AuditHoldReleased, fmt.Sprintf("released legal hold on file owned by user %q", file.Owner)
+		}
+		a.audit(ctx, AuditRecord{
+			Action:   action,
+			UserID:   admin,
+			FileID:   file.ID,
+			FileName: file.Name,
+			Detail:   detail,
+		})
+	}
+	return nil
+}
+
+// withoutHeldFiles removes the owner's held files from the list and returns how many were removed. Files that can't be
+// retrieved are left in the list for the caller to handle.
+func (a *App) withoutHeldFiles(ctx context.Context, owner blinkfile.UserID, fileIDs []blinkfile.FileID) ([]blinkfile.FileID, int) {
+	out := make([]blinkfile.FileID, 0, len(fileIDs))
+	for _, fileID := range fileIDs {
+		file, err := a.cfg.FileRepo.Get(ctx, fileID)
+		if err == nil && file.Owner == owner && file.LegalHold {
+			continue
+		}
+		out = append(out, fileID)
+	}
+	return out, len(fileIDs) - len(out)
+}
+
+func heldFilesErr(held int) error {
+	if held == 0 {
+		return nil
+	}
+	detail := "The file is on legal hold and wasn't deleted."
+	if held > 1 {
+		detail = fmt.Sprintf("%d files are on legal hold and weren't deleted.", held)
+	}
+	return ErrUser("Files on legal hold", detail, ErrFileOnHold)
+}
@@ -0,0 +1,204 @@
+package app_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+func TestApp_SetLegalHold(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		files      []blinkfile.FileHeader
+		fileIDs    []blinkfile.FileID
+		hold       bool
+		wantErr    error
+		wantFiles  map[blinkfile.FileID]blinkfile.FileHeader
+		wantAudits []app.AuditRecord
+	}{
+		{
+			name:    "should fail without changing any files if one doesn't exist",
+			files:   []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}},
+			fileIDs: []blinkfile.FileID{"file1", "file2"},
+			hold:    true,
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error updating legal hold",
+				Detail: "File not found.",
+				Err:    app.ErrFileNotFound,
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": {ID: "file1", Owner: "user1"}},
+		},
+		{
+			name:      "should place a hold and audit it",
+			files:     []blinkfile.FileHeader{{ID: "file1", Name: "file1.txt", Owner: "user1"}},
+			fileIDs:   []blinkfile.FileID{"file1"},
+			hold:      true,
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": {ID: "file1", Name: "file1.txt", Owner: "user1", LegalHold: true}},
+			wantAudits: []app.AuditRecord{{
+				Time:     time.Unix(100, 0),
+				Action:   app.AuditHoldPlaced,
+				UserID:   "admin",
+				FileID:   "file1",
+				FileName: "file1.txt",
+				Detail:   `placed legal hold on file owned by user "user1"`,
+			}},
+		},
+		{
+			name:      "should release a hold and audit it",
+			files:     []blinkfile.FileHeader{{ID: "file1", Name: "file1.txt", Owner: "user1", LegalHold: true}},
+			fileIDs:   []blinkfile.FileID{"file1"},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": {ID: "file1", Name: "file1.txt", Owner: "user1"}},
+			wantAudits: []app.AuditRecord{{
+				Time:     time.Unix(100, 0),
+				Action:   app.AuditHoldReleased,
+				UserID:   "admin",
+				FileID:   "file1",
+				FileName: "file1.txt",
+				Detail:   `released legal hold on file owned by user "user1"`,
+			}},
+		},
+		{
+			name:      "should not audit a file that is already held",
+			files:     []blinkfile.FileHeader{{ID: "file1", Owner: "user1", LegalHold: true}},
+			fileIDs:   []blinkfile.FileID{"file1"},
+			hold:      true,
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": {ID: "file1", Owner: "user1", LegalHold: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMemFileRepo(tt.files...)
+			var audits []app.AuditRecord
+			cfg := AppConfigDefaults(app.Config{
+				Clock:    &StaticClock{T: time.Unix(100, 0)},
+				FileRepo: r,
+				AuditRepo: &StubAuditRepo{RecordFunc: func(_ context.Context, record app.AuditRecord) error {
+					audits = append(audits, record)
+					return nil
+				}},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			err := application.SetLegalHold(ctx, "admin", tt.fileIDs, tt.hold)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("SetLegalHold() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(r.files, tt.wantFiles) {
+				t.Errorf("SetLegalHold() files = %+v, want %+v", r.files, tt.wantFiles)
+			}
+			if !reflect.DeepEqual(audits, tt.wantAudits) {
+				t.Errorf("SetLegalHold() audits = %+v, want %+v", audits, tt.wantAudits)
+			}
+		})
+	}
+}
+
+func TestApp_LegalHold(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0)
+	held := blinkfile.FileHeader{ID: "file1", Owner: "user1", LegalHold: true}
+	expiredHeld := blinkfile.FileHeader{ID: "file1", Owner: "user1", Expires: now.Add(-time.Minute), LegalHold: true}
+	trashedHeld := blinkfile.FileHeader{ID: "file1", Owner: "user1", Trashed: now.Add(-2 * time.Hour), LegalHold: true}
+	tests := []struct {
+		name           string
+		files          []blinkfile.FileHeader
+		trashRetention time.Duration
+		act            func(*app.App) error
+		wantErr        error
+		wantFiles      map[blinkfile.FileID]blinkfile.FileHeader
+	}{
+		{
+			name:  "should skip held files when deleting without a trash",
+			files: []blinkfile.FileHeader{held, {ID: "file2", Owner: "user1"}},
+			act: func(a *app.App) error {
+				return a.DeleteFiles(ctx, "user1", []blinkfile.FileID{"file1", "file2"})
+			},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Files on legal hold",
+				Detail: "The file is on legal hold and wasn't deleted.",
+				Err:    app.ErrFileOnHold,
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": held},
+		},
+		{
+			name:           "should skip held files when moving files to the trash",
+			files:          []blinkfile.FileHeader{held, {ID: "file2", Owner: "user1"}},
+			trashRetention: time.Hour,
+			act: func(a *app.App) error {
+				return a.DeleteFiles(ctx, "user1", []blinkfile.FileID{"file1", "file2"})
+			},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Files on legal hold",
+				Detail: "The file is on legal hold and wasn't deleted.",
+				Err:    app.ErrFileOnHold,
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": held, "file2": {ID: "file2", Owner: "user1", Trashed: now}},
+		},
+		{
+			name:           "should not purge held files from the trash",
+			files:          []blinkfile.FileHeader{trashedHeld},
+			trashRetention: time.Hour,
+			act: func(a *app.App) error {
+				return a.DeleteExpiredFiles(ctx)
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": trashedHeld},
+		},
+		{
+			name:  "should not purge a held file after its last download",
+			files: []blinkfile.FileHeader{{ID: "file1", Owner: "user1", DownloadLimit: 1, LegalHold: true}},
+			act: func(a *app.App) error {
+				_, err := a.DownloadFile(ctx, "user2", "file1", "")
+				a.FinishDownload(ctx, "file1")
+				return err
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": {ID: "file1", Owner: "user1", DownloadLimit: 1, Downloads: 1, LastDownloaded: now, LegalHold: true}},
+		},
+		{
+			name:           "should keep held files when deleting their owner",
+			files:          []blinkfile.FileHeader{held, {ID: "file2", Owner: "user1"}},
+			trashRetention: time.Hour,
+			act: func(a *app.App) error {
+				return a.DeleteUsers(ctx, []blinkfile.UserID{"user1"})
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": held, "file2": {ID: "file2", Owner: "user1", Trashed: now}},
+		},
+		{
+			name:  "should not download an expired held file",
+			files: []blinkfile.FileHeader{expiredHeld},
+			act: func(a *app.App) error {
+				_, err := a.DownloadFile(ctx, "user2", "file1", "")
+				return err
+			},
+			wantErr:   app.Err(app.ErrAuthzFailed, blinkfile.ErrFilePasswordRequired),
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": expiredHeld},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMemFileRepo(tt.files...)
+			r.ListByUserFunc = func(context.Context, blinkfile.UserID) ([]blinkfile.FileHeader, error) {
+				return r.ListAll(ctx)
+			}
+			cfg := AppConfigDefaults(app.Config{
+				Clock:          &StaticClock{T: now},
+				FileRepo:       r,
+				TrashRetention: tt.trashRetention,
+			})
+			application := NewTestApp(ctx, t, cfg)
+			err := tt.act(application)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(r.files, tt.wantFiles) {
+				t.Errorf("files = %+v, want %+v", r.files, tt.wantFiles)
+			}
+		})
+	}
+}
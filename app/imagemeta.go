@@ -0,0 +1,51 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/benjohns1/blinkfile/imagemeta"
+)
+
+// maxStripMetadataSize limits how much image data is buffered in memory to remove its metadata.
+const maxStripMetadataSize = 128 << 20
+
+// StripImageMetadataEnforced returns true if metadata is always removed from uploaded images, rather than chosen per
+// upload.
+func (a *App) StripImageMetadataEnforced() bool {
+	return a.cfg.StripImageMetadata
+}
+
+// stripImageMetadata is an upload processor that replaces the upload data with the image data without its metadata, if
+// the uploader chose to or it is enforced. Other content types are left unchanged.
+func (a *App) stripImageMetadata(_ context.Context, upload *Upload) error {
+	if !a.cfg.StripImageMetadata && !upload.StripMetadata {
+		return nil
+	}
+	if !imagemeta.Supported(upload.ContentType) {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(upload.Data, maxStripMetadataSize+1))
+	if err != nil {
+		return ErrUser("Error uploading file", "Could not read the uploaded file data.", err)
+	}
+	if len(data) > maxStripMetadataSize {
+		return ErrUser("Error uploading file", "The image is too large to remove its metadata.", fmt.Errorf("image is larger than %d bytes", maxStripMetadataSize))
+	}
+	data, removed, err := imagemeta.Strip(upload.ContentType, data)
+	if err != nil {
+		if errors.Is(err, imagemeta.ErrMalformed) {
+			return ErrUser("Error uploading file", "The image metadata could not be removed because the image data is not valid.", err)
+		}
+		return Err(ErrInternal, fmt.Errorf("stripping image metadata: %w", err))
+	}
+	upload.Data = sniffedReader{bytes.NewReader(data), upload.Data}
+	if removed {
+		upload.Size = int64(len(data))
+		upload.MetadataStripped = true
+	}
+	return nil
+}
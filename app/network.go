@@ -0,0 +1,20 @@
+package app
+
+import (
+	"context"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/request"
+)
+
+// checkClientNetwork returns an error if the file restricts the networks it can be downloaded from and the client's IP
+// address isn't in them. The owner can download their files from anywhere.
+func checkClientNetwork(ctx context.Context, file blinkfile.FileHeader, userID blinkfile.UserID) error {
+	if file.Owner == userID {
+		return nil
+	}
+	if !file.AllowsClient(request.GetClientIP(ctx)) {
+		return Err(ErrAuthzFailed, blinkfile.ErrNetworkNotAllowed)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package app_test
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/request"
+)
+
+func TestApp_DownloadFile_AllowedNetworks(t *testing.T) {
+	now := time.Unix(100, 0)
+	file := blinkfile.FileHeader{ID: "file1", Owner: "user1", AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	downloaded := file
+	downloaded.Downloads = 1
+	downloaded.LastDownloaded = now
+	tests := []struct {
+		name      string
+		user      blinkfile.UserID
+		clientIP  string
+		wantErr   error
+		wantFiles map[blinkfile.FileID]blinkfile.FileHeader
+	}{
+		{
+			name:      "should download from an allowed network",
+			user:      "user2",
+			clientIP:  "10.1.2.3",
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": downloaded},
+		},
+		{
+			name:      "should mimic a missing file outside the allowed networks",
+			user:      "user2",
+			clientIP:  "192.0.2.1",
+			wantErr:   app.Err(app.ErrAuthzFailed, blinkfile.ErrFilePasswordRequired),
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": file},
+		},
+		{
+			name:      "should mimic a missing file for an unknown client",
+			user:      "user2",
+			wantErr:   app.Err(app.ErrAuthzFailed, blinkfile.ErrFilePasswordRequired),
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": file},
+		},
+		{
+			name:      "should let the owner download from anywhere",
+			user:      "user1",
+			clientIP:  "192.0.2.1",
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": downloaded},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.clientIP != "" {
+				ctx = request.CtxWithClientIP(ctx, netip.MustParseAddr(tt.clientIP))
+			}
+			r := newMemFileRepo(file)
+			cfg := AppConfigDefaults(app.Config{
+				Clock:    &StaticClock{T: now},
+				FileRepo: r,
+			})
+			application := NewTestApp(ctx, t, cfg)
+			_, err := application.DownloadFile(ctx, tt.user, "file1", "")
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("DownloadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(r.files, tt.wantFiles) {
+				t.Errorf("DownloadFile() files = %+v, want %+v", r.files, tt.wantFiles)
+			}
+		})
+	}
+}
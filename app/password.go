@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+// FilePasswordLocked returns true if the file's password is locked after too many failed attempts.
+func (a *App) FilePasswordLocked(file blinkfile.FileHeader) bool {
+	return file.PasswordLocked(a.cfg.PasswordLockoutAttempts)
+}
+
+// checkPasswordAttempt blocks attempts at a file's password while it's locked or backing off after failed attempts.
+// Callers must mimic the error so it doesn't reveal that the file exists.
+func (a *App) checkPasswordAttempt(file blinkfile.FileHeader, userID blinkfile.UserID, password string) error {
+	if password == "" || file.PasswordHash == "" || file.Owner == userID {
+		return nil
+	}
+	return file.CheckPasswordAttempt(a.cfg.Now(), a.cfg.PasswordBackoff, a.cfg.PasswordLockoutAttempts)
+}
+
+// recordFailedPassword counts a wrong password attempt on the file and notifies the owner, failures are only logged so
+// the response is the same as for any other wrong password. The attempt is checked against the backoff again as it's
+// counted, in one update, so parallel attempts that all passed the first check can't get past the lockout.
+func (a *App) recordFailedPassword(ctx context.Context, fileID blinkfile.FileID) {
+	now := a.cfg.Now()
+	file, err := a.cfg.FileRepo.UpdateHeader(ctx, fileID, func(current *blinkfile.FileHeader) error {
+		err := current.CheckPasswordAttempt(now, a.cfg.PasswordBackoff, a.cfg.PasswordLockoutAttempts)
+		if err != nil {
+			return err
+		}
+		current.RecordFailedPassword(now)
+		return nil
+	})
+	if errors.Is(err, blinkfile.ErrFilePasswordBackoff) || errors.Is(err, blinkfile.ErrFilePasswordLocked) {
+		// A parallel attempt failed first, so this one was blocked and isn't counted
+		return
+	}
+	if err != nil {
+		a.Errorf(ctx, "recording failed password attempt on file %q: %v", fileID, err)
+		return
+	}
+	change := FilePasswordFailed
+	if file.PasswordLocked(a.cfg.PasswordLockoutAttempts) {
+		change = FilePasswordLocked
+		a.Printf(ctx, "Locked the password of file %q after %d failed attempts", file.ID, file.FailedPasswordAttempts)
+	}
+	fileChanged(ctx, file.Owner, FileEvent{FileHeader: file, Change: change})
+}
+
+// acceptPassword saves the change to a file that the user got access to and clears its failed password attempts. The
+// password attempt is checked against the backoff again on the current header in the same update, so an attempt that
+// was already being checked when a parallel one failed is blocked too. The change returns an error if the current
+// header doesn't allow it, which is returned as is, repo errors are wrapped.
+func (a *App) acceptPassword(ctx context.Context, file blinkfile.FileHeader, userID blinkfile.UserID, password string, change func(*blinkfile.FileHeader) error) (blinkfile.FileHeader, error) {
+	attempted := password != "" && file.PasswordHash != "" && file.Owner != userID
+	if !attempted && change == nil {
+		return file, nil
+	}
+	var denied error
+	updated, err := a.cfg.FileRepo.UpdateHeader(ctx, file.ID, func(current *blinkfile.FileHeader) error {
+		denied = a.checkPasswordAttempt(*current, userID, password)
+		if denied == nil && change != nil {
+			denied = change(current)
+		}
+		if denied != nil {
+			return denied
+		}
+		passwordAccepted(current, userID)
+		return nil
+	})
+	if denied != nil {
+		return blinkfile.FileHeader{}, denied
+	}
+	if err != nil {
+		return blinkfile.FileHeader{}, Err(ErrRepo, err)
+	}
+	return updated, nil
+}
+
+// passwordAccepted clears the failed password attempts once someone other than the owner gets the password right.
+func passwordAccepted(file *blinkfile.FileHeader, userID blinkfile.UserID) {
+	if file.FailedPasswordAttempts == 0 || file.PasswordHash == "" || file.Owner == userID {
+		return
+	}
+	file.ResetPasswordAttempts()
+}
+
+// matchPassword returns a match func that only hashes the password once, so the same attempt can be checked by both
+// the download conditions and the access itself without running the password hasher twice.
+func (a *App) matchPassword() blinkfile.PasswordMatchFunc {
+	var checked struct {
+		done                  bool
+		hashedPassword, check string
+		matched               bool
+	}
+	return func(hashedPassword string, checkPassword string) (bool, error) {
+		if checked.done && checked.hashedPassword == hashedPassword && checked.check == checkPassword {
+			return checked.matched, nil
+		}
+		matched, err := a.cfg.PasswordHasher.Match(hashedPassword, []byte(checkPassword))
+		if err != nil {
+			return false, err
+		}
+		checked.done, checked.hashedPassword, checked.check, checked.matched = true, hashedPassword, checkPassword, matched
+		return matched, nil
+	}
+}
+
+// matchedPassword only matches the password hash that the attempt was already checked against, so the access can be
+// checked again on the current header without hashing the password again.
+func matchedPassword(passwordHash string) blinkfile.PasswordMatchFunc {
+	return func(hashedPassword string, _ string) (bool, error) {
+		return hashedPassword == passwordHash, nil
+	}
+}
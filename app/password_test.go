@@ -0,0 +1,245 @@
+package app_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+func TestApp_DownloadFile_PasswordAttempts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0)
+	hasher := &StubPasswordHasher{MatchFunc: func(hash string, data []byte) (bool, error) {
+		return string(data) == "right", nil
+	}}
+	protected := blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash"}
+	withFailures := func(failures int64, last time.Time) blinkfile.FileHeader {
+		file := protected
+		file.FailedPasswordAttempts = failures
+		file.LastFailedPassword = last
+		return file
+	}
+	tests := []struct {
+		name      string
+		file      blinkfile.FileHeader
+		user      blinkfile.UserID
+		password  string
+		wantErr   error
+		wantFiles map[blinkfile.FileID]blinkfile.FileHeader
+	}{
+		{
+			name:      "should count a wrong password",
+			file:      protected,
+			user:      "user2",
+			password:  "wrong",
+			wantErr:   app.Err(app.ErrAuthzFailed, blinkfile.ErrFilePasswordInvalid),
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": withFailures(1, now)},
+		},
+		{
+			name:      "should mimic a wrong password while backing off, without counting it",
+			file:      withFailures(2, now.Add(-time.Second)),
+			user:      "user2",
+			password:  "right",
+			wantErr:   app.Err(app.ErrAuthzFailed, blinkfile.ErrFilePasswordInvalid),
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": withFailures(2, now.Add(-time.Second))},
+		},
+		{
+			name:      "should mimic a wrong password once locked, without counting it",
+			file:      withFailures(3, now.Add(-24*time.Hour)),
+			user:      "user2",
+			password:  "right",
+			wantErr:   app.Err(app.ErrAuthzFailed, blinkfile.ErrFilePasswordInvalid),
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": withFailures(3, now.Add(-24*time.Hour))},
+		},
+		{
+			name:     "should reset the failures after the right password",
+			file:     withFailures(2, now.Add(-time.Minute)),
+			user:     "user2",
+			password: "right",
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": {
+				ID: "file1", Owner: "user1", PasswordHash: "hash", Downloads: 1, LastDownloaded: now,
+			}},
+		},
+		{
+			name: "should let the owner download a locked file without resetting the failures",
+			file: withFailures(3, now),
+			user: "user1",
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": {
+				ID: "file1", Owner: "user1", PasswordHash: "hash", Downloads: 1, LastDownloaded: now, FailedPasswordAttempts: 3, LastFailedPassword: now,
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMemFileRepo(tt.file)
+			cfg := AppConfigDefaults(app.Config{
+				Clock:                   &StaticClock{T: now},
+				FileRepo:                r,
+				PasswordHasher:          hasher,
+				PasswordBackoff:         time.Second,
+				PasswordLockoutAttempts: 3,
+			})
+			application := NewTestApp(ctx, t, cfg)
+			_, err := application.DownloadFile(ctx, tt.user, tt.file.ID, tt.password)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("DownloadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(r.files, tt.wantFiles) {
+				t.Errorf("DownloadFile() files = %+v, want %+v", r.files, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestApp_DownloadFile_ParallelPasswordAttempts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0)
+	const attempts = 10
+	tests := []struct {
+		name    string
+		backoff time.Duration
+		want    int64
+	}{
+		{
+			name: "should lock the password after the lockout attempts",
+			want: 3,
+		},
+		{
+			name:    "should only count the first attempt while backing off",
+			backoff: time.Second,
+			want:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every attempt waits for the others to pass the backoff check before its password is checked
+			var checking sync.WaitGroup
+			checking.Add(attempts)
+			hasher := &StubPasswordHasher{MatchFunc: func(hash string, data []byte) (bool, error) {
+				checking.Done()
+				checking.Wait()
+				return string(data) == "right", nil
+			}}
+			r := newMemFileRepo(blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash"})
+			cfg := AppConfigDefaults(app.Config{
+				Clock:                   &StaticClock{T: now},
+				FileRepo:                r,
+				PasswordHasher:          hasher,
+				PasswordBackoff:         tt.backoff,
+				PasswordLockoutAttempts: 3,
+			})
+			application := NewTestApp(ctx, t, cfg)
+			var wg sync.WaitGroup
+			for range attempts {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, _ = application.DownloadFile(ctx, "user2", "file1", "wrong")
+				}()
+			}
+			wg.Wait()
+			if got := r.files["file1"].FailedPasswordAttempts; got != tt.want {
+				t.Errorf("DownloadFile() failed password attempts = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApp_DownloadFile_PasswordAttemptDuringParallelFailure(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0)
+	hasher := &StubPasswordHasher{MatchFunc: func(hash string, data []byte) (bool, error) {
+		return string(data) == "right", nil
+	}}
+	protected := blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash"}
+	// A parallel attempt failed after this one passed the backoff check
+	failed := protected
+	failed.RecordFailedPassword(now)
+	r := newMemFileRepo(failed)
+	cfg := AppConfigDefaults(app.Config{
+		Clock: &StaticClock{T: now},
+		FileRepo: &StubFileRepo{
+			GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+				return protected, nil
+			},
+			UpdateHeaderFunc: r.UpdateHeader,
+		},
+		PasswordHasher:          hasher,
+		PasswordBackoff:         time.Second,
+		PasswordLockoutAttempts: 3,
+	})
+	application := NewTestApp(ctx, t, cfg)
+	_, err := application.DownloadFile(ctx, "user2", "file1", "right")
+	wantErr := app.Err(app.ErrAuthzFailed, blinkfile.ErrFilePasswordInvalid)
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("DownloadFile() error = %v, wantErr %v", err, wantErr)
+	}
+	wantFiles := map[blinkfile.FileID]blinkfile.FileHeader{"file1": failed}
+	if !reflect.DeepEqual(r.files, wantFiles) {
+		t.Errorf("DownloadFile() files = %+v, want %+v", r.files, wantFiles)
+	}
+}
+
+func TestApp_PasswordHashedOnce(t *testing.T) {
+	ctx := context.Background()
+	file := blinkfile.FileHeader{
+		ID:           "file1",
+		Owner:        "user1",
+		PasswordHash: "hash",
+		ContentType:  "image/png",
+		AllowPreview: true,
+		Terms:        "terms",
+	}
+	// The terms are only checked once the password is, which is the first time it's hashed
+	ctx = app.CtxWithTermsAccepted(ctx)
+	tests := []struct {
+		name   string
+		access func(*app.App) error
+	}{
+		{
+			name: "should hash the password once to download a file",
+			access: func(a *app.App) error {
+				_, err := a.DownloadFile(ctx, "user2", "file1", "right")
+				return err
+			},
+		},
+		{
+			name: "should hash the password once to preview a file",
+			access: func(a *app.App) error {
+				_, err := a.PreviewFile(ctx, "user2", "file1", "right")
+				return err
+			},
+		},
+		{
+			name: "should hash the password once to sign a download URL",
+			access: func(a *app.App) error {
+				_, err := a.SignDownloadURL(ctx, "user2", "file1", "right", 0)
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hashed int
+			hasher := &StubPasswordHasher{MatchFunc: func(hash string, data []byte) (bool, error) {
+				hashed++
+				return string(data) == "right", nil
+			}}
+			application := NewTestApp(ctx, t, AppConfigDefaults(app.Config{
+				FileRepo:       newMemFileRepo(file),
+				PasswordHasher: hasher,
+			}))
+			if err := tt.access(application); err != nil {
+				t.Fatal(err)
+			}
+			if hashed != 1 {
+				t.Errorf("password hashed %d times, want 1", hashed)
+			}
+		})
+	}
+}
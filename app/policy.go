@@ -0,0 +1,281 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/longduration"
+)
+
+type (
+	// Policy holds the deployment-wide settings that admins manage, with optional per-user settings.
+	Policy struct {
+		FileTypes     blinkfile.FileTypePolicy
+		UserFileTypes map[blinkfile.UserID]blinkfile.FileTypePolicy `json:",omitempty"`
+		Sharing       blinkfile.SharingPolicy
+		// UserSharing overrides the deployment sharing policy for each user.
+		UserSharing map[blinkfile.UserID]blinkfile.SharingPolicy `json:",omitempty"`
+	}
+
+	PolicyRepo interface {
+		Get(context.Context) (Policy, error)
+		Save(context.Context, Policy) error
+	}
+
+	SetFileTypePolicyArgs struct {
+		// UserID sets a per-user policy, or the deployment policy if it's empty.
+		UserID       blinkfile.UserID
+		Mode         blinkfile.FileTypePolicyMode
+		Extensions   string
+		ContentTypes string
+	}
+
+	SetSharingPolicyArgs struct {
+		// UserID sets a per-user override, or the deployment policy if it's empty.
+		UserID blinkfile.UserID
+		// RemoveOverride removes the user's override so the deployment policy applies to them again.
+		RemoveOverride       bool
+		DefaultExpiration    longduration.LongDuration
+		MaxExpiration        longduration.LongDuration
+		DefaultDownloadLimit int64
+		MaxDownloadLimit     int64
+		RequirePassword      bool
+		// DefaultTerms must be accepted by recipients of files that don't have their own terms.
+		DefaultTerms string
+	}
+)
+
+func (a *App) GetPolicy(ctx context.Context) (Policy, error) {
+	policy, err := a.cfg.PolicyRepo.Get(ctx)
+	if err != nil {
+		return Policy{}, Err(ErrRepo, fmt.Errorf("retrieving policy: %w", err))
+	}
+	return policy, nil
+}
+
+// SetFileTypePolicy replaces the deployment or a user's file type policy. An empty per-user policy is removed.
+func (a *App) SetFileTypePolicy(ctx context.Context, admin blinkfile.UserID, args SetFileTypePolicyArgs) error {
+	fileTypes, err := blinkfile.ParseFileTypePolicy(args.Mode, args.Extensions, args.ContentTypes)
+	if err != nil {
+		return ErrUser("Error saving file type policy", fmt.Sprintf("%s.", upperFirst(err.Error())), err)
+	}
+	if args.UserID != "" {
+		if _, found, err := a.cfg.UserRepo.Get(ctx, args.UserID); err != nil {
+			return Err(ErrRepo, err)
+		} else if !found {
+			return ErrUser("Error saving file type policy", "User not found.", ErrUserNotFound)
+		}
+	}
+	a.policyMu.Lock()
+	defer a.policyMu.Unlock()
+	policy, err := a.GetPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if args.UserID == "" {
+		policy.FileTypes = fileTypes
+	} else if fileTypes.IsEmpty() {
+		delete(policy.UserFileTypes, args.UserID)
+	} else {
+		if policy.UserFileTypes == nil {
+			policy.UserFileTypes = make(map[blinkfile.UserID]blinkfile.FileTypePolicy, 1)
+		}
+		policy.UserFileTypes[args.UserID] = fileTypes
+	}
+	err = a.cfg.PolicyRepo.Save(ctx, policy)
+	if err != nil {
+		return Err(ErrRepo, fmt.Errorf("saving policy: %w", err))
+	}
+	scope := "deployment"
+	if args.UserID != "" {
+		scope = fmt.Sprintf("user %q", args.UserID)
+	}
+	a.audit(ctx, AuditRecord{
+		Action: AuditPolicyChanged,
+		UserID: admin,
+		Detail: fmt.Sprintf("set %s file type policy to %s extensions %q and content types %q", scope, fileTypes.Mode, strings.Join(fileTypes.Extensions, " "), strings.Join(fileTypes.ContentTypes, " ")),
+	})
+	return nil
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// checkFileType is an upload processor that rejects files that the deployment or the owner's file type policy don't
+// allow, and audits the rejection.
+func (a *App) checkFileType(ctx context.Context, upload *Upload) error {
+	policy, err := a.GetPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	err = policy.FileTypes.Check(upload.Name, upload.ContentType)
+	if err == nil {
+		if userPolicy, ok := policy.UserFileTypes[upload.Owner]; ok {
+			err = userPolicy.Check(upload.Name, upload.ContentType)
+		}
+	}
+	var typeErr *blinkfile.FileTypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+	a.audit(ctx, AuditRecord{
+		Action:   AuditUploadRejected,
+		UserID:   upload.Owner,
+		FileName: upload.Name,
+		Detail:   typeErr.Error(),
+	})
+	detail := fmt.Sprintf("Files with the %s extension are not allowed.", typeErr.Extension)
+	if typeErr.Extension == "(none)" {
+		detail = "Files without an allowed extension are not allowed."
+	} else if typeErr.Extension == "" {
+		detail = fmt.Sprintf("The file contents were detected as %s, which is not allowed, even if the file is renamed.", typeErr.ContentType)
+	}
+	return ErrUser("File type not allowed", detail, err)
+}
+
+// SetSharingPolicy replaces the deployment sharing policy, or sets or removes a user's override.
+func (a *App) SetSharingPolicy(ctx context.Context, admin blinkfile.UserID, args SetSharingPolicyArgs) error {
+	var sharing blinkfile.SharingPolicy
+	if !args.RemoveOverride {
+		var err error
+		sharing, err = parseSharingPolicy(args)
+		if err != nil {
+			return err
+		}
+	}
+	if args.UserID != "" {
+		if _, found, err := a.cfg.UserRepo.Get(ctx, args.UserID); err != nil {
+			return Err(ErrRepo, err)
+		} else if !found {
+			return ErrUser("Error saving sharing policy", "User not found.", ErrUserNotFound)
+		}
+	}
+	a.policyMu.Lock()
+	defer a.policyMu.Unlock()
+	policy, err := a.GetPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if args.UserID == "" {
+		policy.Sharing = sharing
+	} else if args.RemoveOverride {
+		delete(policy.UserSharing, args.UserID)
+	} else {
+		if policy.UserSharing == nil {
+			policy.UserSharing = make(map[blinkfile.UserID]blinkfile.SharingPolicy, 1)
+		}
+		policy.UserSharing[args.UserID] = sharing
+	}
+	err = a.cfg.PolicyRepo.Save(ctx, policy)
+	if err != nil {
+		return Err(ErrRepo, fmt.Errorf("saving policy: %w", err))
+	}
+	detail := fmt.Sprintf("set deployment sharing policy to %q", strings.Join(SharingRules(sharing), "; "))
+	if args.RemoveOverride {
+		detail = fmt.Sprintf("removed user %q sharing policy override", args.UserID)
+	} else if args.UserID != "" {
+		detail = fmt.Sprintf("set user %q sharing policy override to %q", args.UserID, strings.Join(SharingRules(sharing), "; "))
+	}
+	a.audit(ctx, AuditRecord{
+		Action: AuditPolicyChanged,
+		UserID: admin,
+		Detail: detail,
+	})
+	return nil
+}
+
+func parseSharingPolicy(args SetSharingPolicyArgs) (blinkfile.SharingPolicy, error) {
+	defaultExpiration, err := args.DefaultExpiration.Duration()
+	if err != nil {
+		return blinkfile.SharingPolicy{}, ErrUser("Error saving sharing policy", "Default expiration is not in a valid format.", err)
+	}
+	maxExpiration, err := args.MaxExpiration.Duration()
+	if err != nil {
+		return blinkfile.SharingPolicy{}, ErrUser("Error saving sharing policy", "Maximum expiration is not in a valid format.", err)
+	}
+	sharing := blinkfile.SharingPolicy{
+		DefaultExpiration:    defaultExpiration,
+		MaxExpiration:        maxExpiration,
+		DefaultDownloadLimit: args.DefaultDownloadLimit,
+		MaxDownloadLimit:     args.MaxDownloadLimit,
+		RequirePassword:      args.RequirePassword,
+		DefaultTerms:         strings.TrimSpace(args.DefaultTerms),
+	}
+	err = sharing.Validate()
+	if err != nil {
+		return blinkfile.SharingPolicy{}, ErrUser("Error saving sharing policy", fmt.Sprintf("%s.", upperFirst(err.Error())), err)
+	}
+	return sharing, nil
+}
+
+// GetSharingPolicy returns the sharing policy that applies to the user's files, which is their override if they have
+// one or the deployment policy.
+func (a *App) GetSharingPolicy(ctx context.Context, userID blinkfile.UserID) (blinkfile.SharingPolicy, error) {
+	policy, err := a.GetPolicy(ctx)
+	if err != nil {
+		return blinkfile.SharingPolicy{}, err
+	}
+	if sharing, ok := policy.UserSharing[userID]; ok {
+		return sharing, nil
+	}
+	return policy.Sharing, nil
+}
+
+// SharingRules describes the sharing policy for users.
+func SharingRules(p blinkfile.SharingPolicy) []string {
+	var rules []string
+	if p.RequirePassword {
+		rules = append(rules, "Files must be password-protected")
+	}
+	if p.DefaultExpiration > 0 {
+		rules = append(rules, fmt.Sprintf("Files expire after %s by default", formatDuration(p.DefaultExpiration)))
+	}
+	if p.MaxExpiration > 0 {
+		rules = append(rules, fmt.Sprintf("Files must expire within %s", formatDuration(p.MaxExpiration)))
+	}
+	if p.DefaultDownloadLimit > 0 {
+		rules = append(rules, fmt.Sprintf("Files can be downloaded %s by default", formatTimes(p.DefaultDownloadLimit)))
+	}
+	if p.MaxDownloadLimit > 0 {
+		rules = append(rules, fmt.Sprintf("Files can be downloaded at most %s", formatTimes(p.MaxDownloadLimit)))
+	}
+	if p.DefaultTerms != "" {
+		rules = append(rules, "Recipients must accept the default terms unless a file has its own")
+	}
+	return rules
+}
+
+func formatTimes(n int64) string {
+	if n == 1 {
+		return "once"
+	}
+	return fmt.Sprintf("%d times", n)
+}
+
+// applySharingPolicy sets the sharing policy defaults on a new file and rejects it if it's outside the policy limits.
+func (a *App) applySharingPolicy(ctx context.Context, file *blinkfile.FileHeader) error {
+	sharing, err := a.GetSharingPolicy(ctx, file.Owner)
+	if err != nil {
+		return err
+	}
+	return sharingPolicyErr(sharing, sharing.Apply(file))
+}
+
+func sharingPolicyErr(sharing blinkfile.SharingPolicy, err error) error {
+	switch {
+	case errors.Is(err, blinkfile.ErrSharingPasswordRequired):
+		return ErrUser("Password required", "Files must be password-protected to be shared.", err)
+	case errors.Is(err, blinkfile.ErrSharingExpirationTooLong):
+		return ErrUser("Expiration too long", fmt.Sprintf("Files must expire within %s.", formatDuration(sharing.MaxExpiration)), err)
+	case errors.Is(err, blinkfile.ErrSharingDownloadLimitTooHigh):
+		return ErrUser("Download limit too high", fmt.Sprintf("Files can be downloaded at most %s.", formatTimes(sharing.MaxDownloadLimit)), err)
+	}
+	return err
+}
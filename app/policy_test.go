@@ -0,0 +1,529 @@
+package app_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+func TestApp_UploadFile_FileTypePolicy(t *testing.T) {
+	ctx := context.Background()
+	blockExecutables := blinkfile.FileTypePolicy{
+		Mode:         blinkfile.FileTypeBlock,
+		Extensions:   []string{".exe"},
+		ContentTypes: []string{"application/vnd.microsoft.portable-executable"},
+	}
+	tests := []struct {
+		name       string
+		policy     app.Policy
+		filename   string
+		data       string
+		wantErr    error
+		wantAudits []app.AuditRecord
+	}{
+		{
+			name:     "should allow any file without a policy",
+			filename: "setup.exe",
+			data:     "MZ\x90\x00",
+		},
+		{
+			name:     "should reject a blocked extension and audit it",
+			policy:   app.Policy{FileTypes: blockExecutables},
+			filename: "setup.exe",
+			data:     "file-data",
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "File type not allowed",
+				Detail: "Files with the .exe extension are not allowed.",
+				Err:    &blinkfile.FileTypeError{Extension: ".exe"},
+			},
+			wantAudits: []app.AuditRecord{{
+				Time:     time.Unix(1, 0),
+				Action:   app.AuditUploadRejected,
+				UserID:   "user1",
+				FileName: "setup.exe",
+				Detail:   `file extension ".exe" is not allowed`,
+			}},
+		},
+		{
+			name:     "should reject a renamed executable by its content",
+			policy:   app.Policy{FileTypes: blockExecutables},
+			filename: "holiday.jpg",
+			data:     "MZ\x90\x00",
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "File type not allowed",
+				Detail: "The file contents were detected as application/vnd.microsoft.portable-executable, which is not allowed, even if the file is renamed.",
+				Err:    &blinkfile.FileTypeError{ContentType: "application/vnd.microsoft.portable-executable"},
+			},
+			wantAudits: []app.AuditRecord{{
+				Time:     time.Unix(1, 0),
+				Action:   app.AuditUploadRejected,
+				UserID:   "user1",
+				FileName: "holiday.jpg",
+				Detail:   `file content type "application/vnd.microsoft.portable-executable" is not allowed`,
+			}},
+		},
+		{
+			name: "should apply the owner's policy in addition to the deployment policy",
+			policy: app.Policy{UserFileTypes: map[blinkfile.UserID]blinkfile.FileTypePolicy{
+				"user1": {Mode: blinkfile.FileTypeAllow, Extensions: []string{".pdf"}},
+			}},
+			filename: "notes.txt",
+			data:     "file-data",
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "File type not allowed",
+				Detail: "Files with the .txt extension are not allowed.",
+				Err:    &blinkfile.FileTypeError{Extension: ".txt"},
+			},
+			wantAudits: []app.AuditRecord{{
+				Time:     time.Unix(1, 0),
+				Action:   app.AuditUploadRejected,
+				UserID:   "user1",
+				FileName: "notes.txt",
+				Detail:   `file extension ".txt" is not allowed`,
+			}},
+		},
+		{
+			name: "should not apply another user's policy",
+			policy: app.Policy{UserFileTypes: map[blinkfile.UserID]blinkfile.FileTypePolicy{
+				"user2": {Mode: blinkfile.FileTypeAllow, Extensions: []string{".pdf"}},
+			}},
+			filename: "notes.txt",
+			data:     "file-data",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var audits []app.AuditRecord
+			cfg := AppConfigDefaults(app.Config{
+				Clock: &StaticClock{T: time.Unix(1, 0)},
+				PolicyRepo: &StubPolicyRepo{GetFunc: func(context.Context) (app.Policy, error) {
+					return tt.policy, nil
+				}},
+				AuditRepo: &StubAuditRepo{RecordFunc: func(_ context.Context, record app.AuditRecord) error {
+					audits = append(audits, record)
+					return nil
+				}},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			_, err := application.UploadFile(ctx, app.UploadFileArgs{
+				Filename: tt.filename,
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader(tt.data)),
+			})
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("UploadFile() error = \n\t%v\n, wantErr \n\t%v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(audits, tt.wantAudits) {
+				t.Errorf("UploadFile() audits = %+v, want %+v", audits, tt.wantAudits)
+			}
+		})
+	}
+}
+
+func TestApp_SetFileTypePolicy(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		existing   app.Policy
+		args       app.SetFileTypePolicyArgs
+		userFound  bool
+		wantErr    error
+		wantSaved  *app.Policy
+		wantAudits int
+	}{
+		{
+			name: "should fail with an invalid policy",
+			args: app.SetFileTypePolicyArgs{Mode: "deny"},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error saving file type policy",
+				Detail: `Invalid file type policy: unknown mode "deny".`,
+				Err:    fmt.Errorf("%w: unknown mode %q", blinkfile.ErrInvalidFileTypePolicy, "deny"),
+			},
+		},
+		{
+			name: "should fail if the user doesn't exist",
+			args: app.SetFileTypePolicyArgs{UserID: "user1", Extensions: "exe"},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error saving file type policy",
+				Detail: "User not found.",
+				Err:    app.ErrUserNotFound,
+			},
+		},
+		{
+			name: "should save the deployment policy",
+			args: app.SetFileTypePolicyArgs{Mode: blinkfile.FileTypeBlock, Extensions: "exe, bat"},
+			wantSaved: &app.Policy{FileTypes: blinkfile.FileTypePolicy{
+				Mode:       blinkfile.FileTypeBlock,
+				Extensions: []string{".exe", ".bat"},
+			}},
+			wantAudits: 1,
+		},
+		{
+			name:      "should save a user policy",
+			args:      app.SetFileTypePolicyArgs{UserID: "user1", Mode: blinkfile.FileTypeAllow, ContentTypes: "image/*"},
+			userFound: true,
+			wantSaved: &app.Policy{UserFileTypes: map[blinkfile.UserID]blinkfile.FileTypePolicy{
+				"user1": {Mode: blinkfile.FileTypeAllow, ContentTypes: []string{"image/*"}},
+			}},
+			wantAudits: 1,
+		},
+		{
+			name: "should remove an empty user policy",
+			existing: app.Policy{UserFileTypes: map[blinkfile.UserID]blinkfile.FileTypePolicy{
+				"user1": {Mode: blinkfile.FileTypeAllow, ContentTypes: []string{"image/*"}},
+			}},
+			args:       app.SetFileTypePolicyArgs{UserID: "user1"},
+			userFound:  true,
+			wantSaved:  &app.Policy{UserFileTypes: map[blinkfile.UserID]blinkfile.FileTypePolicy{}},
+			wantAudits: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved *app.Policy
+			var audits int
+			cfg := AppConfigDefaults(app.Config{
+				UserRepo: &StubUserRepo{GetFunc: func(context.Context, blinkfile.UserID) (blinkfile.User, bool, error) {
+					return blinkfile.User{}, tt.userFound, nil
+				}},
+				PolicyRepo: &StubPolicyRepo{
+					GetFunc: func(context.Context) (app.Policy, error) { return tt.existing, nil },
+					SaveFunc: func(_ context.Context, policy app.Policy) error {
+						saved = &policy
+						return nil
+					},
+				},
+				AuditRepo: &StubAuditRepo{RecordFunc: func(context.Context, app.AuditRecord) error {
+					audits++
+					return nil
+				}},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			err := application.SetFileTypePolicy(ctx, "admin", tt.args)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("SetFileTypePolicy() error = \n\t%v\n, wantErr \n\t%v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(saved, tt.wantSaved) {
+				t.Errorf("SetFileTypePolicy() saved = %+v, want %+v", saved, tt.wantSaved)
+			}
+			if audits != tt.wantAudits {
+				t.Errorf("SetFileTypePolicy() recorded %d audits, want %d", audits, tt.wantAudits)
+			}
+		})
+	}
+}
+
+func TestApp_UploadFile_SharingPolicy(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0)
+	tests := []struct {
+		name    string
+		policy  app.Policy
+		args    app.UploadFileArgs
+		want    func(blinkfile.FileHeader) error
+		wantErr error
+	}{
+		{
+			name: "should apply the default expiration and download limit",
+			policy: app.Policy{Sharing: blinkfile.SharingPolicy{
+				DefaultExpiration:    24 * time.Hour,
+				DefaultDownloadLimit: 3,
+			}},
+			want: func(file blinkfile.FileHeader) error {
+				if !file.Expires.Equal(now.Add(24*time.Hour)) || file.DownloadLimit != 3 {
+					return fmt.Errorf("got expiration %v and download limit %d", file.Expires, file.DownloadLimit)
+				}
+				return nil
+			},
+		},
+		{
+			name:   "should reject an expiration beyond the maximum",
+			policy: app.Policy{Sharing: blinkfile.SharingPolicy{MaxExpiration: 30 * 24 * time.Hour}},
+			args:   app.UploadFileArgs{ExpiresIn: "5w"},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Expiration too long",
+				Detail: "Files must expire within 30 days.",
+				Err:    blinkfile.ErrSharingExpirationTooLong,
+			},
+		},
+		{
+			name:   "should reject a download limit above the maximum",
+			policy: app.Policy{Sharing: blinkfile.SharingPolicy{MaxDownloadLimit: 10}},
+			args:   app.UploadFileArgs{DownloadLimit: 11},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Download limit too high",
+				Detail: "Files can be downloaded at most 10 times.",
+				Err:    blinkfile.ErrSharingDownloadLimitTooHigh,
+			},
+		},
+		{
+			name:   "should reject a file without a password if one is required",
+			policy: app.Policy{Sharing: blinkfile.SharingPolicy{RequirePassword: true}},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Password required",
+				Detail: "Files must be password-protected to be shared.",
+				Err:    blinkfile.ErrSharingPasswordRequired,
+			},
+		},
+		{
+			name:   "should allow a file with a password if one is required",
+			policy: app.Policy{Sharing: blinkfile.SharingPolicy{RequirePassword: true}},
+			args:   app.UploadFileArgs{Password: "password"},
+		},
+		{
+			name: "should apply the owner's override instead of the deployment policy",
+			policy: app.Policy{
+				Sharing: blinkfile.SharingPolicy{RequirePassword: true},
+				UserSharing: map[blinkfile.UserID]blinkfile.SharingPolicy{
+					"user1": {MaxDownloadLimit: 1},
+				},
+			},
+			want: func(file blinkfile.FileHeader) error {
+				if file.DownloadLimit != 1 {
+					return fmt.Errorf("got download limit %d", file.DownloadLimit)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved blinkfile.FileHeader
+			cfg := AppConfigDefaults(app.Config{
+				Clock: &StaticClock{T: now},
+				PolicyRepo: &StubPolicyRepo{GetFunc: func(context.Context) (app.Policy, error) {
+					return tt.policy, nil
+				}},
+				FileRepo: &StubFileRepo{SaveFunc: func(_ context.Context, file blinkfile.File) error {
+					saved = file.FileHeader
+					return nil
+				}},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			args := tt.args
+			args.Filename, args.Owner, args.Reader = "file1", "user1", io.NopCloser(strings.NewReader("file-data"))
+			_, err := application.UploadFile(ctx, args)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("UploadFile() error = \n\t%v\n, wantErr \n\t%v", err, tt.wantErr)
+			}
+			if tt.want != nil {
+				if err := tt.want(saved); err != nil {
+					t.Errorf("UploadFile() saved file: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestApp_UpdateFile_SharingPolicy(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0).Add(90 * 24 * time.Hour).UTC()
+	tests := []struct {
+		name      string
+		policy    app.Policy
+		file      blinkfile.FileHeader
+		args      app.UpdateFileArgs
+		wantErr   error
+		wantFiles map[blinkfile.FileID]blinkfile.FileHeader
+	}{
+		{
+			name:   "should restore the default terms if they are cleared",
+			policy: app.Policy{Sharing: blinkfile.SharingPolicy{DefaultTerms: "Do not share."}},
+			file:   blinkfile.FileHeader{ID: "file1", Owner: "user1", Terms: "Do not share."},
+			args:   app.UpdateFileArgs{ID: "file1", Owner: "user1"},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", Terms: "Do not share."},
+			},
+		},
+		{
+			name:   "should not set an expiration on an older file without one",
+			policy: app.Policy{Sharing: blinkfile.SharingPolicy{DefaultExpiration: 24 * time.Hour, MaxExpiration: 30 * 24 * time.Hour}},
+			file:   blinkfile.FileHeader{ID: "file1", Owner: "user1", Created: time.Unix(100, 0).UTC()},
+			args:   app.UpdateFileArgs{ID: "file1", Owner: "user1", Terms: "New terms"},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", Created: time.Unix(100, 0).UTC(), Terms: "New terms"},
+			},
+		},
+		{
+			name:   "should count the maximum expiration from now",
+			policy: app.Policy{Sharing: blinkfile.SharingPolicy{MaxExpiration: 30 * 24 * time.Hour}},
+			file:   blinkfile.FileHeader{ID: "file1", Owner: "user1", Created: time.Unix(100, 0).UTC(), Expires: now.Add(24 * time.Hour)},
+			args:   app.UpdateFileArgs{ID: "file1", Owner: "user1", Terms: "New terms"},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", Created: time.Unix(100, 0).UTC(), Expires: now.Add(24 * time.Hour), Terms: "New terms"},
+			},
+		},
+		{
+			name:   "should update a file shared before the policy required a password",
+			policy: app.Policy{Sharing: blinkfile.SharingPolicy{RequirePassword: true}},
+			file:   blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+			args:   app.UpdateFileArgs{ID: "file1", Owner: "user1", Terms: "New terms"},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", Terms: "New terms"},
+			},
+		},
+		{
+			name:   "should unlock the password of a file shared before the policy was tightened",
+			policy: app.Policy{Sharing: blinkfile.SharingPolicy{MaxDownloadLimit: 10}},
+			file:   blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash", DownloadLimit: 11, FailedPasswordAttempts: 5, LastFailedPassword: now},
+			args:   app.UpdateFileArgs{ID: "file1", Owner: "user1", UnlockPassword: true},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", PasswordHash: "hash", DownloadLimit: 11},
+			},
+		},
+		{
+			name:   "should update a file within the policy",
+			policy: app.Policy{Sharing: blinkfile.SharingPolicy{RequirePassword: true}},
+			file:   blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash"},
+			args:   app.UpdateFileArgs{ID: "file1", Owner: "user1", Terms: "New terms"},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", PasswordHash: "hash", Terms: "New terms"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMemFileRepo(tt.file)
+			cfg := AppConfigDefaults(app.Config{
+				Clock:    &StaticClock{T: now},
+				FileRepo: r,
+				PolicyRepo: &StubPolicyRepo{GetFunc: func(context.Context) (app.Policy, error) {
+					return tt.policy, nil
+				}},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			_, err := application.UpdateFile(ctx, tt.args)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("UpdateFile() error = \n\t%v\n, wantErr \n\t%v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(r.files, tt.wantFiles) {
+				t.Errorf("UpdateFile() files = %+v, want %+v", r.files, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestApp_SetSharingPolicy(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		existing   app.Policy
+		args       app.SetSharingPolicyArgs
+		userFound  bool
+		wantErr    error
+		wantSaved  *app.Policy
+		wantAudits []string
+	}{
+		{
+			name: "should fail with an invalid expiration",
+			args: app.SetSharingPolicyArgs{MaxExpiration: "invalid-duration"},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error saving sharing policy",
+				Detail: "Maximum expiration is not in a valid format.",
+				Err: func() error {
+					_, err := time.ParseDuration("invalid-duration")
+					return err
+				}(),
+			},
+		},
+		{
+			name: "should fail with an invalid policy",
+			args: app.SetSharingPolicyArgs{DefaultDownloadLimit: 5, MaxDownloadLimit: 2},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error saving sharing policy",
+				Detail: "Invalid sharing policy: default download limit is higher than the maximum.",
+				Err:    fmt.Errorf("%w: default download limit is higher than the maximum", blinkfile.ErrInvalidSharingPolicy),
+			},
+		},
+		{
+			name: "should fail if the user doesn't exist",
+			args: app.SetSharingPolicyArgs{UserID: "user1"},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error saving sharing policy",
+				Detail: "User not found.",
+				Err:    app.ErrUserNotFound,
+			},
+		},
+		{
+			name: "should save the deployment policy",
+			args: app.SetSharingPolicyArgs{DefaultExpiration: "1w", MaxExpiration: "30d", MaxDownloadLimit: 10, RequirePassword: true},
+			wantSaved: &app.Policy{Sharing: blinkfile.SharingPolicy{
+				DefaultExpiration: 7 * 24 * time.Hour,
+				MaxExpiration:     30 * 24 * time.Hour,
+				MaxDownloadLimit:  10,
+				RequirePassword:   true,
+			}},
+			wantAudits: []string{`set deployment sharing policy to "Files must be password-protected; Files expire after 7 days by default; Files must expire within 30 days; Files can be downloaded at most 10 times"`},
+		},
+		{
+			name:      "should save an empty user override",
+			args:      app.SetSharingPolicyArgs{UserID: "user1"},
+			userFound: true,
+			wantSaved: &app.Policy{UserSharing: map[blinkfile.UserID]blinkfile.SharingPolicy{
+				"user1": {},
+			}},
+			wantAudits: []string{`set user "user1" sharing policy override to ""`},
+		},
+		{
+			name: "should remove a user override",
+			existing: app.Policy{UserSharing: map[blinkfile.UserID]blinkfile.SharingPolicy{
+				"user1": {MaxDownloadLimit: 1},
+			}},
+			args:       app.SetSharingPolicyArgs{UserID: "user1", RemoveOverride: true, MaxDownloadLimit: 5},
+			userFound:  true,
+			wantSaved:  &app.Policy{UserSharing: map[blinkfile.UserID]blinkfile.SharingPolicy{}},
+			wantAudits: []string{`removed user "user1" sharing policy override`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved *app.Policy
+			var audits []string
+			cfg := AppConfigDefaults(app.Config{
+				UserRepo: &StubUserRepo{GetFunc: func(context.Context, blinkfile.UserID) (blinkfile.User, bool, error) {
+					return blinkfile.User{}, tt.userFound, nil
+				}},
+				PolicyRepo: &StubPolicyRepo{
+					GetFunc: func(context.Context) (app.Policy, error) { return tt.existing, nil },
+					SaveFunc: func(_ context.Context, policy app.Policy) error {
+						saved = &policy
+						return nil
+					},
+				},
+				AuditRepo: &StubAuditRepo{RecordFunc: func(_ context.Context, record app.AuditRecord) error {
+					audits = append(audits, record.Detail)
+					return nil
+				}},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			err := application.SetSharingPolicy(ctx, "admin", tt.args)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("SetSharingPolicy() error = \n\t%v\n, wantErr \n\t%v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(saved, tt.wantSaved) {
+				t.Errorf("SetSharingPolicy() saved = %+v, want %+v", saved, tt.wantSaved)
+			}
+			if !reflect.DeepEqual(audits, tt.wantAudits) {
+				t.Errorf("SetSharingPolicy() audits = %q, want %q", audits, tt.wantAudits)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+type (
+	PreviewToken string
+
+	FilePreview struct {
+		blinkfile.FileHeader
+		Token PreviewToken
+	}
+
+	previewGrant struct {
+		fileID  blinkfile.FileID
+		userID  blinkfile.UserID
+		expires time.Time
+	}
+
+	previewGrants struct {
+		mu     sync.Mutex
+		grants map[PreviewToken]previewGrant
+	}
+)
+
+const previewTokenExpiration = time.Hour
+
+func newPreviewGrants() *previewGrants {
+	return &previewGrants{grants: make(map[PreviewToken]previewGrant)}
+}
+
+func (g *previewGrants) add(token PreviewToken, grant previewGrant, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for t, existing := range g.grants {
+		if !now.Before(existing.expires) {
+			delete(g.grants, t)
+		}
+	}
+	g.grants[token] = grant
+}
+
+func (g *previewGrants) get(token PreviewToken, now time.Time) (previewGrant, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	grant, ok := g.grants[token]
+	if !ok {
+		return previewGrant{}, false
+	}
+	if !now.Before(grant.expires) {
+		delete(g.grants, token)
+		return previewGrant{}, false
+	}
+	return grant, true
+}
+
+// PreviewFile authorizes an inline preview of the file and returns a short-lived token that grants access to the
+// preview content, so that it can be loaded separately by the browser without re-sending the file password.
+func (a *App) PreviewFile(ctx context.Context, userID blinkfile.UserID, fileID blinkfile.FileID, password string) (FilePreview, error) {
+	if fileID == "" {
+		return FilePreview{}, Err(ErrBadRequest, fmt.Errorf("file ID is required"))
+	}
+	matchFunc := a.matchPassword()
+	file, err := a.cfg.FileRepo.Get(ctx, fileID)
+	if err != nil {
+		return FilePreview{}, a.mimicErr(ctx, password, Err(ErrRepo, err))
+	}
+	err = checkClientNetwork(ctx, file, userID)
+	if err == nil {
+		err = a.checkPasswordAttempt(file, userID, password)
+	}
+	var conditions downloadConditions
+	if err == nil {
+		conditions, err = a.checkDownloadConditions(ctx, file, userID, password, matchFunc)
+	}
+	if err == nil {
+		err = file.Preview(userID, password, matchFunc, a.cfg.Now, a.cfg.PreviewCountsAsDownload)
+	}
+	if err == nil {
+		var countDownload func(*blinkfile.FileHeader) error
+		if a.cfg.PreviewCountsAsDownload {
+			countDownload = func(current *blinkfile.FileHeader) error {
+				return current.Preview(userID, password, matchedPassword(file.PasswordHash), a.cfg.Now, true)
+			}
+		}
+		var previewed blinkfile.FileHeader
+		previewed, err = a.acceptPassword(ctx, file, userID, password, countDownload)
+		if err == nil {
+			file = previewed
+		}
+	}
+	if err != nil {
+		a.downloadFailed(ctx, file, userID, err)
+		if notAvailable := a.notAvailableErr(file, err); notAvailable != nil {
+			return FilePreview{}, notAvailable
+		}
+		if errors.Is(err, blinkfile.ErrPreviewUnavailable) {
+			return FilePreview{}, Err(ErrNotFound, err)
+		}
+		if errors.Is(err, blinkfile.ErrFilePasswordInvalid) {
+			a.recordFailedPassword(ctx, file.ID)
+			err = Err(ErrAuthzFailed, err)
+		}
+		return FilePreview{}, a.mimicErr(ctx, password, err)
+	}
+	if !a.cfg.PreviewCountsAsDownload {
+		// The recipient is only recorded as downloading the file if previews count as downloads
+		conditions.recipient = ""
+	}
+	a.conditionsMet(ctx, file, userID, conditions)
+	a.recordAccess(ctx, file.ID, AccessRecord{Action: AccessPreviewed, UserID: userID})
+	if a.cfg.PreviewCountsAsDownload {
+		fileChanged(ctx, file.Owner, FileEvent{FileHeader: file, Change: FileDownloaded})
+	}
+	token, err := a.cfg.GenerateToken()
+	if err != nil {
+		return FilePreview{}, Err(ErrInternal, err)
+	}
+	previewToken := PreviewToken(token)
+	a.previews.add(previewToken, previewGrant{fileID: file.ID, userID: userID, expires: a.cfg.Now().Add(previewTokenExpiration)}, a.cfg.Now())
+	return FilePreview{FileHeader: file, Token: previewToken}, nil
+}
+
+// GetPreviewContent returns the file header for a previously granted preview token.
+func (a *App) GetPreviewContent(ctx context.Context, token PreviewToken) (blinkfile.FileHeader, error) {
+	if token == "" {
+		return blinkfile.FileHeader{}, Err(ErrBadRequest, fmt.Errorf("preview token is required"))
+	}
+	grant, ok := a.previews.get(token, a.cfg.Now())
+	if !ok {
+		return blinkfile.FileHeader{}, Err(ErrNotFound, blinkfile.ErrPreviewUnavailable)
+	}
+	file, err := a.cfg.FileRepo.Get(ctx, grant.fileID)
+	if err != nil {
+		return blinkfile.FileHeader{}, Err(ErrNotFound, err)
+	}
+	if !file.Previewable() {
+		return blinkfile.FileHeader{}, Err(ErrNotFound, blinkfile.ErrPreviewUnavailable)
+	}
+	// The preview was checked against the download limit when it was granted, and may have used the last download
+	granted := file
+	granted.DownloadLimit = 0
+	err = granted.CheckAvailable(grant.userID, a.cfg.Now)
+	if err != nil {
+		return blinkfile.FileHeader{}, Err(ErrNotFound, err)
+	}
+	a.downloads.start(file.ID)
+	return file, nil
+}
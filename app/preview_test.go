@@ -0,0 +1,276 @@
+package app_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+func TestApp_PreviewFile(t *testing.T) {
+	ctx := context.Background()
+	type args struct {
+		userID   blinkfile.UserID
+		fileID   blinkfile.FileID
+		password string
+	}
+	previewableFile := blinkfile.FileHeader{
+		ID:           "file1",
+		Owner:        "user1",
+		ContentType:  "image/png",
+		AllowPreview: true,
+	}
+	tests := []struct {
+		name      string
+		cfg       app.Config
+		args      args
+		want      app.FilePreview
+		wantErr   error
+		wantSaved *blinkfile.FileHeader
+	}{
+		{
+			name: "should fail if file ID is empty",
+			args: args{
+				fileID: "",
+			},
+			wantErr: &app.Error{
+				Type: app.ErrBadRequest,
+				Err:  fmt.Errorf("file ID is required"),
+			},
+		},
+		{
+			name: "should mimic a password-protected file if the file is not found",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+					return blinkfile.FileHeader{}, app.ErrFileNotFound
+				}},
+			},
+			args: args{
+				fileID: "file1",
+			},
+			wantErr: &app.Error{
+				Type: app.ErrAuthzFailed,
+				Err:  blinkfile.ErrFilePasswordRequired,
+			},
+		},
+		{
+			name: "should fail with not found if the owner did not allow previews",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+					return blinkfile.FileHeader{ID: "file1", ContentType: "image/png"}, nil
+				}},
+			},
+			args: args{
+				fileID: "file1",
+			},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  blinkfile.ErrPreviewUnavailable,
+			},
+		},
+		{
+			name: "should fail with not found if the content type is not safe to preview",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+					return blinkfile.FileHeader{ID: "file1", ContentType: "text/html; charset=utf-8", AllowPreview: true}, nil
+				}},
+			},
+			args: args{
+				fileID: "file1",
+			},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  blinkfile.ErrPreviewUnavailable,
+			},
+		},
+		{
+			name: "should require a password for a password-protected file",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+					file := previewableFile
+					file.PasswordHash = "password-hash"
+					return file, nil
+				}},
+			},
+			args: args{
+				fileID: "file1",
+			},
+			wantErr: blinkfile.ErrFilePasswordRequired,
+		},
+		{
+			name: "should grant a preview without counting a download",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{
+					GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+						return previewableFile, nil
+					},
+					PutHeaderFunc: func(context.Context, blinkfile.FileHeader) error {
+						return fmt.Errorf("header should not be updated")
+					},
+				},
+				GenerateToken: func() (app.Token, error) { return "preview-token", nil },
+			},
+			args: args{
+				fileID: "file1",
+			},
+			want: app.FilePreview{FileHeader: previewableFile, Token: "preview-token"},
+		},
+		{
+			name: "should count a download if configured to",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{
+					GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+						return previewableFile, nil
+					},
+				},
+				GenerateToken:           func() (app.Token, error) { return "preview-token", nil },
+				PreviewCountsAsDownload: true,
+				Clock:                   &StaticClock{T: time.Unix(1, 0).UTC()},
+			},
+			args: args{
+				fileID: "file1",
+			},
+			want: app.FilePreview{
+				FileHeader: func() blinkfile.FileHeader {
+					file := previewableFile
+					file.Downloads = 1
+					file.LastDownloaded = time.Unix(1, 0).UTC()
+					return file
+				}(),
+				Token: "preview-token",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := AppConfigDefaults(tt.cfg)
+			application := NewTestApp(ctx, t, cfg)
+			got, err := application.PreviewFile(ctx, tt.args.userID, tt.args.fileID, tt.args.password)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("PreviewFile() error = \n\t%v\n, wantErr \n\t%v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PreviewFile() got:\n\t%+v\nwant:\n\t%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApp_GetPreviewContent(t *testing.T) {
+	ctx := context.Background()
+	file := blinkfile.FileHeader{
+		ID:           "file1",
+		ContentType:  "application/pdf",
+		AllowPreview: true,
+		Expires:      time.Unix(10, 0).UTC(),
+	}
+	clock := &StaticClock{T: time.Unix(1, 0).UTC()}
+	cfg := AppConfigDefaults(app.Config{
+		Clock: clock,
+		FileRepo: &StubFileRepo{GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+			return file, nil
+		}},
+		GenerateToken: func() (app.Token, error) { return "preview-token", nil },
+	})
+	application := NewTestApp(ctx, t, cfg)
+
+	_, err := application.GetPreviewContent(ctx, "preview-token")
+	wantErr := &app.Error{Type: app.ErrNotFound, Err: blinkfile.ErrPreviewUnavailable}
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Fatalf("GetPreviewContent() before preview error = %v, wantErr %v", err, wantErr)
+	}
+
+	preview, err := application.PreviewFile(ctx, "", "file1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := application.GetPreviewContent(ctx, preview.Token)
+	if err != nil {
+		t.Fatalf("GetPreviewContent() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, file) {
+		t.Errorf("GetPreviewContent() got:\n\t%+v\nwant:\n\t%+v", got, file)
+	}
+
+	clock.T = time.Unix(10, 0).UTC()
+	_, err = application.GetPreviewContent(ctx, preview.Token)
+	wantErr = &app.Error{Type: app.ErrNotFound, Err: blinkfile.ErrFileExpired}
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("GetPreviewContent() after file expired error = %v, wantErr %v", err, wantErr)
+	}
+
+	clock.T = time.Unix(1, 0).UTC().Add(2 * time.Hour)
+	_, err = application.GetPreviewContent(ctx, preview.Token)
+	wantErr = &app.Error{Type: app.ErrNotFound, Err: blinkfile.ErrPreviewUnavailable}
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("GetPreviewContent() after token expired error = %v, wantErr %v", err, wantErr)
+	}
+}
+
+func TestApp_GetPreviewContent_FileState(t *testing.T) {
+	ctx := context.Background()
+	previewable := blinkfile.FileHeader{
+		ID:           "file1",
+		Owner:        "user1",
+		Created:      time.Unix(1, 0).UTC(),
+		ContentType:  "application/pdf",
+		AllowPreview: true,
+	}
+	tests := []struct {
+		name    string
+		change  func(*blinkfile.FileHeader)
+		wantErr error
+	}{
+		{
+			name:    "should fail once the file expires from inactivity",
+			change:  func(file *blinkfile.FileHeader) { file.InactivityExpiry = time.Second },
+			wantErr: &app.Error{Type: app.ErrNotFound, Err: blinkfile.ErrFileExpired},
+		},
+		{
+			name:    "should fail once the file is quarantined",
+			change:  func(file *blinkfile.FileHeader) { file.Quarantined = true },
+			wantErr: &app.Error{Type: app.ErrNotFound, Err: blinkfile.ErrFileQuarantined},
+		},
+		{
+			name:    "should fail if the file is being scanned",
+			change:  func(file *blinkfile.FileHeader) { file.ScanStatus = blinkfile.ScanPending },
+			wantErr: &app.Error{Type: app.ErrNotFound, Err: blinkfile.ErrFileNotScanned},
+		},
+		{
+			name:    "should fail if the file is embargoed",
+			change:  func(file *blinkfile.FileHeader) { file.AvailableFrom = time.Unix(100, 0).UTC() },
+			wantErr: &app.Error{Type: app.ErrNotFound, Err: blinkfile.ErrFileNotAvailable},
+		},
+		{
+			name:   "should succeed if the preview used the last download",
+			change: func(file *blinkfile.FileHeader) { file.Downloads, file.DownloadLimit = 1, 1 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := previewable
+			cfg := AppConfigDefaults(app.Config{
+				Clock: &StaticClock{T: time.Unix(10, 0).UTC()},
+				FileRepo: &StubFileRepo{GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+					return file, nil
+				}},
+				GenerateToken: func() (app.Token, error) { return "preview-token", nil },
+			})
+			application := NewTestApp(ctx, t, cfg)
+			preview, err := application.PreviewFile(ctx, "user2", "file1", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(&file)
+			_, err = application.GetPreviewContent(ctx, preview.Token)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("GetPreviewContent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+type (
+	// Upload is a file being uploaded, as it is passed through the upload processors before it is saved.
+	Upload struct {
+		blinkfile.File
+		// StripMetadata is set if the uploader chose to remove image metadata.
+		StripMetadata bool
+	}
+
+	// Processor inspects or transforms an upload before it is saved. It can replace the upload data reader, change the
+	// file header, or reject the upload by returning an error. Errors created with ErrUser are shown to the uploader.
+	Processor interface {
+		Process(context.Context, *Upload) error
+	}
+
+	// ProcessorFunc adapts a function to the Processor interface.
+	ProcessorFunc func(context.Context, *Upload) error
+
+	// AsyncProcessor runs in the background after a file is saved. Changes it makes to the file header are saved if it
+	// succeeds, and it can quarantine the file by returning an error created with Quarantine.
+	AsyncProcessor interface {
+		ProcessSaved(ctx context.Context, file *blinkfile.FileHeader, data io.Reader) error
+	}
+
+	// AsyncProcessorFunc adapts a function to the AsyncProcessor interface.
+	AsyncProcessorFunc func(ctx context.Context, file *blinkfile.FileHeader, data io.Reader) error
+
+	QuarantineError struct {
+		Reason string
+	}
+)
+
+func (f ProcessorFunc) Process(ctx context.Context, upload *Upload) error {
+	return f(ctx, upload)
+}
+
+func (f AsyncProcessorFunc) ProcessSaved(ctx context.Context, file *blinkfile.FileHeader, data io.Reader) error {
+	return f(ctx, file, data)
+}
+
+// Quarantine returns an error for an AsyncProcessor to block all access to a saved file.
+func Quarantine(reason string) error {
+	return &QuarantineError{reason}
+}
+
+func (e *QuarantineError) Error() string {
+	return fmt.Sprintf("file quarantined: %s", e.Reason)
+}
+
+// processors returns the built-in upload processors followed by the configured ones.
+func (a *App) processors() []Processor {
+	processors := append([]Processor{
+		ProcessorFunc(detectContentType),
+		ProcessorFunc(a.checkFileType),
+		ProcessorFunc(a.stripImageMetadata),
+	}, a.cfg.Processors...)
+	// Scan last, so the data is scanned as it will be saved
+	return append(processors, ProcessorFunc(a.scanUpload))
+}
+
+// asyncProcessors returns the processors to run after a file is saved. The virus scan runs first and thumbnails last,
+// so that thumbnails are only generated for files that weren't quarantined.
+func (a *App) asyncProcessors() []AsyncProcessor {
+	var processors []AsyncProcessor
+	if a.cfg.Scanner != nil && a.cfg.ScanAsync {
+		processors = append(processors, AsyncProcessorFunc(a.scanSaved))
+	}
+	processors = append(processors, a.cfg.AsyncProcessors...)
+	return append(processors, AsyncProcessorFunc(a.generateThumbnail))
+}
+
+func (a *App) processUpload(ctx context.Context, upload *Upload) error {
+	for _, processor := range a.processors() {
+		err := processor.Process(ctx, upload)
+		if err != nil {
+			var appErr *Error
+			if errors.As(err, &appErr) {
+				return err
+			}
+			return Err(ErrInternal, fmt.Errorf("processing upload: %w", err))
+		}
+	}
+	return nil
+}
+
+// processSaved runs the async processors in order, stopping if one of them quarantines the file. It is run in the
+// background after an upload, so failures are only logged.
+func (a *App) processSaved(ctx context.Context, fileID blinkfile.FileID) {
+	for _, processor := range a.asyncProcessors() {
+		quarantined, err := a.runAsyncProcessor(ctx, fileID, processor)
+		if err != nil {
+			if errors.Is(err, ErrFileNotFound) {
+				return
+			}
+			a.Errorf(ctx, "processing saved file %q: %v", fileID, err)
+		}
+		if quarantined {
+			return
+		}
+	}
+}
+
+func (a *App) runAsyncProcessor(ctx context.Context, fileID blinkfile.FileID, processor AsyncProcessor) (quarantined bool, err error) {
+	file, err := a.cfg.FileRepo.Get(ctx, fileID)
+	if err != nil {
+		return false, err
+	}
+	data, err := a.cfg.FileRepo.Open(ctx, fileID)
+	if err != nil {
+		return false, fmt.Errorf("opening file: %w", err)
+	}
+	defer func() { _ = data.Close() }()
+	processed := file
+	err = processor.ProcessSaved(ctx, &processed, data)
+	var quarantine *QuarantineError
+	if errors.As(err, &quarantine) {
+		processed.Quarantine(quarantine.Reason)
+		quarantined = true
+	} else if err != nil {
+		return false, err
+	}
+	if reflect.DeepEqual(processed, file) {
+		return false, nil
+	}
+	// Only the fields the processor changed are saved, the file could have been downloaded, trashed or edited while it
+	// was processed
+	processed, err = a.cfg.FileRepo.UpdateHeader(ctx, fileID, func(current *blinkfile.FileHeader) error {
+		mergeChangedFields(current, file, processed)
+		return nil
+	})
+	if err != nil {
+		return quarantined, fmt.Errorf("saving processed file header: %w", err)
+	}
+	if quarantined {
+		a.Printf(ctx, "Quarantined file %q: %s", fileID, quarantine.Reason)
+		fileChanged(ctx, processed.Owner, FileEvent{FileHeader: processed, Change: FileQuarantined})
+	} else {
+		fileChanged(ctx, processed.Owner, FileEvent{FileHeader: processed, Change: FileProcessed})
+	}
+	return quarantined, nil
+}
+
+// mergeChangedFields sets the fields of the current header that were changed from before to after.
+func mergeChangedFields(current *blinkfile.FileHeader, before, after blinkfile.FileHeader) {
+	currentValue := reflect.ValueOf(current).Elem()
+	beforeValue, afterValue := reflect.ValueOf(before), reflect.ValueOf(after)
+	for i := range currentValue.NumField() {
+		if !reflect.DeepEqual(beforeValue.Field(i).Interface(), afterValue.Field(i).Interface()) {
+			currentValue.Field(i).Set(afterValue.Field(i))
+		}
+	}
+}
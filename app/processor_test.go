@@ -0,0 +1,312 @@
+package app_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+func TestApp_UploadFile_Processors(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		processors []app.Processor
+		wantData   string
+		wantHeader func(blinkfile.FileHeader) bool
+		wantErr    error
+	}{
+		{
+			name: "should reject the upload with a processor's user error",
+			processors: []app.Processor{
+				app.ProcessorFunc(func(context.Context, *app.Upload) error {
+					return app.ErrUser("Upload rejected", "File is not allowed.", nil)
+				}),
+			},
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Upload rejected",
+				Detail: "File is not allowed.",
+			},
+		},
+		{
+			name: "should wrap other processor errors as internal errors",
+			processors: []app.Processor{
+				app.ProcessorFunc(func(context.Context, *app.Upload) error {
+					return fmt.Errorf("processor err")
+				}),
+			},
+			wantErr: &app.Error{
+				Type: app.ErrInternal,
+				Err:  fmt.Errorf("processing upload: %w", fmt.Errorf("processor err")),
+			},
+		},
+		{
+			name: "should not run later processors after one fails",
+			processors: []app.Processor{
+				app.ProcessorFunc(func(context.Context, *app.Upload) error {
+					return app.ErrUser("Upload rejected", "", nil)
+				}),
+				app.ProcessorFunc(func(context.Context, *app.Upload) error {
+					panic("should not be called")
+				}),
+			},
+			wantErr: &app.Error{
+				Type:  app.ErrBadRequest,
+				Title: "Upload rejected",
+			},
+		},
+		{
+			name: "should run processors in order after content type detection, and save their changes",
+			processors: []app.Processor{
+				app.ProcessorFunc(func(_ context.Context, upload *app.Upload) error {
+					if upload.ContentType != "text/plain; charset=utf-8" {
+						return fmt.Errorf("unexpected content type %q", upload.ContentType)
+					}
+					data, err := io.ReadAll(upload.Data)
+					if err != nil {
+						return err
+					}
+					upload.Data = io.NopCloser(strings.NewReader(strings.ToUpper(string(data))))
+					return nil
+				}),
+				app.ProcessorFunc(func(_ context.Context, upload *app.Upload) error {
+					upload.AllowPreview = true
+					return nil
+				}),
+			},
+			wantData: "FILE-DATA",
+			wantHeader: func(file blinkfile.FileHeader) bool {
+				return file.AllowPreview
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved blinkfile.FileHeader
+			var savedData string
+			cfg := AppConfigDefaults(app.Config{
+				Processors: tt.processors,
+				FileRepo: &StubFileRepo{SaveFunc: func(_ context.Context, file blinkfile.File) error {
+					data, err := io.ReadAll(file.Data)
+					saved, savedData = file.FileHeader, string(data)
+					return err
+				}},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			_, err := application.UploadFile(ctx, app.UploadFileArgs{
+				Filename: "file1.txt",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader("file-data")),
+			})
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("UploadFile() error = \n\t%v\n, wantErr \n\t%v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if savedData != tt.wantData {
+				t.Errorf("UploadFile() saved data %q, want %q", savedData, tt.wantData)
+			}
+			if tt.wantHeader != nil && !tt.wantHeader(saved) {
+				t.Errorf("UploadFile() saved unexpected header %+v", saved)
+			}
+		})
+	}
+}
+
+func TestApp_UploadFile_AsyncProcessors(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		processors func(calls chan<- string) []app.AsyncProcessor
+		wantCalls  []string
+		wantPut    *blinkfile.FileHeader
+	}{
+		{
+			name: "should run processors in order with the saved file data",
+			processors: func(calls chan<- string) []app.AsyncProcessor {
+				return []app.AsyncProcessor{
+					app.AsyncProcessorFunc(func(_ context.Context, _ *blinkfile.FileHeader, data io.Reader) error {
+						b, err := io.ReadAll(data)
+						calls <- "first " + string(b)
+						return err
+					}),
+					app.AsyncProcessorFunc(func(context.Context, *blinkfile.FileHeader, io.Reader) error {
+						calls <- "second"
+						return nil
+					}),
+				}
+			},
+			wantCalls: []string{"first file-data", "second"},
+		},
+		{
+			name: "should save header changes made by a processor",
+			processors: func(calls chan<- string) []app.AsyncProcessor {
+				return []app.AsyncProcessor{
+					app.AsyncProcessorFunc(func(_ context.Context, file *blinkfile.FileHeader, _ io.Reader) error {
+						file.AllowPreview = true
+						calls <- "first"
+						return nil
+					}),
+				}
+			},
+			wantCalls: []string{"first"},
+			wantPut:   &blinkfile.FileHeader{ID: "file1", Owner: "user1", AllowPreview: true},
+		},
+		{
+			name: "should quarantine the file and stop processing",
+			processors: func(calls chan<- string) []app.AsyncProcessor {
+				return []app.AsyncProcessor{
+					app.AsyncProcessorFunc(func(context.Context, *blinkfile.FileHeader, io.Reader) error {
+						calls <- "first"
+						return app.Quarantine("malware found")
+					}),
+					app.AsyncProcessorFunc(func(context.Context, *blinkfile.FileHeader, io.Reader) error {
+						calls <- "second"
+						return nil
+					}),
+				}
+			},
+			wantCalls: []string{"first"},
+			wantPut:   &blinkfile.FileHeader{ID: "file1", Owner: "user1", Quarantined: true, QuarantineReason: "malware found"},
+		},
+		{
+			name: "should continue with the next processor if one fails",
+			processors: func(calls chan<- string) []app.AsyncProcessor {
+				return []app.AsyncProcessor{
+					app.AsyncProcessorFunc(func(context.Context, *blinkfile.FileHeader, io.Reader) error {
+						calls <- "first"
+						return fmt.Errorf("processor err")
+					}),
+					app.AsyncProcessorFunc(func(context.Context, *blinkfile.FileHeader, io.Reader) error {
+						calls <- "second"
+						return nil
+					}),
+				}
+			},
+			wantCalls: []string{"first", "second"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := make(chan string, 10)
+			puts := make(chan blinkfile.FileHeader, 10)
+			cfg := AppConfigDefaults(app.Config{
+				GenerateFileID:  func() (blinkfile.FileID, error) { return "file1", nil },
+				AsyncProcessors: tt.processors(calls),
+				FileRepo: &StubFileRepo{
+					GetFunc: func(_ context.Context, fileID blinkfile.FileID) (blinkfile.FileHeader, error) {
+						return blinkfile.FileHeader{ID: fileID, Owner: "user1"}, nil
+					},
+					OpenFunc: func(context.Context, blinkfile.FileID) (io.ReadCloser, error) {
+						return io.NopCloser(strings.NewReader("file-data")), nil
+					},
+					PutHeaderFunc: func(_ context.Context, file blinkfile.FileHeader) error {
+						puts <- file
+						return nil
+					},
+				},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			_, err := application.UploadFile(ctx, app.UploadFileArgs{
+				Filename: "file1.txt",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader("file-data")),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotCalls []string
+			for range tt.wantCalls {
+				select {
+				case call := <-calls:
+					gotCalls = append(gotCalls, call)
+				case <-time.After(time.Second):
+					t.Fatalf("async processors were not called, got calls %q", gotCalls)
+				}
+			}
+			if !reflect.DeepEqual(gotCalls, tt.wantCalls) {
+				t.Errorf("UploadFile() async processor calls = %q, want %q", gotCalls, tt.wantCalls)
+			}
+			select {
+			case call := <-calls:
+				t.Errorf("UploadFile() unexpected async processor call %q", call)
+			case <-time.After(50 * time.Millisecond):
+			}
+			select {
+			case got := <-puts:
+				if tt.wantPut == nil {
+					t.Errorf("UploadFile() unexpectedly saved header %+v", got)
+				} else if !reflect.DeepEqual(got, *tt.wantPut) {
+					t.Errorf("UploadFile() saved header:\n\t%+v\nwant:\n\t%+v", got, *tt.wantPut)
+				}
+			default:
+				if tt.wantPut != nil {
+					t.Errorf("UploadFile() did not save header %+v", *tt.wantPut)
+				}
+			}
+		})
+	}
+}
+
+func TestApp_UploadFile_AsyncProcessorKeepsConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0).UTC()
+	files := newMemFileRepo()
+	cfg := AppConfigDefaults(app.Config{
+		Clock:          &StaticClock{T: now},
+		GenerateFileID: func() (blinkfile.FileID, error) { return "file1", nil },
+		AsyncProcessors: []app.AsyncProcessor{
+			app.AsyncProcessorFunc(func(ctx context.Context, file *blinkfile.FileHeader, _ io.Reader) error {
+				// The file is downloaded, trashed and put on hold while it's processed
+				current, err := files.Get(ctx, file.ID)
+				if err != nil {
+					return err
+				}
+				current.Downloads = 3
+				current.Trashed = now
+				current.LegalHold = true
+				if err = files.PutHeader(ctx, current); err != nil {
+					return err
+				}
+				file.AllowPreview = true
+				return nil
+			}),
+		},
+		FileRepo: files,
+	})
+	application := NewTestApp(ctx, t, cfg)
+	_, err := application.UploadFile(ctx, app.UploadFileArgs{
+		Filename: "file1.txt",
+		Owner:    "user1",
+		Reader:   io.NopCloser(strings.NewReader("file-data")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		got, err := files.Get(ctx, "file1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.AllowPreview {
+			if got.Downloads != 3 || !got.Trashed.Equal(now) || !got.LegalHold {
+				t.Errorf("processed header lost concurrent changes: %+v", got)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("processed header was not saved: %+v", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
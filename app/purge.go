@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"sync"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+// activeDownloads counts the downloads that are still being sent for each file, so a file isn't purged while its data
+// is being read.
+type activeDownloads struct {
+	mu     sync.Mutex
+	counts map[blinkfile.FileID]int
+}
+
+func newActiveDownloads() *activeDownloads {
+	return &activeDownloads{counts: make(map[blinkfile.FileID]int)}
+}
+
+func (d *activeDownloads) active(fileID blinkfile.FileID) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.counts[fileID] > 0
+}
+
+func (d *activeDownloads) start(fileID blinkfile.FileID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.counts[fileID]++
+}
+
+// finish returns true if it was the last download of the file that was still being sent.
+func (d *activeDownloads) finish(fileID blinkfile.FileID) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.counts[fileID] > 1 {
+		d.counts[fileID]--
+		return false
+	}
+	delete(d.counts, fileID)
+	return true
+}
+
+// FinishDownload must be called once the file data returned by DownloadFile or GetPreviewContent has been sent. If the
+// file's download limit has been reached and no other downloads are still being sent, it is purged immediately instead
+// of waiting for the next expired file cleanup, unless it's on legal hold.
+func (a *App) FinishDownload(ctx context.Context, fileID blinkfile.FileID) {
+	if !a.downloads.finish(fileID) {
+		return
+	}
+	// The download counts aren't locked while purging, and the repo shreds the file outside its own lock, so a slow
+	// shred doesn't hold up other downloads
+	file, err := a.cfg.FileRepo.Get(ctx, fileID)
+	if err != nil {
+		// Already deleted
+		return
+	}
+	if file.LegalHold || !file.DownloadLimitReached() || a.downloads.active(fileID) {
+		return
+	}
+	err = a.cfg.FileRepo.Delete(ctx, file.Owner, []blinkfile.FileID{file.ID})
+	if err != nil {
+		a.Errorf(ctx, "purging file %q after its last download: %v", file.ID, err)
+		return
+	}
+	a.Printf(ctx, "Purged file %q after its last download", file.ID)
+	fileChanged(ctx, file.Owner, FileEvent{
+		FileHeader: blinkfile.FileHeader{ID: file.ID},
+		Change:     FileDeleted,
+	})
+}
@@ -0,0 +1,138 @@
+package app_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+func TestApp_FinishDownload(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name        string
+		file        blinkfile.FileHeader
+		concurrent  int
+		wantDeletes [][]blinkfile.FileID
+	}{
+		{
+			name: "should keep a file without a download limit",
+			file: blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+		},
+		{
+			name: "should keep a file with downloads remaining",
+			file: blinkfile.FileHeader{ID: "file1", Owner: "user1", DownloadLimit: 2},
+		},
+		{
+			name:        "should purge a file after its last download",
+			file:        blinkfile.FileHeader{ID: "file1", Owner: "user1", DownloadLimit: 1},
+			wantDeletes: [][]blinkfile.FileID{{"file1"}},
+		},
+		{
+			name:        "should wait for other downloads to finish before purging",
+			file:        blinkfile.FileHeader{ID: "file1", Owner: "user1", DownloadLimit: 2},
+			concurrent:  2,
+			wantDeletes: [][]blinkfile.FileID{{"file1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := tt.file
+			var deletes [][]blinkfile.FileID
+			cfg := AppConfigDefaults(app.Config{
+				FileRepo: &StubFileRepo{
+					GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+						return file, nil
+					},
+					PutHeaderFunc: func(_ context.Context, header blinkfile.FileHeader) error {
+						file = header
+						return nil
+					},
+					DeleteFunc: func(_ context.Context, owner blinkfile.UserID, fileIDs []blinkfile.FileID) error {
+						if owner != file.Owner {
+							t.Errorf("Delete() owner = %q, want %q", owner, file.Owner)
+						}
+						deletes = append(deletes, fileIDs)
+						return nil
+					},
+				},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			downloads := max(tt.concurrent, 1)
+			for range downloads {
+				if _, err := application.DownloadFile(ctx, "user2", tt.file.ID, ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := range downloads {
+				application.FinishDownload(ctx, tt.file.ID)
+				if i < downloads-1 && len(deletes) > 0 {
+					t.Fatalf("FinishDownload() purged the file while %d download(s) were still active", downloads-1-i)
+				}
+			}
+			if !reflect.DeepEqual(deletes, tt.wantDeletes) {
+				t.Errorf("FinishDownload() deleted %v, want %v", deletes, tt.wantDeletes)
+			}
+		})
+	}
+}
+
+func TestApp_FinishDownload_DoesNotBlockOtherDownloads(t *testing.T) {
+	ctx := context.Background()
+	files := map[blinkfile.FileID]blinkfile.FileHeader{
+		"file1": {ID: "file1", Owner: "user1", DownloadLimit: 1},
+		"file2": {ID: "file2", Owner: "user1"},
+	}
+	var mu sync.Mutex
+	purging := make(chan struct{})
+	release := make(chan struct{})
+	cfg := AppConfigDefaults(app.Config{
+		FileRepo: &StubFileRepo{
+			GetFunc: func(_ context.Context, fileID blinkfile.FileID) (blinkfile.FileHeader, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				return files[fileID], nil
+			},
+			PutHeaderFunc: func(_ context.Context, header blinkfile.FileHeader) error {
+				mu.Lock()
+				defer mu.Unlock()
+				files[header.ID] = header
+				return nil
+			},
+			DeleteFunc: func(context.Context, blinkfile.UserID, []blinkfile.FileID) error {
+				// Shredding a large file takes a while
+				close(purging)
+				<-release
+				return nil
+			},
+		},
+	})
+	application := NewTestApp(ctx, t, cfg)
+	for _, fileID := range []blinkfile.FileID{"file1", "file2"} {
+		if _, err := application.DownloadFile(ctx, "user2", fileID, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go application.FinishDownload(ctx, "file1")
+	<-purging
+	defer close(release)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := application.DownloadFile(ctx, "user2", "file2", ""); err != nil {
+			t.Error(err)
+		}
+		application.FinishDownload(ctx, "file2")
+		application.FinishDownload(ctx, "file2")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("other downloads were blocked while a file was purged")
+	}
+}
@@ -0,0 +1,269 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/mailer"
+)
+
+type (
+	// Mailer sends emails, such as the codes recipients use to verify their email address.
+	Mailer interface {
+		Send(context.Context, mailer.Message) error
+	}
+
+	// RecipientToken proves that the client verified one of a file's recipient email addresses.
+	RecipientToken string
+
+	recipientKey struct {
+		fileID blinkfile.FileID
+		email  string
+	}
+
+	recipientCode struct {
+		hash     [sha256.Size]byte
+		sent     time.Time
+		expires  time.Time
+		attempts int
+	}
+
+	recipientGrant struct {
+		fileID  blinkfile.FileID
+		email   string
+		expires time.Time
+	}
+
+	// recipientVerifications holds the codes sent to recipients and the tokens granted once they're verified.
+	recipientVerifications struct {
+		mu     sync.Mutex
+		codes  map[recipientKey]recipientCode
+		grants map[RecipientToken]recipientGrant
+	}
+
+	recipientTokenKey struct{}
+)
+
+const (
+	recipientCodeExpiration  = 10 * time.Minute
+	recipientCodeResendWait  = time.Minute
+	maxRecipientCodeAttempts = 5
+	recipientTokenExpiration = 24 * time.Hour
+)
+
+func newRecipientVerifications() *recipientVerifications {
+	return &recipientVerifications{
+		codes:  make(map[recipientKey]recipientCode),
+		grants: make(map[RecipientToken]recipientGrant),
+	}
+}
+
+// addCode stores a new code for the recipient, unless one was sent too recently.
+func (v *recipientVerifications) addCode(key recipientKey, code string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for k, existing := range v.codes {
+		if !now.Before(existing.expires) {
+			delete(v.codes, k)
+		}
+	}
+	if existing, ok := v.codes[key]; ok && now.Before(existing.sent.Add(recipientCodeResendWait)) {
+		return false
+	}
+	v.codes[key] = recipientCode{hash: sha256.Sum256([]byte(code)), sent: now, expires: now.Add(recipientCodeExpiration)}
+	return true
+}
+
+// checkCode returns true if the code matches the one sent to the recipient, which can only be used once. The code is
+// discarded after too many wrong attempts.
+func (v *recipientVerifications) checkCode(key recipientKey, code string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	existing, ok := v.codes[key]
+	if !ok {
+		return false
+	}
+	if !now.Before(existing.expires) {
+		delete(v.codes, key)
+		return false
+	}
+	hash := sha256.Sum256([]byte(code))
+	if subtle.ConstantTimeCompare(hash[:], existing.hash[:]) == 1 {
+		delete(v.codes, key)
+		return true
+	}
+	existing.attempts++
+	if existing.attempts >= maxRecipientCodeAttempts {
+		delete(v.codes, key)
+		return false
+	}
+	v.codes[key] = existing
+	return false
+}
+
+func (v *recipientVerifications) addGrant(token RecipientToken, grant recipientGrant, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for t, existing := range v.grants {
+		if !now.Before(existing.expires) {
+			delete(v.grants, t)
+		}
+	}
+	v.grants[token] = grant
+}
+
+func (v *recipientVerifications) getGrant(token RecipientToken, now time.Time) (recipientGrant, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	grant, ok := v.grants[token]
+	if !ok {
+		return recipientGrant{}, false
+	}
+	if !now.Before(grant.expires) {
+		delete(v.grants, token)
+		return recipientGrant{}, false
+	}
+	return grant, true
+}
+
+// CtxWithRecipientToken passes the token from a verified recipient to DownloadFile, PreviewFile and GetThumbnail.
+func CtxWithRecipientToken(ctx context.Context, token RecipientToken) context.Context {
+	return context.WithValue(ctx, recipientTokenKey{}, token)
+}
+
+func getRecipientToken(ctx context.Context) RecipientToken {
+	token, _ := ctx.Value(recipientTokenKey{}).(RecipientToken)
+	return token
+}
+
+// EmailVerificationEnabled returns true if files can be restricted to recipients who verify their email address.
+func (a *App) EmailVerificationEnabled() bool {
+	return a.cfg.Mailer != nil
+}
+
+func generateVerificationCode() (string, error) {
+	const codeDigits = 6
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", codeDigits, n), nil
+}
+
+// SendRecipientCode emails a one-time code to the address if it's one of the file's recipients. It responds the same
+// whether or not the file exists and the address is a recipient, and the email is sent in the background, so that it
+// doesn't reveal either.
+func (a *App) SendRecipientCode(ctx context.Context, fileID blinkfile.FileID, email string) error {
+	if fileID == "" {
+		return Err(ErrBadRequest, fmt.Errorf("file ID is required"))
+	}
+	emails, err := blinkfile.ParseEmails([]string{email})
+	if err != nil || len(emails) != 1 {
+		return ErrUser("Invalid email address", "Please enter a valid email address, such as alice@example.com.", err)
+	}
+	email = emails[0]
+	if a.cfg.Mailer == nil {
+		a.Errorf(ctx, "not sending a verification code for file %q, email is not configured", fileID)
+		return nil
+	}
+	file, err := a.cfg.FileRepo.Get(ctx, fileID)
+	if err != nil {
+		a.Errorf(ctx, "not sending a verification code for file %q: %v", fileID, err)
+		return nil
+	}
+	now := a.cfg.Now()
+	if !file.HasRecipient(email) || file.IsExpired(now) || file.IsTrashed() || file.Quarantined {
+		a.Errorf(ctx, "not sending a verification code for file %q, the address is not a recipient or the file is unavailable", fileID)
+		return nil
+	}
+	code, err := a.cfg.GenerateVerificationCode()
+	if err != nil {
+		return Err(ErrInternal, fmt.Errorf("generating verification code: %w", err))
+	}
+	if !a.recipients.addCode(recipientKey{file.ID, email}, code, now) {
+		a.Printf(ctx, "Not sending another verification code for file %q yet, one was sent less than %s ago", file.ID, recipientCodeResendWait)
+		return nil
+	}
+	msg := mailer.Message{
+		To:      []string{email},
+		Subject: fmt.Sprintf("Your code to download %s", file.Name),
+		Body: fmt.Sprintf("Your verification code to download %s is:\n\n%s\n\nIt expires in %s. If you didn't ask for it, you can ignore this email.\n",
+			file.Name, code, formatDuration(recipientCodeExpiration)),
+	}
+	go func(ctx context.Context) {
+		sendErr := a.cfg.Mailer.Send(ctx, msg)
+		if sendErr != nil {
+			a.Errorf(ctx, "sending verification code for file %q: %v", file.ID, sendErr)
+			return
+		}
+		a.Printf(ctx, "Sent a verification code for file %q", file.ID)
+	}(context.WithoutCancel(ctx))
+	return nil
+}
+
+// VerifyRecipientCode checks the code sent to the recipient and returns a token that lets them download the file.
+func (a *App) VerifyRecipientCode(ctx context.Context, fileID blinkfile.FileID, email, code string) (RecipientToken, error) {
+	emails, err := blinkfile.ParseEmails([]string{email})
+	if err != nil || len(emails) != 1 {
+		return "", ErrUser("Invalid email address", "Please enter a valid email address, such as alice@example.com.", err)
+	}
+	email = emails[0]
+	invalid := ErrUser("Verification failed", "The code is not valid or has expired.", fmt.Errorf("invalid verification code for file %q", fileID))
+	now := a.cfg.Now()
+	if !a.recipients.checkCode(recipientKey{fileID, email}, code, now) {
+		return "", invalid
+	}
+	file, err := a.cfg.FileRepo.Get(ctx, fileID)
+	if err != nil || !file.HasRecipient(email) {
+		return "", invalid
+	}
+	token, err := a.cfg.GenerateToken()
+	if err != nil {
+		return "", Err(ErrInternal, err)
+	}
+	recipientToken := RecipientToken(token)
+	a.recipients.addGrant(recipientToken, recipientGrant{fileID: file.ID, email: email, expires: now.Add(recipientTokenExpiration)}, now)
+	a.audit(ctx, AuditRecord{Action: AuditRecipientVerified, FileID: file.ID, FileName: file.Name, Detail: email})
+	return recipientToken, nil
+}
+
+// checkRecipient returns the verified recipient email address of a client downloading the file, or an error if the file
+// is restricted to recipients and the client isn't one. It's empty if the file isn't restricted or the user is the
+// owner, who doesn't need to verify.
+func (a *App) checkRecipient(ctx context.Context, file blinkfile.FileHeader, userID blinkfile.UserID) (string, error) {
+	if !file.RequiresRecipient() || file.Owner == userID {
+		return "", nil
+	}
+	grant, ok := a.recipients.getGrant(getRecipientToken(ctx), a.cfg.Now())
+	if !ok || grant.fileID != file.ID || !file.HasRecipient(grant.email) {
+		return "", Err(ErrAuthzFailed, blinkfile.ErrRecipientNotVerified)
+	}
+	return grant.email, nil
+}
+
+// recipientDownloaded records which verified recipient downloaded the file.
+func (a *App) recipientDownloaded(ctx context.Context, file blinkfile.FileHeader, email string) {
+	if email == "" {
+		return
+	}
+	a.Printf(ctx, "Verified recipient downloaded file %q", file.ID)
+	a.audit(ctx, AuditRecord{Action: AuditRecipientDownloaded, FileID: file.ID, FileName: file.Name, Detail: email})
+}
+
+func (a *App) parseRecipientEmails(in []string) ([]string, error) {
+	emails, err := blinkfile.ParseEmails(in)
+	if err != nil {
+		return nil, ErrUser("Invalid recipient emails", "Recipient emails must be email addresses, such as alice@example.com.", err)
+	}
+	if len(emails) > 0 && a.cfg.Mailer == nil {
+		return nil, ErrUser("Invalid recipient emails", "Recipient emails can't be set because sending email isn't configured.", fmt.Errorf("mailer is not configured"))
+	}
+	return emails, nil
+}
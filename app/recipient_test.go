@@ -0,0 +1,246 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/mailer"
+)
+
+type StubMailer struct {
+	SendFunc func(context.Context, mailer.Message) error
+}
+
+func (m *StubMailer) Send(ctx context.Context, msg mailer.Message) error {
+	if m.SendFunc != nil {
+		return m.SendFunc(ctx, msg)
+	}
+	return nil
+}
+
+// newRecipientTestApp returns an app whose emails are sent to the returned channel, with verification code "123456".
+func newRecipientTestApp(t *testing.T, clock *StaticClock, r *memFileRepo, audit *[]app.AuditRecord) (*app.App, <-chan mailer.Message) {
+	sent := make(chan mailer.Message, 10)
+	cfg := AppConfigDefaults(app.Config{
+		Clock:    clock,
+		FileRepo: r,
+		Mailer: &StubMailer{SendFunc: func(_ context.Context, msg mailer.Message) error {
+			sent <- msg
+			return nil
+		}},
+		GenerateVerificationCode: func() (string, error) { return "123456", nil },
+		AuditRepo: &StubAuditRepo{RecordFunc: func(_ context.Context, record app.AuditRecord) error {
+			if audit != nil {
+				*audit = append(*audit, record)
+			}
+			return nil
+		}},
+	})
+	return NewTestApp(context.Background(), t, cfg), sent
+}
+
+func receiveEmail(t *testing.T, sent <-chan mailer.Message) mailer.Message {
+	t.Helper()
+	select {
+	case msg := <-sent:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no email was sent")
+		return mailer.Message{}
+	}
+}
+
+func TestApp_SendRecipientCode(t *testing.T) {
+	file := blinkfile.FileHeader{ID: "file1", Name: "report.pdf", Owner: "user1", RecipientEmails: []string{"alice@example.com"}}
+	tests := []struct {
+		name      string
+		fileID    blinkfile.FileID
+		emails    []string
+		wantErr   bool
+		wantEmail bool
+	}{
+		{
+			name:    "should fail for an invalid email address",
+			fileID:  "file1",
+			emails:  []string{"alice"},
+			wantErr: true,
+		},
+		{
+			name:      "should send the code to a recipient",
+			fileID:    "file1",
+			emails:    []string{"Alice@Example.com"},
+			wantEmail: true,
+		},
+		{
+			name:   "should not send a code to an address that isn't a recipient",
+			fileID: "file1",
+			emails: []string{"bob@example.com"},
+		},
+		{
+			name:   "should not send a code for a file that doesn't exist",
+			fileID: "file2",
+			emails: []string{"alice@example.com"},
+		},
+		{
+			name:      "should only send one code while waiting to resend",
+			fileID:    "file1",
+			emails:    []string{"alice@example.com", "alice@example.com"},
+			wantEmail: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			application, sent := newRecipientTestApp(t, &StaticClock{T: time.Unix(100, 0)}, newMemFileRepo(file), nil)
+			var err error
+			for _, email := range tt.emails {
+				err = application.SendRecipientCode(context.Background(), tt.fileID, email)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SendRecipientCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantEmail {
+				msg := receiveEmail(t, sent)
+				if !reflect.DeepEqual(msg.To, []string{"alice@example.com"}) || !strings.Contains(msg.Body, "123456") {
+					t.Errorf("SendRecipientCode() sent %+v, want the code sent to alice@example.com", msg)
+				}
+			}
+			select {
+			case msg := <-sent:
+				t.Errorf("SendRecipientCode() sent an unexpected email %+v", msg)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestApp_VerifyRecipientCode(t *testing.T) {
+	file := blinkfile.FileHeader{ID: "file1", Name: "report.pdf", Owner: "user1", RecipientEmails: []string{"alice@example.com"}}
+	tests := []struct {
+		name         string
+		codes        []string
+		elapsed      time.Duration
+		user         blinkfile.UserID
+		wantErr      bool
+		wantDownload error
+		wantAudit    []app.AuditAction
+	}{
+		{
+			name:         "should not download without verifying",
+			wantDownload: app.Err(app.ErrAuthzFailed, blinkfile.ErrRecipientNotVerified),
+		},
+		{
+			name: "should let the owner download without verifying",
+			user: "user1",
+		},
+		{
+			name:      "should download after verifying the code, recording the recipient",
+			codes:     []string{"123456"},
+			wantAudit: []app.AuditAction{app.AuditRecipientVerified, app.AuditRecipientDownloaded},
+		},
+		{
+			name:      "should verify after a wrong code",
+			codes:     []string{"000000", "123456"},
+			wantAudit: []app.AuditAction{app.AuditRecipientVerified, app.AuditRecipientDownloaded},
+		},
+		{
+			name:         "should fail after too many wrong codes",
+			codes:        []string{"000000", "000000", "000000", "000000", "000000", "123456"},
+			wantErr:      true,
+			wantDownload: app.Err(app.ErrAuthzFailed, blinkfile.ErrRecipientNotVerified),
+		},
+		{
+			name:         "should fail for an expired code",
+			codes:        []string{"123456"},
+			elapsed:      11 * time.Minute,
+			wantErr:      true,
+			wantDownload: app.Err(app.ErrAuthzFailed, blinkfile.ErrRecipientNotVerified),
+		},
+		{
+			name:      "should only verify a code once",
+			codes:     []string{"123456", "123456"},
+			wantErr:   true,
+			wantAudit: []app.AuditAction{app.AuditRecipientVerified, app.AuditRecipientDownloaded},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := &StaticClock{T: time.Unix(100, 0)}
+			var audit []app.AuditRecord
+			application, sent := newRecipientTestApp(t, clock, newMemFileRepo(file), &audit)
+			if err := application.SendRecipientCode(ctx, "file1", "alice@example.com"); err != nil {
+				t.Fatal(err)
+			}
+			receiveEmail(t, sent)
+			clock.T = clock.T.Add(tt.elapsed)
+			var token app.RecipientToken
+			var err error
+			for _, code := range tt.codes {
+				var verified app.RecipientToken
+				verified, err = application.VerifyRecipientCode(ctx, "file1", "alice@example.com", code)
+				if verified != "" {
+					token = verified
+				}
+			}
+			if len(tt.codes) > 0 && (err != nil) != tt.wantErr {
+				t.Errorf("VerifyRecipientCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			user := tt.user
+			if user == "" {
+				user = "user2"
+			}
+			_, err = application.DownloadFile(app.CtxWithRecipientToken(ctx, token), user, "file1", "")
+			if !reflect.DeepEqual(err, tt.wantDownload) {
+				t.Errorf("DownloadFile() error = %v, want %v", err, tt.wantDownload)
+			}
+			var gotAudit []app.AuditAction
+			for _, record := range audit {
+				gotAudit = append(gotAudit, record.Action)
+				if record.Detail != "alice@example.com" {
+					t.Errorf("audit record %+v should record the recipient email", record)
+				}
+			}
+			if !reflect.DeepEqual(gotAudit, tt.wantAudit) {
+				t.Errorf("audit = %v, want %v", gotAudit, tt.wantAudit)
+			}
+		})
+	}
+}
+
+func TestApp_DownloadFile_RecipientToken(t *testing.T) {
+	ctx := context.Background()
+	files := []blinkfile.FileHeader{
+		{ID: "file1", Owner: "user1", RecipientEmails: []string{"alice@example.com"}},
+		{ID: "file2", Owner: "user1", RecipientEmails: []string{"alice@example.com"}},
+	}
+	r := newMemFileRepo(files...)
+	application, sent := newRecipientTestApp(t, &StaticClock{T: time.Unix(100, 0)}, r, nil)
+	if err := application.SendRecipientCode(ctx, "file1", "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	receiveEmail(t, sent)
+	token, err := application.VerifyRecipientCode(ctx, "file1", "alice@example.com", "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = app.CtxWithRecipientToken(ctx, token)
+
+	_, err = application.DownloadFile(ctx, "user2", "file2", "")
+	if !errors.Is(err, blinkfile.ErrRecipientNotVerified) {
+		t.Errorf("DownloadFile() of another file error = %v, want %v", err, blinkfile.ErrRecipientNotVerified)
+	}
+
+	file := r.files["file1"]
+	file.RecipientEmails = []string{"bob@example.com"}
+	r.files["file1"] = file
+	_, err = application.DownloadFile(ctx, "user2", "file1", "")
+	if !errors.Is(err, blinkfile.ErrRecipientNotVerified) {
+		t.Errorf("DownloadFile() after removing the recipient error = %v, want %v", err, blinkfile.ErrRecipientNotVerified)
+	}
+}
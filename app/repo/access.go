@@ -0,0 +1,139 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+// DefaultMaxAccessLogSize keeps the last 1 MiB of each file's access log, several thousand records.
+const DefaultMaxAccessLogSize = 1 << 20
+
+func (r *FileRepo) accessFilename(fileID blinkfile.FileID) string {
+	dir, _, _ := r.filenames(fileID)
+	return filepath.Join(dir, "access.jsonl")
+}
+
+// oldAccessFilename holds the records from before the access log was last rotated.
+func (r *FileRepo) oldAccessFilename(fileID blinkfile.FileID) string {
+	dir, _, _ := r.filenames(fileID)
+	return filepath.Join(dir, "access.old.jsonl")
+}
+
+// RecordAccess appends the record to the file's access log as a JSON line, next to the file data so it is deleted along
+// with the file. Once the log reaches half the max size it's rotated, replacing the previously rotated records, so the
+// two logs together stay within the max size.
+func (r *FileRepo) RecordAccess(_ context.Context, fileID blinkfile.FileID, record app.AccessRecord) error {
+	if fileID == "" {
+		return fmt.Errorf("file ID cannot be empty")
+	}
+	data, err := Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshaling access record: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, found := r.idIndex[fileID]; !found {
+		return app.ErrFileNotFound
+	}
+	filename := r.accessFilename(fileID)
+	info, err := Lstat(filename)
+	if err == nil && info.Size() > 0 && info.Size()+int64(len(data))+1 > r.maxAccessLogSize/2 {
+		err = Rename(filename, r.oldAccessFilename(fileID))
+		if err != nil {
+			return fmt.Errorf("rotating access log: %w", err)
+		}
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("getting access log info: %w", err)
+	}
+	f, err := AppendFile(filename)
+	if err != nil {
+		return fmt.Errorf("opening access log: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing access record: %w", err)
+	}
+	return nil
+}
+
+// ListAccess returns the file's access log, oldest first.
+func (r *FileRepo) ListAccess(ctx context.Context, fileID blinkfile.FileID) ([]app.AccessRecord, error) {
+	if fileID == "" {
+		return nil, fmt.Errorf("file ID cannot be empty")
+	}
+	r.mu.RLock()
+	if _, found := r.idIndex[fileID]; !found {
+		r.mu.RUnlock()
+		return nil, app.ErrFileNotFound
+	}
+	old, err := r.readAccessLog(r.oldAccessFilename(fileID))
+	var data []byte
+	if err == nil {
+		data, err = r.readAccessLog(r.accessFilename(fileID))
+	}
+	r.mu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("reading access log: %w", err)
+	}
+	data = append(old, data...)
+	var records []app.AccessRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		var record app.AccessRecord
+		err = Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			r.Errorf(ctx, "Loading access record for file %q on line %d: %v", fileID, line, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// readAccessLog reads the end of an access log, up to the max size, so a log written before it was limited isn't read
+// into memory in full. The partial record at the start of the cut is dropped.
+func (r *FileRepo) readAccessLog(filename string) ([]byte, error) {
+	f, err := OpenFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	cut := info.Size() > r.maxAccessLogSize
+	if cut {
+		if _, err = f.Seek(info.Size()-r.maxAccessLogSize, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(f, r.maxAccessLogSize))
+	if err != nil {
+		return nil, err
+	}
+	if cut {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		} else {
+			data = nil
+		}
+	}
+	return data, nil
+}
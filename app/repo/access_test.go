@@ -0,0 +1,124 @@
+package repo_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/app/repo"
+)
+
+func TestFileRepo_RecordAccess(t *testing.T) {
+	ctx := context.Background()
+	r := newTestFileRepo(t, "")
+	defer cleanDir(t, r.Dir())
+	record := app.AccessRecord{Time: time.Unix(100, 0).UTC(), Action: app.AccessTermsAccepted, IP: "192.0.2.1", UserAgent: "curl/8.0"}
+	err := r.RecordAccess(ctx, "", record)
+	if !reflect.DeepEqual(err, fmt.Errorf("file ID cannot be empty")) {
+		t.Errorf("RecordAccess() with empty ID error = %v", err)
+	}
+	err = r.RecordAccess(ctx, "file1", record)
+	if !reflect.DeepEqual(err, app.ErrFileNotFound) {
+		t.Errorf("RecordAccess() before saving error = %v, want %v", err, app.ErrFileNotFound)
+	}
+	fatalOnErr(t, r.Save(ctx, blinkfile.File{
+		FileHeader: blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+		Data:       io.NopCloser(strings.NewReader("file-data")),
+	}))
+	records, err := r.ListAccess(ctx, "file1")
+	fatalOnErr(t, err)
+	if len(records) != 0 {
+		t.Errorf("ListAccess() before recording = %+v, want none", records)
+	}
+	second := record
+	second.Time = time.Unix(200, 0).UTC()
+	fatalOnErr(t, r.RecordAccess(ctx, "file1", record))
+	fatalOnErr(t, r.RecordAccess(ctx, "file1", second))
+	records, err = r.ListAccess(ctx, "file1")
+	fatalOnErr(t, err)
+	if want := []app.AccessRecord{record, second}; !reflect.DeepEqual(records, want) {
+		t.Errorf("ListAccess() = %+v, want %+v", records, want)
+	}
+
+	fatalOnErr(t, r.Delete(ctx, "user1", []blinkfile.FileID{"file1"}))
+	_, err = r.ListAccess(ctx, "file1")
+	if !reflect.DeepEqual(err, app.ErrFileNotFound) {
+		t.Errorf("ListAccess() after deleting error = %v, want %v", err, app.ErrFileNotFound)
+	}
+}
+
+func TestFileRepo_RecordAccess_MaxSize(t *testing.T) {
+	ctx := context.Background()
+	const maxSize = 400
+	newRecord := func(i int) app.AccessRecord {
+		return app.AccessRecord{Time: time.Unix(int64(i), 0).UTC(), Action: app.AccessDenied, IP: "192.0.2.1"}
+	}
+	tests := []struct {
+		name   string
+		record func(*testing.T, *repo.FileRepo, []app.AccessRecord)
+	}{
+		{
+			name: "should keep only the latest records once the log reaches the max size",
+			record: func(t *testing.T, r *repo.FileRepo, records []app.AccessRecord) {
+				for _, record := range records {
+					fatalOnErr(t, r.RecordAccess(ctx, "file1", record))
+				}
+			},
+		},
+		{
+			name: "should only read the latest records of a log that's already over the max size",
+			record: func(t *testing.T, r *repo.FileRepo, records []app.AccessRecord) {
+				var data []byte
+				for _, record := range records {
+					line, err := json.Marshal(record)
+					fatalOnErr(t, err)
+					data = append(append(data, line...), '\n')
+				}
+				fatalOnErr(t, os.WriteFile(filepath.Join(r.Dir(), "file1", "access.jsonl"), data, 0644))
+			},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newFileDir(t, []string{"access_maxSize", "access_maxSizeExisting"}[i])
+			r, err := repo.NewFileRepo(ctx, repo.FileRepoConfig{Dir: dir, Log: &spyLog{}, MaxAccessLogSize: maxSize})
+			fatalOnErr(t, err)
+			defer cleanDir(t, r.Dir())
+			fatalOnErr(t, r.Save(ctx, blinkfile.File{
+				FileHeader: blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+				Data:       io.NopCloser(strings.NewReader("file-data")),
+			}))
+			var recorded []app.AccessRecord
+			for n := range 20 {
+				recorded = append(recorded, newRecord(n))
+			}
+			tt.record(t, r, recorded)
+
+			got, err := r.ListAccess(ctx, "file1")
+			fatalOnErr(t, err)
+			if len(got) < 2 || len(got) >= len(recorded) {
+				t.Fatalf("ListAccess() returned %d records, want some but not all of %d", len(got), len(recorded))
+			}
+			if want := recorded[len(recorded)-len(got):]; !reflect.DeepEqual(got, want) {
+				t.Errorf("ListAccess() = %+v, want the latest records %+v", got, want)
+			}
+			var size int
+			for _, name := range []string{"access.jsonl", "access.old.jsonl"} {
+				data, _ := os.ReadFile(filepath.Join(r.Dir(), "file1", name))
+				size += len(data)
+			}
+			if i == 0 && size > maxSize {
+				t.Errorf("access log size = %d, want at most %d", size, maxSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+type (
+	APITokenRepoConfig struct {
+		Dir string
+	}
+
+	// APITokenRepo keeps all API tokens in memory and writes them to a single file whenever they change.
+	APITokenRepo struct {
+		mu     sync.RWMutex
+		path   string
+		tokens map[app.APITokenID]app.APIToken
+	}
+)
+
+func NewAPITokenRepo(_ context.Context, cfg APITokenRepoConfig) (*APITokenRepo, error) {
+	dir := filepath.Clean(cfg.Dir)
+	err := mkdirValidate(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &APITokenRepo{path: filepath.Join(dir, "tokens.json"), tokens: make(map[app.APITokenID]app.APIToken)}
+	data, err := ReadFile(r.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading API tokens: %w", err)
+	}
+	err = Unmarshal(data, &r.tokens)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling API tokens: %w", err)
+	}
+	return r, nil
+}
+
+func (r *APITokenRepo) Save(_ context.Context, token app.APIToken) error {
+	if token.ID == "" {
+		return fmt.Errorf("API token ID cannot be empty")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev, existed := r.tokens[token.ID]
+	r.tokens[token.ID] = token
+	err := r.write()
+	if err != nil {
+		if existed {
+			r.tokens[token.ID] = prev
+		} else {
+			delete(r.tokens, token.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *APITokenRepo) Get(_ context.Context, id app.APITokenID) (app.APIToken, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	token, found := r.tokens[id]
+	return token, found, nil
+}
+
+func (r *APITokenRepo) ListByUser(_ context.Context, userID blinkfile.UserID) ([]app.APIToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var tokens []app.APIToken
+	for _, token := range r.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *APITokenRepo) Delete(_ context.Context, id app.APITokenID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, found := r.tokens[id]
+	if !found {
+		return nil
+	}
+	delete(r.tokens, id)
+	err := r.write()
+	if err != nil {
+		r.tokens[id] = token
+		return err
+	}
+	return nil
+}
+
+func (r *APITokenRepo) DeleteAllUserTokens(_ context.Context, userID blinkfile.UserID) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deleted := make(map[app.APITokenID]app.APIToken)
+	for id, token := range r.tokens {
+		if token.UserID == userID {
+			deleted[id] = token
+			delete(r.tokens, id)
+		}
+	}
+	if len(deleted) == 0 {
+		return 0, nil
+	}
+	err := r.write()
+	if err != nil {
+		maps.Copy(r.tokens, deleted)
+		return 0, err
+	}
+	return len(deleted), nil
+}
+
+func (r *APITokenRepo) Touch(_ context.Context, id app.APITokenID, lastUsed time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, found := r.tokens[id]
+	if !found {
+		return nil
+	}
+	prev := token
+	token.LastUsed = lastUsed
+	r.tokens[id] = token
+	err := r.write()
+	if err != nil {
+		r.tokens[id] = prev
+		return err
+	}
+	return nil
+}
+
+// write must be called with the lock held.
+func (r *APITokenRepo) write() error {
+	data, err := Marshal(r.tokens)
+	if err != nil {
+		return fmt.Errorf("marshaling API tokens: %w", err)
+	}
+	err = WriteFile(r.path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("writing API tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package repo_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/app/repo"
+)
+
+func TestAPITokenRepo(t *testing.T) {
+	const dir = "./_test/repo_api_token/test"
+	ctx := context.Background()
+	cleanDir(t, dir)
+	defer cleanDir(t, dir)
+	r, err := repo.NewAPITokenRepo(ctx, repo.APITokenRepoConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token1 := app.APIToken{ID: "token1", UserID: "user1", Name: "backup", Hash: "hash1", Scopes: []app.APITokenScope{app.APIScopeUpload}, Expires: time.Unix(1000, 0).UTC(), Created: time.Unix(100, 0).UTC(), LastUsed: time.Unix(150, 0).UTC()}
+	token2 := app.APIToken{ID: "token2", UserID: "user2", Name: "ci", Hash: "hash2", Created: time.Unix(200, 0).UTC()}
+	for _, token := range []app.APIToken{token1, token2} {
+		if err = r.Save(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err = repo.NewAPITokenRepo(ctx, repo.APITokenRepoConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, found, err := r.Get(ctx, "token1")
+	if err != nil || !found || !reflect.DeepEqual(got, token1) {
+		t.Errorf("Get() after reloading = %+v, %v, %v, want %+v", got, found, err, token1)
+	}
+	list, err := r.ListByUser(ctx, "user2")
+	if err != nil || !reflect.DeepEqual(list, []app.APIToken{token2}) {
+		t.Errorf("ListByUser() = %+v, %v, want %+v", list, err, []app.APIToken{token2})
+	}
+
+	lastUsed := time.Unix(300, 0).UTC()
+	if err = r.Touch(ctx, "token2", lastUsed); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ = r.Get(ctx, "token2"); !got.LastUsed.Equal(lastUsed) {
+		t.Errorf("Get() after Touch() LastUsed = %v, want %v", got.LastUsed, lastUsed)
+	}
+	if err = r.Touch(ctx, "unknown", lastUsed); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ = r.Get(ctx, "unknown"); found {
+		t.Errorf("Get() after Touch() of an unknown token found = true, want false")
+	}
+
+	prev := repo.WriteFile
+	repo.WriteFile = func(string, []byte, os.FileMode) error {
+		return fmt.Errorf("write err")
+	}
+	err = r.Delete(ctx, "token1")
+	repo.WriteFile = prev
+	if want := fmt.Errorf("writing API tokens: %w", fmt.Errorf("write err")); !reflect.DeepEqual(err, want) {
+		t.Errorf("Delete() error = %v, want %v", err, want)
+	}
+	if _, found, _ = r.Get(ctx, "token1"); !found {
+		t.Errorf("Get() after failed Delete() found = false, want true")
+	}
+
+	if err = r.Delete(ctx, "token1"); err != nil {
+		t.Fatal(err)
+	}
+	r, err = repo.NewAPITokenRepo(ctx, repo.APITokenRepoConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ = r.Get(ctx, "token1"); found {
+		t.Errorf("Get() after Delete() found = true, want false")
+	}
+
+	count, err := r.DeleteAllUserTokens(ctx, "user2")
+	if err != nil || count != 1 {
+		t.Errorf("DeleteAllUserTokens() = %d, %v, want 1", count, err)
+	}
+	if _, found, _ = r.Get(ctx, "token2"); found {
+		t.Errorf("Get() after DeleteAllUserTokens() found = true, want false")
+	}
+}
@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+
+	"github.com/benjohns1/blinkfile/app"
+)
+
+type (
+	AuditRepoConfig struct {
+		Log
+		Dir string
+	}
+
+	// AuditRepo appends audit records to a file as JSON lines.
+	AuditRepo struct {
+		mu   sync.Mutex
+		path string
+		Log
+	}
+)
+
+func NewAuditRepo(_ context.Context, cfg AuditRepoConfig) (*AuditRepo, error) {
+	dir := filepath.Clean(cfg.Dir)
+	err := mkdirValidate(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditRepo{path: filepath.Join(dir, "audit.jsonl"), Log: cfg.Log}, nil
+}
+
+func (r *AuditRepo) Record(_ context.Context, record app.AuditRecord) error {
+	data, err := Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshaling audit record: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := AppendFile(r.path)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing audit record: %w", err)
+	}
+	return nil
+}
+
+func (r *AuditRepo) List(ctx context.Context, limit int) ([]app.AuditRecord, error) {
+	r.mu.Lock()
+	data, err := ReadFile(r.path)
+	r.mu.Unlock()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading audit log: %w", err)
+	}
+	var records []app.AuditRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		var record app.AuditRecord
+		err = Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			r.Errorf(ctx, "Loading audit record on line %d: %v", line, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	if len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
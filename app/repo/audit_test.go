@@ -0,0 +1,127 @@
+package repo_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/app/repo"
+)
+
+func TestAuditRepo_Record(t *testing.T) {
+	const dir = "./_test/repo_audit/record_test"
+	tests := []struct {
+		name    string
+		patch   func(*testing.T) func()
+		wantErr error
+	}{
+		{
+			name: "should fail if the audit log can't be opened",
+			patch: func(_ *testing.T) func() {
+				prev := repo.AppendFile
+				repo.AppendFile = func(string) (io.WriteCloser, error) {
+					return nil, fmt.Errorf("open err")
+				}
+				return func() { repo.AppendFile = prev }
+			},
+			wantErr: fmt.Errorf("opening audit log: %w", fmt.Errorf("open err")),
+		},
+		{
+			name: "should record to the audit log",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanDir(t, dir)
+			defer cleanDir(t, dir)
+			r, err := repo.NewAuditRepo(context.Background(), repo.AuditRepoConfig{Dir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.patch != nil {
+				defer tt.patch(t)()
+			}
+			err = r.Record(context.Background(), app.AuditRecord{Action: app.AuditPolicyChanged})
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Record() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuditRepo_List(t *testing.T) {
+	const dir = "./_test/repo_audit/list_test"
+	record := func(n int) app.AuditRecord {
+		return app.AuditRecord{
+			Time:   time.Unix(int64(n), 0).UTC(),
+			Action: app.AuditUploadRejected,
+			UserID: "user1",
+			Detail: fmt.Sprintf("record %d", n),
+		}
+	}
+	tests := []struct {
+		name        string
+		records     []app.AuditRecord
+		raw         string
+		limit       int
+		want        []app.AuditRecord
+		wantErrLogs []string
+	}{
+		{
+			name:  "should return nothing without an audit log",
+			limit: 10,
+		},
+		{
+			name:    "should return the most recent records first, up to the limit",
+			records: []app.AuditRecord{record(1), record(2), record(3)},
+			limit:   2,
+			want:    []app.AuditRecord{record(3), record(2)},
+		},
+		{
+			name:        "should skip and log invalid records",
+			raw:         "not json\n",
+			records:     []app.AuditRecord{record(1)},
+			limit:       10,
+			want:        []app.AuditRecord{record(1)},
+			wantErrLogs: []string{"Loading audit record on line 1: invalid character 'o' in literal null (expecting 'u')"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanDir(t, dir)
+			defer cleanDir(t, dir)
+			log := &spyLog{}
+			r, err := repo.NewAuditRepo(context.Background(), repo.AuditRepoConfig{Log: log, Dir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.raw != "" {
+				err = os.WriteFile(filepath.Join(dir, "audit.jsonl"), []byte(tt.raw), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, rec := range tt.records {
+				if err = r.Record(context.Background(), rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := r.List(context.Background(), tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List() got = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(log.errors, tt.wantErrLogs) {
+				t.Errorf("List() error logs = %v, want %v", log.errors, tt.wantErrLogs)
+			}
+		})
+	}
+}
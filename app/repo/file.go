@@ -2,8 +2,12 @@ package repo
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/fs"
+	"net/netip"
 	"path/filepath"
 	"sort"
 	"sync"
@@ -17,6 +21,11 @@ type (
 	FileRepoConfig struct {
 		Log
 		Dir string
+		// Shred overwrites file data before it is deleted.
+		Shred bool
+		// MaxAccessLogSize limits the size of each file's access log in bytes, the oldest records are dropped once it's
+		// reached. Defaults to DefaultMaxAccessLogSize.
+		MaxAccessLogSize int64
 	}
 
 	FileRepo struct {
@@ -24,20 +33,44 @@ type (
 		dir        string
 		ownerIndex map[blinkfile.UserID]map[blinkfile.FileID]fileHeader
 		idIndex    map[blinkfile.FileID]fileHeader
+		shred      bool
 		Log
+		maxAccessLogSize int64
 	}
 
 	fileHeader struct {
-		ID            blinkfile.FileID
-		Name          string
-		Location      string
-		Owner         blinkfile.UserID
-		Created       time.Time
-		Expires       time.Time
-		Downloads     int64
-		DownloadLimit int64
-		Size          int64
-		PasswordHash  string
+		ID                     blinkfile.FileID
+		Name                   string
+		Location               string
+		Owner                  blinkfile.UserID
+		Created                time.Time
+		Expires                time.Time
+		Downloads              int64
+		DownloadLimit          int64
+		Size                   int64
+		PasswordHash           string
+		ContentType            string
+		AllowPreview           bool
+		ThumbnailLocation      string
+		ShowThumbnail          bool
+		Checksum               string
+		MetadataStripped       bool
+		Quarantined            bool
+		QuarantineReason       string
+		ScanStatus             blinkfile.ScanStatus
+		ScanSignature          string
+		Scanned                time.Time
+		Trashed                time.Time
+		LastDownloaded         time.Time
+		AvailableFrom          time.Time
+		InactivityExpiry       time.Duration
+		LegalHold              bool
+		DownloadRateLimit      int64
+		FailedPasswordAttempts int64
+		LastFailedPassword     time.Time
+		AllowedNetworks        []netip.Prefix
+		RecipientEmails        []string
+		Terms                  string
 	}
 
 	Log interface {
@@ -47,6 +80,9 @@ type (
 
 func NewFileRepo(ctx context.Context, cfg FileRepoConfig) (*FileRepo, error) {
 	dir := filepath.Clean(cfg.Dir)
+	if cfg.MaxAccessLogSize <= 0 {
+		cfg.MaxAccessLogSize = DefaultMaxAccessLogSize
+	}
 	err := mkdirValidate(dir)
 	if err != nil {
 		return nil, err
@@ -56,7 +92,9 @@ func NewFileRepo(ctx context.Context, cfg FileRepoConfig) (*FileRepo, error) {
 		dir,
 		make(map[blinkfile.UserID]map[blinkfile.FileID]fileHeader),
 		make(map[blinkfile.FileID]fileHeader),
+		cfg.Shred,
 		cfg.Log,
+		cfg.MaxAccessLogSize,
 	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -138,20 +176,24 @@ func (r *FileRepo) Save(ctx context.Context, file blinkfile.File) error {
 		return fmt.Errorf("making directory %q: %w", dir, err)
 	}
 
-	err = writeHeaderFile(ctx, headerFilename, header)
-	if err != nil {
-		return err
-	}
-
 	target, err := CreateFile(filename)
 	if err != nil {
 		return fmt.Errorf("creating file %q: %w", filename, err)
 	}
 	defer func() { _ = target.Close() }()
-	_, err = Copy(target, file.Data)
+	checksum := sha256.New()
+	size, err := Copy(io.MultiWriter(target, checksum), file.Data)
 	if err != nil {
 		return fmt.Errorf("writing file %q: %w", filename, err)
 	}
+	// Record what was actually stored, which can differ from the upload if it was modified before saving
+	header.Size = size
+	header.Checksum = hex.EncodeToString(checksum.Sum(nil))
+
+	err = writeHeaderFile(ctx, headerFilename, header)
+	if err != nil {
+		return err
+	}
 	r.addToIndices(header)
 
 	return nil
@@ -176,8 +218,39 @@ func (r *FileRepo) PutHeader(ctx context.Context, putHeader blinkfile.FileHeader
 	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	return r.putHeader(ctx, fileHeader(putHeader))
+}
 
-	header := fileHeader(putHeader)
+// UpdateHeader changes the file's header with the update function while holding the lock, so changes made at the same
+// time by other requests aren't lost. Nothing is saved if the update returns an error.
+func (r *FileRepo) UpdateHeader(ctx context.Context, fileID blinkfile.FileID, update func(*blinkfile.FileHeader) error) (blinkfile.FileHeader, error) {
+	if fileID == "" {
+		return blinkfile.FileHeader{}, fmt.Errorf("file ID cannot be empty")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, found := r.idIndex[fileID]
+	if !found {
+		return blinkfile.FileHeader{}, app.ErrFileNotFound
+	}
+	header := blinkfile.FileHeader(previous)
+	if header.Location == "" {
+		_, header.Location, _ = r.filenames(header.ID)
+	}
+	err := update(&header)
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	header.ID = fileID
+	err = r.putHeader(ctx, fileHeader(header))
+	if err != nil {
+		return blinkfile.FileHeader{}, err
+	}
+	return header, nil
+}
+
+// putHeader must be called with the lock held.
+func (r *FileRepo) putHeader(ctx context.Context, header fileHeader) error {
 	previous, found := r.idIndex[header.ID]
 	if !found {
 		return app.ErrFileNotFound
@@ -185,6 +258,7 @@ func (r *FileRepo) PutHeader(ctx context.Context, putHeader blinkfile.FileHeader
 
 	_, _, headerFilename := r.filenames(header.ID)
 	header.Location = previous.Location
+	header.ThumbnailLocation = previous.ThumbnailLocation
 
 	err := writeHeaderFile(ctx, headerFilename, header)
 	if err != nil {
@@ -195,9 +269,62 @@ func (r *FileRepo) PutHeader(ctx context.Context, putHeader blinkfile.FileHeader
 	return nil
 }
 
-func (r *FileRepo) filteredDelete(_ context.Context, filter func(fileHeader) bool) (int, error) {
+// Open returns a reader for the stored file data.
+func (r *FileRepo) Open(_ context.Context, fileID blinkfile.FileID) (io.ReadCloser, error) {
+	if fileID == "" {
+		return nil, fmt.Errorf("file ID cannot be empty")
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, found := r.idIndex[fileID]; !found {
+		return nil, app.ErrFileNotFound
+	}
+	_, filename, _ := r.filenames(fileID)
+	f, err := OpenFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("opening file %q: %w", filename, err)
+	}
+	return f, nil
+}
+
+// SaveThumbnail stores a thumbnail image next to the file data, so it is deleted along with the file.
+func (r *FileRepo) SaveThumbnail(ctx context.Context, fileID blinkfile.FileID, data io.Reader) error {
+	if fileID == "" {
+		return fmt.Errorf("file ID cannot be empty")
+	}
+	if data == nil {
+		return fmt.Errorf("thumbnail data cannot be nil")
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	header, found := r.idIndex[fileID]
+	if !found {
+		return app.ErrFileNotFound
+	}
+	dir, _, headerFilename := r.filenames(fileID)
+	filename := filepath.Join(dir, "thumbnail.jpg")
+	target, err := CreateFile(filename)
+	if err != nil {
+		return fmt.Errorf("creating thumbnail %q: %w", filename, err)
+	}
+	defer func() { _ = target.Close() }()
+	_, err = Copy(target, data)
+	if err != nil {
+		return fmt.Errorf("writing thumbnail %q: %w", filename, err)
+	}
+	header.ThumbnailLocation = filename
+	err = writeHeaderFile(ctx, headerFilename, header)
+	if err != nil {
+		return err
+	}
+	r.addToIndices(header)
+	return nil
+}
+
+// filteredDelete only holds the read lock while finding the files to delete, then re-checks each file while holding the
+// write lock for just its own deletion, so uploads and downloads aren't blocked by a scan of every file.
+func (r *FileRepo) filteredDelete(_ context.Context, filter func(fileHeader) bool) (int, error) {
+	r.mu.RLock()
 	var deleteList []blinkfile.FileHeader
 	for _, header := range r.idIndex {
 		if !filter(header) {
@@ -205,24 +332,44 @@ func (r *FileRepo) filteredDelete(_ context.Context, filter func(fileHeader) boo
 		}
 		deleteList = append(deleteList, blinkfile.FileHeader(header))
 	}
+	r.mu.RUnlock()
 	var count int
 	for _, header := range sortFiles(deleteList) {
-		err := r.deleteFile(header)
+		deleted, err := r.deleteIf(header.ID, filter)
 		if err != nil {
 			return count, err
 		}
-		count++
+		if deleted {
+			count++
+		}
 	}
 	return count, nil
 }
 
+func (r *FileRepo) deleteIf(fileID blinkfile.FileID, filter func(fileHeader) bool) (bool, error) {
+	r.mu.Lock()
+	header, found := r.idIndex[fileID]
+	if !found || !filter(header) {
+		r.mu.Unlock()
+		return false, nil
+	}
+	r.removeFromIndices(blinkfile.FileHeader(header))
+	r.mu.Unlock()
+	return true, r.deleteFile(header)
+}
+
 func (r *FileRepo) DeleteExpiredBefore(ctx context.Context, t time.Time) (int, error) {
 	return r.filteredDelete(ctx, func(header fileHeader) bool {
-		if !header.Expires.IsZero() && !header.Expires.After(t) {
+		file := blinkfile.FileHeader(header)
+		if file.LegalHold {
+			return false
+		}
+
+		if file.IsExpired(t) {
 			return true
 		}
 
-		if header.DownloadLimit > 0 && header.Downloads >= header.DownloadLimit {
+		if file.DownloadLimitReached() {
 			return true
 		}
 
@@ -255,6 +402,16 @@ func (r *FileRepo) ListByUser(_ context.Context, userID blinkfile.UserID) ([]bli
 	return sortFiles(out), nil
 }
 
+func (r *FileRepo) ListAll(_ context.Context) ([]blinkfile.FileHeader, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]blinkfile.FileHeader, 0, len(r.idIndex))
+	for _, header := range r.idIndex {
+		out = append(out, blinkfile.FileHeader(header))
+	}
+	return sortFiles(out), nil
+}
+
 func (r *FileRepo) Get(_ context.Context, fileID blinkfile.FileID) (blinkfile.FileHeader, error) {
 	if fileID == "" {
 		return blinkfile.FileHeader{}, fmt.Errorf("file ID cannot be empty")
@@ -279,36 +436,59 @@ func (r *FileRepo) Delete(_ context.Context, owner blinkfile.UserID, deleteFiles
 		return nil
 	}
 	r.mu.Lock()
-	defer r.mu.Unlock()
 	ownedFiles := r.ownerIndex[owner]
 
-	toRemove := make([]blinkfile.FileHeader, 0, len(deleteFiles))
+	toRemove := make([]fileHeader, 0, len(deleteFiles))
 	for _, fileID := range deleteFiles {
 		header, exists := ownedFiles[fileID]
 		if !exists {
+			r.mu.Unlock()
 			return fmt.Errorf("file %q not found to delete by user %q", fileID, owner)
 		}
-		toRemove = append(toRemove, blinkfile.FileHeader(header))
+		toRemove = append(toRemove, header)
+	}
+	for _, header := range toRemove {
+		r.removeFromIndices(blinkfile.FileHeader(header))
 	}
+	r.mu.Unlock()
 
-	var count int
-	for _, file := range toRemove {
-		err := r.deleteFile(file)
+	for i, header := range toRemove {
+		err := r.deleteFile(header)
 		if err != nil {
-			return fmt.Errorf("successfully deleted the first %d file(s) but failed deleting file %q: %w", count, file.ID, err)
+			r.restoreToIndices(toRemove[i+1:])
+			return fmt.Errorf("successfully deleted the first %d file(s) but failed deleting file %q: %w", i, header.ID, err)
 		}
-		count++
 	}
 	return nil
 }
 
-func (r *FileRepo) deleteFile(file blinkfile.FileHeader) error {
-	dir, _, _ := r.filenames(file.ID)
-	if err := RemoveAll(dir); err != nil {
-		return err
+// deleteFile removes the data of a file that has already been removed from the indices. It's called without the lock,
+// since shredding a large file can take a while and would hold up every other file operation. If removing the data
+// fails, the file is added back to the indices so deleting it can be retried.
+func (r *FileRepo) deleteFile(header fileHeader) error {
+	dir, _, _ := r.filenames(header.ID)
+	err := r.removeDir(dir)
+	if err != nil {
+		r.restoreToIndices([]fileHeader{header})
+	}
+	return err
+}
+
+func (r *FileRepo) removeDir(dir string) error {
+	if r.shred {
+		if err := shredDir(dir); err != nil {
+			return err
+		}
+	}
+	return RemoveAll(dir)
+}
+
+func (r *FileRepo) restoreToIndices(headers []fileHeader) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, header := range headers {
+		r.addToIndices(header)
 	}
-	r.removeFromIndices(file)
-	return nil
 }
 
 func (r *FileRepo) filenames(fileID blinkfile.FileID) (dir, file, header string) {
@@ -187,6 +187,7 @@ func TestFileRepo_Save(t *testing.T) {
 		patch   func(*testing.T) func()
 		args    args
 		wantErr error
+		assert  func(*testing.T, *repo.FileRepo)
 	}{
 		{
 			name: "should fail if the file ID is empty",
@@ -353,6 +354,28 @@ func TestFileRepo_Save(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name: "should record the stored size and checksum",
+			args: args{
+				file: blinkfile.File{
+					FileHeader: blinkfile.FileHeader{
+						ID:    "file1",
+						Owner: "user1",
+						Size:  1000,
+					},
+					Data: io.NopCloser(strings.NewReader("file-data")),
+				},
+			},
+			assert: func(t *testing.T, r *repo.FileRepo) {
+				got, err := r.Get(context.Background(), "file1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Size != int64(len("file-data")) || got.Checksum != fileDataChecksum {
+					t.Errorf("After Save(), Get() size = %d, checksum = %q, want %d, %q", got.Size, got.Checksum, len("file-data"), fileDataChecksum)
+				}
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -367,6 +390,9 @@ func TestFileRepo_Save(t *testing.T) {
 			if !reflect.DeepEqual(err, tt.wantErr) {
 				t.Errorf("Save() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if tt.assert != nil {
+				tt.assert(t, tt.r)
+			}
 		})
 	}
 }
@@ -495,6 +521,59 @@ func TestFileRepo_PutHeader(t *testing.T) {
 	}
 }
 
+func TestFileRepo_UpdateHeader(t *testing.T) {
+	ctx := context.Background()
+	r := newTestFileRepo(t, "updateFileHeader")
+	err := r.Save(ctx, blinkfile.File{
+		FileHeader: blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+		Data:       io.NopCloser(strings.NewReader("file-data")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.UpdateHeader(ctx, "not-in-repo", func(*blinkfile.FileHeader) error { return nil })
+	if !reflect.DeepEqual(err, app.ErrFileNotFound) {
+		t.Errorf("UpdateHeader() of a missing file error = %v, want %v", err, app.ErrFileNotFound)
+	}
+
+	updateErr := fmt.Errorf("update err")
+	_, err = r.UpdateHeader(ctx, "file1", func(header *blinkfile.FileHeader) error {
+		header.Name = "not-saved"
+		return updateErr
+	})
+	if !reflect.DeepEqual(err, updateErr) {
+		t.Errorf("UpdateHeader() error = %v, want %v", err, updateErr)
+	}
+
+	const updates = 20
+	var wg sync.WaitGroup
+	for range updates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, updateErr := r.UpdateHeader(ctx, "file1", func(header *blinkfile.FileHeader) error {
+				header.Downloads++
+				return nil
+			})
+			if updateErr != nil {
+				t.Error(updateErr)
+			}
+		}()
+	}
+	wg.Wait()
+	got, err := r.Get(ctx, "file1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Downloads != updates || got.Name != "" {
+		t.Errorf("After concurrent UpdateHeader() Get() = %+v, want %d downloads and no name", got, updates)
+	}
+}
+
+// fileDataChecksum is the SHA-256 checksum of "file-data"
+const fileDataChecksum = "8e6537b695ff181bc341e32d8b8970485ac3513408e5eb1e8ba9fc5af1cd3f57"
+
 func newTestFileRepo(t *testing.T, dir string) *repo.FileRepo {
 	r, err := repo.NewFileRepo(context.Background(), repo.FileRepoConfig{Dir: newFileDir(t, dir), Log: &spyLog{}})
 	if err != nil {
@@ -563,12 +642,16 @@ func TestFileRepo_DeleteExpiredBefore(t *testing.T) {
 					{
 						ID:       "file1",
 						Location: filepath.Clean("_test/repo_file/deleteExpiredBefore_noExpiration/file1/file"),
+						Size:     int64(len("file-data")),
+						Checksum: fileDataChecksum,
 						Owner:    "user1",
 						Expires:  time.Time{},
 					},
 					{
 						ID:       "file2",
 						Location: filepath.Clean("_test/repo_file/deleteExpiredBefore_noExpiration/file2/file"),
+						Size:     int64(len("file-data")),
+						Checksum: fileDataChecksum,
 						Owner:    "user1",
 						Expires:  time.Unix(1, 1),
 					},
@@ -629,6 +712,8 @@ func TestFileRepo_DeleteExpiredBefore(t *testing.T) {
 					{
 						ID:       "file2",
 						Location: filepath.Clean("_test/repo_file/deleteExpiredBefore_deleteFailure/file2/file"),
+						Size:     int64(len("file-data")),
+						Checksum: fileDataChecksum,
 						Owner:    "user1",
 						Expires:  time.Unix(1, 0),
 					},
@@ -722,6 +807,113 @@ func TestFileRepo_DeleteExpiredBefore(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "should delete all files that have not been downloaded within their inactivity expiry",
+			r: func() *repo.FileRepo {
+				r := newTestFileRepo(t, "deleteInactive_success")
+				fatalOnErr(t,
+					r.Save(ctx, blinkfile.File{
+						FileHeader: blinkfile.FileHeader{
+							ID:               "never-downloaded",
+							Owner:            "user1",
+							Created:          time.Unix(0, 0),
+							InactivityExpiry: time.Second,
+						},
+						Data: io.NopCloser(strings.NewReader("file-data")),
+					}),
+					r.Save(ctx, blinkfile.File{
+						FileHeader: blinkfile.FileHeader{
+							ID:               "downloaded-long-ago",
+							Owner:            "user1",
+							Created:          time.Unix(0, 0),
+							LastDownloaded:   time.Unix(1, 0),
+							InactivityExpiry: time.Second,
+						},
+						Data: io.NopCloser(strings.NewReader("file-data")),
+					}),
+					r.Save(ctx, blinkfile.File{
+						FileHeader: blinkfile.FileHeader{
+							ID:               "downloaded-recently",
+							Owner:            "user1",
+							Created:          time.Unix(0, 0),
+							LastDownloaded:   time.Unix(2, 0),
+							InactivityExpiry: time.Second,
+						},
+						Data: io.NopCloser(strings.NewReader("file-data")),
+					}),
+				)
+				return r
+			}(),
+			args: args{
+				t: time.Unix(2, 0),
+			},
+			want: 2,
+			assert: func(t *testing.T, r *repo.FileRepo) {
+				want := []blinkfile.FileHeader{
+					{
+						ID:               "downloaded-recently",
+						Location:         filepath.Clean("_test/repo_file/deleteInactive_success/downloaded-recently/file"),
+						Size:             int64(len("file-data")),
+						Checksum:         fileDataChecksum,
+						Owner:            "user1",
+						Created:          time.Unix(0, 0),
+						LastDownloaded:   time.Unix(2, 0),
+						InactivityExpiry: time.Second,
+					},
+				}
+
+				got, err := r.ListByUser(ctx, "user1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("After DeleteExpiredBefore(), ListByUser() for user1 got: \n\t%+v\nwant: \n\t%+v", got, want)
+				}
+			},
+		},
+		{
+			name: "should not delete files on legal hold",
+			r: func() *repo.FileRepo {
+				r := newTestFileRepo(t, "deleteHeld_success")
+				fatalOnErr(t,
+					r.Save(ctx, blinkfile.File{
+						FileHeader: blinkfile.FileHeader{
+							ID:        "expired-held",
+							Owner:     "user1",
+							Created:   time.Unix(0, 0),
+							Expires:   time.Unix(1, 0),
+							LegalHold: true,
+						},
+						Data: io.NopCloser(strings.NewReader("file-data")),
+					}),
+					r.Save(ctx, blinkfile.File{
+						FileHeader: blinkfile.FileHeader{
+							ID:            "download-limit-reached-held",
+							Owner:         "user1",
+							Created:       time.Unix(1, 0),
+							Downloads:     1,
+							DownloadLimit: 1,
+							LegalHold:     true,
+						},
+						Data: io.NopCloser(strings.NewReader("file-data")),
+					}),
+				)
+				return r
+			}(),
+			args: args{
+				t: time.Unix(2, 0),
+			},
+			want: 0,
+			assert: func(t *testing.T, r *repo.FileRepo) {
+				got, err := r.ListByUser(ctx, "user1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != 2 {
+					t.Errorf("After DeleteExpiredBefore(), ListByUser() for user1 got %d files, want 2", len(got))
+				}
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -793,6 +985,8 @@ func TestFileRepo_Get(t *testing.T) {
 				ID:       "file1",
 				Owner:    "user1",
 				Location: filepath.Clean(`_test/repo_file/get_withLocation/file1/file`),
+				Size:     int64(len("file-data")),
+				Checksum: fileDataChecksum,
 			},
 		},
 	}
@@ -867,6 +1061,8 @@ func TestFileRepo_Delete(t *testing.T) {
 					ID:       "file1",
 					Owner:    "user1",
 					Location: filepath.Clean(`_test/repo_file/delete_failWithoutDelete/file1/file`),
+					Size:     int64(len("file-data")),
+					Checksum: fileDataChecksum,
 				}
 				got, _ := r.Get(ctx, "file1")
 				if !reflect.DeepEqual(got, want) {
@@ -918,6 +1114,8 @@ func TestFileRepo_Delete(t *testing.T) {
 					ID:       "file2",
 					Owner:    "user1",
 					Location: filepath.Clean(`_test/repo_file/delete_partialFailure/file2/file`),
+					Size:     int64(len("file-data")),
+					Checksum: fileDataChecksum,
 				}}
 				got, _ := r.ListByUser(ctx, "user1")
 				if !reflect.DeepEqual(got, want) {
@@ -946,3 +1144,221 @@ func TestFileRepo_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestFileRepo_SaveThumbnail(t *testing.T) {
+	ctx := context.Background()
+	saveFile := func(r *repo.FileRepo) *repo.FileRepo {
+		err := r.Save(ctx, blinkfile.File{
+			FileHeader: blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+			Data:       io.NopCloser(strings.NewReader("file-data")),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	type args struct {
+		fileID blinkfile.FileID
+		data   io.Reader
+	}
+	tests := []struct {
+		name     string
+		r        *repo.FileRepo
+		patch    func(*testing.T) func()
+		args     args
+		wantErr  error
+		wantData string
+	}{
+		{
+			name:    "should fail if the file ID is empty",
+			args:    args{fileID: ""},
+			wantErr: fmt.Errorf("file ID cannot be empty"),
+		},
+		{
+			name:    "should fail if the thumbnail data is nil",
+			args:    args{fileID: "file1"},
+			wantErr: fmt.Errorf("thumbnail data cannot be nil"),
+		},
+		{
+			name:    "should fail if the file is not found",
+			args:    args{fileID: "file1", data: strings.NewReader("thumbnail-data")},
+			wantErr: app.ErrFileNotFound,
+		},
+		{
+			name: "should fail if writing the thumbnail fails",
+			r:    saveFile(newTestFileRepo(t, "thumbnailCopyFail")),
+			patch: func(_ *testing.T) func() {
+				prev := repo.Copy
+				repo.Copy = func(io.Writer, io.Reader) (int64, error) {
+					return 0, fmt.Errorf("copy err")
+				}
+				return func() { repo.Copy = prev }
+			},
+			args:    args{fileID: "file1", data: strings.NewReader("thumbnail-data")},
+			wantErr: fmt.Errorf("writing thumbnail %q: %w", filepath.Clean("_test/repo_file/thumbnailCopyFail/file1/thumbnail.jpg"), fmt.Errorf("copy err")),
+		},
+		{
+			name:     "should save a thumbnail and keep it when the header is updated",
+			r:        saveFile(newTestFileRepo(t, "thumbnail")),
+			args:     args{fileID: "file1", data: strings.NewReader("thumbnail-data")},
+			wantData: "thumbnail-data",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.patch != nil {
+				defer tt.patch(t)()
+			}
+			if tt.r == nil {
+				tt.r = newTestFileRepo(t, "")
+			}
+			defer cleanDir(t, tt.r.Dir())
+			err := tt.r.SaveThumbnail(ctx, tt.args.fileID, tt.args.data)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("SaveThumbnail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			fatalOnErr(t, tt.r.PutHeader(ctx, blinkfile.FileHeader{ID: tt.args.fileID, Owner: "user1", Downloads: 1}))
+			got, err := tt.r.Get(ctx, tt.args.fileID)
+			fatalOnErr(t, err)
+			data, err := os.ReadFile(got.ThumbnailLocation)
+			fatalOnErr(t, err)
+			if string(data) != tt.wantData {
+				t.Errorf("SaveThumbnail() saved %q, want %q", data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestFileRepo_Open(t *testing.T) {
+	ctx := context.Background()
+	r := newTestFileRepo(t, "")
+	defer cleanDir(t, r.Dir())
+	_, err := r.Open(ctx, "")
+	if !reflect.DeepEqual(err, fmt.Errorf("file ID cannot be empty")) {
+		t.Errorf("Open() with empty ID error = %v", err)
+	}
+	_, err = r.Open(ctx, "file1")
+	if !reflect.DeepEqual(err, app.ErrFileNotFound) {
+		t.Errorf("Open() before saving error = %v, want %v", err, app.ErrFileNotFound)
+	}
+	fatalOnErr(t, r.Save(ctx, blinkfile.File{
+		FileHeader: blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+		Data:       io.NopCloser(strings.NewReader("file-data")),
+	}))
+	f, err := r.Open(ctx, "file1")
+	fatalOnErr(t, err)
+	defer func() { _ = f.Close() }()
+	data, err := io.ReadAll(f)
+	fatalOnErr(t, err)
+	if string(data) != "file-data" {
+		t.Errorf("Open() read %q, want %q", data, "file-data")
+	}
+}
+
+func TestFileRepo_Delete_Shred(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		patch    func(*testing.T) func()
+		wantErr  error
+		wantData func(*testing.T, []byte)
+	}{
+		{
+			name: "should fail without deleting the file if it can't be shredded",
+			patch: func(_ *testing.T) func() {
+				prev := repo.OpenForWrite
+				repo.OpenForWrite = func(string) (*os.File, error) {
+					return nil, fmt.Errorf("open err")
+				}
+				return func() { repo.OpenForWrite = prev }
+			},
+			wantErr: fmt.Errorf(`successfully deleted the first %d file(s) but failed deleting file "file1": %w`, 0,
+				fmt.Errorf("opening %q to shred: %w", filepath.Clean("_test/repo_file/delete_shredFailure/file1/file"), fmt.Errorf("open err"))),
+			wantData: func(t *testing.T, data []byte) {
+				if string(data) != "file-data" {
+					t.Errorf("After Delete(), file data = %q, want %q", data, "file-data")
+				}
+			},
+		},
+		{
+			name: "should overwrite the file data before deleting it",
+			wantData: func(t *testing.T, data []byte) {
+				if len(data) != len("file-data") || string(data) == "file-data" {
+					t.Errorf("After Delete(), file data = %q, want it overwritten", data)
+				}
+			},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newFileDir(t, []string{"delete_shredFailure", "delete_shred"}[i])
+			r, err := repo.NewFileRepo(ctx, repo.FileRepoConfig{Dir: dir, Log: &spyLog{}, Shred: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanDir(t, r.Dir())
+			fatalOnErr(t, r.Save(ctx, blinkfile.File{
+				FileHeader: blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+				Data:       io.NopCloser(strings.NewReader("file-data")),
+			}))
+			// Keep the data readable after it is unlinked
+			f, err := os.Open(filepath.Join(dir, "file1", "file"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = f.Close() }()
+			if tt.patch != nil {
+				defer tt.patch(t)()
+			}
+			err = r.Delete(ctx, "user1", []blinkfile.FileID{"file1"})
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Delete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			data, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.wantData(t, data)
+		})
+	}
+}
+
+func TestFileRepo_Delete_ShredUnlocked(t *testing.T) {
+	ctx := context.Background()
+	dir := newFileDir(t, "delete_shredUnlocked")
+	r, err := repo.NewFileRepo(ctx, repo.FileRepoConfig{Dir: dir, Log: &spyLog{}, Shred: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanDir(t, r.Dir())
+	fatalOnErr(t, r.Save(ctx, blinkfile.File{
+		FileHeader: blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+		Data:       io.NopCloser(strings.NewReader("file-data")),
+	}))
+	prev := repo.OpenForWrite
+	defer func() { repo.OpenForWrite = prev }()
+	var listed bool
+	repo.OpenForWrite = func(name string) (*os.File, error) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = r.ListByUser(ctx, "user1")
+		}()
+		select {
+		case <-done:
+			listed = true
+		case <-time.After(time.Second):
+		}
+		return prev(name)
+	}
+	err = r.Delete(ctx, "user1", []blinkfile.FileID{"file1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !listed {
+		t.Errorf("Delete() held the lock while shredding the file")
+	}
+}
@@ -8,16 +8,24 @@ import (
 )
 
 var (
-	RemoveFile = os.Remove
-	WriteFile  = os.WriteFile
-	ReadFile   = os.ReadFile
-	CreateFile = os.Create
-	MkdirAll   = os.MkdirAll
-	RemoveAll  = os.RemoveAll
-	Copy       = io.Copy
-	Lstat      = os.Lstat
-	Unmarshal  = json.Unmarshal
-	Marshal    = json.Marshal
+	RemoveFile   = os.Remove
+	WriteFile    = os.WriteFile
+	ReadFile     = os.ReadFile
+	CreateFile   = os.Create
+	OpenFile     = os.Open
+	MkdirAll     = os.MkdirAll
+	RemoveAll    = os.RemoveAll
+	Copy         = io.Copy
+	Lstat        = os.Lstat
+	Rename       = os.Rename
+	Unmarshal    = json.Unmarshal
+	Marshal      = json.Marshal
+	OpenForWrite = func(name string) (*os.File, error) {
+		return os.OpenFile(name, os.O_WRONLY, 0)
+	}
+	AppendFile = func(name string) (io.WriteCloser, error) {
+		return os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	}
 )
 
 const ModeDir = os.ModeDir
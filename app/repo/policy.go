@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+
+	"github.com/benjohns1/blinkfile/app"
+)
+
+type (
+	PolicyRepoConfig struct {
+		Dir string
+	}
+
+	PolicyRepo struct {
+		mu     sync.RWMutex
+		path   string
+		policy app.Policy
+	}
+)
+
+func NewPolicyRepo(_ context.Context, cfg PolicyRepoConfig) (*PolicyRepo, error) {
+	dir := filepath.Clean(cfg.Dir)
+	err := mkdirValidate(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &PolicyRepo{path: filepath.Join(dir, "policy.json")}
+	data, err := ReadFile(r.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading policy: %w", err)
+	}
+	err = Unmarshal(data, &r.policy)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling policy: %w", err)
+	}
+	return r, nil
+}
+
+func (r *PolicyRepo) Get(context.Context) (app.Policy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.policy, nil
+}
+
+func (r *PolicyRepo) Save(_ context.Context, policy app.Policy) error {
+	data, err := Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("marshaling policy: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = WriteFile(r.path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("writing policy: %w", err)
+	}
+	r.policy = policy
+	return nil
+}
@@ -0,0 +1,146 @@
+package repo_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/app/repo"
+)
+
+func TestNewPolicyRepo(t *testing.T) {
+	const dir = "./_test/repo_policy/new_test"
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T)
+		patch   func(*testing.T) func()
+		want    app.Policy
+		wantErr error
+	}{
+		{
+			name: "should fail if making directory fails",
+			patch: func(_ *testing.T) func() {
+				prev := repo.MkdirAll
+				repo.MkdirAll = func(string, os.FileMode) error {
+					return fmt.Errorf("mkdir err")
+				}
+				return func() { repo.MkdirAll = prev }
+			},
+			wantErr: fmt.Errorf(`making directory %q: %w`, filepath.Clean(dir), fmt.Errorf("mkdir err")),
+		},
+		{
+			name: "should fail if the policy can't be read",
+			patch: func(_ *testing.T) func() {
+				prev := repo.ReadFile
+				repo.ReadFile = func(string) ([]byte, error) {
+					return nil, fmt.Errorf("read err")
+				}
+				return func() { repo.ReadFile = prev }
+			},
+			wantErr: fmt.Errorf("reading policy: %w", fmt.Errorf("read err")),
+		},
+		{
+			name: "should start with an empty policy",
+		},
+		{
+			name: "should load a saved policy",
+			setup: func(t *testing.T) {
+				r, err := repo.NewPolicyRepo(context.Background(), repo.PolicyRepoConfig{Dir: dir})
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = r.Save(context.Background(), app.Policy{FileTypes: blinkfile.FileTypePolicy{Mode: blinkfile.FileTypeBlock, Extensions: []string{".exe"}}})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: app.Policy{FileTypes: blinkfile.FileTypePolicy{Mode: blinkfile.FileTypeBlock, Extensions: []string{".exe"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanDir(t, dir)
+			defer cleanDir(t, dir)
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+			if tt.patch != nil {
+				defer tt.patch(t)()
+			}
+			r, err := repo.NewPolicyRepo(context.Background(), repo.PolicyRepoConfig{Dir: dir})
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("NewPolicyRepo() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			got, err := r.Get(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyRepo_Save(t *testing.T) {
+	const dir = "./_test/repo_policy/save_test"
+	tests := []struct {
+		name    string
+		policy  app.Policy
+		patch   func(*testing.T) func()
+		want    app.Policy
+		wantErr error
+	}{
+		{
+			name:   "should fail if writing the policy fails and keep the previous policy",
+			policy: app.Policy{FileTypes: blinkfile.FileTypePolicy{Mode: blinkfile.FileTypeAllow}},
+			patch: func(_ *testing.T) func() {
+				prev := repo.WriteFile
+				repo.WriteFile = func(string, []byte, os.FileMode) error {
+					return fmt.Errorf("write err")
+				}
+				return func() { repo.WriteFile = prev }
+			},
+			wantErr: fmt.Errorf("writing policy: %w", fmt.Errorf("write err")),
+		},
+		{
+			name: "should save the policy",
+			policy: app.Policy{UserFileTypes: map[blinkfile.UserID]blinkfile.FileTypePolicy{
+				"user1": {Mode: blinkfile.FileTypeAllow, ContentTypes: []string{"image/*"}},
+			}},
+			want: app.Policy{UserFileTypes: map[blinkfile.UserID]blinkfile.FileTypePolicy{
+				"user1": {Mode: blinkfile.FileTypeAllow, ContentTypes: []string{"image/*"}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanDir(t, dir)
+			defer cleanDir(t, dir)
+			r, err := repo.NewPolicyRepo(context.Background(), repo.PolicyRepoConfig{Dir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.patch != nil {
+				defer tt.patch(t)()
+			}
+			err = r.Save(context.Background(), tt.policy)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Save() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, _ := r.Get(context.Background())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
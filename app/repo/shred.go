@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+)
+
+// shredDir overwrites the contents of every regular file in the directory with random data, so the data can't be
+// recovered from the disk after it is unlinked. It's best-effort on filesystems that don't overwrite in place, like
+// copy-on-write and journaled data filesystems.
+func shredDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return shredFile(path)
+	})
+}
+
+func shredFile(path string) error {
+	f, err := OpenForWrite(path)
+	if err != nil {
+		return fmt.Errorf("opening %q to shred: %w", path, err)
+	}
+	info, err := f.Stat()
+	if err == nil {
+		_, err = io.CopyN(f, rand.Reader, info.Size())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("shredding %q: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+func (r *FileRepo) statsFilename(fileID blinkfile.FileID) string {
+	dir, _, _ := r.filenames(fileID)
+	return filepath.Join(dir, "stats.json")
+}
+
+// AddDownloadStats adds the download to the file's stats rollup, which is stored next to the file data so it is deleted
+// along with the file.
+func (r *FileRepo) AddDownloadStats(_ context.Context, fileID blinkfile.FileID, event blinkfile.DownloadEvent) error {
+	if fileID == "" {
+		return fmt.Errorf("file ID cannot be empty")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, found := r.idIndex[fileID]; !found {
+		return app.ErrFileNotFound
+	}
+	stats, err := r.readStats(fileID)
+	if err != nil {
+		return err
+	}
+	stats.Add(event)
+	data, err := Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("marshaling download stats: %w", err)
+	}
+	err = WriteFile(r.statsFilename(fileID), data, 0644)
+	if err != nil {
+		return fmt.Errorf("writing download stats: %w", err)
+	}
+	return nil
+}
+
+// GetDownloadStats returns the file's stats rollup, which is empty if it was never downloaded.
+func (r *FileRepo) GetDownloadStats(_ context.Context, fileID blinkfile.FileID) (blinkfile.DownloadStats, error) {
+	if fileID == "" {
+		return blinkfile.DownloadStats{}, fmt.Errorf("file ID cannot be empty")
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, found := r.idIndex[fileID]; !found {
+		return blinkfile.DownloadStats{}, app.ErrFileNotFound
+	}
+	return r.readStats(fileID)
+}
+
+func (r *FileRepo) readStats(fileID blinkfile.FileID) (blinkfile.DownloadStats, error) {
+	var stats blinkfile.DownloadStats
+	data, err := ReadFile(r.statsFilename(fileID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, fmt.Errorf("reading download stats: %w", err)
+	}
+	err = Unmarshal(data, &stats)
+	if err != nil {
+		return stats, fmt.Errorf("unmarshaling download stats: %w", err)
+	}
+	return stats, nil
+}
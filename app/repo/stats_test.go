@@ -0,0 +1,55 @@
+package repo_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+func TestFileRepo_AddDownloadStats(t *testing.T) {
+	ctx := context.Background()
+	r := newTestFileRepo(t, "")
+	defer cleanDir(t, r.Dir())
+	event := blinkfile.DownloadEvent{Time: time.Unix(100, 0), Downloader: "a", IP: netip.MustParseAddr("198.51.100.7"), BytesSent: 9, Completed: true}
+	err := r.AddDownloadStats(ctx, "", event)
+	if !reflect.DeepEqual(err, fmt.Errorf("file ID cannot be empty")) {
+		t.Errorf("AddDownloadStats() with empty ID error = %v", err)
+	}
+	err = r.AddDownloadStats(ctx, "file1", event)
+	if !reflect.DeepEqual(err, app.ErrFileNotFound) {
+		t.Errorf("AddDownloadStats() before saving error = %v, want %v", err, app.ErrFileNotFound)
+	}
+	fatalOnErr(t, r.Save(ctx, blinkfile.File{
+		FileHeader: blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+		Data:       io.NopCloser(strings.NewReader("file-data")),
+	}))
+	stats, err := r.GetDownloadStats(ctx, "file1")
+	fatalOnErr(t, err)
+	if !reflect.DeepEqual(stats, blinkfile.DownloadStats{}) {
+		t.Errorf("GetDownloadStats() before downloading = %+v, want empty stats", stats)
+	}
+	fatalOnErr(t, r.AddDownloadStats(ctx, "file1", event))
+	fatalOnErr(t, r.AddDownloadStats(ctx, "file1", event))
+	var want blinkfile.DownloadStats
+	want.Add(event)
+	want.Add(event)
+	stats, err = r.GetDownloadStats(ctx, "file1")
+	fatalOnErr(t, err)
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("GetDownloadStats() = %+v, want %+v", stats, want)
+	}
+
+	fatalOnErr(t, r.Delete(ctx, "user1", []blinkfile.FileID{"file1"}))
+	_, err = r.GetDownloadStats(ctx, "file1")
+	if !reflect.DeepEqual(err, app.ErrFileNotFound) {
+		t.Errorf("GetDownloadStats() after deleting error = %v, want %v", err, app.ErrFileNotFound)
+	}
+}
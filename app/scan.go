@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/clamav"
+)
+
+type (
+	// Scanner scans file data for viruses.
+	Scanner interface {
+		Scan(context.Context, io.Reader) (clamav.Result, error)
+	}
+
+	// scanTempFile holds a copy of the scanned upload data until it is saved.
+	scanTempFile struct {
+		*os.File
+		upload io.Closer
+	}
+
+	// activeScans tracks the saved files that are being scanned, so a file isn't scanned again while the scan after its
+	// upload is still running.
+	activeScans struct {
+		mu    sync.Mutex
+		files map[blinkfile.FileID]struct{}
+	}
+)
+
+func newActiveScans() *activeScans {
+	return &activeScans{files: make(map[blinkfile.FileID]struct{})}
+}
+
+// start returns false if the file is already being scanned.
+func (s *activeScans) start(fileID blinkfile.FileID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[fileID]; ok {
+		return false
+	}
+	s.files[fileID] = struct{}{}
+	return true
+}
+
+func (s *activeScans) finish(fileID blinkfile.FileID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, fileID)
+}
+
+func (f scanTempFile) Close() error {
+	_ = f.upload.Close()
+	err := f.File.Close()
+	_ = os.Remove(f.Name())
+	return err
+}
+
+// scanUpload is an upload processor that rejects infected files before they are saved. With asynchronous scanning it
+// only marks the file as waiting to be scanned, which blocks downloads until scanSaved has run.
+func (a *App) scanUpload(ctx context.Context, upload *Upload) error {
+	if a.cfg.Scanner == nil {
+		return nil
+	}
+	if a.cfg.ScanAsync {
+		upload.ScanStatus = blinkfile.ScanPending
+		return nil
+	}
+	// The data is copied to a temporary file while it is streamed to the scanner, so it can be saved afterward
+	tmp, err := os.CreateTemp("", "blinkfile-scan-*")
+	if err != nil {
+		return Err(ErrInternal, fmt.Errorf("creating scan file: %w", err))
+	}
+	uploaded := upload.Data
+	// Replace the upload data straight away, so the temporary file is removed when the upload is closed
+	upload.Data = scanTempFile{tmp, uploaded}
+	result, err := a.cfg.Scanner.Scan(ctx, io.TeeReader(uploaded, tmp))
+	if err == nil {
+		// Copy anything the scanner didn't read
+		_, err = io.Copy(tmp, uploaded)
+	}
+	if err != nil {
+		return ErrUser("Error uploading file", "The file could not be scanned for viruses, please try again later.", err)
+	}
+	if result.Infected {
+		return ErrUser("Virus detected", fmt.Sprintf("The file was rejected because a virus was found (%s).", result.Signature), fmt.Errorf("virus found: %s", result.Signature))
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return Err(ErrInternal, fmt.Errorf("rewinding scan file: %w", err))
+	}
+	upload.RecordScan(false, "", a.cfg.Now())
+	return nil
+}
+
+// scanSaved is an async processor that scans files uploaded with asynchronous scanning, and quarantines infected ones.
+// If the scan fails the file stays pending, and is scanned again by RescanPendingFiles.
+func (a *App) scanSaved(ctx context.Context, file *blinkfile.FileHeader, data io.Reader) error {
+	if file.ScanStatus != blinkfile.ScanPending || !a.scans.start(file.ID) {
+		return nil
+	}
+	defer a.scans.finish(file.ID)
+	result, err := a.cfg.Scanner.Scan(ctx, data)
+	if err != nil {
+		return fmt.Errorf("scanning file: %w", err)
+	}
+	file.RecordScan(result.Infected, result.Signature, a.cfg.Now())
+	if result.Infected {
+		return Quarantine(file.QuarantineReason)
+	}
+	return nil
+}
+
+// RescanPendingFiles scans the files that are still waiting to be scanned, because the scan after their upload failed or
+// the server stopped before it finished. It should be run at startup and then occasionally while uploads are scanned
+// asynchronously.
+func (a *App) RescanPendingFiles(ctx context.Context) error {
+	if a.cfg.Scanner == nil || !a.cfg.ScanAsync {
+		return nil
+	}
+	files, err := a.cfg.FileRepo.ListAll(ctx)
+	if err != nil {
+		return Err(ErrRepo, fmt.Errorf("retrieving files: %w", err))
+	}
+	var scanned, failed int
+	for _, file := range files {
+		if file.ScanStatus != blinkfile.ScanPending {
+			continue
+		}
+		_, err = a.runAsyncProcessor(ctx, file.ID, AsyncProcessorFunc(a.scanSaved))
+		if errors.Is(err, ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			a.Errorf(ctx, "rescanning file %q: %v", file.ID, err)
+			failed++
+			continue
+		}
+		scanned++
+	}
+	if scanned > 0 || failed > 0 {
+		a.Printf(ctx, "Rescanned %d pending files, %d failed", scanned, failed)
+	}
+	return nil
+}
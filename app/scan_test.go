@@ -0,0 +1,294 @@
+package app_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/clamav"
+)
+
+type StubScanner struct {
+	ScanFunc func(context.Context, io.Reader) (clamav.Result, error)
+}
+
+func (s *StubScanner) Scan(ctx context.Context, r io.Reader) (clamav.Result, error) {
+	if s.ScanFunc != nil {
+		return s.ScanFunc(ctx, r)
+	}
+	_, err := io.Copy(io.Discard, r)
+	return clamav.Result{}, err
+}
+
+func scanFor(signature string) *StubScanner {
+	return &StubScanner{ScanFunc: func(_ context.Context, r io.Reader) (clamav.Result, error) {
+		data, err := io.ReadAll(r)
+		if strings.Contains(string(data), signature) {
+			return clamav.Result{Infected: true, Signature: signature}, err
+		}
+		return clamav.Result{}, err
+	}}
+}
+
+func TestApp_UploadFile_Scan(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		scanner   app.Scanner
+		data      string
+		wantErr   error
+		wantSaved blinkfile.FileHeader
+		wantData  string
+	}{
+		{
+			name: "should fail if the file can't be scanned",
+			scanner: &StubScanner{ScanFunc: func(context.Context, io.Reader) (clamav.Result, error) {
+				return clamav.Result{}, fmt.Errorf("scan err")
+			}},
+			data: "file-data",
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Error uploading file",
+				Detail: "The file could not be scanned for viruses, please try again later.",
+				Err:    fmt.Errorf("scan err"),
+			},
+		},
+		{
+			name:    "should reject an infected file",
+			scanner: scanFor("Eicar-Test-Signature"),
+			data:    "data with Eicar-Test-Signature",
+			wantErr: &app.Error{
+				Type:   app.ErrBadRequest,
+				Title:  "Virus detected",
+				Detail: "The file was rejected because a virus was found (Eicar-Test-Signature).",
+				Err:    fmt.Errorf("virus found: %s", "Eicar-Test-Signature"),
+			},
+		},
+		{
+			name:      "should save a clean file with its scan result",
+			scanner:   scanFor("Eicar-Test-Signature"),
+			data:      "file-data",
+			wantSaved: blinkfile.FileHeader{ScanStatus: blinkfile.ScanClean, Scanned: time.Unix(1, 0)},
+			wantData:  "file-data",
+		},
+		{
+			name: "should save all the data even if the scanner doesn't read it all",
+			scanner: &StubScanner{ScanFunc: func(_ context.Context, r io.Reader) (clamav.Result, error) {
+				_, err := io.ReadFull(r, make([]byte, 4))
+				return clamav.Result{}, err
+			}},
+			data:      "file-data",
+			wantSaved: blinkfile.FileHeader{ScanStatus: blinkfile.ScanClean, Scanned: time.Unix(1, 0)},
+			wantData:  "file-data",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved blinkfile.FileHeader
+			var savedData string
+			cfg := AppConfigDefaults(app.Config{
+				Clock:   &StaticClock{T: time.Unix(1, 0)},
+				Scanner: tt.scanner,
+				FileRepo: &StubFileRepo{SaveFunc: func(_ context.Context, file blinkfile.File) error {
+					data, err := io.ReadAll(file.Data)
+					saved, savedData = file.FileHeader, string(data)
+					return err
+				}},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			_, err := application.UploadFile(ctx, app.UploadFileArgs{
+				Filename: "file1",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader(tt.data)),
+			})
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("UploadFile() error = \n\t%v\n, wantErr \n\t%v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if savedData != tt.wantData {
+				t.Errorf("UploadFile() saved data %q, want %q", savedData, tt.wantData)
+			}
+			if saved.ScanStatus != tt.wantSaved.ScanStatus || !saved.Scanned.Equal(tt.wantSaved.Scanned) {
+				t.Errorf("UploadFile() saved scan status %q at %v, want %q at %v", saved.ScanStatus, saved.Scanned, tt.wantSaved.ScanStatus, tt.wantSaved.Scanned)
+			}
+		})
+	}
+}
+
+func TestApp_UploadFile_ScanAsync(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		data    string
+		wantPut blinkfile.FileHeader
+	}{
+		{
+			name: "should record a clean scan result after the file is saved",
+			data: "file-data",
+			wantPut: blinkfile.FileHeader{
+				ID:         "file1",
+				Owner:      "user1",
+				ScanStatus: blinkfile.ScanClean,
+				Scanned:    time.Unix(1, 0),
+			},
+		},
+		{
+			name: "should quarantine an infected file after it is saved",
+			data: "data with Eicar-Test-Signature",
+			wantPut: blinkfile.FileHeader{
+				ID:               "file1",
+				Owner:            "user1",
+				ScanStatus:       blinkfile.ScanInfected,
+				ScanSignature:    "Eicar-Test-Signature",
+				Scanned:          time.Unix(1, 0),
+				Quarantined:      true,
+				QuarantineReason: "virus found: Eicar-Test-Signature",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored blinkfile.FileHeader
+			puts := make(chan blinkfile.FileHeader, 1)
+			cfg := AppConfigDefaults(app.Config{
+				Clock:          &StaticClock{T: time.Unix(1, 0)},
+				GenerateFileID: func() (blinkfile.FileID, error) { return "file1", nil },
+				Scanner:        scanFor("Eicar-Test-Signature"),
+				ScanAsync:      true,
+				FileRepo: &StubFileRepo{
+					SaveFunc: func(_ context.Context, file blinkfile.File) error {
+						stored = blinkfile.FileHeader{ID: file.ID, Owner: file.Owner, ScanStatus: file.ScanStatus}
+						return nil
+					},
+					GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+						return stored, nil
+					},
+					OpenFunc: func(context.Context, blinkfile.FileID) (io.ReadCloser, error) {
+						return io.NopCloser(strings.NewReader(tt.data)), nil
+					},
+					PutHeaderFunc: func(_ context.Context, file blinkfile.FileHeader) error {
+						puts <- file
+						return nil
+					},
+				},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			got, err := application.UploadFile(ctx, app.UploadFileArgs{
+				Filename: "file1",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader(tt.data)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ScanStatus != blinkfile.ScanPending {
+				t.Errorf("UploadFile() scan status = %q, want %q", got.ScanStatus, blinkfile.ScanPending)
+			}
+			select {
+			case put := <-puts:
+				if !reflect.DeepEqual(put, tt.wantPut) {
+					t.Errorf("UploadFile() saved header:\n\t%+v\nwant:\n\t%+v", put, tt.wantPut)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("UploadFile() did not save the scan result")
+			}
+		})
+	}
+}
+
+func TestApp_DownloadFile_NotScanned(t *testing.T) {
+	ctx := context.Background()
+	cfg := AppConfigDefaults(app.Config{
+		FileRepo: &StubFileRepo{GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+			return blinkfile.FileHeader{ID: "file1", Owner: "user1", ScanStatus: blinkfile.ScanPending}, nil
+		}},
+	})
+	application := NewTestApp(ctx, t, cfg)
+	_, err := application.DownloadFile(ctx, "user2", "file1", "")
+	wantErr := &app.Error{
+		Type:   app.ErrBadRequest,
+		Title:  "File not available yet",
+		Detail: "The file is still being scanned for viruses, please try again shortly.",
+		Err:    blinkfile.ErrFileNotScanned,
+	}
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("DownloadFile() error = \n\t%v\n, wantErr \n\t%v", err, wantErr)
+	}
+}
+
+func TestApp_RescanPendingFiles(t *testing.T) {
+	ctx := context.Background()
+	pending := blinkfile.FileHeader{ID: "file1", Owner: "user1", ScanStatus: blinkfile.ScanPending}
+	clean := blinkfile.FileHeader{ID: "file2", Owner: "user1", ScanStatus: blinkfile.ScanClean, Scanned: time.Unix(1, 0)}
+	tests := []struct {
+		name      string
+		scanner   *StubScanner
+		data      string
+		wantFiles map[blinkfile.FileID]blinkfile.FileHeader
+	}{
+		{
+			name:    "should record a clean scan result for a pending file",
+			scanner: scanFor("Eicar-Test-Signature"),
+			data:    "file-data",
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", ScanStatus: blinkfile.ScanClean, Scanned: time.Unix(100, 0)},
+				"file2": clean,
+			},
+		},
+		{
+			name:    "should quarantine a pending file that is infected",
+			scanner: scanFor("Eicar-Test-Signature"),
+			data:    "data with Eicar-Test-Signature",
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {
+					ID:               "file1",
+					Owner:            "user1",
+					ScanStatus:       blinkfile.ScanInfected,
+					ScanSignature:    "Eicar-Test-Signature",
+					Scanned:          time.Unix(100, 0),
+					Quarantined:      true,
+					QuarantineReason: "virus found: Eicar-Test-Signature",
+				},
+				"file2": clean,
+			},
+		},
+		{
+			name: "should leave the file pending if it still can't be scanned",
+			scanner: &StubScanner{ScanFunc: func(context.Context, io.Reader) (clamav.Result, error) {
+				return clamav.Result{}, fmt.Errorf("clamd unreachable")
+			}},
+			data:      "file-data",
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": pending, "file2": clean},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMemFileRepo(pending, clean)
+			r.OpenFunc = func(context.Context, blinkfile.FileID) (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader(tt.data)), nil
+			}
+			application := NewTestApp(ctx, t, AppConfigDefaults(app.Config{
+				Clock:     &StaticClock{T: time.Unix(100, 0)},
+				FileRepo:  r,
+				Scanner:   tt.scanner,
+				ScanAsync: true,
+			}))
+			err := application.RescanPendingFiles(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(r.files, tt.wantFiles) {
+				t.Errorf("RescanPendingFiles() files = %+v, want %+v", r.files, tt.wantFiles)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/signedurl"
+)
+
+// SignedURL is a download URL that doesn't need the file's password until it expires.
+type SignedURL struct {
+	FileID blinkfile.FileID
+	// Query holds the signature and must be added to the URL.
+	Query   url.Values
+	Expires time.Time
+}
+
+const (
+	DefaultSignedURLTTL    = time.Hour
+	DefaultSignedURLMaxTTL = 7 * 24 * time.Hour
+
+	signedURLDownloadScope = "download"
+)
+
+// signedURLResource binds a signed URL to the file's password, so changing the password revokes the URLs signed for it.
+func signedURLResource(file blinkfile.FileHeader) string {
+	return fmt.Sprintf("%s %s", file.ID, file.PasswordHash)
+}
+
+// SignDownloadURL signs a URL that downloads the file without the password until it expires, for scripts and tools like
+// curl. The owner can sign one without the password, anyone else needs it and must meet the file's other download
+// conditions, such as verifying a recipient email and accepting the terms. The default TTL is used if it's zero.
+func (a *App) SignDownloadURL(ctx context.Context, userID blinkfile.UserID, fileID blinkfile.FileID, password string, ttl time.Duration) (SignedURL, error) {
+	if fileID == "" {
+		return SignedURL{}, Err(ErrBadRequest, fmt.Errorf("file ID is required"))
+	}
+	if ttl < 0 {
+		return SignedURL{}, ErrUser("Invalid link expiry", "Link expiry cannot be negative.", fmt.Errorf("signed URL TTL %s cannot be negative", ttl))
+	}
+	if ttl == 0 {
+		ttl = DefaultSignedURLTTL
+	}
+	if ttl > a.cfg.SignedURLMaxTTL {
+		return SignedURL{}, ErrUser("Invalid link expiry", fmt.Sprintf("Links can't last longer than %s.", formatDuration(a.cfg.SignedURLMaxTTL)), fmt.Errorf("signed URL TTL %s is more than the max %s", ttl, a.cfg.SignedURLMaxTTL))
+	}
+	matchFunc := a.matchPassword()
+	file, err := a.cfg.FileRepo.Get(ctx, fileID)
+	if err != nil {
+		// Mimic responses for files that don't exist
+		return SignedURL{}, a.mimicErr(ctx, password, Err(ErrRepo, err))
+	}
+	err = checkClientNetwork(ctx, file, userID)
+	if err == nil {
+		err = a.checkPasswordAttempt(file, userID, password)
+	}
+	var conditions downloadConditions
+	if err == nil {
+		conditions, err = a.checkDownloadConditions(ctx, file, userID, password, matchFunc)
+	}
+	if err == nil {
+		err = file.Authorize(userID, password, matchFunc, a.cfg.Now)
+	}
+	if err == nil {
+		var accepted blinkfile.FileHeader
+		accepted, err = a.acceptPassword(ctx, file, userID, password, nil)
+		if err == nil {
+			file = accepted
+		}
+	}
+	if err != nil {
+		a.downloadFailed(ctx, file, userID, err)
+		if notAvailable := a.notAvailableErr(file, err); notAvailable != nil {
+			return SignedURL{}, notAvailable
+		}
+		if errors.Is(err, blinkfile.ErrFilePasswordInvalid) {
+			a.recordFailedPassword(ctx, file.ID)
+			err = Err(ErrAuthzFailed, err)
+		}
+		return SignedURL{}, a.mimicErr(ctx, password, err)
+	}
+	expires := a.cfg.Now().Add(ttl)
+	query := a.signer.Sign(signedURLResource(file), signedURLDownloadScope, expires)
+
+	if conditions.acceptedTerms {
+		a.recordTermsAccepted(ctx, file, userID)
+	}
+	detail := "expires " + expires.Format(time.RFC3339)
+	if conditions.recipient != "" {
+		detail += " for recipient " + conditions.recipient
+	}
+	a.recordAccess(ctx, file.ID, AccessRecord{Action: AccessLinkSigned, UserID: userID, Detail: detail})
+	return SignedURL{FileID: file.ID, Query: query, Expires: expires}, nil
+}
+
+// DownloadSignedFile counts a download of the file with a signed URL, the query must hold the signature. It still counts
+// against the download limit, and the client must be on a network the file allows.
+func (a *App) DownloadSignedFile(ctx context.Context, fileID blinkfile.FileID, query url.Values) (blinkfile.FileHeader, error) {
+	if fileID == "" {
+		return blinkfile.FileHeader{}, Err(ErrBadRequest, fmt.Errorf("file ID is required"))
+	}
+	file, err := a.cfg.FileRepo.Get(ctx, fileID)
+	if err != nil {
+		// Mimic responses for files that don't exist
+		a.Errorf(ctx, "mimicking an invalid signed URL for security, but real error was: %s", err)
+		return blinkfile.FileHeader{}, invalidSignedURLErr(signedurl.ErrInvalid)
+	}
+	err = a.signer.Verify(signedURLResource(file), signedURLDownloadScope, query)
+	if errors.Is(err, signedurl.ErrExpired) {
+		return blinkfile.FileHeader{}, Err(ErrAuthzFailed, err).AddDetail("The download link has expired.")
+	}
+	if err != nil {
+		return blinkfile.FileHeader{}, invalidSignedURLErr(err)
+	}
+	err = checkClientNetwork(ctx, file, "")
+	if err == nil {
+		err = file.DownloadSigned(a.cfg.Now)
+	}
+	if err == nil {
+		// Count the download on the current header, so it can't go over the limit or undo concurrent changes
+		var denied error
+		var downloaded blinkfile.FileHeader
+		downloaded, err = a.cfg.FileRepo.UpdateHeader(ctx, file.ID, func(current *blinkfile.FileHeader) error {
+			denied = current.DownloadSigned(a.cfg.Now)
+			return denied
+		})
+		if err != nil && denied == nil {
+			return blinkfile.FileHeader{}, Err(ErrRepo, err)
+		}
+		if err == nil {
+			file = downloaded
+		}
+	}
+	if err != nil {
+		a.downloadFailed(ctx, file, "", err)
+		if notAvailable := a.notAvailableErr(file, err); notAvailable != nil {
+			return blinkfile.FileHeader{}, notAvailable
+		}
+		if errors.Is(err, blinkfile.ErrDownloadLimitReached) {
+			return blinkfile.FileHeader{}, Err(ErrAuthzFailed, err).AddDetail("The file has reached its download limit.")
+		}
+		return blinkfile.FileHeader{}, invalidSignedURLErr(err)
+	}
+	a.downloads.start(file.ID)
+	fileChanged(ctx, file.Owner, FileEvent{FileHeader: file, Change: FileDownloaded})
+	return file, nil
+}
+
+// invalidSignedURLErr gives the same response whether the signature is wrong or the file is gone, so links don't reveal
+// which files exist.
+func invalidSignedURLErr(err error) error {
+	return Err(ErrAuthzFailed, err).AddDetail("The download link is invalid or the file is no longer available.")
+}
@@ -0,0 +1,246 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/signedurl"
+)
+
+func TestApp_SignDownloadURL(t *testing.T) {
+	now := time.Unix(100, 0)
+	hasher := &StubPasswordHasher{MatchFunc: func(hash string, data []byte) (bool, error) {
+		return string(data) == "right", nil
+	}}
+	file := blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash"}
+	tests := []struct {
+		name        string
+		userID      blinkfile.UserID
+		fileID      blinkfile.FileID
+		password    string
+		ttl         time.Duration
+		wantExpires time.Time
+		wantErr     error
+	}{
+		{
+			name:        "should sign a URL for the owner without the password",
+			userID:      "user1",
+			fileID:      "file1",
+			wantExpires: now.Add(app.DefaultSignedURLTTL),
+		},
+		{
+			name:        "should sign a URL for another user with the password",
+			userID:      "user2",
+			fileID:      "file1",
+			password:    "right",
+			ttl:         time.Minute,
+			wantExpires: now.Add(time.Minute),
+		},
+		{
+			name:    "should fail for another user without the password",
+			userID:  "user2",
+			fileID:  "file1",
+			wantErr: blinkfile.ErrFilePasswordRequired,
+		},
+		{
+			name:     "should fail for another user with the wrong password",
+			userID:   "user2",
+			fileID:   "file1",
+			password: "wrong",
+			wantErr:  app.Err(app.ErrAuthzFailed, blinkfile.ErrFilePasswordInvalid),
+		},
+		{
+			name:     "should mimic a wrong password for a file that doesn't exist",
+			userID:   "user2",
+			fileID:   "file2",
+			password: "right",
+			wantErr:  app.Err(app.ErrAuthzFailed, blinkfile.ErrFilePasswordInvalid),
+		},
+		{
+			name:    "should fail if the TTL is longer than the max",
+			userID:  "user1",
+			fileID:  "file1",
+			ttl:     app.DefaultSignedURLMaxTTL + time.Second,
+			wantErr: app.ErrUser("Invalid link expiry", "Links can't last longer than 7 days.", fmt.Errorf("signed URL TTL 168h0m1s is more than the max 168h0m0s")),
+		},
+		{
+			name:    "should fail if the TTL is negative",
+			userID:  "user1",
+			fileID:  "file1",
+			ttl:     -time.Second,
+			wantErr: app.ErrUser("Invalid link expiry", "Link expiry cannot be negative.", fmt.Errorf("signed URL TTL -1s cannot be negative")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			application := NewTestApp(ctx, t, AppConfigDefaults(app.Config{
+				Clock:          &StaticClock{T: now},
+				FileRepo:       newMemFileRepo(file),
+				PasswordHasher: hasher,
+			}))
+			got, err := application.SignDownloadURL(ctx, tt.userID, tt.fileID, tt.password, tt.ttl)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("SignDownloadURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.FileID != tt.fileID || !got.Expires.Equal(tt.wantExpires) {
+				t.Errorf("SignDownloadURL() = %+v, want file ID %q expiring at %s", got, tt.fileID, tt.wantExpires)
+			}
+			if _, err = application.DownloadSignedFile(ctx, tt.fileID, got.Query); err != nil {
+				t.Errorf("DownloadSignedFile() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestApp_DownloadSignedFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		file          blinkfile.FileHeader
+		query         func(url.Values) url.Values
+		after         time.Duration
+		changeFile    func(*blinkfile.FileHeader)
+		wantErr       error
+		wantDownloads int64
+	}{
+		{
+			name:          "should download the file without the password",
+			file:          blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash"},
+			wantDownloads: 1,
+		},
+		{
+			name:    "should fail if the signature was tampered with",
+			file:    blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+			query:   func(q url.Values) url.Values { q.Set(signedurl.ExpiresParam, "99999999999"); return q },
+			wantErr: signedurl.ErrInvalid,
+		},
+		{
+			name:    "should fail once the URL expires",
+			file:    blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+			after:   app.DefaultSignedURLTTL,
+			wantErr: signedurl.ErrExpired,
+		},
+		{
+			name:       "should fail after the password is changed",
+			file:       blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash"},
+			changeFile: func(f *blinkfile.FileHeader) { f.PasswordHash = "new-hash" },
+			wantErr:    signedurl.ErrInvalid,
+		},
+		{
+			name:       "should count against the download limit",
+			file:       blinkfile.FileHeader{ID: "file1", Owner: "user1", DownloadLimit: 1},
+			changeFile: func(f *blinkfile.FileHeader) { f.Downloads = 1 },
+			wantErr:    blinkfile.ErrDownloadLimitReached,
+		},
+		{
+			name:       "should fail if the file was deleted",
+			file:       blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+			changeFile: func(f *blinkfile.FileHeader) { f.Trashed = time.Unix(100, 0) },
+			wantErr:    blinkfile.ErrFileTrashed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := &StaticClock{T: time.Unix(100, 0)}
+			r := newMemFileRepo(tt.file)
+			application := NewTestApp(ctx, t, AppConfigDefaults(app.Config{Clock: clock, FileRepo: r}))
+			signed, err := application.SignDownloadURL(ctx, tt.file.Owner, tt.file.ID, "", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := signed.Query
+			if tt.query != nil {
+				query = tt.query(query)
+			}
+			clock.T = clock.T.Add(tt.after)
+			if tt.changeFile != nil {
+				file := r.files[tt.file.ID]
+				tt.changeFile(&file)
+				r.files[tt.file.ID] = file
+			}
+			_, err = application.DownloadSignedFile(ctx, tt.file.ID, query)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DownloadSignedFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			application.FinishDownload(ctx, tt.file.ID)
+			if got := r.files[tt.file.ID].Downloads; got != tt.wantDownloads {
+				t.Errorf("DownloadSignedFile() downloads = %d, want %d", got, tt.wantDownloads)
+			}
+		})
+	}
+}
+
+// staleFileRepo gets the stale header while it's set, like a read that raced a concurrent change.
+type staleFileRepo struct {
+	*memFileRepo
+	stale *blinkfile.FileHeader
+}
+
+func (r *staleFileRepo) Get(ctx context.Context, fileID blinkfile.FileID) (blinkfile.FileHeader, error) {
+	if r.stale != nil {
+		return *r.stale, nil
+	}
+	return r.memFileRepo.Get(ctx, fileID)
+}
+
+func TestApp_DownloadSignedFile_ConcurrentChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     blinkfile.FileHeader
+		change   func(*blinkfile.FileHeader)
+		wantErr  error
+		wantFile blinkfile.FileHeader
+	}{
+		{
+			name:     "should not go over the download limit",
+			file:     blinkfile.FileHeader{ID: "file1", Owner: "user1", DownloadLimit: 1},
+			change:   func(f *blinkfile.FileHeader) { f.Downloads = 1 },
+			wantErr:  blinkfile.ErrDownloadLimitReached,
+			wantFile: blinkfile.FileHeader{ID: "file1", Owner: "user1", DownloadLimit: 1, Downloads: 1},
+		},
+		{
+			name:     "should keep concurrent changes",
+			file:     blinkfile.FileHeader{ID: "file1", Owner: "user1"},
+			change:   func(f *blinkfile.FileHeader) { f.Downloads, f.LegalHold = 1, true },
+			wantFile: blinkfile.FileHeader{ID: "file1", Owner: "user1", Downloads: 2, LastDownloaded: time.Unix(100, 0), LegalHold: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r := &staleFileRepo{memFileRepo: newMemFileRepo(tt.file)}
+			application := NewTestApp(ctx, t, AppConfigDefaults(app.Config{Clock: &StaticClock{T: time.Unix(100, 0)}, FileRepo: r}))
+			signed, err := application.SignDownloadURL(ctx, tt.file.Owner, tt.file.ID, "", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stale := r.files[tt.file.ID]
+			r.stale = &stale
+			file := r.files[tt.file.ID]
+			tt.change(&file)
+			r.files[tt.file.ID] = file
+
+			_, err = application.DownloadSignedFile(ctx, tt.file.ID, signed.Query)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DownloadSignedFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := r.files[tt.file.ID]; !reflect.DeepEqual(got, tt.wantFile) {
+				t.Errorf("DownloadSignedFile() file = %+v, want %+v", got, tt.wantFile)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/request"
+)
+
+// addDownloadStats adds the download to the file's stats rollup. Failures are only logged so they don't block the
+// download.
+func (a *App) addDownloadStats(ctx context.Context, userID blinkfile.UserID, fileID blinkfile.FileID, bytesSent int64, completed bool) {
+	ip := request.GetClientIP(ctx)
+	err := a.cfg.FileRepo.AddDownloadStats(ctx, fileID, blinkfile.DownloadEvent{
+		Time:       a.cfg.Now(),
+		Downloader: blinkfile.DownloaderID(userID, ip, request.GetUserAgent(ctx)),
+		IP:         ip,
+		BytesSent:  bytesSent,
+		Completed:  completed,
+	})
+	if err != nil {
+		a.Errorf(ctx, "adding download of file %q to its stats: %v", fileID, err)
+	}
+}
+
+// GetFileStats returns the download stats of one of the owner's files.
+func (a *App) GetFileStats(ctx context.Context, owner blinkfile.UserID, fileID blinkfile.FileID) (blinkfile.DownloadStats, error) {
+	file, err := a.GetFile(ctx, owner, fileID)
+	if err != nil {
+		return blinkfile.DownloadStats{}, err
+	}
+	stats, err := a.cfg.FileRepo.GetDownloadStats(ctx, file.ID)
+	if err != nil {
+		return blinkfile.DownloadStats{}, Err(ErrRepo, fmt.Errorf("retrieving download stats of file %q: %w", file.ID, err))
+	}
+	return stats, nil
+}
+
+// GetUserStats sums the download stats of all the owner's files, including those in the trash. The stats of deleted
+// files are deleted along with them.
+func (a *App) GetUserStats(ctx context.Context, owner blinkfile.UserID) (blinkfile.DownloadStats, error) {
+	if owner == "" {
+		return blinkfile.DownloadStats{}, Err(ErrBadRequest, fmt.Errorf("owner is required"))
+	}
+	files, err := a.cfg.FileRepo.ListByUser(ctx, owner)
+	if err != nil {
+		return blinkfile.DownloadStats{}, Err(ErrRepo, fmt.Errorf("retrieving file list: %w", err))
+	}
+	var sum blinkfile.DownloadStats
+	for _, file := range files {
+		stats, err := a.cfg.FileRepo.GetDownloadStats(ctx, file.ID)
+		if err != nil {
+			return blinkfile.DownloadStats{}, Err(ErrRepo, fmt.Errorf("retrieving download stats of file %q: %w", file.ID, err))
+		}
+		sum.Merge(stats)
+	}
+	return sum, nil
+}
@@ -0,0 +1,70 @@
+package app_test
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/request"
+)
+
+func TestApp_RecordDownload_Stats(t *testing.T) {
+	now := time.Unix(100, 0)
+	ctx := request.CtxWithClientIP(context.Background(), netip.MustParseAddr("198.51.100.7"))
+	ctx = request.CtxWithUserAgent(ctx, "curl/8.0")
+	r := newMemFileRepo(blinkfile.FileHeader{ID: "file1", Owner: "user1", Size: 2048})
+	var events []blinkfile.DownloadEvent
+	r.AddDownloadStatsFunc = func(_ context.Context, fileID blinkfile.FileID, event blinkfile.DownloadEvent) error {
+		events = append(events, event)
+		return nil
+	}
+	application := NewTestApp(ctx, t, AppConfigDefaults(app.Config{Clock: &StaticClock{T: now}, FileRepo: r}))
+
+	application.RecordDownload(ctx, "", "file1", 2048)
+	application.RecordDownload(ctx, "user2", "file1", 1024)
+	downloader := blinkfile.DownloaderID("", netip.MustParseAddr("198.51.100.7"), "curl/8.0")
+	want := []blinkfile.DownloadEvent{
+		{Time: now, Downloader: downloader, IP: netip.MustParseAddr("198.51.100.7"), BytesSent: 2048, Completed: true},
+		{Time: now, Downloader: blinkfile.DownloaderID("user2", netip.Addr{}, ""), IP: netip.MustParseAddr("198.51.100.7"), BytesSent: 1024},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("RecordDownload() stats events = %+v, want %+v", events, want)
+	}
+}
+
+func TestApp_GetUserStats(t *testing.T) {
+	ctx := context.Background()
+	r := &StubFileRepo{
+		ListByUserFunc: func(_ context.Context, owner blinkfile.UserID) ([]blinkfile.FileHeader, error) {
+			return []blinkfile.FileHeader{{ID: "file1", Owner: owner}, {ID: "file2", Owner: owner}}, nil
+		},
+		GetDownloadStatsFunc: func(_ context.Context, fileID blinkfile.FileID) (blinkfile.DownloadStats, error) {
+			if fileID == "file1" {
+				return blinkfile.DownloadStats{Completed: 1, Downloaders: map[string]int64{"a": 1}}, nil
+			}
+			return blinkfile.DownloadStats{Aborted: 1, Downloaders: map[string]int64{"a": 1}}, nil
+		},
+	}
+	application := NewTestApp(ctx, t, AppConfigDefaults(app.Config{FileRepo: r}))
+	got, err := application.GetUserStats(ctx, "user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := blinkfile.DownloadStats{Completed: 1, Aborted: 1, Downloaders: map[string]int64{"a": 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetUserStats() = %+v, want %+v", got, want)
+	}
+
+	r.ListByUserFunc = func(context.Context, blinkfile.UserID) ([]blinkfile.FileHeader, error) {
+		return nil, fmt.Errorf("repo err")
+	}
+	_, err = application.GetUserStats(ctx, "user1")
+	if want := app.Err(app.ErrRepo, fmt.Errorf("retrieving file list: %w", fmt.Errorf("repo err"))); !reflect.DeepEqual(err, want) {
+		t.Errorf("GetUserStats() error = %v, want %v", err, want)
+	}
+}
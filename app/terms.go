@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+type (
+	// TermsError is returned when the file's terms must be accepted before it can be downloaded.
+	TermsError struct {
+		Terms string
+	}
+
+	termsAcceptedKey struct{}
+)
+
+func (e *TermsError) Error() string {
+	return blinkfile.ErrTermsNotAccepted.Error()
+}
+
+func (e *TermsError) Unwrap() error {
+	return blinkfile.ErrTermsNotAccepted
+}
+
+// CtxWithTermsAccepted passes the client's explicit acceptance of the file's terms to DownloadFile and PreviewFile.
+func CtxWithTermsAccepted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, termsAcceptedKey{}, true)
+}
+
+func termsAccepted(ctx context.Context) bool {
+	accepted, _ := ctx.Value(termsAcceptedKey{}).(bool)
+	return accepted
+}
+
+// downloadConditions are what a client met before downloading a file, besides the password.
+type downloadConditions struct {
+	// recipient is the verified recipient email address, if the file is restricted to recipients.
+	recipient string
+	// acceptedTerms is set if the client accepted the file's terms.
+	acceptedTerms bool
+}
+
+// checkDownloadConditions checks that a client other than the owner verified a recipient email address and accepted the
+// terms, if the file requires them. The file is authorized first, so the conditions and terms are only revealed to
+// clients who have the password.
+func (a *App) checkDownloadConditions(ctx context.Context, file blinkfile.FileHeader, userID blinkfile.UserID, password string, matchFunc blinkfile.PasswordMatchFunc) (downloadConditions, error) {
+	if file.Owner == userID || (!file.RequiresRecipient() && !file.RequiresTerms()) {
+		return downloadConditions{}, nil
+	}
+	err := file.Authorize(userID, password, matchFunc, a.cfg.Now)
+	if err != nil {
+		return downloadConditions{}, err
+	}
+	var conditions downloadConditions
+	conditions.recipient, err = a.checkRecipient(ctx, file, userID)
+	if err != nil {
+		return downloadConditions{}, err
+	}
+	if file.RequiresTerms() {
+		if !termsAccepted(ctx) {
+			return downloadConditions{}, Err(ErrAuthzFailed, &TermsError{Terms: file.Terms})
+		}
+		conditions.acceptedTerms = true
+	}
+	return conditions, nil
+}
+
+// conditionsMet records the verified recipient and the acceptance of the terms once the file is downloaded.
+func (a *App) conditionsMet(ctx context.Context, file blinkfile.FileHeader, userID blinkfile.UserID, conditions downloadConditions) {
+	a.recipientDownloaded(ctx, file, conditions.recipient)
+	if conditions.acceptedTerms {
+		a.recordTermsAccepted(ctx, file, userID)
+	}
+}
+
+// recordTermsAccepted records the acceptance of the file's terms in its access log.
+func (a *App) recordTermsAccepted(ctx context.Context, file blinkfile.FileHeader, userID blinkfile.UserID) {
+	// The hash identifies which version of the terms was accepted
+	hash := sha256.Sum256([]byte(file.Terms))
+	a.recordAccess(ctx, file.ID, AccessRecord{Action: AccessTermsAccepted, UserID: userID, Detail: "terms sha256:" + hex.EncodeToString(hash[:])})
+}
@@ -0,0 +1,129 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/request"
+)
+
+func TestApp_DownloadFile_Terms(t *testing.T) {
+	now := time.Unix(100, 0)
+	hasher := &StubPasswordHasher{MatchFunc: func(hash string, data []byte) (bool, error) {
+		return string(data) == "right", nil
+	}}
+	tests := []struct {
+		name         string
+		file         blinkfile.FileHeader
+		user         blinkfile.UserID
+		password     string
+		accepted     bool
+		wantErr      error
+		wantTerms    string
+		wantDownload bool
+		wantAccess   []app.AccessAction
+	}{
+		{
+			name:      "should require a client with the password to accept the terms",
+			file:      blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash", Terms: "Do not share"},
+			user:      "user2",
+			password:  "right",
+			wantErr:   blinkfile.ErrTermsNotAccepted,
+			wantTerms: "Do not share",
+		},
+		{
+			name:       "should not reveal the terms without the password",
+			file:       blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash", Terms: "Do not share"},
+			user:       "user2",
+			password:   "wrong",
+			accepted:   true,
+			wantErr:    blinkfile.ErrFilePasswordInvalid,
+			wantAccess: []app.AccessAction{app.AccessWrongPassword},
+		},
+		{
+			name:      "should require accepting the terms of a public file",
+			file:      blinkfile.FileHeader{ID: "file1", Owner: "user1", Terms: "Do not share"},
+			wantErr:   blinkfile.ErrTermsNotAccepted,
+			wantTerms: "Do not share",
+		},
+		{
+			name:         "should download after accepting the terms, recording the acceptance",
+			file:         blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash", Terms: "Do not share"},
+			user:         "user2",
+			password:     "right",
+			accepted:     true,
+			wantDownload: true,
+			wantAccess:   []app.AccessAction{app.AccessTermsAccepted},
+		},
+		{
+			name:         "should let the owner download without accepting the terms",
+			file:         blinkfile.FileHeader{ID: "file1", Owner: "user1", PasswordHash: "hash", Terms: "Do not share"},
+			user:         "user1",
+			wantDownload: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := request.CtxWithNewID(context.Background())
+			ctx = request.CtxWithClientIP(ctx, netip.MustParseAddr("192.0.2.1"))
+			ctx = request.CtxWithUserAgent(ctx, "curl/8.0")
+			if tt.accepted {
+				ctx = app.CtxWithTermsAccepted(ctx)
+			}
+			r := newMemFileRepo(tt.file)
+			var access []app.AccessRecord
+			r.RecordAccessFunc = func(_ context.Context, fileID blinkfile.FileID, record app.AccessRecord) error {
+				if fileID != tt.file.ID {
+					t.Errorf("RecordAccess() file ID = %q, want %q", fileID, tt.file.ID)
+				}
+				access = append(access, record)
+				return nil
+			}
+			cfg := AppConfigDefaults(app.Config{
+				Clock:          &StaticClock{T: now},
+				FileRepo:       r,
+				PasswordHasher: hasher,
+			})
+			application := NewTestApp(ctx, t, cfg)
+			_, err := application.DownloadFile(ctx, tt.user, tt.file.ID, tt.password)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("DownloadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var termsErr *app.TermsError
+			if errors.As(err, &termsErr) != (tt.wantTerms != "") || (termsErr != nil && termsErr.Terms != tt.wantTerms) {
+				t.Errorf("DownloadFile() error = %#v, want terms %q", err, tt.wantTerms)
+			}
+			if downloaded := r.files[tt.file.ID].Downloads > 0; downloaded != tt.wantDownload {
+				t.Errorf("DownloadFile() downloaded = %v, want %v", downloaded, tt.wantDownload)
+			}
+			var gotAccess []app.AccessAction
+			for _, record := range access {
+				gotAccess = append(gotAccess, record.Action)
+				if record.Action != app.AccessTermsAccepted {
+					continue
+				}
+				want := app.AccessRecord{
+					Time:      now,
+					Action:    record.Action,
+					UserID:    tt.user,
+					IP:        "192.0.2.1",
+					UserAgent: "curl/8.0",
+					RequestID: request.GetID(ctx),
+					Detail:    "terms sha256:9c7a097bc982c653dc446a65699cfc40f461ab281fdc0b47e7e081fbec542535",
+				}
+				if !reflect.DeepEqual(record, want) {
+					t.Errorf("access record = %+v, want %+v", record, want)
+				}
+			}
+			if !reflect.DeepEqual(gotAccess, tt.wantAccess) {
+				t.Errorf("access = %v, want %v", gotAccess, tt.wantAccess)
+			}
+		})
+	}
+}
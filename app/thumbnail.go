@@ -0,0 +1,83 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/thumbnail"
+)
+
+func canGenerateThumbnail(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	_, ok := thumbnail.ContentTypes[mediaType]
+	return ok
+}
+
+// generateThumbnail is the last of the async processors run after an upload.
+func (a *App) generateThumbnail(ctx context.Context, file *blinkfile.FileHeader, data io.Reader) error {
+	if !canGenerateThumbnail(file.ContentType) {
+		return nil
+	}
+	thumb, err := a.cfg.GenerateThumbnail(data)
+	if err != nil {
+		return fmt.Errorf("generating thumbnail: %w", err)
+	}
+	err = a.cfg.FileRepo.SaveThumbnail(ctx, file.ID, bytes.NewReader(thumb))
+	if err != nil {
+		return fmt.Errorf("saving thumbnail: %w", err)
+	}
+	*file, err = a.cfg.FileRepo.Get(ctx, file.ID)
+	if err != nil {
+		return err
+	}
+	fileChanged(ctx, file.Owner, FileEvent{FileHeader: *file, Change: FileThumbnailCreated})
+	return nil
+}
+
+// GetThumbnail returns the file header if the user can view the file's thumbnail. Owners can always view their own
+// thumbnails, other users only if the owner chose to show it on the download page and the file has no password.
+func (a *App) GetThumbnail(ctx context.Context, userID blinkfile.UserID, fileID blinkfile.FileID) (blinkfile.FileHeader, error) {
+	if fileID == "" {
+		return blinkfile.FileHeader{}, Err(ErrBadRequest, fmt.Errorf("file ID is required"))
+	}
+	file, err := a.cfg.FileRepo.Get(ctx, fileID)
+	if err != nil {
+		return blinkfile.FileHeader{}, Err(ErrNotFound, err)
+	}
+	if file.ThumbnailLocation == "" {
+		return blinkfile.FileHeader{}, Err(ErrNotFound, fmt.Errorf("file %q has no thumbnail", fileID))
+	}
+	isOwner := userID != "" && file.Owner == userID
+	if !isOwner {
+		if !file.ShowThumbnail {
+			return blinkfile.FileHeader{}, Err(ErrNotFound, fmt.Errorf("file %q thumbnail is not shown to other users", fileID))
+		}
+		if err = checkClientNetwork(ctx, file, userID); err != nil {
+			return blinkfile.FileHeader{}, Err(ErrNotFound, err)
+		}
+		if _, err = a.checkRecipient(ctx, file, userID); err != nil {
+			return blinkfile.FileHeader{}, Err(ErrNotFound, err)
+		}
+		if file.PasswordHash != "" {
+			// The thumbnail shows the file's content, so it stays behind the password
+			return blinkfile.FileHeader{}, Err(ErrNotFound, fmt.Errorf("file %q is password protected", fileID))
+		}
+		if file.RequiresTerms() {
+			return blinkfile.FileHeader{}, Err(ErrNotFound, blinkfile.ErrTermsNotAccepted)
+		}
+		if err = file.CheckAvailable(userID, a.cfg.Now); err != nil {
+			return blinkfile.FileHeader{}, Err(ErrNotFound, err)
+		}
+	} else if file.Quarantined {
+		// Owners still see their expired and trashed files, but not content that may be malicious
+		return blinkfile.FileHeader{}, Err(ErrNotFound, blinkfile.ErrFileQuarantined)
+	}
+	return file, nil
+}
@@ -0,0 +1,326 @@
+package app_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+func TestApp_UploadFile_Thumbnail(t *testing.T) {
+	ctx := context.Background()
+	const pngData = "\x89PNG\r\n\x1a\nimage-data"
+	tests := []struct {
+		name          string
+		data          string
+		wantThumbnail bool
+	}{
+		{
+			name:          "should generate a thumbnail in the background for an image",
+			data:          pngData,
+			wantThumbnail: true,
+		},
+		{
+			name:          "should not generate a thumbnail for other content types",
+			data:          "plain text",
+			wantThumbnail: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := make(chan string, 1)
+			var stored blinkfile.FileHeader
+			cfg := AppConfigDefaults(app.Config{
+				GenerateFileID: func() (blinkfile.FileID, error) { return "file1", nil },
+				FileRepo: &StubFileRepo{
+					SaveFunc: func(_ context.Context, file blinkfile.File) error {
+						stored = file.FileHeader
+						return nil
+					},
+					GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+						return stored, nil
+					},
+					OpenFunc: func(_ context.Context, fileID blinkfile.FileID) (io.ReadCloser, error) {
+						if fileID != "file1" {
+							return nil, fmt.Errorf("unexpected file ID %q", fileID)
+						}
+						return io.NopCloser(strings.NewReader(pngData)), nil
+					},
+					SaveThumbnailFunc: func(_ context.Context, _ blinkfile.FileID, data io.Reader) error {
+						b, err := io.ReadAll(data)
+						saved <- string(b)
+						return err
+					},
+				},
+				GenerateThumbnail: func(r io.Reader) ([]byte, error) {
+					b, err := io.ReadAll(r)
+					return append([]byte("thumbnail of "), b...), err
+				},
+			})
+			application := NewTestApp(ctx, t, cfg)
+			_, err := application.UploadFile(ctx, app.UploadFileArgs{
+				Filename: "file1",
+				Owner:    "user1",
+				Reader:   io.NopCloser(strings.NewReader(tt.data)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case got := <-saved:
+				if !tt.wantThumbnail {
+					t.Errorf("UploadFile() unexpectedly saved thumbnail %q", got)
+				}
+				if want := "thumbnail of " + pngData; got != want {
+					t.Errorf("UploadFile() saved thumbnail %q, want %q", got, want)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantThumbnail {
+					t.Errorf("UploadFile() did not save a thumbnail")
+				}
+			}
+		})
+	}
+}
+
+func TestApp_GetThumbnail(t *testing.T) {
+	ctx := context.Background()
+	type args struct {
+		userID blinkfile.UserID
+		fileID blinkfile.FileID
+	}
+	withThumbnail := blinkfile.FileHeader{
+		ID:                "file1",
+		Owner:             "user1",
+		ThumbnailLocation: "thumbnail-location",
+	}
+	repoWith := func(file blinkfile.FileHeader) *StubFileRepo {
+		return &StubFileRepo{GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+			return file, nil
+		}}
+	}
+	tests := []struct {
+		name    string
+		cfg     app.Config
+		args    args
+		want    blinkfile.FileHeader
+		wantErr error
+	}{
+		{
+			name: "should fail if file ID is empty",
+			args: args{fileID: ""},
+			wantErr: &app.Error{
+				Type: app.ErrBadRequest,
+				Err:  fmt.Errorf("file ID is required"),
+			},
+		},
+		{
+			name: "should fail with not found if the file doesn't exist",
+			cfg: app.Config{
+				FileRepo: &StubFileRepo{GetFunc: func(context.Context, blinkfile.FileID) (blinkfile.FileHeader, error) {
+					return blinkfile.FileHeader{}, app.ErrFileNotFound
+				}},
+			},
+			args: args{fileID: "file1"},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  app.ErrFileNotFound,
+			},
+		},
+		{
+			name: "should fail with not found if the file has no thumbnail",
+			cfg:  app.Config{FileRepo: repoWith(blinkfile.FileHeader{ID: "file1", Owner: "user1"})},
+			args: args{userID: "user1", fileID: "file1"},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  fmt.Errorf("file %q has no thumbnail", "file1"),
+			},
+		},
+		{
+			name: "should return the thumbnail to the owner",
+			cfg:  app.Config{FileRepo: repoWith(withThumbnail)},
+			args: args{userID: "user1", fileID: "file1"},
+			want: withThumbnail,
+		},
+		{
+			name: "should not return the thumbnail to other users if the owner didn't choose to show it",
+			cfg:  app.Config{FileRepo: repoWith(withThumbnail)},
+			args: args{userID: "user2", fileID: "file1"},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  fmt.Errorf("file %q thumbnail is not shown to other users", "file1"),
+			},
+		},
+		{
+			name: "should not return the thumbnail to other users if the file has expired",
+			cfg: app.Config{
+				Clock: &StaticClock{T: time.Unix(2, 0)},
+				FileRepo: repoWith(func() blinkfile.FileHeader {
+					file := withThumbnail
+					file.ShowThumbnail = true
+					file.Expires = time.Unix(1, 0)
+					return file
+				}()),
+			},
+			args: args{fileID: "file1"},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  blinkfile.ErrFileExpired,
+			},
+		},
+		{
+			name: "should not return the thumbnail to other users if the file expired from inactivity",
+			cfg: app.Config{
+				Clock: &StaticClock{T: time.Unix(100, 0)},
+				FileRepo: repoWith(func() blinkfile.FileHeader {
+					file := withThumbnail
+					file.ShowThumbnail = true
+					file.Created = time.Unix(0, 0)
+					file.InactivityExpiry = time.Minute
+					return file
+				}()),
+			},
+			args: args{fileID: "file1"},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  blinkfile.ErrFileExpired,
+			},
+		},
+		{
+			name: "should not return the thumbnail to other users if the file is quarantined",
+			cfg: app.Config{
+				FileRepo: repoWith(func() blinkfile.FileHeader {
+					file := withThumbnail
+					file.ShowThumbnail = true
+					file.Quarantined = true
+					return file
+				}()),
+			},
+			args: args{fileID: "file1"},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  blinkfile.ErrFileQuarantined,
+			},
+		},
+		{
+			name: "should not return the thumbnail to the owner if the file is quarantined",
+			cfg: app.Config{
+				FileRepo: repoWith(func() blinkfile.FileHeader {
+					file := withThumbnail
+					file.ShowThumbnail = true
+					file.Quarantined = true
+					return file
+				}()),
+			},
+			args: args{userID: "user1", fileID: "file1"},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  blinkfile.ErrFileQuarantined,
+			},
+		},
+		{
+			name: "should not return the thumbnail to other users if the file is password protected",
+			cfg: app.Config{
+				FileRepo: repoWith(func() blinkfile.FileHeader {
+					file := withThumbnail
+					file.ShowThumbnail = true
+					file.PasswordHash = "hash"
+					return file
+				}()),
+			},
+			args: args{userID: "user2", fileID: "file1"},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  fmt.Errorf("file %q is password protected", "file1"),
+			},
+		},
+		{
+			name: "should not return the thumbnail to other users if the file hasn't been scanned yet",
+			cfg: app.Config{
+				FileRepo: repoWith(func() blinkfile.FileHeader {
+					file := withThumbnail
+					file.ShowThumbnail = true
+					file.ScanStatus = blinkfile.ScanPending
+					return file
+				}()),
+			},
+			args: args{fileID: "file1"},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  blinkfile.ErrFileNotScanned,
+			},
+		},
+		{
+			name: "should not return the thumbnail to other users before the file is available",
+			cfg: app.Config{
+				Clock: &StaticClock{T: time.Unix(100, 0)},
+				FileRepo: repoWith(func() blinkfile.FileHeader {
+					file := withThumbnail
+					file.ShowThumbnail = true
+					file.AvailableFrom = time.Unix(200, 0)
+					return file
+				}()),
+			},
+			args: args{fileID: "file1"},
+			wantErr: &app.Error{
+				Type: app.ErrNotFound,
+				Err:  blinkfile.ErrFileNotAvailable,
+			},
+		},
+		{
+			name: "should return the thumbnail to the owner before the file is available",
+			cfg: app.Config{
+				Clock: &StaticClock{T: time.Unix(100, 0)},
+				FileRepo: repoWith(func() blinkfile.FileHeader {
+					file := withThumbnail
+					file.ShowThumbnail = true
+					file.AvailableFrom = time.Unix(200, 0)
+					return file
+				}()),
+			},
+			args: args{userID: "user1", fileID: "file1"},
+			want: func() blinkfile.FileHeader {
+				file := withThumbnail
+				file.ShowThumbnail = true
+				file.AvailableFrom = time.Unix(200, 0)
+				return file
+			}(),
+		},
+		{
+			name: "should return the thumbnail to other users if the owner chose to show it",
+			cfg: app.Config{
+				FileRepo: repoWith(func() blinkfile.FileHeader {
+					file := withThumbnail
+					file.ShowThumbnail = true
+					return file
+				}()),
+			},
+			args: args{fileID: "file1"},
+			want: func() blinkfile.FileHeader {
+				file := withThumbnail
+				file.ShowThumbnail = true
+				return file
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := AppConfigDefaults(tt.cfg)
+			application := NewTestApp(ctx, t, cfg)
+			got, err := application.GetThumbnail(ctx, tt.args.userID, tt.args.fileID)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("GetThumbnail() error = \n\t%v\n, wantErr \n\t%v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetThumbnail() got:\n\t%+v\nwant:\n\t%+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+type TrashedFile struct {
+	blinkfile.FileHeader
+	// Purges is when the file will be permanently deleted, zero if it's on legal hold.
+	Purges time.Time
+}
+
+// DeleteFiles moves the owner's files to the trash, or deletes them immediately if there is no trash retention. Files on
+// legal hold are skipped.
+func (a *App) DeleteFiles(ctx context.Context, owner blinkfile.UserID, deleteFiles []blinkfile.FileID) error {
+	if owner == "" {
+		return Err(ErrRepo, fmt.Errorf("owner is required"))
+	}
+	deleteFiles, held := a.withoutHeldFiles(ctx, owner, deleteFiles)
+	if a.cfg.TrashRetention <= 0 {
+		if err := a.purgeFiles(ctx, owner, deleteFiles); err != nil {
+			return err
+		}
+		return heldFilesErr(held)
+	}
+	files, err := a.getOwnedFiles(ctx, owner, deleteFiles, false)
+	if err != nil {
+		return err
+	}
+	now := a.cfg.Now()
+	for _, file := range files {
+		// The file is trashed on the current header, so a hold placed since it was checked is kept
+		var denied error
+		_, err = a.cfg.FileRepo.UpdateHeader(ctx, file.ID, func(current *blinkfile.FileHeader) error {
+			denied = ownedFileErr(*current, owner, false)
+			if denied == nil && current.LegalHold {
+				denied = ErrFileOnHold
+			}
+			if denied != nil {
+				return denied
+			}
+			current.Trash(now)
+			return nil
+		})
+		if errors.Is(denied, ErrFileOnHold) {
+			held++
+			continue
+		}
+		if denied != nil {
+			return denied
+		}
+		if err != nil {
+			return Err(ErrRepo, fmt.Errorf("moving file %q to the trash: %w", file.ID, err))
+		}
+		fileChanged(ctx, owner, FileEvent{
+			FileHeader: blinkfile.FileHeader{ID: file.ID},
+			Change:     FileDeleted,
+		})
+	}
+	return heldFilesErr(held)
+}
+
+// getOwnedFiles retrieves all the files, failing if any aren't owned by the owner or aren't in the expected trash state.
+func (a *App) getOwnedFiles(ctx context.Context, owner blinkfile.UserID, fileIDs []blinkfile.FileID, trashed bool) ([]blinkfile.FileHeader, error) {
+	files := make([]blinkfile.FileHeader, 0, len(fileIDs))
+	for _, fileID := range fileIDs {
+		file, err := a.cfg.FileRepo.Get(ctx, fileID)
+		if err == nil && (file.Owner != owner || file.IsTrashed() != trashed) {
+			err = ErrFileNotFound
+		}
+		if err != nil {
+			return nil, Err(ErrRepo, fmt.Errorf("file %q not found for user %q: %w", fileID, owner, err))
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// ownedFileErr checks that a file retrieved earlier by getOwnedFiles is still owned by the owner and in the expected
+// trash state when it's updated.
+func ownedFileErr(file blinkfile.FileHeader, owner blinkfile.UserID, trashed bool) error {
+	if file.Owner != owner || file.IsTrashed() != trashed {
+		return Err(ErrRepo, fmt.Errorf("file %q not found for user %q: %w", file.ID, owner, ErrFileNotFound))
+	}
+	return nil
+}
+
+func (a *App) purgeFiles(ctx context.Context, owner blinkfile.UserID, fileIDs []blinkfile.FileID) error {
+	err := a.cfg.FileRepo.Delete(ctx, owner, fileIDs)
+	if err != nil {
+		return Err(ErrRepo, err)
+	}
+	for _, fileID := range fileIDs {
+		fileChanged(ctx, owner, FileEvent{
+			FileHeader: blinkfile.FileHeader{ID: fileID},
+			Change:     FileDeleted,
+		})
+	}
+	return nil
+}
+
+func (a *App) ListTrashedFiles(ctx context.Context, owner blinkfile.UserID) ([]TrashedFile, error) {
+	if owner == "" {
+		return nil, Err(ErrBadRequest, fmt.Errorf("owner is required"))
+	}
+	files, err := a.cfg.FileRepo.ListByUser(ctx, owner)
+	if err != nil {
+		return nil, Err(ErrRepo, fmt.Errorf("retrieving file list: %w", err))
+	}
+	files = filterTrashed(files, true)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Trashed.After(files[j].Trashed)
+	})
+	out := make([]TrashedFile, 0, len(files))
+	for _, file := range files {
+		var purges time.Time
+		if !file.LegalHold {
+			purges = file.Trashed.Add(a.cfg.TrashRetention)
+		}
+		out = append(out, TrashedFile{file, purges})
+	}
+	return out, nil
+}
+
+func filterTrashed(files []blinkfile.FileHeader, trashed bool) []blinkfile.FileHeader {
+	out := make([]blinkfile.FileHeader, 0, len(files))
+	for _, file := range files {
+		if file.IsTrashed() != trashed {
+			continue
+		}
+		out = append(out, file)
+	}
+	return out
+}
+
+// RestoreFiles takes the owner's files back out of the trash.
+func (a *App) RestoreFiles(ctx context.Context, owner blinkfile.UserID, fileIDs []blinkfile.FileID) error {
+	if owner == "" {
+		return Err(ErrBadRequest, fmt.Errorf("owner is required"))
+	}
+	files, err := a.getOwnedFiles(ctx, owner, fileIDs, true)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		var denied error
+		_, err = a.cfg.FileRepo.UpdateHeader(ctx, file.ID, func(current *blinkfile.FileHeader) error {
+			if denied = ownedFileErr(*current, owner, true); denied != nil {
+				return denied
+			}
+			current.Restore()
+			return nil
+		})
+		if denied != nil {
+			return denied
+		}
+		if err != nil {
+			return Err(ErrRepo, fmt.Errorf("restoring file %q from the trash: %w", file.ID, err))
+		}
+	}
+	return nil
+}
+
+// PurgeTrashedFiles permanently deletes the owner's files from the trash before the retention period is over. Files on
+// legal hold are skipped.
+func (a *App) PurgeTrashedFiles(ctx context.Context, owner blinkfile.UserID, fileIDs []blinkfile.FileID) error {
+	if owner == "" {
+		return Err(ErrBadRequest, fmt.Errorf("owner is required"))
+	}
+	if _, err := a.getOwnedFiles(ctx, owner, fileIDs, true); err != nil {
+		return err
+	}
+	fileIDs, held := a.withoutHeldFiles(ctx, owner, fileIDs)
+	err := a.cfg.FileRepo.Delete(ctx, owner, fileIDs)
+	if err != nil {
+		return Err(ErrRepo, err)
+	}
+	return heldFilesErr(held)
+}
+
+// purgeExpiredTrash deletes all files that have been in the trash for longer than the retention period.
+func (a *App) purgeExpiredTrash(ctx context.Context) error {
+	if a.cfg.TrashRetention <= 0 {
+		return nil
+	}
+	files, err := a.cfg.FileRepo.ListAll(ctx)
+	if err != nil {
+		return Err(ErrRepo, fmt.Errorf("retrieving files: %w", err))
+	}
+	var count int
+	now := a.cfg.Now()
+	for _, file := range filterTrashed(files, true) {
+		if file.LegalHold || file.Trashed.Add(a.cfg.TrashRetention).After(now) {
+			continue
+		}
+		err = a.cfg.FileRepo.Delete(ctx, file.Owner, []blinkfile.FileID{file.ID})
+		if err != nil {
+			return Err(ErrRepo, fmt.Errorf("purging file %q from the trash: %w", file.ID, err))
+		}
+		count++
+	}
+	if count > 0 {
+		a.Printf(ctx, "Purged %d files from the trash", count)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package app_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+)
+
+func TestApp_DeleteFiles_Trash(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0)
+	tests := []struct {
+		name        string
+		files       []blinkfile.FileHeader
+		deleteFiles []blinkfile.FileID
+		wantErr     error
+		wantFiles   map[blinkfile.FileID]blinkfile.FileHeader
+	}{
+		{
+			name:        "should fail without trashing any files if one isn't owned by the user",
+			files:       []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}, {ID: "file2", Owner: "user2"}},
+			deleteFiles: []blinkfile.FileID{"file1", "file2"},
+			wantErr:     app.Err(app.ErrRepo, fmt.Errorf("file %q not found for user %q: %w", "file2", "user1", app.ErrFileNotFound)),
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1"},
+				"file2": {ID: "file2", Owner: "user2"},
+			},
+		},
+		{
+			name:        "should move the files to the trash",
+			files:       []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}, {ID: "file2", Owner: "user1"}},
+			deleteFiles: []blinkfile.FileID{"file1"},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": {ID: "file1", Owner: "user1", Trashed: now},
+				"file2": {ID: "file2", Owner: "user1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMemFileRepo(tt.files...)
+			cfg := AppConfigDefaults(app.Config{
+				Clock:          &StaticClock{T: now},
+				FileRepo:       r,
+				TrashRetention: time.Hour,
+			})
+			application := NewTestApp(ctx, t, cfg)
+			err := application.DeleteFiles(ctx, "user1", tt.deleteFiles)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("DeleteFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(r.files, tt.wantFiles) {
+				t.Errorf("DeleteFiles() files = %+v, want %+v", r.files, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestApp_Trash(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0)
+	trashed := func(id blinkfile.FileID, at time.Time) blinkfile.FileHeader {
+		return blinkfile.FileHeader{ID: id, Owner: "user1", Trashed: at}
+	}
+	tests := []struct {
+		name      string
+		files     []blinkfile.FileHeader
+		act       func(*app.App) error
+		wantErr   error
+		wantFiles map[blinkfile.FileID]blinkfile.FileHeader
+	}{
+		{
+			name:  "should list trashed files newest first with their purge time",
+			files: []blinkfile.FileHeader{trashed("file1", time.Unix(10, 0)), trashed("file2", time.Unix(20, 0)), {ID: "file3", Owner: "user1"}},
+			act: func(a *app.App) error {
+				got, err := a.ListTrashedFiles(ctx, "user1")
+				want := []app.TrashedFile{
+					{FileHeader: trashed("file2", time.Unix(20, 0)), Purges: time.Unix(20, 0).Add(time.Hour)},
+					{FileHeader: trashed("file1", time.Unix(10, 0)), Purges: time.Unix(10, 0).Add(time.Hour)},
+				}
+				if !reflect.DeepEqual(got, want) {
+					return fmt.Errorf("ListTrashedFiles() got = %+v, want %+v", got, want)
+				}
+				return err
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{
+				"file1": trashed("file1", time.Unix(10, 0)),
+				"file2": trashed("file2", time.Unix(20, 0)),
+				"file3": {ID: "file3", Owner: "user1"},
+			},
+		},
+		{
+			name:  "should not list trashed files with the other files",
+			files: []blinkfile.FileHeader{trashed("file1", time.Unix(10, 0))},
+			act: func(a *app.App) error {
+				got, err := a.ListFiles(ctx, "user1")
+				if len(got) != 0 {
+					return fmt.Errorf("ListFiles() got = %+v, want none", got)
+				}
+				return err
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": trashed("file1", time.Unix(10, 0))},
+		},
+		{
+			name:  "should restore trashed files",
+			files: []blinkfile.FileHeader{trashed("file1", time.Unix(10, 0))},
+			act: func(a *app.App) error {
+				return a.RestoreFiles(ctx, "user1", []blinkfile.FileID{"file1"})
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": {ID: "file1", Owner: "user1"}},
+		},
+		{
+			name:  "should fail to restore a file that isn't in the trash",
+			files: []blinkfile.FileHeader{{ID: "file1", Owner: "user1"}},
+			act: func(a *app.App) error {
+				return a.RestoreFiles(ctx, "user1", []blinkfile.FileID{"file1"})
+			},
+			wantErr:   app.Err(app.ErrRepo, fmt.Errorf("file %q not found for user %q: %w", "file1", "user1", app.ErrFileNotFound)),
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": {ID: "file1", Owner: "user1"}},
+		},
+		{
+			name:  "should permanently delete trashed files",
+			files: []blinkfile.FileHeader{trashed("file1", time.Unix(10, 0))},
+			act: func(a *app.App) error {
+				return a.PurgeTrashedFiles(ctx, "user1", []blinkfile.FileID{"file1"})
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{},
+		},
+		{
+			name:  "should purge files from the trash once their retention has passed",
+			files: []blinkfile.FileHeader{trashed("file1", now.Add(-time.Hour)), trashed("file2", now.Add(-time.Minute))},
+			act: func(a *app.App) error {
+				return a.DeleteExpiredFiles(ctx)
+			},
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file2": trashed("file2", now.Add(-time.Minute))},
+		},
+		{
+			name:  "should not download a trashed file, mimicking a missing file",
+			files: []blinkfile.FileHeader{trashed("file1", time.Unix(10, 0))},
+			act: func(a *app.App) error {
+				_, err := a.DownloadFile(ctx, "user2", "file1", "")
+				return err
+			},
+			wantErr:   app.Err(app.ErrAuthzFailed, blinkfile.ErrFilePasswordRequired),
+			wantFiles: map[blinkfile.FileID]blinkfile.FileHeader{"file1": trashed("file1", time.Unix(10, 0))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMemFileRepo(tt.files...)
+			r.ListByUserFunc = func(context.Context, blinkfile.UserID) ([]blinkfile.FileHeader, error) {
+				return r.ListAll(ctx)
+			}
+			cfg := AppConfigDefaults(app.Config{
+				Clock:          &StaticClock{T: now},
+				FileRepo:       r,
+				TrashRetention: time.Hour,
+			})
+			application := NewTestApp(ctx, t, cfg)
+			err := tt.act(application)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(r.files, tt.wantFiles) {
+				t.Errorf("files = %+v, want %+v", r.files, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestApp_UpdateFiles_ConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0)
+	file := blinkfile.FileHeader{ID: "file1", Owner: "user1"}
+	trashed := file
+	trashed.Trashed = now.Add(-time.Hour)
+	tests := []struct {
+		name    string
+		file    blinkfile.FileHeader
+		change  func(*blinkfile.FileHeader)
+		update  func(*app.App) error
+		wantErr error
+		want    func(*blinkfile.FileHeader)
+	}{
+		{
+			name:   "should keep a concurrent download when placing a legal hold",
+			file:   file,
+			change: func(f *blinkfile.FileHeader) { f.Downloads = 1 },
+			update: func(a *app.App) error {
+				return a.SetLegalHold(ctx, "admin", []blinkfile.FileID{"file1"}, true)
+			},
+			want: func(f *blinkfile.FileHeader) { f.LegalHold = true },
+		},
+		{
+			name:   "should keep a concurrent download when moving a file to the trash",
+			file:   file,
+			change: func(f *blinkfile.FileHeader) { f.Downloads = 1 },
+			update: func(a *app.App) error {
+				return a.DeleteFiles(ctx, "user1", []blinkfile.FileID{"file1"})
+			},
+			want: func(f *blinkfile.FileHeader) { f.Trash(now) },
+		},
+		{
+			name:   "should not move a file to the trash if it was concurrently placed on legal hold",
+			file:   file,
+			change: func(f *blinkfile.FileHeader) { f.LegalHold = true },
+			update: func(a *app.App) error {
+				return a.DeleteFiles(ctx, "user1", []blinkfile.FileID{"file1"})
+			},
+			wantErr: app.ErrUser("Files on legal hold", "The file is on legal hold and wasn't deleted.", app.ErrFileOnHold),
+			want:    func(*blinkfile.FileHeader) {},
+		},
+		{
+			name:   "should keep a concurrent legal hold when restoring a file from the trash",
+			file:   trashed,
+			change: func(f *blinkfile.FileHeader) { f.LegalHold = true },
+			update: func(a *app.App) error {
+				return a.RestoreFiles(ctx, "user1", []blinkfile.FileID{"file1"})
+			},
+			want: func(f *blinkfile.FileHeader) { f.Restore() },
+		},
+		{
+			name:   "should keep a concurrent download when updating a file",
+			file:   file,
+			change: func(f *blinkfile.FileHeader) { f.Downloads = 1 },
+			update: func(a *app.App) error {
+				_, err := a.UpdateFile(ctx, app.UpdateFileArgs{ID: "file1", Owner: "user1", Terms: "terms"})
+				return err
+			},
+			want: func(f *blinkfile.FileHeader) { f.Terms = "terms" },
+		},
+		{
+			name:   "should not update a file that was concurrently moved to the trash",
+			file:   file,
+			change: func(f *blinkfile.FileHeader) { f.Trash(now) },
+			update: func(a *app.App) error {
+				_, err := a.UpdateFile(ctx, app.UpdateFileArgs{ID: "file1", Owner: "user1", Terms: "terms"})
+				return err
+			},
+			wantErr: app.Err(app.ErrRepo, fmt.Errorf("file %q not found for user %q: %w", "file1", "user1", app.ErrFileNotFound)),
+			want:    func(*blinkfile.FileHeader) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &staleFileRepo{memFileRepo: newMemFileRepo(tt.file)}
+			stale := tt.file
+			r.stale = &stale
+			current := tt.file
+			tt.change(&current)
+			r.files[tt.file.ID] = current
+			application := NewTestApp(ctx, t, AppConfigDefaults(app.Config{
+				Clock:          &StaticClock{T: now},
+				FileRepo:       r,
+				TrashRetention: 24 * time.Hour,
+			}))
+			err := tt.update(application)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := current
+			tt.want(&want)
+			if got := r.files[tt.file.ID]; !reflect.DeepEqual(got, want) {
+				t.Errorf("file = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
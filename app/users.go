@@ -132,6 +132,10 @@ func (a *App) ChangePassword(ctx context.Context, args ChangePasswordArgs) (blin
 	} else {
 		a.Printf(ctx, "deleted %d sessions for user ID %s", count, args.ID)
 	}
+	err = a.revokeAllUserAPITokens(ctx, args.ID)
+	if err != nil {
+		a.Errorf(ctx, "error deleting user API tokens after changing password: %s", err)
+	}
 	return user.Username, nil
 }
 
@@ -185,19 +189,40 @@ func (a *App) DeleteUsers(ctx context.Context, userIDs []blinkfile.UserID) error
 			return Err(ErrRepo, err)
 		}
 		a.Printf(ctx, "deleted %d sessions for user ID %s", count, userID)
+		err = a.revokeAllUserAPITokens(ctx, userID)
+		if err != nil {
+			return Err(ErrRepo, err)
+		}
 		files, err := a.cfg.FileRepo.ListByUser(ctx, userID)
 		if err != nil {
 			return Err(ErrRepo, err)
 		}
-		filesToDelete := make([]blinkfile.FileID, 0, len(files))
+		var filesToDelete, filesToPurge []blinkfile.FileID
 		for _, file := range files {
-			filesToDelete = append(filesToDelete, file.ID)
+			switch {
+			case file.LegalHold:
+				continue
+			case file.IsTrashed():
+				// DeleteFiles only takes files that aren't in the trash yet
+				filesToPurge = append(filesToPurge, file.ID)
+			default:
+				filesToDelete = append(filesToDelete, file.ID)
+			}
+		}
+		if len(filesToPurge) > 0 {
+			appErr := a.purgeFiles(ctx, userID, filesToPurge)
+			if appErr != nil {
+				return appErr
+			}
 		}
 		appErr := a.DeleteFiles(ctx, userID, filesToDelete)
 		if appErr != nil {
 			return appErr
 		}
-		a.Printf(ctx, "deleted %d files for user ID %s", len(filesToDelete), userID)
+		a.Printf(ctx, "deleted %d files for user ID %s", len(filesToDelete)+len(filesToPurge), userID)
+		if held := len(files) - len(filesToDelete) - len(filesToPurge); held > 0 {
+			a.Printf(ctx, "kept %d files on legal hold for user ID %s", held, userID)
+		}
 		err = a.cfg.CredentialRepo.Remove(ctx, userID)
 		if err != nil {
 			return Err(ErrRepo, err)
@@ -3,12 +3,16 @@ package app_test
 import (
 	"context"
 	"fmt"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/benjohns1/blinkfile"
 
 	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/app/repo"
 )
 
 func TestApp_CreateUser(t *testing.T) {
@@ -226,6 +230,21 @@ func TestApp_DeleteUsers(t *testing.T) {
 				Err:  fmt.Errorf("cred repo err"),
 			},
 		},
+		{
+			name: "should fail if API token repo returns an error",
+			args: args{
+				userIDs: []blinkfile.UserID{"u1"},
+			},
+			cfg: app.Config{
+				APITokenRepo: &StubAPITokenRepo{DeleteAllFunc: func(context.Context, blinkfile.UserID) (int, error) {
+					return 0, fmt.Errorf("token repo err")
+				}},
+			},
+			wantErr: &app.Error{
+				Type: app.ErrRepo,
+				Err:  fmt.Errorf("token repo err"),
+			},
+		},
 		{
 			name: "should delete a user",
 			args: args{
@@ -244,3 +263,45 @@ func TestApp_DeleteUsers(t *testing.T) {
 		})
 	}
 }
+
+func TestApp_DeleteUsers_TrashedFiles(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0).UTC()
+	files, err := repo.NewFileRepo(ctx, repo.FileRepoConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, header := range []blinkfile.FileHeader{
+		{ID: "file1", Owner: "u1"},
+		{ID: "file2", Owner: "u1", Trashed: now.Add(-time.Hour)},
+		{ID: "file3", Owner: "u1", Trashed: now.Add(-time.Hour), LegalHold: true},
+	} {
+		err = files.Save(ctx, blinkfile.File{FileHeader: header, Data: io.NopCloser(strings.NewReader("file-data"))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := AppConfigDefaults(app.Config{
+		Clock:          &StaticClock{T: now},
+		FileRepo:       files,
+		TrashRetention: 7 * 24 * time.Hour,
+	})
+	application := NewTestApp(ctx, t, cfg)
+
+	err = application.DeleteUsers(ctx, []blinkfile.UserID{"u1"})
+	if err != nil {
+		t.Fatalf("DeleteUsers() error = %v", err)
+	}
+	got, err := files.ListByUser(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashed := make(map[blinkfile.FileID]bool, len(got))
+	for _, file := range got {
+		trashed[file.ID] = file.IsTrashed()
+	}
+	want := map[blinkfile.FileID]bool{"file1": true, "file3": true}
+	if !reflect.DeepEqual(trashed, want) {
+		t.Errorf("DeleteUsers() left files trashed = %v, want %v", trashed, want)
+	}
+}
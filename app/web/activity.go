@@ -0,0 +1,65 @@
+package web
+
+import (
+	"strings"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/kataras/iris/v12"
+)
+
+type (
+	FileActivityView struct {
+		LayoutView
+		File          FileView
+		AccessRecords []AccessRecordView
+	}
+
+	AccessRecordView struct {
+		Time      string
+		Action    string
+		User      string
+		IP        string
+		UserAgent string
+		RequestID string
+		BytesSent string
+		Detail    string
+	}
+)
+
+// showFileActivity shows the owner every attempt to download one of their files, newest first.
+func showFileActivity(ctx iris.Context, a App) error {
+	fileID := blinkfile.FileID(ctx.Params().Get("file_id"))
+	owner := loggedInUser(ctx)
+	file, err := a.GetFile(ctx, owner, fileID)
+	if err != nil {
+		return err
+	}
+	records, err := a.ListFileAccess(ctx, owner, fileID)
+	if err != nil {
+		return err
+	}
+	view := FileActivityView{File: fileToView(file, a.FilePasswordLocked(file))}
+	for _, record := range records {
+		user := string(record.UserID)
+		if record.UserID == owner {
+			user = "You"
+		}
+		var bytesSent string
+		if record.BytesSent > 0 {
+			bytesSent = formatFileSize(record.BytesSent)
+		}
+		view.AccessRecords = append(view.AccessRecords, AccessRecordView{
+			Time:      record.Time.Format(time.RFC3339),
+			Action:    strings.ReplaceAll(string(record.Action), "_", " "),
+			User:      user,
+			IP:        record.IP,
+			UserAgent: record.UserAgent,
+			RequestID: record.RequestID,
+			BytesSent: bytesSent,
+			Detail:    record.Detail,
+		})
+	}
+	ctx.ViewData("content", view)
+	return ctx.View("file_activity.html")
+}
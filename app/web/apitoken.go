@@ -0,0 +1,224 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/longduration"
+	"github.com/kataras/iris/v12"
+)
+
+type (
+	APITokensView struct {
+		LayoutView
+		Tokens []APITokenView
+		// NewToken is only shown once, right after it's created.
+		NewToken string
+		// UploadURL is where the new token can upload files to.
+		UploadURL string
+		Scopes    []app.APITokenScope
+		MessageView
+	}
+
+	APITokenView struct {
+		ID       string
+		Name     string
+		Scopes   string
+		Created  string
+		Expires  string
+		LastUsed string
+	}
+)
+
+// apiTokenUserKey stores the user authenticated by an API token in the request values, where loggedInUser finds it.
+const apiTokenUserKey = "api_token_user"
+
+// apiTokenRequired authenticates scripts and other clients that aren't browsers with an API token that has the scope in
+// the Authorization header, instead of the login cookie that loginRequired checks.
+func apiTokenRequired(scope app.APITokenScope) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		if _, ok := bearerToken(ctx); !ok {
+			ctx.Header("WWW-Authenticate", "Bearer")
+			respondError(ctx, a, app.Err(app.ErrAuthnFailed, fmt.Errorf("API token is missing")).AddDetail("An API token is required."))
+			return nil
+		}
+		if authenticateAPIToken(ctx, a, scope) {
+			ctx.Next()
+		}
+		return nil
+	}
+}
+
+// apiTokenAccepted authenticates clients that send an API token with the scope, so they act as its user, while clients
+// without one continue anonymously, like anyone with a file's link.
+func apiTokenAccepted(scope app.APITokenScope) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		if _, ok := bearerToken(ctx); !ok || authenticateAPIToken(ctx, a, scope) {
+			ctx.Next()
+		}
+		return nil
+	}
+}
+
+// authenticateAPIToken stores the user of the request's API token where loggedInUser finds it, or responds with the error
+// and returns false if the token is invalid or doesn't have the scope.
+func authenticateAPIToken(ctx iris.Context, a App, scope app.APITokenScope) bool {
+	token, _ := bearerToken(ctx)
+	userID, err := a.AuthenticateAPIToken(ctx, token, scope)
+	if err != nil {
+		errorCode := "invalid_token"
+		var appErr *app.Error
+		if errors.As(err, &appErr) && appErr.Type == app.ErrAuthzFailed {
+			errorCode = "insufficient_scope"
+		}
+		ctx.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="%s", scope="%s"`, errorCode, scope))
+		respondError(ctx, a, err)
+		return false
+	}
+	ctx.Values().Set(apiTokenUserKey, string(userID))
+	return true
+}
+
+func bearerToken(ctx iris.Context) (string, bool) {
+	token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	return token, ok && token != ""
+}
+
+// uploadRawFile uploads the request body as a file, like curl -T does, and responds with the file's download URL in
+// plain text. The expiration and download limit are query parameters, the password and download limit can also be sent
+// in headers so they stay out of logged URLs.
+func uploadRawFile(trustedProxies []netip.Prefix) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		file, err := doRawFileUpload(ctx, a)
+		if err != nil {
+			respondError(ctx, a, err)
+			return nil
+		}
+		link := absoluteURL(ctx, fmt.Sprintf("/file/%s", file.ID), nil, trustedProxies)
+		ctx.Header("Location", link)
+		ctx.StatusCode(http.StatusCreated)
+		_, err = ctx.WriteString(link + "\n")
+		return err
+	}
+}
+
+func doRawFileUpload(ctx iris.Context, a App) (blinkfile.FileHeader, error) {
+	filename := ctx.Params().Get("filename")
+	if filename == "" {
+		return blinkfile.FileHeader{}, app.ErrUser("Invalid file.", "The file name is required in the URL, such as /upload/file.txt.", fmt.Errorf("upload filename is empty"))
+	}
+	downloadLimitStr := ctx.URLParam("limit")
+	if downloadLimitStr == "" {
+		downloadLimitStr = ctx.GetHeader("X-Download-Limit")
+	}
+	var downloadLimit int64
+	if downloadLimitStr != "" {
+		var err error
+		downloadLimit, err = strconv.ParseInt(downloadLimitStr, 10, 64)
+		if err != nil {
+			return blinkfile.FileHeader{}, app.ErrUser("Invalid download limit.", "Invalid file download limit, please make sure it's a valid number.", err)
+		}
+	}
+	req := ctx.Request()
+	// The size is unknown for chunked uploads, the repo records the size that was stored either way
+	size := max(req.ContentLength, 0)
+	return a.UploadFile(ctx, app.UploadFileArgs{
+		Filename:      filename,
+		Owner:         loggedInUser(ctx),
+		Reader:        req.Body,
+		Size:          size,
+		Password:      ctx.GetHeader("X-File-Password"),
+		ExpiresIn:     longduration.LongDuration(ctx.URLParam("expires")),
+		DownloadLimit: downloadLimit,
+	})
+}
+
+func showAPITokens(ctx iris.Context, a App) error {
+	view, err := apiTokensView(ctx, a)
+	if err != nil {
+		return err
+	}
+	view.MessageView = flashMessageView(ctx)
+	ctx.ViewData("content", view)
+	return ctx.View("tokens.html")
+}
+
+func apiTokensView(ctx iris.Context, a App) (APITokensView, error) {
+	tokens, err := a.ListAPITokens(ctx, loggedInUser(ctx))
+	if err != nil {
+		return APITokensView{}, err
+	}
+	views := make([]APITokenView, 0, len(tokens))
+	for _, token := range tokens {
+		scopes := make([]string, 0, len(token.Scopes))
+		for _, scope := range token.Scopes {
+			scopes = append(scopes, string(scope))
+		}
+		var expires, lastUsed string
+		if !token.Expires.IsZero() {
+			expires = token.Expires.Format(time.RFC3339)
+		}
+		if !token.LastUsed.IsZero() {
+			lastUsed = token.LastUsed.Format(time.RFC3339)
+		}
+		views = append(views, APITokenView{
+			ID:       string(token.ID),
+			Name:     token.Name,
+			Scopes:   strings.Join(scopes, ", "),
+			Created:  token.Created.Format(time.RFC3339),
+			Expires:  expires,
+			LastUsed: lastUsed,
+		})
+	}
+	return APITokensView{Tokens: views, Scopes: app.APITokenScopes}, nil
+}
+
+// createAPIToken shows the new token on the page instead of redirecting, so it's never stored in the session.
+func createAPIToken(trustedProxies []netip.Prefix) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		var scopes []app.APITokenScope
+		for _, scope := range ctx.FormValues()["scope"] {
+			scopes = append(scopes, app.APITokenScope(scope))
+		}
+		secret, token, err := a.CreateAPIToken(ctx, app.CreateAPITokenArgs{
+			UserID:    loggedInUser(ctx),
+			Name:      ctx.FormValue("name"),
+			Scopes:    scopes,
+			ExpiresIn: longduration.LongDuration(ctx.FormValue("expires_in")),
+		})
+		view, listErr := apiTokensView(ctx, a)
+		if listErr != nil {
+			return listErr
+		}
+		if err != nil {
+			view.ErrorView = ParseAppErr(ctx, a, err)
+		} else {
+			view.NewToken = secret
+			if token.HasScope(app.APIScopeUpload) {
+				view.UploadURL = absoluteURL(ctx, "/upload/", nil, trustedProxies)
+			}
+			view.SuccessMessage = fmt.Sprintf("Created token %s, copy it now because it won't be shown again", token.Name)
+		}
+		ctx.ViewData("content", view)
+		return ctx.View("tokens.html")
+	}
+}
+
+func revokeAPIToken(ctx iris.Context, a App) error {
+	err := a.RevokeAPIToken(ctx, loggedInUser(ctx), app.APITokenID(ctx.FormValue("token_id")))
+	if err != nil {
+		setFlashErr(ctx, a, err)
+	} else {
+		setFlashSuccess(ctx, "Revoked the token")
+	}
+	ctx.Redirect("/tokens")
+	return nil
+}
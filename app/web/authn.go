@@ -1,6 +1,7 @@
 package web
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -11,18 +12,21 @@ import (
 
 type LoginView struct {
 	LayoutView
+	ProofOfWork *ProofOfWorkView
 	MessageView
 }
 
 const authnTokenCookieName = "token"
 
-func showLogin(ctx iris.Context, a App) error {
-	if isAuthenticated(ctx, a) {
-		ctx.Redirect("/")
-		return nil
+func showLogin(p *proofOfWork) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		if isAuthenticated(ctx, a) {
+			ctx.Redirect("/")
+			return nil
+		}
+		ctx.ViewData("content", LoginView{ProofOfWork: p.issue(ctx, powLoginScope, "")})
+		return ctx.View("login.html")
 	}
-	ctx.ViewData("content", LoginView{})
-	return ctx.View("login.html")
 }
 
 func isAuthenticated(ctx iris.Context, a App) bool {
@@ -72,17 +76,20 @@ func requirePermission(permission string) func(iris.Context, App) error {
 	}
 }
 
-func logout(ctx iris.Context, a App) error {
-	err := doLogout(ctx, a)
-	if err != nil {
-		return err
+func logout(p *proofOfWork) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		err := doLogout(ctx, a)
+		if err != nil {
+			return err
+		}
+		ctx.ViewData("content", LoginView{
+			ProofOfWork: p.issue(ctx, powLoginScope, ""),
+			MessageView: MessageView{
+				SuccessMessage: "Successfully logged out",
+			},
+		})
+		return ctx.View("login.html")
 	}
-	ctx.ViewData("content", LoginView{
-		MessageView: MessageView{
-			SuccessMessage: "Successfully logged out",
-		},
-	})
-	return ctx.View("login.html")
 }
 
 func doLogout(ctx iris.Context, a App) error {
@@ -102,22 +109,32 @@ func doLogout(ctx iris.Context, a App) error {
 	return nil
 }
 
-func login(ctx iris.Context, a App) error {
-	view, err := doLogin(ctx, a)
-	if err != nil {
-		view.ErrorView = ParseAppErr(ctx, a, err)
+func login(p *proofOfWork) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		view, err := doLogin(ctx, a, p)
+		if err != nil {
+			view.ErrorView = ParseAppErr(ctx, a, err)
+			view.ProofOfWork = p.issue(ctx, powLoginScope, "")
+		}
+		ctx.ViewData("content", view)
+		return ctx.View("login.html")
 	}
-	ctx.ViewData("content", view)
-	return ctx.View("login.html")
 }
 
-func doLogin(ctx iris.Context, a App) (LoginView, error) {
+func doLogin(ctx iris.Context, a App, p *proofOfWork) (LoginView, error) {
 	session, err := getSession(ctx)
 	if err != nil {
 		return LoginView{}, err
 	}
 	username := blinkfile.Username(ctx.FormValue("username"))
 	session.setUsername(username)
+	err = p.verify(ctx, powLoginScope, "")
+	if errors.Is(err, errProofOfWorkMissing) {
+		return LoginView{}, app.ErrUser("Verification required", "Your browser needs to be verified before logging in, please try again.", err)
+	}
+	if err != nil {
+		return LoginView{}, err
+	}
 	password := ctx.FormValue("password")
 	req := ctx.Request()
 	data := app.SessionRequestData{
@@ -126,6 +143,7 @@ func doLogin(ctx iris.Context, a App) (LoginView, error) {
 	}
 	authn, err := a.Login(ctx, username, password, data)
 	if err != nil {
+		p.failed(ctx, powLoginScope)
 		return LoginView{}, err
 	}
 	ctx.SetCookie(&http.Cookie{
@@ -2,9 +2,11 @@ package web
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/benjohns1/blinkfile/app"
 	"github.com/benjohns1/blinkfile/request"
@@ -73,6 +75,55 @@ func showError(ctx iris.Context, a App, err error) {
 	a.Errorf(ctx, err.Error())
 }
 
+// problemView is an RFC 9457 problem details response.
+type problemView struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance"`
+}
+
+// respondError shows the error with its status code in the format the client accepts: HTML for browsers, problem
+// details for clients that accept JSON, and plain text for anything else, such as curl.
+func respondError(ctx iris.Context, a App, err error) {
+	view := ParseAppErr(ctx, a, err)
+	ctx.StatusCode(view.Status)
+	switch {
+	case acceptsHTML(ctx):
+		ctx.ViewData("content", view)
+		err = ctx.View("error.html")
+	case accepts(ctx, "application/json", "application/problem+json"):
+		var data []byte
+		data, err = json.Marshal(problemView{view.Type, view.Title, view.Status, view.Detail, view.Instance})
+		if err == nil {
+			ctx.ContentType("application/problem+json")
+			_, err = ctx.Write(data)
+		}
+	default:
+		_, err = ctx.WriteString(fmt.Sprintf("%s: %s\n", view.Title, view.Detail))
+	}
+	if err != nil {
+		a.Errorf(ctx, "responding with error: %v", err)
+	}
+}
+
+// acceptsHTML returns true if the client asked for HTML, like browsers do.
+func acceptsHTML(ctx iris.Context) bool {
+	return accepts(ctx, "text/html")
+}
+
+// accepts returns true if the Accept header names any of the media types.
+func accepts(ctx iris.Context, mediaTypes ...string) bool {
+	accept := ctx.GetHeader("Accept")
+	for _, mediaType := range mediaTypes {
+		if strings.Contains(accept, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
 func ParseAppErr(ctx context.Context, a App, err error) ErrorView {
 	var appErr *app.Error
 	if !errors.As(err, &appErr) {
@@ -6,19 +6,27 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/benjohns1/blinkfile"
 	"github.com/benjohns1/blinkfile/app"
 	"github.com/benjohns1/blinkfile/longduration"
+	"github.com/benjohns1/blinkfile/request"
 	"github.com/kataras/iris/v12"
 )
 
 type (
 	FilesView struct {
 		LayoutView
-		Files []FileView
+		Files                      []FileView
+		StripImageMetadataEnforced bool
+		EmailVerificationEnabled   bool
+		SharingRules               []string
+		PasswordRequired           bool
+		DefaultTerms               bool
 		MessageView
 	}
 	FileView struct {
@@ -31,20 +39,60 @@ type (
 		ByteSize          int64
 		Size              string
 		PasswordProtected bool
+		ContentType       string
+		Previewable       bool
+		HasThumbnail      bool
+		MetadataStripped  bool
+		Quarantined       bool
+		QuarantineReason  string
+		ScanPending       bool
+		InactivityExpiry  string
+		AvailableFrom     string
+		LegalHold         bool
+		// FailedPasswords counts the wrong passwords entered since the last correct one.
+		FailedPasswords int64
+		PasswordLocked  bool
+		AllowedNetworks string
+		RecipientEmails string
+		Terms           string
+	}
+	EditFileView struct {
+		LayoutView
+		File             FileView
+		InactivityAmount int64
+		InactivityUnit   string
+		// DownloadRateLimit is in KiB per second.
+		DownloadRateLimit        int64
+		EmailVerificationEnabled bool
+		MessageView
 	}
 	FileDownloadView struct {
 		LayoutView
-		ID string
+		ID          string
+		ProofOfWork *ProofOfWorkView
+		// Recipient is set if the client must verify a recipient email address before downloading.
+		Recipient *RecipientView
+		// Terms are set if the client must accept them before downloading.
+		Terms string
 		MessageView
 	}
 )
 
-func fileToView(file blinkfile.FileHeader) FileView {
+func fileToView(file blinkfile.FileHeader, passwordLocked bool) FileView {
 	var expires string
-	if file.Expires.IsZero() {
+	if expiresAt := file.ExpiresAt(); expiresAt.IsZero() {
 		expires = "Never"
 	} else {
-		expires = file.Expires.Format(time.RFC3339)
+		expires = expiresAt.Format(time.RFC3339)
+	}
+	var availableFrom string
+	if !file.AvailableFrom.IsZero() {
+		availableFrom = file.AvailableFrom.Format(time.RFC3339)
+	}
+	var inactivityExpiry string
+	if file.InactivityExpiry > 0 {
+		amount, unit := splitDuration(file.InactivityExpiry)
+		inactivityExpiry = fmt.Sprintf("%d%s", amount, unit)
 	}
 	return FileView{
 		ID:                string(file.ID),
@@ -56,9 +104,41 @@ func fileToView(file blinkfile.FileHeader) FileView {
 		ByteSize:          file.Size,
 		Size:              formatFileSize(file.Size),
 		PasswordProtected: file.PasswordHash != "",
+		ContentType:       file.ContentType,
+		Previewable:       file.Previewable(),
+		HasThumbnail:      file.ThumbnailLocation != "",
+		MetadataStripped:  file.MetadataStripped,
+		Quarantined:       file.Quarantined,
+		QuarantineReason:  file.QuarantineReason,
+		ScanPending:       file.ScanStatus == blinkfile.ScanPending,
+		InactivityExpiry:  inactivityExpiry,
+		AvailableFrom:     availableFrom,
+		LegalHold:         file.LegalHold,
+		FailedPasswords:   file.FailedPasswordAttempts,
+		PasswordLocked:    passwordLocked,
+		AllowedNetworks:   formatNetworks(file.AllowedNetworks),
+		RecipientEmails:   strings.Join(file.RecipientEmails, ", "),
+		Terms:             file.Terms,
 	}
 }
 
+// splitDuration splits the duration into the largest whole long duration unit, rounding down to the minute.
+func splitDuration(d time.Duration) (int64, string) {
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{
+		{7 * 24 * time.Hour, "w"},
+		{24 * time.Hour, "d"},
+		{time.Hour, "h"},
+	} {
+		if d%unit.d == 0 {
+			return int64(d / unit.d), unit.name
+		}
+	}
+	return int64(d / time.Minute), "m"
+}
+
 func showFiles(ctx iris.Context, a App) error {
 	owner := loggedInUser(ctx)
 	files, err := a.ListFiles(ctx, owner)
@@ -67,11 +147,20 @@ func showFiles(ctx iris.Context, a App) error {
 	}
 	fileList := make([]FileView, 0, len(files))
 	for _, file := range files {
-		fileList = append(fileList, fileToView(file))
+		fileList = append(fileList, fileToView(file, a.FilePasswordLocked(file)))
+	}
+	sharing, err := a.GetSharingPolicy(ctx, owner)
+	if err != nil {
+		return err
 	}
 	ctx.ViewData("content", FilesView{
-		Files:       fileList,
-		MessageView: flashMessageView(ctx),
+		Files:                      fileList,
+		StripImageMetadataEnforced: a.StripImageMetadataEnforced(),
+		EmailVerificationEnabled:   a.EmailVerificationEnabled(),
+		SharingRules:               app.SharingRules(sharing),
+		PasswordRequired:           sharing.RequirePassword,
+		DefaultTerms:               sharing.DefaultTerms != "",
+		MessageView:                flashMessageView(ctx),
 	})
 	return ctx.View("files.html")
 }
@@ -92,26 +181,24 @@ func formatFileSize(size int64) string {
 }
 
 func uploadFile(ctx iris.Context, a App) error {
-	filename, err := doFileUpload(ctx, a)
+	file, err := doFileUpload(ctx, a)
 	if err != nil {
 		setFlashErr(ctx, a, err)
+	} else if file.MetadataStripped {
+		setFlashSuccess(ctx, fmt.Sprintf("Successfully uploaded %s, location and other metadata was removed from the image", file.Name))
 	} else {
-		setFlashSuccess(ctx, fmt.Sprintf("Successfully uploaded %s", filename))
+		setFlashSuccess(ctx, fmt.Sprintf("Successfully uploaded %s", file.Name))
 	}
 	ctx.Redirect("/")
 	return nil
 }
 
-func doFileUpload(ctx iris.Context, a App) (string, error) {
+func doFileUpload(ctx iris.Context, a App) (blinkfile.FileHeader, error) {
 	args, err := parseFileUploadArgs(ctx)
 	if err != nil {
-		return "", err
-	}
-	err = a.UploadFile(ctx, args)
-	if err != nil {
-		return "", err
+		return blinkfile.FileHeader{}, err
 	}
-	return args.Filename, nil
+	return a.UploadFile(ctx, args)
 }
 
 func parseFileUploadArgs(ctx iris.Context) (app.UploadFileArgs, error) {
@@ -121,11 +208,7 @@ func parseFileUploadArgs(ctx iris.Context) (app.UploadFileArgs, error) {
 		return empty, app.ErrUser("Invalid file.", "We couldn't retrieve the uploaded file, please try again.", err)
 	}
 
-	var expiresIn longduration.LongDuration
-	expireFutureAmount := ctx.FormValue("expire_in_amount")
-	if expireFutureAmount != "" {
-		expiresIn = longduration.LongDuration(fmt.Sprintf("%s%s", expireFutureAmount, ctx.FormValue("expire_in_unit")))
-	}
+	expiresIn := longDurationFormValue(ctx, "expire_in_amount", "expire_in_unit")
 	var expires time.Time
 	expirationTime := ctx.FormValue("expiration_time")
 	if expirationTime != "" {
@@ -135,6 +218,16 @@ func parseFileUploadArgs(ctx iris.Context) (app.UploadFileArgs, error) {
 			return empty, app.ErrUser("Invalid expiration time.", fmt.Sprintf("We couldn't understand the file expiration time %q, please make sure the date format is correct.", expirationTime), err)
 		}
 	}
+	availableIn := longDurationFormValue(ctx, "available_in_amount", "available_in_unit")
+	var availableFrom time.Time
+	availableTime := ctx.FormValue("available_time")
+	if availableTime != "" {
+		availableFrom, err = time.Parse(time.RFC3339, availableTime)
+		if err != nil {
+			err = fmt.Errorf("parsing available time %q: %w", availableTime, err)
+			return empty, app.ErrUser("Invalid availability time.", fmt.Sprintf("We couldn't understand the file availability time %q, please make sure the date format is correct.", availableTime), err)
+		}
+	}
 	var downloadLimit int64
 	downloadLimitStr := ctx.FormValue("download_limit")
 	if downloadLimitStr != "" {
@@ -144,68 +237,244 @@ func parseFileUploadArgs(ctx iris.Context) (app.UploadFileArgs, error) {
 		}
 	}
 	return app.UploadFileArgs{
-		Filename:      header.Filename,
-		Owner:         loggedInUser(ctx),
-		Reader:        file,
-		Size:          header.Size,
-		Password:      ctx.FormValue("password"),
-		ExpiresIn:     expiresIn,
-		Expires:       expires,
-		DownloadLimit: downloadLimit,
+		Filename:         header.Filename,
+		Owner:            loggedInUser(ctx),
+		Reader:           file,
+		Size:             header.Size,
+		Password:         ctx.FormValue("password"),
+		ExpiresIn:        expiresIn,
+		Expires:          expires,
+		DownloadLimit:    downloadLimit,
+		AllowPreview:     ctx.FormValue("allow_preview") == "on",
+		ShowThumbnail:    ctx.FormValue("show_thumbnail") == "on",
+		StripMetadata:    ctx.FormValue("strip_metadata") == "on",
+		InactivityExpiry: longDurationFormValue(ctx, "expire_inactive_amount", "expire_inactive_unit"),
+		AvailableIn:      availableIn,
+		AvailableFrom:    availableFrom,
+		AllowedNetworks:  listFormValue(ctx, "allowed_networks"),
+		RecipientEmails:  listFormValue(ctx, "recipient_emails"),
+		Terms:            ctx.FormValue("terms"),
 	}, nil
 }
 
-func sanitizeFilename(in string) string {
-	return strings.ReplaceAll(in, ";", "_")
+// listFormValue splits a form field of values separated by commas or whitespace, such as IP addresses or emails.
+func listFormValue(ctx iris.Context, field string) []string {
+	return strings.FieldsFunc(ctx.FormValue(field), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// formatNetworks lists the networks, showing ranges of a single address as just the address.
+func formatNetworks(networks []netip.Prefix) string {
+	out := make([]string, 0, len(networks))
+	for _, network := range networks {
+		if network.IsSingleIP() {
+			out = append(out, network.Addr().String())
+			continue
+		}
+		out = append(out, network.String())
+	}
+	return strings.Join(out, ", ")
 }
 
-func downloadFile(ctx iris.Context, a App) error {
+// longDurationFormValue combines an amount and a unit form field into a long duration, which is empty if no amount was
+// entered.
+func longDurationFormValue(ctx iris.Context, amountField, unitField string) longduration.LongDuration {
+	amount := ctx.FormValue(amountField)
+	if amount == "" {
+		return ""
+	}
+	return longduration.LongDuration(fmt.Sprintf("%s%s", amount, ctx.FormValue(unitField)))
+}
+
+func showEditFile(ctx iris.Context, a App) error {
 	fileID := blinkfile.FileID(ctx.Params().Get("file_id"))
-	view := FileDownloadView{
-		ID: string(fileID),
+	file, err := a.GetFile(ctx, loggedInUser(ctx), fileID)
+	if err != nil {
+		return err
+	}
+	view := EditFileView{
+		File:                     fileToView(file, a.FilePasswordLocked(file)),
+		InactivityUnit:           "d",
+		EmailVerificationEnabled: a.EmailVerificationEnabled(),
+		MessageView:              flashMessageView(ctx),
+	}
+	if file.InactivityExpiry > 0 {
+		view.InactivityAmount, view.InactivityUnit = splitDuration(file.InactivityExpiry)
 	}
-	err := func() error {
-		user := loggedInUser(ctx)
-		password := ctx.FormValue("password")
-		file, err := a.DownloadFile(ctx, user, fileID, password)
+	view.DownloadRateLimit = file.DownloadRateLimit / 1024
+	ctx.ViewData("content", view)
+	return ctx.View("file_edit.html")
+}
+
+func editFile(ctx iris.Context, a App) error {
+	fileID := blinkfile.FileID(ctx.Params().Get("file_id"))
+	file, err := doEditFile(ctx, a, fileID)
+	if err != nil {
+		setFlashErr(ctx, a, err)
+	} else {
+		setFlashSuccess(ctx, fmt.Sprintf("Saved settings for %s", file.Name))
+	}
+	ctx.Redirect(fmt.Sprintf("/files/%s/edit", fileID))
+	return nil
+}
+
+func doEditFile(ctx iris.Context, a App, fileID blinkfile.FileID) (blinkfile.FileHeader, error) {
+	var rateLimit int64
+	if rateLimitStr := ctx.FormValue("download_rate_limit"); rateLimitStr != "" {
+		_, err := fmt.Sscan(rateLimitStr, &rateLimit)
 		if err != nil {
-			return err
+			return blinkfile.FileHeader{}, app.ErrUser("Invalid download speed limit.", "Invalid download speed limit, please make sure it's a valid number.", err)
 		}
-		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", sanitizeFilename(file.Name)))
-		err = ctx.ServeFileWithRate(file.Location, 0, 0)
+	}
+	return a.UpdateFile(ctx, app.UpdateFileArgs{
+		ID:                fileID,
+		Owner:             loggedInUser(ctx),
+		InactivityExpiry:  longDurationFormValue(ctx, "expire_inactive_amount", "expire_inactive_unit"),
+		DownloadRateLimit: rateLimit * 1024,
+		UnlockPassword:    ctx.FormValue("unlock_password") != "",
+		AllowedNetworks:   listFormValue(ctx, "allowed_networks"),
+		RecipientEmails:   listFormValue(ctx, "recipient_emails"),
+		Terms:             ctx.FormValue("terms"),
+	})
+}
+
+func sanitizeFilename(in string) string {
+	return strings.ReplaceAll(in, ";", "_")
+}
+
+func downloadFile(throttle *downloadThrottle, p *proofOfWork) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		fileID := blinkfile.FileID(ctx.Params().Get("file_id"))
+		view := FileDownloadView{
+			ID: string(fileID),
+		}
+		err := func() error {
+			err := p.verify(ctx, powFileScope, string(fileID))
+			if err != nil {
+				return err
+			}
+			done, ok := throttle.start(fileID, request.GetClientIP(ctx).String())
+			if !ok {
+				return errTooManyDownloads
+			}
+			defer done()
+			user := loggedInUser(ctx)
+			password := filePassword(ctx)
+			file, err := a.DownloadFile(withTermsAccepted(withRecipientToken(ctx, fileID)), user, fileID, password)
+			if err != nil {
+				if fileAccessFailed(err) {
+					p.failed(ctx, powFileScope)
+				}
+				return err
+			}
+			defer a.FinishDownload(ctx, file.ID)
+			ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", sanitizeFilename(file.Name)))
+			sent, err := throttle.serveFile(ctx, file)
+			a.RecordDownload(ctx, user, file.ID, sent)
+			if err != nil {
+				return fmt.Errorf("sending file data: %w", err)
+			}
+			return nil
+		}()
 		if err != nil {
-			return fmt.Errorf("sending file data: %w", err)
+			if errors.Is(err, errTooManyDownloads) {
+				err = throttle.tooManyDownloads(ctx)
+			}
+			if !acceptsHTML(ctx) {
+				respondError(ctx, a, plainFileErr(ctx, err))
+				return nil
+			}
+			if errors.Is(err, errTooManyDownloads) {
+				ctx.StatusCode(http.StatusTooManyRequests)
+				view.ErrorView = ParseAppErr(ctx, a, err)
+			} else {
+				setDownloadErr(ctx, a, &view, err)
+			}
+			view.ProofOfWork = p.issue(ctx, powFileScope, string(fileID))
+			ctx.ViewData("content", view)
+			return ctx.View("file.html")
 		}
 		return nil
-	}()
-	if err != nil {
+	}
+}
+
+// filePassword returns the file password from the download form, the X-File-Password header or the password of HTTP
+// Basic auth, whose username is ignored, so scripts can download password-protected files.
+func filePassword(ctx iris.Context) string {
+	if password := ctx.FormValue("password"); password != "" {
+		return password
+	}
+	if password := ctx.GetHeader("X-File-Password"); password != "" {
+		return password
+	}
+	_, password, _ := ctx.Request().BasicAuth()
+	return password
+}
+
+// plainFileErr explains what the download form would ask for to clients that don't accept HTML, such as scripts. A
+// missing or wrong password is challenged with HTTP Basic auth, so they can retry with it.
+func plainFileErr(ctx iris.Context, err error) error {
+	switch {
+	case errors.Is(err, blinkfile.ErrFilePasswordRequired), errors.Is(err, blinkfile.ErrFilePasswordInvalid):
+		ctx.Header("WWW-Authenticate", `Basic realm="file password", charset="UTF-8"`)
 		if errors.Is(err, blinkfile.ErrFilePasswordRequired) {
-			view.MessageView.SuccessMessage = "Password required"
-		} else if errors.Is(err, blinkfile.ErrFilePasswordInvalid) {
-			errView := ParseAppErr(ctx, a, err)
-			errView.Detail = "Invalid password"
-			view.ErrorView = errView
+			return app.Err(app.ErrAuthnFailed, err).AddDetail("The file's password is required.")
 		}
-		ctx.ViewData("content", view)
-		return ctx.View("file.html")
+		return app.Err(app.ErrAuthnFailed, err).AddDetail("Invalid password.")
+	case errors.Is(err, blinkfile.ErrRecipientNotVerified), errors.Is(err, blinkfile.ErrTermsNotAccepted), errors.Is(err, errProofOfWorkMissing):
+		return app.Err(app.ErrAuthzFailed, err).AddDetail("Please use the file's download page in a browser.")
+	case errors.Is(err, blinkfile.ErrDownloadLimitReached):
+		return app.Err(app.ErrAuthzFailed, err).AddDetail("The file has reached its download limit.")
+	}
+	return err
+}
+
+// setDownloadErr shows the client what it needs to do next on the download form, it returns false if the error isn't one
+// the form can show.
+func setDownloadErr(ctx iris.Context, a App, view *FileDownloadView, err error) bool {
+	if errors.Is(err, blinkfile.ErrFilePasswordRequired) {
+		view.MessageView.SuccessMessage = "Password required"
+	} else if errors.Is(err, blinkfile.ErrFilePasswordInvalid) {
+		errView := ParseAppErr(ctx, a, err)
+		errView.Detail = "Invalid password"
+		view.ErrorView = errView
+	} else if errors.Is(err, blinkfile.ErrRecipientNotVerified) {
+		view.Recipient = &RecipientView{}
+		view.MessageView.SuccessMessage = "Verify your email address to download the file"
+	} else if terms, ok := termsToAccept(err); ok {
+		view.Terms = terms
+		view.MessageView.SuccessMessage = "Accept the terms to download the file"
+	} else if errors.Is(err, blinkfile.ErrFileNotAvailable) || errors.Is(err, blinkfile.ErrFileNotScanned) || errors.Is(err, errProofOfWorkFailed) {
+		view.ErrorView = ParseAppErr(ctx, a, err)
+	} else {
+		return false
+	}
+	return true
+}
+
+func serveThumbnail(ctx iris.Context, a App) error {
+	fileID := blinkfile.FileID(ctx.Params().Get("file_id"))
+	file, err := a.GetThumbnail(withRecipientToken(ctx, fileID), loggedInUser(ctx), fileID)
+	if err != nil {
+		return err
+	}
+	ctx.ContentType("image/jpeg")
+	ctx.Header("X-Content-Type-Options", "nosniff")
+	ctx.Header("Cache-Control", "private, max-age=3600")
+	err = ctx.ServeFileWithRate(file.ThumbnailLocation, 0, 0)
+	if err != nil {
+		return fmt.Errorf("sending thumbnail: %w", err)
 	}
 	return nil
 }
 
 func deleteFiles(ctx iris.Context, a App) error {
 	owner := loggedInUser(ctx)
-	req := ctx.Request()
-	err := req.ParseForm()
+	deleteFileIDs, err := selectedFileIDs(ctx)
 	if err != nil {
 		return err
 	}
-	deleteFileIDs := make([]blinkfile.FileID, 0, len(req.Form))
-	for name, values := range req.Form {
-		if len(values) == 0 || values[0] != "on" {
-			continue
-		}
-		deleteFileIDs = append(deleteFileIDs, blinkfile.FileID(strings.TrimPrefix(name, "select-")))
-	}
 	if len(deleteFileIDs) > 0 {
 		err = a.DeleteFiles(ctx, owner, deleteFileIDs)
 		if err != nil {
@@ -217,6 +486,23 @@ func deleteFiles(ctx iris.Context, a App) error {
 	return nil
 }
 
+// selectedFileIDs returns the IDs of the files whose select checkboxes are checked in the submitted form.
+func selectedFileIDs(ctx iris.Context) ([]blinkfile.FileID, error) {
+	req := ctx.Request()
+	err := req.ParseForm()
+	if err != nil {
+		return nil, err
+	}
+	fileIDs := make([]blinkfile.FileID, 0, len(req.Form))
+	for name, values := range req.Form {
+		if !strings.HasPrefix(name, "select-") || len(values) == 0 || values[0] != "on" {
+			continue
+		}
+		fileIDs = append(fileIDs, blinkfile.FileID(strings.TrimPrefix(name, "select-")))
+	}
+	return fileIDs, nil
+}
+
 func fileNotifications(irisCtx iris.Context, a App) error {
 	w := irisCtx.ResponseWriter()
 	userID := loggedInUser(irisCtx)
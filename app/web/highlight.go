@@ -0,0 +1,199 @@
+package web
+
+import (
+	"html"
+	"html/template"
+	"path/filepath"
+	"strings"
+)
+
+type highlightLanguage struct {
+	keywords      map[string]struct{}
+	lineComments  []string
+	blockComments [][2]string
+	quotes        string
+}
+
+func words(s string) map[string]struct{} {
+	out := make(map[string]struct{})
+	for _, w := range strings.Fields(s) {
+		out[w] = struct{}{}
+	}
+	return out
+}
+
+var (
+	goLanguage = &highlightLanguage{
+		keywords:      words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota"),
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        "\"'`",
+	}
+	jsLanguage = &highlightLanguage{
+		keywords:      words("async await break case catch class const continue debugger default delete do else export extends finally for from function if import in instanceof let new of return static super switch this throw try typeof var void while with yield null undefined true false interface type enum implements"),
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        "\"'`",
+	}
+	cLanguage = &highlightLanguage{
+		keywords:      words("auto break case char class const continue default do double else enum extern float for goto if int long namespace new private protected public register return short signed sizeof static struct switch template this typedef union unsigned using virtual void volatile while true false null nullptr fn let mut impl pub use mod match trait self import package extends implements final"),
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        "\"'",
+	}
+	pythonLanguage = &highlightLanguage{
+		keywords:     words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	shellLanguage = &highlightLanguage{
+		keywords:     words("if then else elif fi case esac for while until do done in function return export local readonly"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	sqlLanguage = &highlightLanguage{
+		keywords:      words("select from where and or not insert into values update set delete create table drop alter index join left right inner outer on group by order having limit as null is in SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER INDEX JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT AS NULL IS IN"),
+		lineComments:  []string{"--"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        "'\"",
+	}
+	dataLanguage = &highlightLanguage{
+		keywords:     words("true false null yes no on off"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	jsonLanguage = &highlightLanguage{
+		keywords: words("true false null"),
+		quotes:   "\"",
+	}
+
+	highlightLanguages = map[string]*highlightLanguage{
+		".go":   goLanguage,
+		".js":   jsLanguage,
+		".mjs":  jsLanguage,
+		".jsx":  jsLanguage,
+		".ts":   jsLanguage,
+		".tsx":  jsLanguage,
+		".c":    cLanguage,
+		".h":    cLanguage,
+		".cpp":  cLanguage,
+		".hpp":  cLanguage,
+		".cs":   cLanguage,
+		".java": cLanguage,
+		".kt":   cLanguage,
+		".rs":   cLanguage,
+		".py":   pythonLanguage,
+		".rb":   pythonLanguage,
+		".sh":   shellLanguage,
+		".bash": shellLanguage,
+		".sql":  sqlLanguage,
+		".yml":  dataLanguage,
+		".yaml": dataLanguage,
+		".toml": dataLanguage,
+		".ini":  dataLanguage,
+		".json": jsonLanguage,
+	}
+)
+
+// highlight escapes the text and wraps comments, strings, numbers and keywords in spans for styling. The language is
+// chosen by filename extension, unknown languages are only escaped.
+func highlight(filename, text string) template.HTML {
+	lang, ok := highlightLanguages[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		return template.HTML(html.EscapeString(text))
+	}
+	var b strings.Builder
+	span := func(class, s string) {
+		b.WriteString(`<span class="hl-`)
+		b.WriteString(class)
+		b.WriteString(`">`)
+		b.WriteString(html.EscapeString(s))
+		b.WriteString(`</span>`)
+	}
+	i := 0
+	for i < len(text) {
+		rest := text[i:]
+		if end, found := lang.comment(rest); found {
+			span("comment", rest[:end])
+			i += end
+			continue
+		}
+		if strings.IndexByte(lang.quotes, rest[0]) >= 0 {
+			end := quotedEnd(rest)
+			span("string", rest[:end])
+			i += end
+			continue
+		}
+		if isDigit(rest[0]) && (i == 0 || !isWordByte(text[i-1])) {
+			end := 1
+			for end < len(rest) && (isWordByte(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			span("number", rest[:end])
+			i += end
+			continue
+		}
+		if isWordByte(rest[0]) {
+			end := 1
+			for end < len(rest) && isWordByte(rest[end]) {
+				end++
+			}
+			word := rest[:end]
+			if _, isKeyword := lang.keywords[word]; isKeyword {
+				span("keyword", word)
+			} else {
+				b.WriteString(html.EscapeString(word))
+			}
+			i += end
+			continue
+		}
+		b.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+	return template.HTML(b.String())
+}
+
+func (l *highlightLanguage) comment(s string) (end int, found bool) {
+	for _, start := range l.lineComments {
+		if strings.HasPrefix(s, start) {
+			if nl := strings.IndexByte(s, '\n'); nl >= 0 {
+				return nl, true
+			}
+			return len(s), true
+		}
+	}
+	for _, delims := range l.blockComments {
+		if strings.HasPrefix(s, delims[0]) {
+			if closing := strings.Index(s[len(delims[0]):], delims[1]); closing >= 0 {
+				return len(delims[0]) + closing + len(delims[1]), true
+			}
+			return len(s), true
+		}
+	}
+	return 0, false
+}
+
+// quotedEnd returns the end of the string literal that starts at s[0]. Backtick strings can span lines, other quotes
+// end at a newline so that a stray quote doesn't highlight the rest of the file.
+func quotedEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote != '`':
+			i++
+		case s[i] == quote:
+			return i + 1
+		case s[i] == '\n' && quote != '`':
+			return i
+		}
+	}
+	return len(s)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/kataras/iris/v12"
+)
+
+type (
+	HoldsView struct {
+		LayoutView
+		Files []HeldFileView
+		MessageView
+	}
+
+	HeldFileView struct {
+		ID        string
+		Name      string
+		Owner     string
+		Size      string
+		Uploaded  string
+		Expires   string
+		Downloads int64
+		Limit     int64
+		Trashed   string
+		LegalHold bool
+	}
+)
+
+func showHolds(ctx iris.Context, a App) error {
+	files, err := a.ListAllFiles(ctx)
+	if err != nil {
+		return err
+	}
+	usernames := map[blinkfile.UserID]string{app.AdminUserID: "admin"}
+	if app.FeatureFlagIsOn(ctx, app.FeatureUserAccounts) {
+		users, err := a.ListUsers(ctx)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			usernames[user.ID] = string(user.Username)
+		}
+	}
+	fileList := make([]HeldFileView, 0, len(files))
+	for _, file := range files {
+		owner, ok := usernames[file.Owner]
+		if !ok {
+			owner = string(file.Owner)
+		}
+		var expires string
+		if expiresAt := file.ExpiresAt(); !expiresAt.IsZero() {
+			expires = expiresAt.Format(time.RFC3339)
+		}
+		var trashed string
+		if file.IsTrashed() {
+			trashed = file.Trashed.Format(time.RFC3339)
+		}
+		fileList = append(fileList, HeldFileView{
+			ID:        string(file.ID),
+			Name:      file.Name,
+			Owner:     owner,
+			Size:      formatFileSize(file.Size),
+			Uploaded:  file.Created.Format(time.RFC3339),
+			Expires:   expires,
+			Downloads: file.Downloads,
+			Limit:     file.DownloadLimit,
+			Trashed:   trashed,
+			LegalHold: file.LegalHold,
+		})
+	}
+	ctx.ViewData("content", HoldsView{
+		Files:       fileList,
+		MessageView: flashMessageView(ctx),
+	})
+	return ctx.View("holds.html")
+}
+
+func updateHolds(ctx iris.Context, a App) error {
+	fileIDs, err := selectedFileIDs(ctx)
+	if err != nil {
+		return err
+	}
+	if len(fileIDs) > 0 {
+		var plural string
+		if len(fileIDs) != 1 {
+			plural = "s"
+		}
+		switch action := ctx.FormValue("action"); action {
+		case "hold":
+			err = a.SetLegalHold(ctx, loggedInUser(ctx), fileIDs, true)
+			if err == nil {
+				setFlashSuccess(ctx, fmt.Sprintf("Placed a legal hold on %d file%s.", len(fileIDs), plural))
+			}
+		case "release":
+			err = a.SetLegalHold(ctx, loggedInUser(ctx), fileIDs, false)
+			if err == nil {
+				setFlashSuccess(ctx, fmt.Sprintf("Released the legal hold on %d file%s.", len(fileIDs), plural))
+			}
+		default:
+			err = fmt.Errorf("unknown action %q", action)
+		}
+		if err != nil {
+			setFlashErr(ctx, a, err)
+		}
+	}
+	ctx.Redirect("/holds")
+	return nil
+}
@@ -6,8 +6,11 @@ import (
 	"embed"
 	"encoding/base64"
 	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/benjohns1/blinkfile/app/testautomation"
@@ -32,7 +35,14 @@ type (
 		WriteTimeout                  time.Duration
 		RateLimitUnauthenticated      float64
 		RateLimitBurstUnauthenticated int
-		TestAutomator                 TestAutomator
+		DownloadLimits                DownloadLimits
+		ProofOfWork                   ProofOfWork
+		// TrustedProxies are the reverse proxies whose X-Forwarded-For header is trusted to find the client IP address.
+		TrustedProxies []netip.Prefix
+		TestAutomator  TestAutomator
+		// PreviewOrigin optionally serves preview content from a separate origin, such as a subdomain, e.g.
+		// "https://preview.example.com". Preview content is served from the /preview path of this server by default.
+		PreviewOrigin string
 	}
 
 	HTML struct {
@@ -45,9 +55,35 @@ type (
 		Logout(context.Context, app.Token) error
 		IsAuthenticated(context.Context, app.Token) (blinkfile.UserID, bool, error)
 		ListFiles(context.Context, blinkfile.UserID) ([]blinkfile.FileHeader, error)
-		UploadFile(context.Context, app.UploadFileArgs) error
+		UploadFile(context.Context, app.UploadFileArgs) (blinkfile.FileHeader, error)
+		GetFile(context.Context, blinkfile.UserID, blinkfile.FileID) (blinkfile.FileHeader, error)
+		UpdateFile(context.Context, app.UpdateFileArgs) (blinkfile.FileHeader, error)
+		StripImageMetadataEnforced() bool
+		EmailVerificationEnabled() bool
+		FilePasswordLocked(blinkfile.FileHeader) bool
 		DownloadFile(ctx context.Context, userID blinkfile.UserID, fileID blinkfile.FileID, pass string) (blinkfile.FileHeader, error)
+		PreviewFile(ctx context.Context, userID blinkfile.UserID, fileID blinkfile.FileID, pass string) (app.FilePreview, error)
+		SignDownloadURL(ctx context.Context, userID blinkfile.UserID, fileID blinkfile.FileID, pass string, ttl time.Duration) (app.SignedURL, error)
+		DownloadSignedFile(ctx context.Context, fileID blinkfile.FileID, query url.Values) (blinkfile.FileHeader, error)
+		CreateAPIToken(context.Context, app.CreateAPITokenArgs) (string, app.APIToken, error)
+		AuthenticateAPIToken(ctx context.Context, token string, scope app.APITokenScope) (blinkfile.UserID, error)
+		ListAPITokens(context.Context, blinkfile.UserID) ([]app.APIToken, error)
+		RevokeAPIToken(context.Context, blinkfile.UserID, app.APITokenID) error
+		SendRecipientCode(ctx context.Context, fileID blinkfile.FileID, email string) error
+		VerifyRecipientCode(ctx context.Context, fileID blinkfile.FileID, email, code string) (app.RecipientToken, error)
+		GetPreviewContent(context.Context, app.PreviewToken) (blinkfile.FileHeader, error)
+		RecordDownload(context.Context, blinkfile.UserID, blinkfile.FileID, int64)
+		FinishDownload(context.Context, blinkfile.FileID)
+		ListFileAccess(context.Context, blinkfile.UserID, blinkfile.FileID) ([]app.AccessRecord, error)
+		GetFileStats(context.Context, blinkfile.UserID, blinkfile.FileID) (blinkfile.DownloadStats, error)
+		GetUserStats(context.Context, blinkfile.UserID) (blinkfile.DownloadStats, error)
+		GetThumbnail(context.Context, blinkfile.UserID, blinkfile.FileID) (blinkfile.FileHeader, error)
 		DeleteFiles(context.Context, blinkfile.UserID, []blinkfile.FileID) error
+		ListTrashedFiles(context.Context, blinkfile.UserID) ([]app.TrashedFile, error)
+		RestoreFiles(context.Context, blinkfile.UserID, []blinkfile.FileID) error
+		PurgeTrashedFiles(context.Context, blinkfile.UserID, []blinkfile.FileID) error
+		ListAllFiles(context.Context) ([]blinkfile.FileHeader, error)
+		SetLegalHold(context.Context, blinkfile.UserID, []blinkfile.FileID, bool) error
 		SubscribeToFileChanges(blinkfile.UserID) (<-chan app.FileEvent, func())
 		CreateUser(context.Context, app.CreateUserArgs) error
 		ChangeUsername(context.Context, app.ChangeUsernameArgs) error
@@ -55,6 +91,11 @@ type (
 		ListUsers(context.Context) ([]blinkfile.User, error)
 		GetUserByID(context.Context, blinkfile.UserID) (blinkfile.User, error)
 		DeleteUsers(context.Context, []blinkfile.UserID) error
+		GetPolicy(context.Context) (app.Policy, error)
+		SetFileTypePolicy(context.Context, blinkfile.UserID, app.SetFileTypePolicyArgs) error
+		GetSharingPolicy(context.Context, blinkfile.UserID) (blinkfile.SharingPolicy, error)
+		SetSharingPolicy(context.Context, blinkfile.UserID, app.SetSharingPolicyArgs) error
+		ListAuditRecords(context.Context, int) ([]app.AuditRecord, error)
 
 		app.Log
 	}
@@ -107,6 +148,7 @@ func (c Config) parse(ctx context.Context) (Config, error) {
 	if cfg.RateLimitBurstUnauthenticated <= 0 {
 		cfg.RateLimitBurstUnauthenticated = 5
 	}
+	cfg.PreviewOrigin = strings.TrimSuffix(cfg.PreviewOrigin, "/")
 	return cfg, nil
 }
 
@@ -160,6 +202,11 @@ func New(ctx context.Context, cfg Config) (html *HTML, err error) {
 		return nil, fmt.Errorf("verifying tmp directory: %w", err)
 	}
 
+	p, err := newProofOfWork(cfg.ProofOfWork)
+	if err != nil {
+		return nil, fmt.Errorf("setting up proof-of-work: %w", err)
+	}
+
 	i := iris.New()
 
 	i.HandleDir("/assets", assetsFS)
@@ -185,6 +232,8 @@ func New(ctx context.Context, cfg Config) (html *HTML, err error) {
 	i.Use(iris.Compression)
 	i.Use(func(ctx iris.Context) {
 		ctx = withRequestID(ctx)
+		ctx = withClientIP(ctx, cfg.TrustedProxies)
+		ctx = withUserAgent(ctx)
 		ctx.Next()
 	})
 	i.Use(logRequest(cfg.App))
@@ -208,7 +257,18 @@ func New(ctx context.Context, cfg Config) (html *HTML, err error) {
 		upload := authenticated.Post("/files", w.f(uploadFile))
 		upload.Use(maxSize(cfg.MaxFileByteSize))
 		authenticated.Post("/files/delete", w.f(deleteFiles))
+		authenticated.Get("/files/{file_id:string}/edit", w.f(showEditFile))
+		authenticated.Post("/files/{file_id:string}/edit", w.f(editFile))
+		authenticated.Get("/files/{file_id:string}/activity", w.f(showFileActivity))
+		authenticated.Get("/files/{file_id:string}/stats", w.f(showFileStats))
+		authenticated.Get("/stats", w.f(showUserStats))
+		authenticated.Get("/tokens", w.f(showAPITokens))
+		authenticated.Post("/tokens", w.f(createAPIToken(cfg.TrustedProxies)))
+		authenticated.Post("/tokens/revoke", w.f(revokeAPIToken))
+		authenticated.Get("/trash", w.f(showTrash))
+		authenticated.Post("/trash", w.f(updateTrash))
 		authenticated.Any("/files/notifications", w.f(fileNotifications))
+		authenticated.Get("/files/{file_id:string}/thumbnail", w.f(serveThumbnail))
 
 		if app.FeatureFlagIsOn(ctx, app.FeatureUserAccounts) {
 			userMgmt := authenticated.Party("/users")
@@ -222,6 +282,21 @@ func New(ctx context.Context, cfg Config) (html *HTML, err error) {
 			}
 		}
 
+		policyMgmt := authenticated.Party("/policy")
+		{
+			policyMgmt.Use(w.f(requirePermission("policy_management")))
+			policyMgmt.Get("/", w.f(showPolicy))
+			policyMgmt.Post("/file-types", w.f(setFileTypePolicy))
+			policyMgmt.Post("/sharing", w.f(setSharingPolicy))
+		}
+
+		holdMgmt := authenticated.Party("/holds")
+		{
+			holdMgmt.Use(w.f(requirePermission("hold_management")))
+			holdMgmt.Get("/", w.f(showHolds))
+			holdMgmt.Post("/", w.f(updateHolds))
+		}
+
 		if cfg.TestAutomator != nil {
 			authenticated.Post("/test-automation", func(ctx iris.Context) {
 				var deleteUserFiles blinkfile.UserID
@@ -241,6 +316,13 @@ func New(ctx context.Context, cfg Config) (html *HTML, err error) {
 		}
 	}
 
+	api := i.Party("/")
+	{
+		api.Use(w.f(apiTokenRequired(app.APIScopeUpload)))
+		rawUpload := api.Put("/upload/{filename:string}", w.f(uploadRawFile(cfg.TrustedProxies)))
+		rawUpload.Use(maxSize(cfg.MaxFileByteSize))
+	}
+
 	unauthenticated := i.Party("/")
 	{
 		const (
@@ -249,11 +331,21 @@ func New(ctx context.Context, cfg Config) (html *HTML, err error) {
 		)
 		limit := rate.Limit(cfg.RateLimitUnauthenticated, cfg.RateLimitBurstUnauthenticated, rate.PurgeEvery(purgeEvery, purgeMaxLifetime))
 		unauthenticated.Use(limit)
-		unauthenticated.Get("/login", w.f(showLogin))
-		unauthenticated.Post("/login", w.f(login))
-		unauthenticated.Get("/logout", w.f(logout))
-		unauthenticated.Get("/file/{file_id:string}", w.f(downloadFile))
-		unauthenticated.Post("/file/{file_id:string}", w.f(downloadFile))
+		unauthenticated.Get("/login", w.f(showLogin(p)))
+		unauthenticated.Post("/login", w.f(login(p)))
+		unauthenticated.Get("/logout", w.f(logout(p)))
+		throttle := newDownloadThrottle(cfg.DownloadLimits)
+		// Owners can download their files and sign links to them with API tokens, which aren't required for anyone else
+		acceptDownloadToken := w.f(apiTokenAccepted(app.APIScopeDownload))
+		unauthenticated.Get("/file/{file_id:string}", acceptDownloadToken, w.f(downloadFile(throttle, p)))
+		unauthenticated.Post("/file/{file_id:string}", acceptDownloadToken, w.f(downloadFile(throttle, p)))
+		unauthenticated.Post("/file/{file_id:string}/verify", w.f(verifyRecipient(p)))
+		unauthenticated.Post("/file/{file_id:string}/link", acceptDownloadToken, w.f(signDownloadURL(p, cfg.TrustedProxies)))
+		unauthenticated.Get("/file/{file_id:string}/signed", w.f(downloadSignedFile(throttle)))
+		unauthenticated.Get("/file/{file_id:string}/preview", w.f(previewFile(cfg.PreviewOrigin, p)))
+		unauthenticated.Post("/file/{file_id:string}/preview", w.f(previewFile(cfg.PreviewOrigin, p)))
+		unauthenticated.Get("/preview/{token:string}", w.f(previewContent(throttle)))
+		unauthenticated.Get("/file/{file_id:string}/thumbnail", w.f(serveThumbnail))
 	}
 
 	return &HTML{i, cfg}, nil
@@ -282,12 +374,27 @@ func maxSize(byteSize int64) func(iris.Context) {
 }
 
 func withRequestID(ctx iris.Context) iris.Context {
-	newCtx := request.CtxWithNewID(ctx)
-	r := ctx.Request().WithContext(newCtx)
+	// Derive from the request context, since the iris context looks up values in the request context, which would
+	// recurse forever for keys that aren't set
+	r := ctx.Request()
+	r = r.WithContext(request.CtxWithNewID(r.Context()))
 	ctx.ResetRequest(r)
 	return ctx
 }
 
+func withClientIP(ctx iris.Context, trustedProxies []netip.Prefix) iris.Context {
+	r := ctx.Request()
+	ip := request.ClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"), trustedProxies)
+	ctx.ResetRequest(r.WithContext(request.CtxWithClientIP(r.Context(), ip)))
+	return ctx
+}
+
+func withUserAgent(ctx iris.Context) iris.Context {
+	r := ctx.Request()
+	ctx.ResetRequest(r.WithContext(request.CtxWithUserAgent(r.Context(), r.UserAgent())))
+	return ctx
+}
+
 func setDefaultViewData(title string) func(iris.Context) {
 	return func(ctx iris.Context) {
 		sess := sessions.Get(ctx)
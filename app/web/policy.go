@@ -0,0 +1,218 @@
+package web
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/longduration"
+	"github.com/kataras/iris/v12"
+)
+
+type (
+	PolicyView struct {
+		LayoutView
+		FileTypes     FileTypePolicyView
+		UserFileTypes []UserFileTypePolicyView
+		Users         []UserView
+		EditUser      UserFileTypePolicyView
+		Sharing       SharingPolicyView
+		UserSharing   []UserSharingPolicyView
+		EditSharing   UserSharingPolicyView
+		AuditRecords  []AuditRecordView
+		MessageView
+	}
+
+	FileTypePolicyView struct {
+		Mode         string
+		Extensions   string
+		ContentTypes string
+	}
+
+	UserFileTypePolicyView struct {
+		UserView
+		FileTypePolicyView
+	}
+
+	SharingPolicyView struct {
+		DefaultExpiration    string
+		MaxExpiration        string
+		DefaultDownloadLimit int64
+		MaxDownloadLimit     int64
+		RequirePassword      bool
+		DefaultTerms         string
+		Rules                []string
+	}
+
+	UserSharingPolicyView struct {
+		UserView
+		SharingPolicyView
+		HasOverride bool
+	}
+
+	AuditRecordView struct {
+		Time     string
+		Action   string
+		User     string
+		FileName string
+		Detail   string
+	}
+)
+
+const auditRecordsShown = 50
+
+func showPolicy(ctx iris.Context, a App) error {
+	policy, err := a.GetPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	view := PolicyView{
+		FileTypes:   fileTypePolicyToView(policy.FileTypes),
+		Sharing:     sharingPolicyToView(policy.Sharing),
+		MessageView: flashMessageView(ctx),
+	}
+	usernames := map[blinkfile.UserID]string{"_admin": "admin"}
+	if app.FeatureFlagIsOn(ctx, app.FeatureUserAccounts) {
+		users, err := a.ListUsers(ctx)
+		if err != nil {
+			return err
+		}
+		editUserID := blinkfile.UserID(ctx.URLParam("user_id"))
+		for _, user := range users {
+			userView := userToView(user)
+			usernames[user.ID] = userView.Username
+			view.Users = append(view.Users, userView)
+			if userPolicy, ok := policy.UserFileTypes[user.ID]; ok {
+				view.UserFileTypes = append(view.UserFileTypes, UserFileTypePolicyView{userView, fileTypePolicyToView(userPolicy)})
+			}
+			userSharing, hasOverride := policy.UserSharing[user.ID]
+			if hasOverride {
+				view.UserSharing = append(view.UserSharing, UserSharingPolicyView{userView, sharingPolicyToView(userSharing), true})
+			}
+			if user.ID == editUserID {
+				view.EditUser = UserFileTypePolicyView{userView, fileTypePolicyToView(policy.UserFileTypes[user.ID])}
+				view.EditSharing = UserSharingPolicyView{userView, sharingPolicyToView(userSharing), hasOverride}
+			}
+		}
+	}
+	records, err := a.ListAuditRecords(ctx, auditRecordsShown)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		user, ok := usernames[record.UserID]
+		if !ok {
+			user = string(record.UserID)
+		}
+		view.AuditRecords = append(view.AuditRecords, AuditRecordView{
+			Time:     record.Time.Format(time.RFC3339),
+			Action:   strings.ReplaceAll(string(record.Action), "_", " "),
+			User:     user,
+			FileName: record.FileName,
+			Detail:   record.Detail,
+		})
+	}
+	ctx.ViewData("content", view)
+	return ctx.View("policy.html")
+}
+
+func fileTypePolicyToView(p blinkfile.FileTypePolicy) FileTypePolicyView {
+	mode := p.Mode
+	if mode == "" {
+		mode = blinkfile.FileTypeBlock
+	}
+	return FileTypePolicyView{
+		Mode:         string(mode),
+		Extensions:   strings.Join(p.Extensions, ", "),
+		ContentTypes: strings.Join(p.ContentTypes, ", "),
+	}
+}
+
+func setFileTypePolicy(ctx iris.Context, a App) error {
+	userID := blinkfile.UserID(ctx.FormValue("user_id"))
+	err := a.SetFileTypePolicy(ctx, loggedInUser(ctx), app.SetFileTypePolicyArgs{
+		UserID:       userID,
+		Mode:         blinkfile.FileTypePolicyMode(ctx.FormValue("mode")),
+		Extensions:   ctx.FormValue("extensions"),
+		ContentTypes: ctx.FormValue("content_types"),
+	})
+	if err != nil {
+		setFlashErr(ctx, a, err)
+	} else if userID == "" {
+		setFlashSuccess(ctx, "Saved the file type policy")
+	} else {
+		setFlashSuccess(ctx, "Saved the user's file type policy")
+	}
+	redirect := "/policy"
+	if userID != "" {
+		redirect = fmt.Sprintf("/policy?user_id=%s", userID)
+	}
+	ctx.Redirect(redirect)
+	return nil
+}
+
+func sharingPolicyToView(p blinkfile.SharingPolicy) SharingPolicyView {
+	return SharingPolicyView{
+		DefaultExpiration:    formatLongDuration(p.DefaultExpiration),
+		MaxExpiration:        formatLongDuration(p.MaxExpiration),
+		DefaultDownloadLimit: p.DefaultDownloadLimit,
+		MaxDownloadLimit:     p.MaxDownloadLimit,
+		RequirePassword:      p.RequirePassword,
+		DefaultTerms:         p.DefaultTerms,
+		Rules:                app.SharingRules(p),
+	}
+}
+
+// formatLongDuration formats the duration the way it can be entered as a long duration, or empty if it's zero.
+func formatLongDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	amount, unit := splitDuration(d)
+	return fmt.Sprintf("%d%s", amount, unit)
+}
+
+func setSharingPolicy(ctx iris.Context, a App) error {
+	userID := blinkfile.UserID(ctx.FormValue("user_id"))
+	err := doSetSharingPolicy(ctx, a, userID)
+	if err != nil {
+		setFlashErr(ctx, a, err)
+	} else if userID == "" {
+		setFlashSuccess(ctx, "Saved the sharing policy")
+	} else if ctx.FormValue("remove_override") != "" {
+		setFlashSuccess(ctx, "Removed the user's sharing policy override")
+	} else {
+		setFlashSuccess(ctx, "Saved the user's sharing policy override")
+	}
+	redirect := "/policy"
+	if userID != "" {
+		redirect = fmt.Sprintf("/policy?user_id=%s", userID)
+	}
+	ctx.Redirect(redirect)
+	return nil
+}
+
+func doSetSharingPolicy(ctx iris.Context, a App, userID blinkfile.UserID) error {
+	var limits [2]int64
+	for i, field := range []string{"default_download_limit", "max_download_limit"} {
+		value := ctx.FormValue(field)
+		if value == "" {
+			continue
+		}
+		if _, err := fmt.Sscan(value, &limits[i]); err != nil {
+			return app.ErrUser("Error saving sharing policy", "Download limits must be whole numbers.", err)
+		}
+	}
+	return a.SetSharingPolicy(ctx, loggedInUser(ctx), app.SetSharingPolicyArgs{
+		UserID:               userID,
+		RemoveOverride:       ctx.FormValue("remove_override") != "",
+		DefaultExpiration:    longduration.LongDuration(ctx.FormValue("default_expiration")),
+		MaxExpiration:        longduration.LongDuration(ctx.FormValue("max_expiration")),
+		DefaultDownloadLimit: limits[0],
+		MaxDownloadLimit:     limits[1],
+		RequirePassword:      ctx.FormValue("require_password") == "on",
+		DefaultTerms:         ctx.FormValue("default_terms"),
+	})
+}
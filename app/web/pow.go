@@ -0,0 +1,101 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/pow"
+	"github.com/benjohns1/blinkfile/request"
+	"github.com/kataras/iris/v12"
+)
+
+type (
+	// ProofOfWork requires clients that aren't logged in to solve a proof-of-work challenge before logging in or
+	// downloading files.
+	ProofOfWork struct {
+		Enabled bool
+		pow.Config
+	}
+
+	ProofOfWorkView struct {
+		Token      string
+		Difficulty int
+	}
+
+	// proofOfWork issues and verifies the challenges, a nil challenger doesn't require any.
+	proofOfWork struct {
+		challenger *pow.Challenger
+	}
+)
+
+const (
+	powLoginScope = "login"
+	powFileScope  = "file"
+)
+
+var (
+	// errProofOfWorkMissing means the request didn't include a challenge, so the client should be given one to solve.
+	errProofOfWorkMissing = fmt.Errorf("proof-of-work challenge missing")
+	errProofOfWorkFailed  = fmt.Errorf("proof-of-work verification failed")
+)
+
+func newProofOfWork(cfg ProofOfWork) (*proofOfWork, error) {
+	if !cfg.Enabled {
+		return &proofOfWork{}, nil
+	}
+	challenger, err := pow.New(cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &proofOfWork{challenger}, nil
+}
+
+// required returns false if proof-of-work is disabled or the client is logged in.
+func (p *proofOfWork) required(ctx iris.Context) bool {
+	return p.challenger != nil && loggedInUser(ctx) == ""
+}
+
+// binding ties a challenge to the client and the resource it's for, so a solution can't be shared.
+func powBinding(ctx iris.Context, resource string) string {
+	return fmt.Sprintf("%s %s", request.GetClientIP(ctx), resource)
+}
+
+// issue returns a new challenge to render in a form, or nil if none is required.
+func (p *proofOfWork) issue(ctx iris.Context, scope, resource string) *ProofOfWorkView {
+	if !p.required(ctx) {
+		return nil
+	}
+	challenge := p.challenger.Issue(scope, powBinding(ctx, resource))
+	return &ProofOfWorkView{Token: challenge.Token, Difficulty: challenge.Difficulty}
+}
+
+// verify checks the solved challenge submitted with the form. Invalid solutions count as failures.
+func (p *proofOfWork) verify(ctx iris.Context, scope, resource string) error {
+	if !p.required(ctx) {
+		return nil
+	}
+	token := ctx.FormValue("pow_token")
+	if token == "" {
+		return errProofOfWorkMissing
+	}
+	err := p.challenger.Verify(scope, powBinding(ctx, resource), token, ctx.FormValue("pow_nonce"))
+	if err != nil {
+		p.challenger.RecordFailure(scope)
+		return app.ErrUser("Verification failed", "Your browser couldn't be verified, please try again.", fmt.Errorf("%w: %w", errProofOfWorkFailed, err))
+	}
+	return nil
+}
+
+// failed counts a failed login or download towards raising the difficulty.
+func (p *proofOfWork) failed(ctx iris.Context, scope string) {
+	if p.required(ctx) {
+		p.challenger.RecordFailure(scope)
+	}
+}
+
+// fileAccessFailed returns true if the error is one that a client guessing file links or passwords would get.
+func fileAccessFailed(err error) bool {
+	return errors.Is(err, blinkfile.ErrFilePasswordRequired) || errors.Is(err, blinkfile.ErrFilePasswordInvalid)
+}
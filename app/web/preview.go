@@ -0,0 +1,154 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/request"
+	"github.com/kataras/iris/v12"
+)
+
+type FilePreviewView struct {
+	LayoutView
+	ID               string
+	Name             string
+	Kind             blinkfile.PreviewKind
+	ContentURL       string
+	Text             template.HTML
+	Truncated        bool
+	PasswordRequired bool
+	// Terms are set if the client must accept them before previewing.
+	Terms       string
+	ProofOfWork *ProofOfWorkView
+	MessageView
+}
+
+const maxTextPreviewBytes = 256 * 1024
+
+func previewFile(previewOrigin string, p *proofOfWork) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		return doPreviewFile(ctx, a, previewOrigin, p)
+	}
+}
+
+func doPreviewFile(ctx iris.Context, a App, previewOrigin string, p *proofOfWork) error {
+	fileID := blinkfile.FileID(ctx.Params().Get("file_id"))
+	view := FilePreviewView{ID: string(fileID)}
+	err := p.verify(ctx, powFileScope, string(fileID))
+	var preview app.FilePreview
+	if err == nil {
+		preview, err = a.PreviewFile(withTermsAccepted(withRecipientToken(ctx, fileID)), loggedInUser(ctx), fileID, ctx.FormValue("password"))
+		if fileAccessFailed(err) {
+			p.failed(ctx, powFileScope)
+		}
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, errProofOfWorkMissing):
+			view.PasswordRequired = true
+		case errors.Is(err, errProofOfWorkFailed):
+			view.PasswordRequired = true
+			view.ErrorView = ParseAppErr(ctx, a, err)
+		case errors.Is(err, blinkfile.ErrFilePasswordRequired):
+			view.PasswordRequired = true
+			view.MessageView.SuccessMessage = "Password required"
+		case errors.Is(err, blinkfile.ErrFilePasswordInvalid):
+			view.PasswordRequired = true
+			errView := ParseAppErr(ctx, a, err)
+			errView.Detail = "Invalid password"
+			view.ErrorView = errView
+		case errors.Is(err, blinkfile.ErrTermsNotAccepted):
+			view.PasswordRequired = true
+			view.Terms, _ = termsToAccept(err)
+			view.MessageView.SuccessMessage = "Accept the terms to preview the file"
+		case errors.Is(err, blinkfile.ErrRecipientNotVerified):
+			ctx.Redirect(fmt.Sprintf("/file/%s", fileID))
+			return nil
+		default:
+			return err
+		}
+		view.ProofOfWork = p.issue(ctx, powFileScope, string(fileID))
+		ctx.ViewData("content", view)
+		return ctx.View("preview.html")
+	}
+	view.Name = preview.Name
+	view.Kind = blinkfile.PreviewKindOf(preview.ContentType)
+	view.ContentURL = fmt.Sprintf("%s/preview/%s", previewOrigin, preview.Token)
+	if view.Kind == blinkfile.PreviewText {
+		// Text is read into the page rather than loaded separately, so it's sent like the preview content, which
+		// purges the file if the preview used its last download
+		file, err := a.GetPreviewContent(ctx, preview.Token)
+		if err != nil {
+			return err
+		}
+		defer a.FinishDownload(ctx, file.ID)
+		view.Text, view.Truncated, err = readTextPreview(file.Name, file.Location)
+		if err != nil {
+			return err
+		}
+	}
+	ctx.ViewData("content", view)
+	return ctx.View("preview.html")
+}
+
+func readTextPreview(name, location string) (text template.HTML, truncated bool, err error) {
+	f, err := os.Open(location)
+	if err != nil {
+		return "", false, fmt.Errorf("opening file for preview: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	data, err := io.ReadAll(io.LimitReader(f, maxTextPreviewBytes+1))
+	if err != nil {
+		return "", false, fmt.Errorf("reading file for preview: %w", err)
+	}
+	if len(data) > maxTextPreviewBytes {
+		data = data[:maxTextPreviewBytes]
+		for len(data) > 0 && !utf8.Valid(data) {
+			data = data[:len(data)-1]
+		}
+		truncated = true
+	}
+	return highlight(name, string(data)), truncated, nil
+}
+
+// previewContent serves the raw file data for an inline preview, within the same limits as downloads. The response is
+// locked down so that the content can't run scripts or be interpreted as anything other than its sniffed content type.
+func previewContent(throttle *downloadThrottle) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		token := app.PreviewToken(ctx.Params().Get("token"))
+		file, err := a.GetPreviewContent(ctx, token)
+		if err != nil {
+			return err
+		}
+		defer a.FinishDownload(ctx, file.ID)
+		done, ok := throttle.start(file.ID, request.GetClientIP(ctx).String())
+		if !ok {
+			return throttle.tooManyDownloads(ctx)
+		}
+		defer done()
+		h := ctx.ResponseWriter().Header()
+		h.Set("Content-Type", file.ContentType)
+		h.Set("Content-Disposition", fmt.Sprintf("inline; filename*=UTF-8''%s", sanitizeFilename(file.Name)))
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("Cross-Origin-Resource-Policy", "same-site")
+		h.Set("Cache-Control", "private, no-store")
+		if blinkfile.PreviewKindOf(file.ContentType) == blinkfile.PreviewPDF {
+			// Browsers refuse to run their built-in PDF viewer inside a sandboxed document.
+			h.Set("Content-Security-Policy", "default-src 'none'; object-src 'self'; style-src 'unsafe-inline'")
+		} else {
+			h.Set("Content-Security-Policy", "sandbox; default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'")
+		}
+		_, err = throttle.serveFile(ctx, file)
+		if err != nil {
+			return fmt.Errorf("sending preview data: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,86 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/sessions"
+)
+
+// RecipientView asks the client to verify one of the file's recipient email addresses before downloading.
+type RecipientView struct {
+	Email    string
+	CodeSent bool
+}
+
+func recipientSessionKey(fileID blinkfile.FileID) string {
+	return fmt.Sprintf("recipient.%s", fileID)
+}
+
+// withRecipientToken passes on the token from the client's session if they verified a recipient email for the file.
+func withRecipientToken(ctx iris.Context, fileID blinkfile.FileID) iris.Context {
+	sess := sessions.Get(ctx)
+	if sess == nil {
+		return ctx
+	}
+	token := sess.GetString(recipientSessionKey(fileID))
+	if token == "" {
+		return ctx
+	}
+	r := ctx.Request()
+	ctx.ResetRequest(r.WithContext(app.CtxWithRecipientToken(r.Context(), app.RecipientToken(token))))
+	return ctx
+}
+
+// verifyRecipient sends a one-time code to the submitted email address, or checks the submitted code and stores the
+// resulting token in the session so the client can download the file.
+func verifyRecipient(p *proofOfWork) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		fileID := blinkfile.FileID(ctx.Params().Get("file_id"))
+		email := ctx.FormValue("email")
+		view := FileDownloadView{
+			ID:        string(fileID),
+			Recipient: &RecipientView{Email: email},
+		}
+		err := func() error {
+			err := p.verify(ctx, powFileScope, string(fileID))
+			if err != nil {
+				return err
+			}
+			code := ctx.FormValue("code")
+			if code == "" {
+				// The email is sent in the background, which can outlive the pooled iris context
+				err = a.SendRecipientCode(ctx.Request().Context(), fileID, email)
+				if err != nil {
+					return err
+				}
+				view.Recipient.CodeSent = true
+				view.MessageView.SuccessMessage = fmt.Sprintf("If %s can download this file, a code was sent to it", email)
+				return nil
+			}
+			view.Recipient.CodeSent = true
+			token, err := a.VerifyRecipientCode(ctx, fileID, email, code)
+			if err != nil {
+				p.failed(ctx, powFileScope)
+				return err
+			}
+			sess, err := getSession(ctx)
+			if err != nil {
+				return err
+			}
+			sess.Set(recipientSessionKey(fileID), string(token))
+			view.Recipient = nil
+			view.MessageView.SuccessMessage = "Email address verified, you can download the file now"
+			return nil
+		}()
+		if err != nil && !errors.Is(err, errProofOfWorkMissing) {
+			view.ErrorView = ParseAppErr(ctx, a, err)
+		}
+		view.ProofOfWork = p.issue(ctx, powFileScope, string(fileID))
+		ctx.ViewData("content", view)
+		return ctx.View("file.html")
+	}
+}
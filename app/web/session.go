@@ -60,6 +60,9 @@ func flashMessageView(ctx iris.Context) MessageView {
 }
 
 func loggedInUser(ctx iris.Context) blinkfile.UserID {
+	if userID := ctx.Values().GetString(apiTokenUserKey); userID != "" {
+		return blinkfile.UserID(userID)
+	}
 	session, err := getSession(ctx)
 	if err != nil {
 		return ""
@@ -71,6 +74,8 @@ func (s *Session) setAuthenticated(userID blinkfile.UserID) {
 	s.Set("authenticated", string(userID))
 	if userID == "_admin" {
 		s.Set("permission.user_management", true)
+		s.Set("permission.policy_management", true)
+		s.Set("permission.hold_management", true)
 	}
 }
 
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/benjohns1/blinkfile/request"
+	"github.com/kataras/iris/v12"
+)
+
+// SignedURLView shows a signed download URL that can be used without the file's password until it expires.
+type SignedURLView struct {
+	LayoutView
+	ID      string
+	URL     string
+	Expires time.Time
+}
+
+// signDownloadURL signs a download URL for the file, returned as plain text to clients that don't accept HTML so scripts
+// can use it directly. Clients other than the owner need the file's password, which scripts can send like they do for
+// downloads, and must meet its other download conditions on the download form.
+func signDownloadURL(p *proofOfWork, trustedProxies []netip.Prefix) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		fileID := blinkfile.FileID(ctx.Params().Get("file_id"))
+		signed, err := func() (app.SignedURL, error) {
+			err := p.verify(ctx, powFileScope, string(fileID))
+			if err != nil {
+				return app.SignedURL{}, err
+			}
+			var ttl time.Duration
+			if expiresIn := ctx.FormValue("expires_in"); expiresIn != "" {
+				ttl, err = time.ParseDuration(expiresIn)
+				if err != nil {
+					return app.SignedURL{}, app.ErrUser("Invalid link expiry", "Invalid link expiry, please use a duration such as 30m or 24h.", err)
+				}
+			}
+			signed, err := a.SignDownloadURL(withTermsAccepted(withRecipientToken(ctx, fileID)), loggedInUser(ctx), fileID, filePassword(ctx), ttl)
+			if err != nil && fileAccessFailed(err) {
+				p.failed(ctx, powFileScope)
+			}
+			return signed, err
+		}()
+		if err != nil {
+			if !acceptsHTML(ctx) {
+				respondError(ctx, a, plainFileErr(ctx, err))
+				return nil
+			}
+			view := FileDownloadView{ID: string(fileID)}
+			if !setDownloadErr(ctx, a, &view, err) && !errors.Is(err, errProofOfWorkMissing) {
+				respondError(ctx, a, err)
+				return nil
+			}
+			view.ProofOfWork = p.issue(ctx, powFileScope, string(fileID))
+			ctx.ViewData("content", view)
+			return ctx.View("file.html")
+		}
+		link := signedDownloadURL(ctx, signed, trustedProxies)
+		if !acceptsHTML(ctx) {
+			_, err = ctx.WriteString(link + "\n")
+			return err
+		}
+		ctx.ViewData("content", SignedURLView{ID: string(fileID), URL: link, Expires: signed.Expires})
+		return ctx.View("file_link.html")
+	}
+}
+
+// signedDownloadURL returns the absolute URL that downloads the file with the signature.
+func signedDownloadURL(ctx iris.Context, signed app.SignedURL, trustedProxies []netip.Prefix) string {
+	return absoluteURL(ctx, fmt.Sprintf("/file/%s/signed", signed.FileID), signed.Query, trustedProxies)
+}
+
+// absoluteURL returns the URL of the path on this server as the client sees it through any trusted proxies.
+func absoluteURL(ctx iris.Context, path string, query url.Values, trustedProxies []netip.Prefix) string {
+	r := ctx.Request()
+	u := url.URL{
+		Scheme:   request.Scheme(r.RemoteAddr, r.TLS != nil, r.Header.Get("X-Forwarded-Proto"), trustedProxies),
+		Host:     r.Host,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// downloadSignedFile sends the file to a client with a signed URL, without asking for the password.
+func downloadSignedFile(throttle *downloadThrottle) func(iris.Context, App) error {
+	return func(ctx iris.Context, a App) error {
+		fileID := blinkfile.FileID(ctx.Params().Get("file_id"))
+		done, ok := throttle.start(fileID, request.GetClientIP(ctx).String())
+		if !ok {
+			respondError(ctx, a, throttle.tooManyDownloads(ctx))
+			return nil
+		}
+		defer done()
+		file, err := a.DownloadSignedFile(ctx, fileID, ctx.Request().URL.Query())
+		if err != nil {
+			respondError(ctx, a, err)
+			return nil
+		}
+		defer a.FinishDownload(ctx, file.ID)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", sanitizeFilename(file.Name)))
+		sent, err := throttle.serveFile(ctx, file)
+		// Signed URLs are anonymous, like the downloads recorded when they fail
+		a.RecordDownload(ctx, "", file.ID, sent)
+		if err != nil {
+			return fmt.Errorf("sending file data: %w", err)
+		}
+		return nil
+	}
+}
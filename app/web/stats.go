@@ -0,0 +1,152 @@
+package web
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/kataras/iris/v12"
+)
+
+type (
+	StatsView struct {
+		LayoutView
+		// File is set for the stats of one file, otherwise they're the stats of all the user's files.
+		File                *FileView
+		Downloads           int64
+		Completed           int64
+		Aborted             int64
+		CompletedPercent    int64
+		DistinctDownloaders int
+		BytesSent           string
+		Chart               DownloadChartView
+		Networks            []NetworkStatsView
+	}
+
+	// DownloadChartView is a bar chart of the completed and aborted downloads per day.
+	DownloadChartView struct {
+		Width  int
+		Height int
+		From   string
+		To     string
+		Max    int64
+		Bars   []ChartBarView
+	}
+
+	ChartBarView struct {
+		X               int
+		Width           int
+		CompletedY      int
+		CompletedHeight int
+		AbortedY        int
+		AbortedHeight   int
+		Title           string
+	}
+
+	NetworkStatsView struct {
+		Network   string
+		Downloads int64
+		Percent   int64
+	}
+)
+
+const (
+	statsChartDays     = 30
+	statsChartBarWidth = 12
+	statsChartBarGap   = 2
+	statsChartHeight   = 120
+	statsNetworksShown = 10
+)
+
+func showFileStats(ctx iris.Context, a App) error {
+	fileID := blinkfile.FileID(ctx.Params().Get("file_id"))
+	owner := loggedInUser(ctx)
+	file, err := a.GetFile(ctx, owner, fileID)
+	if err != nil {
+		return err
+	}
+	stats, err := a.GetFileStats(ctx, owner, fileID)
+	if err != nil {
+		return err
+	}
+	view := statsToView(stats, time.Now())
+	fileView := fileToView(file, a.FilePasswordLocked(file))
+	view.File = &fileView
+	ctx.ViewData("content", view)
+	return ctx.View("stats.html")
+}
+
+func showUserStats(ctx iris.Context, a App) error {
+	stats, err := a.GetUserStats(ctx, loggedInUser(ctx))
+	if err != nil {
+		return err
+	}
+	ctx.ViewData("content", statsToView(stats, time.Now()))
+	return ctx.View("stats.html")
+}
+
+func statsToView(stats blinkfile.DownloadStats, now time.Time) StatsView {
+	view := StatsView{
+		Downloads:           stats.Downloads(),
+		Completed:           stats.Completed,
+		Aborted:             stats.Aborted,
+		DistinctDownloaders: stats.DistinctDownloaders(),
+		BytesSent:           formatFileSize(stats.BytesSent),
+		Chart:               downloadChart(stats.Days, now),
+	}
+	if view.Downloads > 0 {
+		view.CompletedPercent = stats.Completed * 100 / view.Downloads
+	}
+	for network, downloads := range stats.Networks {
+		view.Networks = append(view.Networks, NetworkStatsView{
+			Network:   network,
+			Downloads: downloads,
+			Percent:   downloads * 100 / view.Downloads,
+		})
+	}
+	slices.SortFunc(view.Networks, func(x, y NetworkStatsView) int {
+		if c := cmp.Compare(y.Downloads, x.Downloads); c != 0 {
+			return c
+		}
+		return cmp.Compare(x.Network, y.Network)
+	})
+	if len(view.Networks) > statsNetworksShown {
+		view.Networks = view.Networks[:statsNetworksShown]
+	}
+	return view
+}
+
+// downloadChart lays out a bar for each of the last statsChartDays days up to now, scaled to the busiest day.
+func downloadChart(days map[string]blinkfile.DayStats, now time.Time) DownloadChartView {
+	end := now.UTC()
+	start := end.AddDate(0, 0, -(statsChartDays - 1))
+	chart := DownloadChartView{
+		Width:  statsChartDays * (statsChartBarWidth + statsChartBarGap),
+		Height: statsChartHeight,
+		From:   start.Format(blinkfile.StatsDateLayout),
+		To:     end.Format(blinkfile.StatsDateLayout),
+	}
+	for i := 0; i < statsChartDays; i++ {
+		day := days[start.AddDate(0, 0, i).Format(blinkfile.StatsDateLayout)]
+		chart.Max = max(chart.Max, day.Completed+day.Aborted)
+	}
+	for i := 0; i < statsChartDays; i++ {
+		date := start.AddDate(0, 0, i).Format(blinkfile.StatsDateLayout)
+		day := days[date]
+		bar := ChartBarView{
+			X:     i * (statsChartBarWidth + statsChartBarGap),
+			Width: statsChartBarWidth,
+			Title: fmt.Sprintf("%s: %d completed, %d aborted", date, day.Completed, day.Aborted),
+		}
+		if chart.Max > 0 {
+			bar.CompletedHeight = int(day.Completed * statsChartHeight / chart.Max)
+			bar.AbortedHeight = int(day.Aborted * statsChartHeight / chart.Max)
+		}
+		bar.CompletedY = statsChartHeight - bar.CompletedHeight
+		bar.AbortedY = bar.CompletedY - bar.AbortedHeight
+		chart.Bars = append(chart.Bars, bar)
+	}
+	return chart
+}
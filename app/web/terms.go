@@ -0,0 +1,27 @@
+package web
+
+import (
+	"errors"
+
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/kataras/iris/v12"
+)
+
+// withTermsAccepted passes on the client's acceptance of the file's terms if they checked the box to accept them.
+func withTermsAccepted(ctx iris.Context) iris.Context {
+	if ctx.FormValue("accept_terms") != "on" {
+		return ctx
+	}
+	r := ctx.Request()
+	ctx.ResetRequest(r.WithContext(app.CtxWithTermsAccepted(r.Context())))
+	return ctx
+}
+
+// termsToAccept returns the terms the client must accept if the error is because they haven't accepted them.
+func termsToAccept(err error) (string, bool) {
+	var termsErr *app.TermsError
+	if !errors.As(err, &termsErr) {
+		return "", false
+	}
+	return termsErr.Terms, true
+}
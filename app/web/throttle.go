@@ -0,0 +1,266 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+	"github.com/benjohns1/blinkfile/app"
+	"github.com/kataras/iris/v12"
+	"golang.org/x/time/rate"
+)
+
+type (
+	// DownloadLimits throttles file downloads, zero values don't limit anything.
+	DownloadLimits struct {
+		// RateLimit caps the combined bandwidth of all downloads, in bytes per second.
+		RateLimit int64
+		// RateLimitPerUser caps the combined bandwidth of all downloads of each user's files, in bytes per second.
+		RateLimitPerUser int64
+		// MaxConcurrentPerFile caps how many downloads of the same file can be sent at once.
+		MaxConcurrentPerFile int
+		// MaxConcurrentPerIP caps how many downloads can be sent to the same client IP at once.
+		MaxConcurrentPerIP int
+		// RetryAfter is how long clients are told to wait when there are too many concurrent downloads.
+		RetryAfter time.Duration
+	}
+
+	// downloadThrottle enforces the download limits. Rate limiters are shared by every download they apply to, and are
+	// dropped once no downloads are using them.
+	downloadThrottle struct {
+		limits DownloadLimits
+		global *rate.Limiter
+
+		mu          sync.Mutex
+		users       map[blinkfile.UserID]*sharedLimiter
+		files       map[blinkfile.FileID]*sharedLimiter
+		activeFiles map[blinkfile.FileID]int
+		activeIPs   map[string]int
+	}
+
+	sharedLimiter struct {
+		*rate.Limiter
+		refs int
+	}
+
+	// throttledReader waits for every limiter before returning the data it reads.
+	throttledReader struct {
+		io.ReadSeeker
+		ctx      context.Context
+		limiters []*rate.Limiter
+	}
+
+	// countingReader counts the bytes read from it since the last seek. The content is sniffed and its size found by
+	// seeking before the data is sent, so that isn't counted.
+	countingReader struct {
+		io.ReadSeeker
+		n int64
+	}
+
+	// errReader records the first error other than io.EOF that reading returns, which http.ServeContent doesn't.
+	errReader struct {
+		io.ReadSeeker
+		err error
+	}
+
+	// errResponseWriter records the first error that writing the response returns, which http.ServeContent doesn't.
+	errResponseWriter struct {
+		http.ResponseWriter
+		err error
+	}
+)
+
+var errTooManyDownloads = fmt.Errorf("too many concurrent downloads")
+
+// defaultRetryAfter is how long clients are told to wait when there are too many concurrent downloads, if it isn't
+// configured.
+const defaultRetryAfter = 30 * time.Second
+
+func newDownloadThrottle(limits DownloadLimits) *downloadThrottle {
+	if limits.RetryAfter <= 0 {
+		limits.RetryAfter = defaultRetryAfter
+	}
+	t := &downloadThrottle{
+		limits:      limits,
+		users:       make(map[blinkfile.UserID]*sharedLimiter),
+		files:       make(map[blinkfile.FileID]*sharedLimiter),
+		activeFiles: make(map[blinkfile.FileID]int),
+		activeIPs:   make(map[string]int),
+	}
+	if limits.RateLimit > 0 {
+		t.global = newLimiter(limits.RateLimit)
+	}
+	return t
+}
+
+// newLimiter allows bytesPerSecond with a burst of one second's worth of data.
+func newLimiter(bytesPerSecond int64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond))
+}
+
+// start reserves a download slot for the file and client IP. It returns false if there are already too many concurrent
+// downloads, otherwise the returned func must be called once the download is done.
+func (t *downloadThrottle) start(fileID blinkfile.FileID, ip string) (func(), bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if limit := t.limits.MaxConcurrentPerFile; limit > 0 && t.activeFiles[fileID] >= limit {
+		return nil, false
+	}
+	if limit := t.limits.MaxConcurrentPerIP; limit > 0 && t.activeIPs[ip] >= limit {
+		return nil, false
+	}
+	t.activeFiles[fileID]++
+	t.activeIPs[ip]++
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		decrement(t.activeFiles, fileID)
+		decrement(t.activeIPs, ip)
+	}, true
+}
+
+// tooManyDownloads tells the client when to retry after start returns false.
+func (t *downloadThrottle) tooManyDownloads(ctx iris.Context) *app.Error {
+	retryAfter := int(t.limits.RetryAfter.Round(time.Second).Seconds())
+	ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+	return app.ErrUser("Too many downloads", fmt.Sprintf("Too many downloads are in progress, please try again in %d seconds.", retryAfter), errTooManyDownloads).AddStatus(http.StatusTooManyRequests)
+}
+
+func decrement[K comparable](counts map[K]int, key K) {
+	if counts[key] <= 1 {
+		delete(counts, key)
+		return
+	}
+	counts[key]--
+}
+
+// reader wraps the file content so it isn't read faster than the rate limits that apply to the file allow. The returned
+// func must be called once the content has been sent.
+func (t *downloadThrottle) reader(ctx context.Context, file blinkfile.FileHeader, content io.ReadSeeker) (io.ReadSeeker, func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var limiters []*rate.Limiter
+	if t.global != nil {
+		limiters = append(limiters, t.global)
+	}
+	var releases []func()
+	if t.limits.RateLimitPerUser > 0 {
+		limiter, release := acquire(&t.mu, t.users, file.Owner, t.limits.RateLimitPerUser)
+		limiters = append(limiters, limiter)
+		releases = append(releases, release)
+	}
+	if file.DownloadRateLimit > 0 {
+		limiter, release := acquire(&t.mu, t.files, file.ID, file.DownloadRateLimit)
+		limiters = append(limiters, limiter)
+		releases = append(releases, release)
+	}
+	done := func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+	if len(limiters) == 0 {
+		return content, done
+	}
+	return &throttledReader{ReadSeeker: content, ctx: ctx, limiters: limiters}, done
+}
+
+// acquire returns the shared limiter for the key, creating it or updating its rate, and a func to release it. The mutex
+// must be held when calling acquire, the release func locks it.
+func acquire[K comparable](mu *sync.Mutex, limiters map[K]*sharedLimiter, key K, bytesPerSecond int64) (*rate.Limiter, func()) {
+	shared, ok := limiters[key]
+	if !ok {
+		shared = &sharedLimiter{Limiter: newLimiter(bytesPerSecond)}
+		limiters[key] = shared
+	} else if shared.Limit() != rate.Limit(bytesPerSecond) {
+		// Keep the burst so reads that are already waiting aren't larger than it
+		shared.SetLimit(rate.Limit(bytesPerSecond))
+	}
+	shared.refs++
+	return shared.Limiter, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		shared.refs--
+		if shared.refs <= 0 && limiters[key] == shared {
+			delete(limiters, key)
+		}
+	}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	for _, limiter := range r.limiters {
+		if burst := limiter.Burst(); len(p) > burst {
+			p = p[:burst]
+		}
+	}
+	n, err := r.ReadSeeker.Read(p)
+	for _, limiter := range r.limiters {
+		if waitErr := limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) Seek(offset int64, whence int) (int64, error) {
+	r.n = 0
+	return r.ReadSeeker.Seek(offset, whence)
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (w *errResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// serveFile sends the file data within the rate limits that apply to it, and returns how many bytes of it were sent. A
+// client that goes away can be counted up to one buffer of data it didn't receive. The error is set if the data couldn't
+// be read, waiting for a rate limit failed or the client went away before all of it was sent.
+func (t *downloadThrottle) serveFile(ctx iris.Context, file blinkfile.FileHeader) (int64, error) {
+	f, err := os.Open(file.Location)
+	if err != nil {
+		ctx.StatusCode(http.StatusNotFound)
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	st, err := f.Stat()
+	if err != nil {
+		ctx.StatusCode(http.StatusInternalServerError)
+		return 0, err
+	}
+	counter := &countingReader{ReadSeeker: f}
+	// The request context wraps the iris context, which can't be cancelled without recursing, so a client that goes away
+	// ends the download with a write error instead
+	content, done := t.reader(context.WithoutCancel(ctx), file, counter)
+	defer done()
+	reader := &errReader{ReadSeeker: content}
+	writer := &errResponseWriter{ResponseWriter: ctx.ResponseWriter()}
+	http.ServeContent(writer, ctx.Request(), st.Name(), st.ModTime(), reader)
+	if reader.err != nil {
+		return counter.n, reader.err
+	}
+	return counter.n, writer.err
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+type (
+	TrashView struct {
+		LayoutView
+		Files []TrashedFileView
+		MessageView
+	}
+
+	TrashedFileView struct {
+		ID      string
+		Name    string
+		Size    string
+		Deleted string
+		Purges  string
+	}
+)
+
+func showTrash(ctx iris.Context, a App) error {
+	files, err := a.ListTrashedFiles(ctx, loggedInUser(ctx))
+	if err != nil {
+		return err
+	}
+	fileList := make([]TrashedFileView, 0, len(files))
+	for _, file := range files {
+		var purges string
+		if !file.Purges.IsZero() {
+			purges = file.Purges.Format(time.RFC3339)
+		}
+		fileList = append(fileList, TrashedFileView{
+			ID:      string(file.ID),
+			Name:    file.Name,
+			Size:    formatFileSize(file.Size),
+			Deleted: file.Trashed.Format(time.RFC3339),
+			Purges:  purges,
+		})
+	}
+	ctx.ViewData("content", TrashView{
+		Files:       fileList,
+		MessageView: flashMessageView(ctx),
+	})
+	return ctx.View("trash.html")
+}
+
+func updateTrash(ctx iris.Context, a App) error {
+	owner := loggedInUser(ctx)
+	fileIDs, err := selectedFileIDs(ctx)
+	if err != nil {
+		return err
+	}
+	if len(fileIDs) > 0 {
+		var plural string
+		if len(fileIDs) != 1 {
+			plural = "s"
+		}
+		switch action := ctx.FormValue("action"); action {
+		case "restore":
+			err = a.RestoreFiles(ctx, owner, fileIDs)
+			if err == nil {
+				setFlashSuccess(ctx, fmt.Sprintf("Restored %d file%s.", len(fileIDs), plural))
+			}
+		case "delete":
+			err = a.PurgeTrashedFiles(ctx, owner, fileIDs)
+			if err == nil {
+				setFlashSuccess(ctx, fmt.Sprintf("Permanently deleted %d file%s.", len(fileIDs), plural))
+			}
+		default:
+			err = fmt.Errorf("unknown action %q", action)
+		}
+		if err != nil {
+			setFlashErr(ctx, a, err)
+		}
+	}
+	ctx.Redirect("/trash")
+	return nil
+}
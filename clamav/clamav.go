@@ -0,0 +1,179 @@
+// Package clamav is a client for scanning data with a clamd daemon using its INSTREAM command.
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type (
+	Client struct {
+		// Network is "tcp" or "unix".
+		Network string
+		Address string
+		// Timeout limits a whole scan, including sending the data.
+		Timeout time.Duration
+		// ChunkSize is the size of the data chunks streamed to clamd, it must be less than clamd's StreamMaxLength.
+		ChunkSize int
+	}
+
+	Result struct {
+		Infected  bool
+		Signature string
+	}
+)
+
+const (
+	DefaultTimeout   = 5 * time.Minute
+	DefaultChunkSize = 64 * 1024
+)
+
+var (
+	ErrSizeLimitExceeded = fmt.Errorf("clamd stream size limit exceeded")
+
+	dialer net.Dialer
+)
+
+// New returns a client for a clamd address such as tcp://localhost:3310 or unix:///run/clamav/clamd.ctl.
+func New(address string) (*Client, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("parsing clamd address %q: %w", address, err)
+	}
+	c := &Client{Network: u.Scheme, Timeout: DefaultTimeout, ChunkSize: DefaultChunkSize}
+	switch u.Scheme {
+	case "tcp":
+		c.Address = u.Host
+	case "unix":
+		c.Address = u.Path
+	default:
+		return nil, fmt.Errorf("clamd address %q must start with tcp:// or unix://", address)
+	}
+	if c.Address == "" {
+		return nil, fmt.Errorf("clamd address %q is missing a host or path", address)
+	}
+	return c, nil
+}
+
+// Ping checks that clamd is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	reply, err := c.command(ctx, "zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd ping reply %q", reply)
+	}
+	return nil
+}
+
+// Scan streams the data to clamd and returns whether it found a virus.
+func (c *Client) Scan(ctx context.Context, data io.Reader) (Result, error) {
+	reply, err := c.command(ctx, "zINSTREAM\x00", data)
+	if err != nil {
+		return Result{}, err
+	}
+	return parseScanReply(reply)
+}
+
+func parseScanReply(reply string) (Result, error) {
+	// Replies look like "stream: OK", "stream: Eicar-Signature FOUND" or "INSTREAM size limit exceeded. ERROR"
+	_, status, _ := strings.Cut(reply, ": ")
+	switch {
+	case status == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	case strings.HasPrefix(reply, "INSTREAM size limit exceeded"):
+		return Result{}, ErrSizeLimitExceeded
+	}
+	return Result{}, fmt.Errorf("clamd scan failed: %s", reply)
+}
+
+func (c *Client) command(ctx context.Context, command string, data io.Reader) (string, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return "", fmt.Errorf("connecting to clamd: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	// Unblock reads and writes if the context is canceled before the deadline
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	w := bufio.NewWriter(conn)
+	_, err = w.WriteString(command)
+	if err == nil && data != nil {
+		var readErr error
+		readErr, err = c.writeChunks(w, data)
+		if readErr != nil {
+			return "", fmt.Errorf("reading data to scan: %w", readErr)
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		// clamd closes the connection early if the stream is too large, so check for a reply first
+		if reply, rErr := readReply(conn); rErr == nil && reply != "" {
+			return reply, nil
+		}
+		return "", fmt.Errorf("sending data to clamd: %w", err)
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return "", fmt.Errorf("reading clamd reply: %w", err)
+	}
+	return reply, nil
+}
+
+// writeChunks writes the data as length-prefixed chunks, ending with a zero length chunk.
+func (c *Client) writeChunks(w io.Writer, data io.Reader) (readErr, writeErr error) {
+	size := c.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	buf := make([]byte, 4+size)
+	for {
+		n, err := io.ReadFull(data, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, wErr := w.Write(buf[:4+n]); wErr != nil {
+				return nil, wErr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err, nil
+		}
+	}
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return nil, err
+}
+
+func readReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(r).ReadBytes(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
@@ -0,0 +1,237 @@
+package clamav_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile/clamav"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd serves a minimal clamd that reports the EICAR test string as a virus.
+type fakeClamd struct {
+	maxStreamLength int
+	reply           string
+}
+
+func (f *fakeClamd) listen(t *testing.T, network, address string) string {
+	t.Helper()
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func (f *fakeClamd) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch command {
+	case "zPING\x00":
+		_, _ = conn.Write([]byte("PONG\x00"))
+	case "zINSTREAM\x00":
+		var data bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if f.maxStreamLength > 0 && data.Len()+int(size) > f.maxStreamLength {
+				_, _ = conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+				return
+			}
+			if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+				return
+			}
+		}
+		switch {
+		case f.reply != "":
+			_, _ = conn.Write([]byte(f.reply + "\x00"))
+		case bytes.Contains(data.Bytes(), []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")):
+			_, _ = conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		default:
+			_, _ = conn.Write([]byte("stream: OK\x00"))
+		}
+	default:
+		_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    *clamav.Client
+		wantErr error
+	}{
+		{
+			name:    "should fail with an unsupported scheme",
+			address: "http://localhost:3310",
+			wantErr: fmt.Errorf("clamd address %q must start with tcp:// or unix://", "http://localhost:3310"),
+		},
+		{
+			name:    "should fail without a host",
+			address: "tcp://",
+			wantErr: fmt.Errorf("clamd address %q is missing a host or path", "tcp://"),
+		},
+		{
+			name:    "should create a TCP client",
+			address: "tcp://localhost:3310",
+			want:    &clamav.Client{Network: "tcp", Address: "localhost:3310", Timeout: clamav.DefaultTimeout, ChunkSize: clamav.DefaultChunkSize},
+		},
+		{
+			name:    "should create a Unix socket client",
+			address: "unix:///run/clamav/clamd.ctl",
+			want:    &clamav.Client{Network: "unix", Address: "/run/clamav/clamd.ctl", Timeout: clamav.DefaultTimeout, ChunkSize: clamav.DefaultChunkSize},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := clamav.New(tt.address)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("New() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Scan(t *testing.T) {
+	ctx := context.Background()
+	tcpClient := func(clamd *fakeClamd) *clamav.Client {
+		return &clamav.Client{Network: "tcp", Address: clamd.listen(t, "tcp", "127.0.0.1:0"), ChunkSize: 16}
+	}
+	tests := []struct {
+		name       string
+		client     *clamav.Client
+		data       io.Reader
+		want       clamav.Result
+		wantErr    error
+		wantAnyErr bool
+	}{
+		{
+			name:   "should report clean data",
+			client: tcpClient(&fakeClamd{}),
+			data:   strings.NewReader("a harmless file that spans several chunks"),
+			want:   clamav.Result{},
+		},
+		{
+			name:   "should report an infected file with its signature",
+			client: tcpClient(&fakeClamd{}),
+			data:   strings.NewReader(eicar),
+			want:   clamav.Result{Infected: true, Signature: "Eicar-Test-Signature"},
+		},
+		{
+			name: "should scan over a Unix socket",
+			client: &clamav.Client{
+				Network: "unix",
+				Address: (&fakeClamd{}).listen(t, "unix", filepath.Join(t.TempDir(), "clamd.sock")),
+			},
+			data: strings.NewReader(eicar),
+			want: clamav.Result{Infected: true, Signature: "Eicar-Test-Signature"},
+		},
+		{
+			name:    "should fail if the data is larger than the clamd stream limit",
+			client:  tcpClient(&fakeClamd{maxStreamLength: 32}),
+			data:    strings.NewReader(strings.Repeat("x", 1024)),
+			wantErr: clamav.ErrSizeLimitExceeded,
+		},
+		{
+			name:    "should fail with an unexpected reply",
+			client:  tcpClient(&fakeClamd{reply: "stream: lstat() failed. ERROR"}),
+			data:    strings.NewReader("data"),
+			wantErr: fmt.Errorf("clamd scan failed: %s", "stream: lstat() failed. ERROR"),
+		},
+		{
+			name:       "should fail if clamd is unreachable",
+			client:     &clamav.Client{Network: "unix", Address: filepath.Join(t.TempDir(), "missing.sock")},
+			data:       strings.NewReader("data"),
+			wantAnyErr: true,
+		},
+		{
+			name:       "should time out if clamd doesn't reply",
+			client:     &clamav.Client{Network: "tcp", Address: silentServer(t), Timeout: 50 * time.Millisecond},
+			data:       strings.NewReader("data"),
+			wantAnyErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.client.Scan(ctx, tt.data)
+			if tt.wantAnyErr {
+				if err == nil {
+					t.Errorf("Scan() expected an error")
+				}
+				return
+			}
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Scan() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Scan() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	client := &clamav.Client{Network: "tcp", Address: (&fakeClamd{}).listen(t, "tcp", "127.0.0.1:0")}
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+}
+
+// silentServer accepts connections and reads from them without ever replying.
+func silentServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
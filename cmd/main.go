@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/benjohns1/blinkfile"
 	"github.com/benjohns1/blinkfile/hash"
 
 	"github.com/benjohns1/blinkfile/app/testautomation"
@@ -14,8 +16,11 @@ import (
 	"github.com/benjohns1/blinkfile/app"
 	"github.com/benjohns1/blinkfile/app/repo"
 	"github.com/benjohns1/blinkfile/app/web"
+	"github.com/benjohns1/blinkfile/clamav"
 	"github.com/benjohns1/blinkfile/featureflag"
 	"github.com/benjohns1/blinkfile/log"
+	"github.com/benjohns1/blinkfile/mailer"
+	"github.com/benjohns1/blinkfile/pow"
 	"github.com/benjohns1/blinkfile/request"
 )
 
@@ -49,8 +54,9 @@ func run(ctx context.Context) (err error) {
 	}
 
 	fileRepo, err := repo.NewFileRepo(ctx, repo.FileRepoConfig{
-		Log: l,
-		Dir: fmt.Sprintf("%s/files", cfg.DataDir),
+		Log:   l,
+		Dir:   fmt.Sprintf("%s/files", cfg.DataDir),
+		Shred: cfg.ShredDeletedFiles,
 	})
 	if err != nil {
 		return err
@@ -72,6 +78,33 @@ func run(ctx context.Context) (err error) {
 		return err
 	}
 
+	policyRepo, err := repo.NewPolicyRepo(ctx, repo.PolicyRepoConfig{
+		Dir: fmt.Sprintf("%s/policy", cfg.DataDir),
+	})
+	if err != nil {
+		return err
+	}
+
+	auditRepo, err := repo.NewAuditRepo(ctx, repo.AuditRepoConfig{
+		Log: l,
+		Dir: fmt.Sprintf("%s/audit", cfg.DataDir),
+	})
+	if err != nil {
+		return err
+	}
+
+	apiTokenRepo, err := repo.NewAPITokenRepo(ctx, repo.APITokenRepoConfig{
+		Dir: fmt.Sprintf("%s/api-tokens", cfg.DataDir),
+	})
+	if err != nil {
+		return err
+	}
+
+	trustedProxies, err := blinkfile.ParseNetworks(strings.Split(cfg.TrustedProxies, ","))
+	if err != nil {
+		return fmt.Errorf("parsing TRUSTED_PROXIES: %w", err)
+	}
+
 	var releasedFeatureNames []string
 	for _, flag := range releasedFeatures {
 		releasedFeatureNames = append(releasedFeatureNames, string(flag))
@@ -92,15 +125,25 @@ func run(ctx context.Context) (err error) {
 	}
 
 	appConfig := app.Config{
-		Log:               l,
-		AdminUsername:     cfg.AdminUsername,
-		AdminPassword:     cfg.AdminPassword,
-		SessionExpiration: 7 * 24 * time.Hour,
-		SessionRepo:       sessionRepo,
-		FileRepo:          fileRepo,
-		UserRepo:          userRepo,
-		CredentialRepo:    credentialRepo,
-		PasswordHasher:    &hash.Argon2idDefault,
+		Log:                     l,
+		AdminUsername:           cfg.AdminUsername,
+		AdminPassword:           cfg.AdminPassword,
+		SessionExpiration:       7 * 24 * time.Hour,
+		SessionRepo:             sessionRepo,
+		FileRepo:                fileRepo,
+		UserRepo:                userRepo,
+		CredentialRepo:          credentialRepo,
+		PolicyRepo:              policyRepo,
+		AuditRepo:               auditRepo,
+		APITokenRepo:            apiTokenRepo,
+		PasswordHasher:          &hash.Argon2idDefault,
+		PreviewCountsAsDownload: cfg.PreviewCountsAsDownload,
+		StripImageMetadata:      cfg.StripImageMetadata,
+		TrashRetention:          cfg.TrashRetention,
+		PasswordBackoff:         cfg.FilePasswordBackoff,
+		PasswordLockoutAttempts: int64(cfg.FilePasswordLockoutAttempts),
+		SignedURLSecret:         []byte(cfg.SignedURLSecret),
+		SignedURLMaxTTL:         cfg.SignedURLMaxTTL,
 	}
 
 	var automator *testautomation.Automator
@@ -117,6 +160,29 @@ func run(ctx context.Context) (err error) {
 		appConfig.Clock = testClock
 	}
 
+	if cfg.ClamAVAddress != "" {
+		scanner, scanErr := clamav.New(cfg.ClamAVAddress)
+		if scanErr != nil {
+			return scanErr
+		}
+		scanner.Timeout = cfg.ClamAVTimeout
+		if pingErr := scanner.Ping(ctx); pingErr != nil {
+			l.Errorf(ctx, "clamd is not reachable, uploads can't be scanned until it is: %v", pingErr)
+		}
+		appConfig.Scanner = scanner
+		appConfig.ScanAsync = cfg.ClamAVAsync
+		l.Printf(ctx, "Scanning uploads for viruses with clamd at %s", cfg.ClamAVAddress)
+	}
+
+	if cfg.SMTPAddress != "" {
+		smtpMailer, mailerErr := mailer.New(cfg.SMTPAddress, cfg.SMTPFrom)
+		if mailerErr != nil {
+			return mailerErr
+		}
+		appConfig.Mailer = smtpMailer
+		l.Printf(ctx, "Sending recipient verification emails through %s", smtpMailer.Address)
+	}
+
 	application, appErr := app.New(ctx, appConfig)
 	if appErr != nil {
 		return appErr
@@ -128,6 +194,23 @@ func run(ctx context.Context) (err error) {
 		RateLimitUnauthenticated:      cfg.RateLimitUnauthenticated,
 		RateLimitBurstUnauthenticated: cfg.RateLimitBurstUnauthenticated,
 		TestAutomator:                 automator,
+		PreviewOrigin:                 cfg.PreviewOrigin,
+		DownloadLimits: web.DownloadLimits{
+			RateLimit:            cfg.DownloadRateLimit,
+			RateLimitPerUser:     cfg.DownloadRateLimitPerUser,
+			MaxConcurrentPerFile: cfg.MaxConcurrentDownloadsPerFile,
+			MaxConcurrentPerIP:   cfg.MaxConcurrentDownloadsPerIP,
+			RetryAfter:           cfg.DownloadRetryAfter,
+		},
+		ProofOfWork: web.ProofOfWork{
+			Enabled: cfg.ProofOfWork,
+			Config: pow.Config{
+				Secret:        []byte(cfg.ProofOfWorkSecret),
+				Difficulty:    cfg.ProofOfWorkDifficulty,
+				MaxDifficulty: cfg.ProofOfWorkMaxDifficulty,
+			},
+		},
+		TrustedProxies: trustedProxies,
 	})
 	if err != nil {
 		return err
@@ -136,13 +219,20 @@ func run(ctx context.Context) (err error) {
 	done := srv.Start(ctx)
 	log.Printf("Started server on port %d", cfg.Port)
 
+	err = application.StartExpiryScheduler(ctx)
+	if err != nil {
+		return err
+	}
 	go startExpiredFileCleanup(ctx, application, cfg.ExpireCheckCycleTime)
+	if cfg.ClamAVAddress != "" && cfg.ClamAVAsync {
+		go startPendingScanRetry(ctx, application, cfg.ClamAVRescanCycleTime)
+	}
 
 	return <-done
 }
 
 func startExpiredFileCleanup(ctx context.Context, a *app.App, expireCheckCycleTime time.Duration) {
-	log.Printf("Starting expired file deletion process, running every %v", expireCheckCycleTime)
+	log.Printf("Starting expired file safety net deletion process, running every %v", expireCheckCycleTime)
 	for {
 		if err := ctx.Err(); err != nil {
 			break
@@ -156,6 +246,21 @@ func startExpiredFileCleanup(ctx context.Context, a *app.App, expireCheckCycleTi
 	log.Printf("Stopped expired file deletion process")
 }
 
+func startPendingScanRetry(ctx context.Context, a *app.App, rescanCycleTime time.Duration) {
+	log.Printf("Starting pending virus scan retry process, running every %v", rescanCycleTime)
+	for {
+		err := a.RescanPendingFiles(ctx)
+		if err != nil {
+			log.Printf("Error rescanning pending files: %v", err)
+		}
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		time.Sleep(rescanCycleTime)
+	}
+	log.Printf("Stopped pending virus scan retry process")
+}
+
 type config struct {
 	Port                          int
 	AdminUsername                 string
@@ -165,6 +270,31 @@ type config struct {
 	RateLimitBurstUnauthenticated int
 	EnableTestAutomation          bool
 	ExpireCheckCycleTime          time.Duration
+	PreviewCountsAsDownload       bool
+	PreviewOrigin                 string
+	StripImageMetadata            bool
+	ClamAVAddress                 string
+	ClamAVAsync                   bool
+	ClamAVTimeout                 time.Duration
+	ClamAVRescanCycleTime         time.Duration
+	ShredDeletedFiles             bool
+	TrashRetention                time.Duration
+	DownloadRateLimit             int64
+	DownloadRateLimitPerUser      int64
+	MaxConcurrentDownloadsPerFile int
+	MaxConcurrentDownloadsPerIP   int
+	DownloadRetryAfter            time.Duration
+	FilePasswordBackoff           time.Duration
+	FilePasswordLockoutAttempts   int
+	ProofOfWork                   bool
+	ProofOfWorkSecret             string
+	ProofOfWorkDifficulty         int
+	ProofOfWorkMaxDifficulty      int
+	TrustedProxies                string
+	SMTPAddress                   string
+	SMTPFrom                      string
+	SignedURLSecret               string
+	SignedURLMaxTTL               time.Duration
 }
 
 func parseConfig() config {
@@ -176,7 +306,32 @@ func parseConfig() config {
 		RateLimitUnauthenticated:      envDefaultFloat("RATE_LIMIT_UNAUTHENTICATED", 2),
 		RateLimitBurstUnauthenticated: envDefaultInt("RATE_LIMIT_BURST_UNAUTHENTICATED", 5),
 		EnableTestAutomation:          envDefaultBool("ENABLE_TEST_AUTOMATION", false),
-		ExpireCheckCycleTime:          envDefaultDuration("EXPIRE_CHECK_CYCLE_TIME", 15*time.Minute),
+		ExpireCheckCycleTime:          envDefaultDuration("EXPIRE_CHECK_CYCLE_TIME", time.Hour),
+		PreviewCountsAsDownload:       envDefaultBool("PREVIEW_COUNTS_AS_DOWNLOAD", false),
+		PreviewOrigin:                 os.Getenv("PREVIEW_ORIGIN"),
+		StripImageMetadata:            envDefaultBool("STRIP_IMAGE_METADATA", false),
+		ClamAVAddress:                 os.Getenv("CLAMAV_ADDRESS"),
+		ClamAVAsync:                   envDefaultBool("CLAMAV_ASYNC", false),
+		ClamAVTimeout:                 envDefaultDuration("CLAMAV_TIMEOUT", clamav.DefaultTimeout),
+		ClamAVRescanCycleTime:         envDefaultDuration("CLAMAV_RESCAN_CYCLE_TIME", 5*time.Minute),
+		ShredDeletedFiles:             envDefaultBool("SHRED_DELETED_FILES", false),
+		TrashRetention:                envDefaultDuration("TRASH_RETENTION", 7*24*time.Hour),
+		DownloadRateLimit:             int64(envDefaultInt("DOWNLOAD_RATE_LIMIT", 0)),
+		DownloadRateLimitPerUser:      int64(envDefaultInt("DOWNLOAD_RATE_LIMIT_PER_USER", 0)),
+		MaxConcurrentDownloadsPerFile: envDefaultInt("MAX_CONCURRENT_DOWNLOADS_PER_FILE", 0),
+		MaxConcurrentDownloadsPerIP:   envDefaultInt("MAX_CONCURRENT_DOWNLOADS_PER_IP", 0),
+		DownloadRetryAfter:            envDefaultDuration("DOWNLOAD_RETRY_AFTER", 30*time.Second),
+		FilePasswordBackoff:           envDefaultDuration("FILE_PASSWORD_BACKOFF", time.Second),
+		FilePasswordLockoutAttempts:   envDefaultInt("FILE_PASSWORD_LOCKOUT_ATTEMPTS", 0),
+		ProofOfWork:                   envDefaultBool("PROOF_OF_WORK", false),
+		ProofOfWorkSecret:             os.Getenv("PROOF_OF_WORK_SECRET"),
+		ProofOfWorkDifficulty:         envDefaultInt("PROOF_OF_WORK_DIFFICULTY", pow.DefaultDifficulty),
+		ProofOfWorkMaxDifficulty:      envDefaultInt("PROOF_OF_WORK_MAX_DIFFICULTY", pow.DefaultMaxDifficulty),
+		TrustedProxies:                os.Getenv("TRUSTED_PROXIES"),
+		SMTPAddress:                   os.Getenv("SMTP_ADDRESS"),
+		SMTPFrom:                      os.Getenv("SMTP_FROM"),
+		SignedURLSecret:               os.Getenv("SIGNED_URL_SECRET"),
+		SignedURLMaxTTL:               envDefaultDuration("SIGNED_URL_MAX_TTL", app.DefaultSignedURLMaxTTL),
 	}
 }
 
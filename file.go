@@ -3,6 +3,7 @@ package blinkfile
 import (
 	"fmt"
 	"io"
+	"net/netip"
 	"time"
 )
 
@@ -10,18 +11,54 @@ type (
 	FileID string
 
 	FileHeader struct {
-		ID            FileID
-		Name          string
-		Location      string
-		Owner         UserID
-		Created       time.Time
-		Expires       time.Time
-		Downloads     int64
-		DownloadLimit int64
-		Size          int64
-		PasswordHash  string
+		ID                FileID
+		Name              string
+		Location          string
+		Owner             UserID
+		Created           time.Time
+		Expires           time.Time
+		Downloads         int64
+		DownloadLimit     int64
+		Size              int64
+		PasswordHash      string
+		ContentType       string
+		AllowPreview      bool
+		ThumbnailLocation string
+		ShowThumbnail     bool
+		Checksum          string
+		MetadataStripped  bool
+		Quarantined       bool
+		QuarantineReason  string
+		ScanStatus        ScanStatus
+		ScanSignature     string
+		Scanned           time.Time
+		Trashed           time.Time
+		LastDownloaded    time.Time
+		AvailableFrom     time.Time
+		// InactivityExpiry expires the file once it hasn't been downloaded for this long, or since it was uploaded if it
+		// was never downloaded.
+		InactivityExpiry time.Duration
+		// LegalHold preserves the file, it isn't deleted for any reason until the hold is released. It still can't be
+		// downloaded once it expires.
+		LegalHold bool
+		// DownloadRateLimit caps the combined bandwidth of all downloads of the file, in bytes per second.
+		DownloadRateLimit int64
+		// FailedPasswordAttempts counts the wrong passwords entered since the last correct one.
+		FailedPasswordAttempts int64
+		LastFailedPassword     time.Time
+		// AllowedNetworks restricts downloads to clients with an IP address in one of the networks, anyone can download
+		// the file if it's empty.
+		AllowedNetworks []netip.Prefix
+		// RecipientEmails restricts downloads to clients who verified they own one of the email addresses, anyone can
+		// download the file if it's empty.
+		RecipientEmails []string
+		// Terms must be accepted by anyone other than the owner before they download the file, such as an NDA.
+		Terms string
 	}
 
+	// ScanStatus is the result of scanning a file for viruses.
+	ScanStatus string
+
 	File struct {
 		FileHeader
 		Data io.ReadCloser
@@ -34,16 +71,24 @@ type (
 	PasswordMatchFunc func(hashedPassword string, checkPassword string) (matched bool, err error)
 
 	UploadFileArgs struct {
-		ID            FileID
-		Name          string
-		Owner         UserID
-		Reader        io.ReadCloser
-		Size          int64
-		Now           NowFunc
-		Password      string
-		HashFunc      PasswordHashFunc
-		Expires       time.Time
-		DownloadLimit int64
+		ID               FileID
+		Name             string
+		Owner            UserID
+		Reader           io.ReadCloser
+		Size             int64
+		Now              NowFunc
+		Password         string
+		HashFunc         PasswordHashFunc
+		Expires          time.Time
+		DownloadLimit    int64
+		ContentType      string
+		AllowPreview     bool
+		ShowThumbnail    bool
+		InactivityExpiry time.Duration
+		AvailableFrom    time.Time
+		AllowedNetworks  []netip.Prefix
+		RecipientEmails  []string
+		Terms            string
 	}
 )
 
@@ -81,41 +126,110 @@ func UploadFile(args UploadFileArgs) (file File, err error) {
 	if args.DownloadLimit < 0 {
 		return File{}, fmt.Errorf("download limit cannot be negative")
 	}
+	if args.InactivityExpiry < 0 {
+		return File{}, fmt.Errorf("inactivity expiry cannot be negative")
+	}
+	if !args.AvailableFrom.IsZero() && !expires.IsZero() && !args.AvailableFrom.Before(expires) {
+		return File{}, ErrAvailableAfterExpiration
+	}
 	return File{
 		FileHeader: FileHeader{
-			ID:            args.ID,
-			Name:          args.Name,
-			Owner:         args.Owner,
-			Created:       now,
-			Size:          args.Size,
-			PasswordHash:  hash,
-			Expires:       expires,
-			DownloadLimit: args.DownloadLimit,
+			ID:               args.ID,
+			Name:             args.Name,
+			Owner:            args.Owner,
+			Created:          now,
+			Size:             args.Size,
+			PasswordHash:     hash,
+			Expires:          expires,
+			DownloadLimit:    args.DownloadLimit,
+			ContentType:      args.ContentType,
+			AllowPreview:     args.AllowPreview,
+			ShowThumbnail:    args.ShowThumbnail,
+			InactivityExpiry: args.InactivityExpiry,
+			AvailableFrom:    args.AvailableFrom,
+			AllowedNetworks:  args.AllowedNetworks,
+			RecipientEmails:  args.RecipientEmails,
+			Terms:            args.Terms,
 		},
 		Data: args.Reader,
 	}, nil
 }
 
+const (
+	ScanNone     ScanStatus = ""
+	ScanPending  ScanStatus = "pending"
+	ScanClean    ScanStatus = "clean"
+	ScanInfected ScanStatus = "infected"
+)
+
 var (
 	ErrFilePasswordRequired = fmt.Errorf("file access requires password")
 	ErrFilePasswordInvalid  = fmt.Errorf("invalid file password")
 	ErrFileExpired          = fmt.Errorf("file has expired")
 	ErrDownloadLimitReached = fmt.Errorf("file download limit reached")
 	ErrExpirationInPast     = fmt.Errorf("expiration cannot be set in the past")
+	ErrPreviewUnavailable   = fmt.Errorf("file preview is not available")
+	ErrFileQuarantined      = fmt.Errorf("file is quarantined")
+	ErrFileNotScanned       = fmt.Errorf("file has not been scanned for viruses yet")
+	ErrFileTrashed          = fmt.Errorf("file is in the trash")
+	ErrFileNotAvailable     = fmt.Errorf("file is not available yet")
+	ErrFilePasswordLocked   = fmt.Errorf("file password is locked after too many failed attempts")
+	ErrFilePasswordBackoff  = fmt.Errorf("file password attempted too soon after a failed attempt")
+	ErrNetworkNotAllowed    = fmt.Errorf("client IP address is not in the file's allowed networks")
+	ErrTermsNotAccepted     = fmt.Errorf("file terms have not been accepted")
+
+	ErrAvailableAfterExpiration = fmt.Errorf("file must become available before it expires")
 )
 
 func (f *FileHeader) Download(user UserID, password string, matchFunc PasswordMatchFunc, nowFunc NowFunc) (err error) {
+	err = f.Authorize(user, password, matchFunc, nowFunc)
+	if err != nil {
+		return err
+	}
+	f.Downloads++
+	f.LastDownloaded = nowFunc()
+	return nil
+}
+
+// Preview checks that the user may view the file inline without downloading it. The download count is only incremented
+// if countAsDownload is set.
+func (f *FileHeader) Preview(user UserID, password string, matchFunc PasswordMatchFunc, nowFunc NowFunc, countAsDownload bool) (err error) {
+	if !f.Previewable() {
+		return ErrPreviewUnavailable
+	}
+	if countAsDownload {
+		return f.Download(user, password, matchFunc, nowFunc)
+	}
+	return f.Authorize(user, password, matchFunc, nowFunc)
+}
+
+// DownloadSigned increments the download count for a download with a signed URL. The password isn't needed because it
+// was checked when the URL was signed, but the file must still be available and under its download limit.
+func (f *FileHeader) DownloadSigned(nowFunc NowFunc) (err error) {
+	if nowFunc == nil {
+		return fmt.Errorf("now() service cannot be empty")
+	}
+	err = f.authorize("", nowFunc, func() error { return nil })
+	if err != nil {
+		return err
+	}
+	f.Downloads++
+	f.LastDownloaded = nowFunc()
+	return nil
+}
+
+// Authorize checks that the user may download the file, without counting a download.
+func (f *FileHeader) Authorize(user UserID, password string, matchFunc PasswordMatchFunc, nowFunc NowFunc) (err error) {
 	if matchFunc == nil {
 		return fmt.Errorf("matchFunc() service cannot be empty")
 	}
 	if nowFunc == nil {
 		return fmt.Errorf("now() service cannot be empty")
 	}
-	now := nowFunc()
-	if !f.Expires.IsZero() && !now.Before(f.Expires) {
-		return ErrFileExpired
-	}
-	if !f.userIsOwner(user) && f.PasswordHash != "" {
+	return f.authorize(user, nowFunc, func() error {
+		if f.userIsOwner(user) || f.PasswordHash == "" {
+			return nil
+		}
 		if password == "" {
 			return ErrFilePasswordRequired
 		}
@@ -126,14 +240,183 @@ func (f *FileHeader) Download(user UserID, password string, matchFunc PasswordMa
 		if !match {
 			return ErrFilePasswordInvalid
 		}
+		return nil
+	})
+}
+
+// CheckAvailable checks that the file's content can be served to the user in its current state, without checking its
+// password or other download conditions. It's for content the user was already authorized for, or that doesn't need
+// the password, such as thumbnails.
+func (f *FileHeader) CheckAvailable(user UserID, nowFunc NowFunc) error {
+	if nowFunc == nil {
+		return fmt.Errorf("now() service cannot be empty")
+	}
+	return f.authorize(user, nowFunc, func() error { return nil })
+}
+
+// authorize runs checkPassword after checking the file's state, and before the checks that should only be revealed to
+// clients with the password.
+func (f *FileHeader) authorize(user UserID, nowFunc NowFunc, checkPassword func() error) error {
+	now := nowFunc()
+	if f.IsExpired(now) {
+		return ErrFileExpired
+	}
+	if f.Quarantined {
+		return ErrFileQuarantined
+	}
+	if f.IsTrashed() {
+		return ErrFileTrashed
+	}
+	if err := checkPassword(); err != nil {
+		return err
 	}
-	if f.DownloadLimit > 0 && f.Downloads >= f.DownloadLimit {
+	if f.DownloadLimitReached() {
 		return ErrDownloadLimitReached
 	}
-	f.Downloads++
+	if !f.userIsOwner(user) && now.Before(f.AvailableFrom) {
+		return ErrFileNotAvailable
+	}
+	if f.ScanStatus == ScanPending {
+		return ErrFileNotScanned
+	}
+	return nil
+}
+
+// ExpiresAt returns when the file expires, whichever comes first of its expiration time or its inactivity expiry, or
+// zero if it never expires.
+func (f *FileHeader) ExpiresAt() time.Time {
+	inactive := f.InactiveAt()
+	if f.Expires.IsZero() || (!inactive.IsZero() && inactive.Before(f.Expires)) {
+		return inactive
+	}
+	return f.Expires
+}
+
+// InactiveAt returns when the file expires if it isn't downloaded again, or zero if it has no inactivity expiry. A file
+// that was never downloaded counts as active from when it was uploaded or became available, whichever is later.
+func (f *FileHeader) InactiveAt() time.Time {
+	if f.InactivityExpiry <= 0 {
+		return time.Time{}
+	}
+	lastActive := f.LastDownloaded
+	if lastActive.IsZero() {
+		lastActive = f.SharedFrom()
+	}
+	return lastActive.Add(f.InactivityExpiry)
+}
+
+// SharedFrom returns when recipients can first download the file, which is when it was uploaded or becomes available,
+// whichever is later.
+func (f *FileHeader) SharedFrom() time.Time {
+	if f.AvailableFrom.After(f.Created) {
+		return f.AvailableFrom
+	}
+	return f.Created
+}
+
+// IsExpired returns true if the file has expired by the given time.
+func (f *FileHeader) IsExpired(now time.Time) bool {
+	expires := f.ExpiresAt()
+	return !expires.IsZero() && !now.Before(expires)
+}
+
+// IsTrashed returns true if the owner deleted the file and it is waiting in the trash to be purged.
+func (f *FileHeader) IsTrashed() bool {
+	return !f.Trashed.IsZero()
+}
+
+// Trash moves the file to the trash.
+func (f *FileHeader) Trash(now time.Time) {
+	f.Trashed = now
+}
+
+// Restore takes the file back out of the trash.
+func (f *FileHeader) Restore() {
+	f.Trashed = time.Time{}
+}
+
+// RequiresTerms returns true if the file has terms that must be accepted before downloading it.
+func (f *FileHeader) RequiresTerms() bool {
+	return f.Terms != ""
+}
+
+// DownloadLimitReached returns true if the file has a download limit and it has been used up.
+func (f *FileHeader) DownloadLimitReached() bool {
+	return f.DownloadLimit > 0 && f.Downloads >= f.DownloadLimit
+}
+
+// AllowsClient returns true if a client with the IP address can download the file. A client with an unknown IP address
+// can only download files that don't restrict networks.
+func (f *FileHeader) AllowsClient(ip netip.Addr) bool {
+	return len(f.AllowedNetworks) == 0 || NetworksContain(f.AllowedNetworks, ip)
+}
+
+// maxPasswordBackoff caps how long to wait between password attempts.
+const maxPasswordBackoff = time.Hour
+
+// CheckPasswordAttempt returns an error if the file's password can't be attempted now, because it's locked after
+// lockoutAttempts failures in a row, or the wait since the last failure hasn't passed. The wait starts at backoff and
+// doubles after each failure. Zero lockoutAttempts or backoff disable them.
+func (f *FileHeader) CheckPasswordAttempt(now time.Time, backoff time.Duration, lockoutAttempts int64) error {
+	if f.FailedPasswordAttempts == 0 {
+		return nil
+	}
+	if f.PasswordLocked(lockoutAttempts) {
+		return ErrFilePasswordLocked
+	}
+	if backoff <= 0 {
+		return nil
+	}
+	wait := maxPasswordBackoff
+	if shift := f.FailedPasswordAttempts - 1; shift < 32 {
+		wait = min(backoff<<shift, maxPasswordBackoff)
+	}
+	if now.Before(f.LastFailedPassword.Add(wait)) {
+		return ErrFilePasswordBackoff
+	}
 	return nil
 }
 
+// PasswordLocked returns true if the file's password is locked after lockoutAttempts failures in a row.
+func (f *FileHeader) PasswordLocked(lockoutAttempts int64) bool {
+	return lockoutAttempts > 0 && f.FailedPasswordAttempts >= lockoutAttempts
+}
+
+// RecordFailedPassword counts a wrong password attempt.
+func (f *FileHeader) RecordFailedPassword(now time.Time) {
+	f.FailedPasswordAttempts++
+	f.LastFailedPassword = now
+}
+
+// ResetPasswordAttempts clears the failed password attempts, after a correct password or to unlock the file.
+func (f *FileHeader) ResetPasswordAttempts() {
+	f.FailedPasswordAttempts = 0
+	f.LastFailedPassword = time.Time{}
+}
+
+// Quarantine blocks all access to the file, for example if a processor found it to be malicious after it was saved.
+func (f *FileHeader) Quarantine(reason string) {
+	f.Quarantined = true
+	f.QuarantineReason = reason
+}
+
+// RecordScan records a virus scan result, infected files are quarantined.
+func (f *FileHeader) RecordScan(infected bool, signature string, now time.Time) {
+	f.Scanned = now
+	if !infected {
+		f.ScanStatus = ScanClean
+		return
+	}
+	f.ScanStatus = ScanInfected
+	f.ScanSignature = signature
+	f.Quarantine(fmt.Sprintf("virus found: %s", signature))
+}
+
+// Previewable returns true if the owner opted into previews and the content type is safe to display inline.
+func (f *FileHeader) Previewable() bool {
+	return f.AllowPreview && PreviewKindOf(f.ContentType) != PreviewNone
+}
+
 func (f *FileHeader) userIsOwner(user UserID) bool {
 	return f.Owner != "" && f.Owner == user
 }
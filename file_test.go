@@ -175,6 +175,42 @@ func TestUploadFile(t *testing.T) {
 				Data: io.NopCloser(strings.NewReader("file-data")),
 			},
 		},
+		{
+			name: "should fail if the file becomes available after it expires",
+			args: blinkfile.UploadFileArgs{
+				ID:            "file1",
+				Name:          "file1",
+				Owner:         "user1",
+				Reader:        io.NopCloser(strings.NewReader("file-data")),
+				Now:           func() time.Time { return time.Unix(0, 0).UTC() },
+				Expires:       time.Unix(1, 0).UTC(),
+				AvailableFrom: time.Unix(1, 0).UTC(),
+			},
+			wantErr: blinkfile.ErrAvailableAfterExpiration,
+		},
+		{
+			name: "should upload a new file that becomes available later",
+			args: blinkfile.UploadFileArgs{
+				ID:            "file1",
+				Name:          "file1",
+				Owner:         "user1",
+				Reader:        io.NopCloser(strings.NewReader("file-data")),
+				Now:           func() time.Time { return time.Unix(0, 0).UTC() },
+				Expires:       time.Unix(2, 0).UTC(),
+				AvailableFrom: time.Unix(1, 0).UTC(),
+			},
+			want: blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					ID:            "file1",
+					Name:          "file1",
+					Owner:         "user1",
+					Created:       time.Unix(0, 0).UTC(),
+					Expires:       time.Unix(2, 0).UTC(),
+					AvailableFrom: time.Unix(1, 0).UTC(),
+				},
+				Data: io.NopCloser(strings.NewReader("file-data")),
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -221,6 +257,35 @@ func TestFile_Download(t *testing.T) {
 			},
 			wantErr: fmt.Errorf("now() service cannot be empty"),
 		},
+		{
+			name: "should fail if the file is quarantined, even for the owner",
+			f: blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Owner:            "user1",
+					Quarantined:      true,
+					QuarantineReason: "malware found",
+				},
+			},
+			args: args{
+				user:      "user1",
+				matchFunc: func(string, string) (bool, error) { return false, nil },
+				nowFunc:   func() time.Time { return time.Unix(0, 0).UTC() },
+			},
+			wantErr: blinkfile.ErrFileQuarantined,
+		},
+		{
+			name: "should fail if the file is waiting to be scanned for viruses",
+			f: blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					ScanStatus: blinkfile.ScanPending,
+				},
+			},
+			args: args{
+				matchFunc: func(string, string) (bool, error) { return false, nil },
+				nowFunc:   func() time.Time { return time.Unix(0, 0).UTC() },
+			},
+			wantErr: blinkfile.ErrFileNotScanned,
+		},
 		{
 			name: "should fail if file is password-protected but no password is supplied",
 			f: blinkfile.File{
@@ -280,9 +345,10 @@ func TestFile_Download(t *testing.T) {
 			},
 			want: &blinkfile.File{
 				FileHeader: blinkfile.FileHeader{
-					Owner:        "user1",
-					PasswordHash: "password-hash",
-					Downloads:    1,
+					Owner:          "user1",
+					PasswordHash:   "password-hash",
+					Downloads:      1,
+					LastDownloaded: time.Unix(0, 0).UTC(),
 				},
 			},
 		},
@@ -310,7 +376,59 @@ func TestFile_Download(t *testing.T) {
 			},
 			want: &blinkfile.File{
 				FileHeader: blinkfile.FileHeader{
-					Downloads: 1,
+					Downloads:      1,
+					LastDownloaded: time.Unix(0, 0).UTC(),
+				},
+			},
+		},
+		{
+			name: "should fail if the file has not been downloaded within its inactivity expiry since it was uploaded",
+			f: blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Created:          time.Unix(0, 0).UTC(),
+					InactivityExpiry: time.Second,
+				},
+			},
+			args: args{
+				matchFunc: func(string, string) (bool, error) { return false, nil },
+				nowFunc:   func() time.Time { return time.Unix(1, 0).UTC() },
+			},
+			wantErr: blinkfile.ErrFileExpired,
+		},
+		{
+			name: "should fail if the file has not been downloaded within its inactivity expiry since it was last downloaded",
+			f: blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Created:          time.Unix(0, 0).UTC(),
+					LastDownloaded:   time.Unix(5, 0).UTC(),
+					InactivityExpiry: 2 * time.Second,
+				},
+			},
+			args: args{
+				matchFunc: func(string, string) (bool, error) { return false, nil },
+				nowFunc:   func() time.Time { return time.Unix(7, 0).UTC() },
+			},
+			wantErr: blinkfile.ErrFileExpired,
+		},
+		{
+			name: "should succeed and record the download time if the file was downloaded within its inactivity expiry",
+			f: blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Created:          time.Unix(0, 0).UTC(),
+					LastDownloaded:   time.Unix(5, 0).UTC(),
+					InactivityExpiry: 2 * time.Second,
+				},
+			},
+			args: args{
+				matchFunc: func(string, string) (bool, error) { return false, nil },
+				nowFunc:   func() time.Time { return time.Unix(6, 0).UTC() },
+			},
+			want: &blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Created:          time.Unix(0, 0).UTC(),
+					Downloads:        1,
+					LastDownloaded:   time.Unix(6, 0).UTC(),
+					InactivityExpiry: 2 * time.Second,
 				},
 			},
 		},
@@ -335,10 +453,93 @@ func TestFile_Download(t *testing.T) {
 			},
 			want: &blinkfile.File{
 				FileHeader: blinkfile.FileHeader{
-					Owner:        "file-owner",
-					Expires:      time.Unix(2, 0).UTC(),
-					PasswordHash: "password-hash",
-					Downloads:    1,
+					Owner:          "file-owner",
+					Expires:        time.Unix(2, 0).UTC(),
+					PasswordHash:   "password-hash",
+					Downloads:      1,
+					LastDownloaded: time.Unix(1, 0).UTC(),
+				},
+			},
+		},
+		{
+			name: "should fail if the file is not available yet",
+			f: blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Owner:         "user1",
+					AvailableFrom: time.Unix(2, 0).UTC(),
+				},
+			},
+			args: args{
+				user:      "user2",
+				matchFunc: func(string, string) (bool, error) { return false, nil },
+				nowFunc:   func() time.Time { return time.Unix(1, 0).UTC() },
+			},
+			wantErr: blinkfile.ErrFileNotAvailable,
+		},
+		{
+			name: "should succeed before the file is available if the user is the owner",
+			f: blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Owner:         "user1",
+					AvailableFrom: time.Unix(2, 0).UTC(),
+				},
+			},
+			args: args{
+				user:      "user1",
+				matchFunc: func(string, string) (bool, error) { return false, nil },
+				nowFunc:   func() time.Time { return time.Unix(1, 0).UTC() },
+			},
+			want: &blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Owner:          "user1",
+					AvailableFrom:  time.Unix(2, 0).UTC(),
+					Downloads:      1,
+					LastDownloaded: time.Unix(1, 0).UTC(),
+				},
+			},
+		},
+		{
+			name: "should succeed once the file is available",
+			f: blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Owner:         "user1",
+					AvailableFrom: time.Unix(2, 0).UTC(),
+				},
+			},
+			args: args{
+				user:      "user2",
+				matchFunc: func(string, string) (bool, error) { return false, nil },
+				nowFunc:   func() time.Time { return time.Unix(2, 0).UTC() },
+			},
+			want: &blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Owner:          "user1",
+					AvailableFrom:  time.Unix(2, 0).UTC(),
+					Downloads:      1,
+					LastDownloaded: time.Unix(2, 0).UTC(),
+				},
+			},
+		},
+		{
+			name: "should count inactivity from when the file became available if it was never downloaded",
+			f: blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Created:          time.Unix(0, 0).UTC(),
+					AvailableFrom:    time.Unix(5, 0).UTC(),
+					InactivityExpiry: 2 * time.Second,
+				},
+			},
+			args: args{
+				matchFunc: func(string, string) (bool, error) { return false, nil },
+				nowFunc:   func() time.Time { return time.Unix(6, 0).UTC() },
+			},
+			want: &blinkfile.File{
+				FileHeader: blinkfile.FileHeader{
+					Created:          time.Unix(0, 0).UTC(),
+					AvailableFrom:    time.Unix(5, 0).UTC(),
+					InactivityExpiry: 2 * time.Second,
+					Downloads:        1,
+					LastDownloaded:   time.Unix(6, 0).UTC(),
 				},
 			},
 		},
@@ -376,8 +577,9 @@ func TestFile_Download(t *testing.T) {
 			},
 			want: &blinkfile.File{
 				FileHeader: blinkfile.FileHeader{
-					Downloads:     2,
-					DownloadLimit: 2,
+					Downloads:      2,
+					DownloadLimit:  2,
+					LastDownloaded: time.Unix(0, 0).UTC(),
 				},
 			},
 		},
@@ -395,3 +597,248 @@ func TestFile_Download(t *testing.T) {
 		})
 	}
 }
+
+func TestFileHeader_Preview(t *testing.T) {
+	type args struct {
+		user            blinkfile.UserID
+		password        string
+		countAsDownload bool
+	}
+	matchFunc := func(string, string) (bool, error) { return true, nil }
+	nowFunc := func() time.Time { return time.Unix(0, 0).UTC() }
+	tests := []struct {
+		name    string
+		f       blinkfile.FileHeader
+		args    args
+		wantErr error
+		want    blinkfile.FileHeader
+	}{
+		{
+			name:    "should fail if previews are not allowed",
+			f:       blinkfile.FileHeader{ContentType: "image/png"},
+			wantErr: blinkfile.ErrPreviewUnavailable,
+			want:    blinkfile.FileHeader{ContentType: "image/png"},
+		},
+		{
+			name:    "should fail if the content type is not safe to preview",
+			f:       blinkfile.FileHeader{ContentType: "image/svg+xml", AllowPreview: true},
+			wantErr: blinkfile.ErrPreviewUnavailable,
+			want:    blinkfile.FileHeader{ContentType: "image/svg+xml", AllowPreview: true},
+		},
+		{
+			name:    "should fail if file is password-protected but no password is supplied",
+			f:       blinkfile.FileHeader{ContentType: "text/plain; charset=utf-8", AllowPreview: true, PasswordHash: "password-hash"},
+			wantErr: blinkfile.ErrFilePasswordRequired,
+			want:    blinkfile.FileHeader{ContentType: "text/plain; charset=utf-8", AllowPreview: true, PasswordHash: "password-hash"},
+		},
+		{
+			name:    "should fail if the file downloads have reached the limit",
+			f:       blinkfile.FileHeader{ContentType: "video/mp4", AllowPreview: true, Downloads: 1, DownloadLimit: 1},
+			wantErr: blinkfile.ErrDownloadLimitReached,
+			want:    blinkfile.FileHeader{ContentType: "video/mp4", AllowPreview: true, Downloads: 1, DownloadLimit: 1},
+		},
+		{
+			name: "should succeed without counting a download",
+			f:    blinkfile.FileHeader{ContentType: "application/pdf", AllowPreview: true},
+			want: blinkfile.FileHeader{ContentType: "application/pdf", AllowPreview: true},
+		},
+		{
+			name: "should succeed and count a download",
+			f:    blinkfile.FileHeader{ContentType: "audio/mpeg", AllowPreview: true},
+			args: args{countAsDownload: true},
+			want: blinkfile.FileHeader{ContentType: "audio/mpeg", AllowPreview: true, Downloads: 1, LastDownloaded: time.Unix(0, 0).UTC()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.f.Preview(tt.args.user, tt.args.password, matchFunc, nowFunc, tt.args.countAsDownload)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Preview() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(tt.f, tt.want) {
+				t.Errorf("Preview() changed file to:\n\t%+v\nwant:\n\t%+v", tt.f, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileHeader_DownloadSigned(t *testing.T) {
+	nowFunc := func() time.Time { return time.Unix(100, 0).UTC() }
+	tests := []struct {
+		name    string
+		f       blinkfile.FileHeader
+		wantErr error
+		want    blinkfile.FileHeader
+	}{
+		{
+			name: "should succeed without a password for a password-protected file",
+			f:    blinkfile.FileHeader{PasswordHash: "password-hash", Downloads: 1, DownloadLimit: 2},
+			want: blinkfile.FileHeader{PasswordHash: "password-hash", Downloads: 2, DownloadLimit: 2, LastDownloaded: time.Unix(100, 0).UTC()},
+		},
+		{
+			name:    "should fail if the file downloads have reached the limit",
+			f:       blinkfile.FileHeader{PasswordHash: "password-hash", Downloads: 2, DownloadLimit: 2},
+			wantErr: blinkfile.ErrDownloadLimitReached,
+			want:    blinkfile.FileHeader{PasswordHash: "password-hash", Downloads: 2, DownloadLimit: 2},
+		},
+		{
+			name:    "should fail if the file has expired",
+			f:       blinkfile.FileHeader{Expires: time.Unix(50, 0).UTC()},
+			wantErr: blinkfile.ErrFileExpired,
+			want:    blinkfile.FileHeader{Expires: time.Unix(50, 0).UTC()},
+		},
+		{
+			name:    "should fail if the file is in the trash",
+			f:       blinkfile.FileHeader{Trashed: time.Unix(50, 0).UTC()},
+			wantErr: blinkfile.ErrFileTrashed,
+			want:    blinkfile.FileHeader{Trashed: time.Unix(50, 0).UTC()},
+		},
+		{
+			name:    "should fail if the file is not available yet",
+			f:       blinkfile.FileHeader{Owner: "user1", AvailableFrom: time.Unix(150, 0).UTC()},
+			wantErr: blinkfile.ErrFileNotAvailable,
+			want:    blinkfile.FileHeader{Owner: "user1", AvailableFrom: time.Unix(150, 0).UTC()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.f.DownloadSigned(nowFunc)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("DownloadSigned() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(tt.f, tt.want) {
+				t.Errorf("DownloadSigned() changed file to:\n\t%+v\nwant:\n\t%+v", tt.f, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileHeader_CheckAvailable(t *testing.T) {
+	nowFunc := func() time.Time { return time.Unix(100, 0).UTC() }
+	tests := []struct {
+		name    string
+		f       blinkfile.FileHeader
+		user    blinkfile.UserID
+		wantErr error
+	}{
+		{
+			name: "should succeed without a password for a password-protected file",
+			f:    blinkfile.FileHeader{PasswordHash: "password-hash"},
+		},
+		{
+			name:    "should fail if the file has expired",
+			f:       blinkfile.FileHeader{Expires: time.Unix(50, 0).UTC()},
+			wantErr: blinkfile.ErrFileExpired,
+		},
+		{
+			name:    "should fail if the file has expired from inactivity",
+			f:       blinkfile.FileHeader{Created: time.Unix(0, 0).UTC(), InactivityExpiry: 50 * time.Second},
+			wantErr: blinkfile.ErrFileExpired,
+		},
+		{
+			name:    "should fail if the file is quarantined",
+			f:       blinkfile.FileHeader{Quarantined: true},
+			wantErr: blinkfile.ErrFileQuarantined,
+		},
+		{
+			name:    "should fail if the file is in the trash",
+			f:       blinkfile.FileHeader{Trashed: time.Unix(50, 0).UTC()},
+			wantErr: blinkfile.ErrFileTrashed,
+		},
+		{
+			name:    "should fail if the file downloads have reached the limit",
+			f:       blinkfile.FileHeader{Downloads: 2, DownloadLimit: 2},
+			wantErr: blinkfile.ErrDownloadLimitReached,
+		},
+		{
+			name:    "should fail if the file is not available to other users yet",
+			f:       blinkfile.FileHeader{Owner: "user1", AvailableFrom: time.Unix(150, 0).UTC()},
+			user:    "user2",
+			wantErr: blinkfile.ErrFileNotAvailable,
+		},
+		{
+			name: "should succeed for the owner before the file is available",
+			f:    blinkfile.FileHeader{Owner: "user1", AvailableFrom: time.Unix(150, 0).UTC()},
+			user: "user1",
+		},
+		{
+			name:    "should fail if the file hasn't been scanned yet",
+			f:       blinkfile.FileHeader{ScanStatus: blinkfile.ScanPending},
+			wantErr: blinkfile.ErrFileNotScanned,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.f.CheckAvailable(tt.user, nowFunc)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("CheckAvailable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileHeader_CheckPasswordAttempt(t *testing.T) {
+	now := time.Unix(100, 0)
+	type args struct {
+		backoff         time.Duration
+		lockoutAttempts int64
+	}
+	tests := []struct {
+		name    string
+		f       blinkfile.FileHeader
+		args    args
+		wantErr error
+	}{
+		{
+			name: "should allow an attempt without any failures",
+			args: args{backoff: time.Second, lockoutAttempts: 1},
+		},
+		{
+			name:    "should fail while waiting after a failure",
+			f:       blinkfile.FileHeader{FailedPasswordAttempts: 1, LastFailedPassword: now.Add(-time.Second + 1)},
+			args:    args{backoff: time.Second},
+			wantErr: blinkfile.ErrFilePasswordBackoff,
+		},
+		{
+			name: "should allow an attempt after waiting",
+			f:    blinkfile.FileHeader{FailedPasswordAttempts: 1, LastFailedPassword: now.Add(-time.Second)},
+			args: args{backoff: time.Second},
+		},
+		{
+			name:    "should double the wait after each failure",
+			f:       blinkfile.FileHeader{FailedPasswordAttempts: 3, LastFailedPassword: now.Add(-3 * time.Second)},
+			args:    args{backoff: time.Second},
+			wantErr: blinkfile.ErrFilePasswordBackoff,
+		},
+		{
+			name: "should cap the wait",
+			f:    blinkfile.FileHeader{FailedPasswordAttempts: 100, LastFailedPassword: now.Add(-time.Hour)},
+			args: args{backoff: time.Second},
+		},
+		{
+			name: "should allow an attempt right away without a backoff",
+			f:    blinkfile.FileHeader{FailedPasswordAttempts: 5, LastFailedPassword: now},
+		},
+		{
+			name:    "should fail once the failures reach the lockout attempts",
+			f:       blinkfile.FileHeader{FailedPasswordAttempts: 3, LastFailedPassword: now.Add(-24 * time.Hour)},
+			args:    args{backoff: time.Second, lockoutAttempts: 3},
+			wantErr: blinkfile.ErrFilePasswordLocked,
+		},
+		{
+			name: "should allow an attempt before the failures reach the lockout attempts",
+			f:    blinkfile.FileHeader{FailedPasswordAttempts: 2, LastFailedPassword: now.Add(-24 * time.Hour)},
+			args: args{backoff: time.Second, lockoutAttempts: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.f.CheckPasswordAttempt(now, tt.args.backoff, tt.args.lockoutAttempts)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("CheckPasswordAttempt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package blinkfile
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	// FileTypePolicy blocks or allows uploads by filename extension and by the content type sniffed from the file data,
+	// so a renamed file is still caught.
+	FileTypePolicy struct {
+		Mode         FileTypePolicyMode
+		Extensions   []string
+		ContentTypes []string
+	}
+
+	FileTypePolicyMode string
+
+	// FileTypeError explains why a file type isn't allowed.
+	FileTypeError struct {
+		Extension   string
+		ContentType string
+	}
+)
+
+const (
+	// FileTypeBlock blocks the listed types and allows everything else.
+	FileTypeBlock FileTypePolicyMode = "block"
+	// FileTypeAllow only allows the listed types.
+	FileTypeAllow FileTypePolicyMode = "allow"
+)
+
+var ErrInvalidFileTypePolicy = fmt.Errorf("invalid file type policy")
+
+func (e *FileTypeError) Error() string {
+	if e.Extension != "" {
+		return fmt.Sprintf("file extension %q is not allowed", e.Extension)
+	}
+	return fmt.Sprintf("file content type %q is not allowed", e.ContentType)
+}
+
+// ParseFileTypePolicy normalizes the extensions and content types, which can be separated by commas or whitespace.
+// Extensions are lower-cased with a leading dot, content types can use a wildcard subtype like "video/*".
+func ParseFileTypePolicy(mode FileTypePolicyMode, extensions, contentTypes string) (FileTypePolicy, error) {
+	if mode == "" {
+		mode = FileTypeBlock
+	}
+	if mode != FileTypeBlock && mode != FileTypeAllow {
+		return FileTypePolicy{}, fmt.Errorf("%w: unknown mode %q", ErrInvalidFileTypePolicy, mode)
+	}
+	policy := FileTypePolicy{Mode: mode}
+	for _, ext := range splitList(extensions) {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if len(ext) < 2 || strings.ContainsAny(ext[1:], `./\`) {
+			return FileTypePolicy{}, fmt.Errorf("%w: extension %q", ErrInvalidFileTypePolicy, ext)
+		}
+		policy.Extensions = append(policy.Extensions, ext)
+	}
+	for _, contentType := range splitList(contentTypes) {
+		contentType = strings.ToLower(contentType)
+		mainType, subType, ok := strings.Cut(contentType, "/")
+		if !ok || mainType == "" || subType == "" || strings.Contains(subType, "/") {
+			return FileTypePolicy{}, fmt.Errorf("%w: content type %q", ErrInvalidFileTypePolicy, contentType)
+		}
+		policy.ContentTypes = append(policy.ContentTypes, contentType)
+	}
+	return policy, nil
+}
+
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+}
+
+// IsEmpty returns true if the policy doesn't restrict anything.
+func (p FileTypePolicy) IsEmpty() bool {
+	return len(p.Extensions) == 0 && len(p.ContentTypes) == 0
+}
+
+// Check returns a *FileTypeError if the policy doesn't allow a file with the name and sniffed content type. In allow
+// mode the file must match both the allowed extensions and the allowed content types, if either list is set.
+func (p FileTypePolicy) Check(filename, contentType string) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+	extMatch := matchExtension(p.Extensions, ext)
+	typeMatch := matchContentType(p.ContentTypes, mediaType)
+	if p.Mode == FileTypeAllow {
+		if len(p.Extensions) > 0 && !extMatch {
+			return &FileTypeError{Extension: extOrNone(ext)}
+		}
+		if len(p.ContentTypes) > 0 && !typeMatch {
+			return &FileTypeError{ContentType: mediaType}
+		}
+		return nil
+	}
+	if extMatch {
+		return &FileTypeError{Extension: ext}
+	}
+	if typeMatch {
+		return &FileTypeError{ContentType: mediaType}
+	}
+	return nil
+}
+
+func extOrNone(ext string) string {
+	if ext == "" {
+		return "(none)"
+	}
+	return ext
+}
+
+func matchExtension(extensions []string, ext string) bool {
+	if ext == "" {
+		return false
+	}
+	for _, e := range extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func matchContentType(contentTypes []string, mediaType string) bool {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	for _, ct := range contentTypes {
+		if ct == mediaType || ct == mainType+"/*" {
+			return true
+		}
+	}
+	return false
+}
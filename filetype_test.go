@@ -0,0 +1,145 @@
+package blinkfile_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+func TestParseFileTypePolicy(t *testing.T) {
+	type args struct {
+		mode         blinkfile.FileTypePolicyMode
+		extensions   string
+		contentTypes string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    blinkfile.FileTypePolicy
+		wantErr error
+	}{
+		{
+			name:    "should fail with an unknown mode",
+			args:    args{mode: "deny"},
+			wantErr: fmt.Errorf("%w: unknown mode %q", blinkfile.ErrInvalidFileTypePolicy, "deny"),
+		},
+		{
+			name:    "should fail with an invalid extension",
+			args:    args{extensions: "tar.gz"},
+			wantErr: fmt.Errorf("%w: extension %q", blinkfile.ErrInvalidFileTypePolicy, ".tar.gz"),
+		},
+		{
+			name:    "should fail with an invalid content type",
+			args:    args{contentTypes: "application"},
+			wantErr: fmt.Errorf("%w: content type %q", blinkfile.ErrInvalidFileTypePolicy, "application"),
+		},
+		{
+			name: "should default to block mode with an empty policy",
+			want: blinkfile.FileTypePolicy{Mode: blinkfile.FileTypeBlock},
+		},
+		{
+			name: "should normalize comma and whitespace separated lists",
+			args: args{
+				mode:         blinkfile.FileTypeAllow,
+				extensions:   "PDF, .txt\n  png",
+				contentTypes: "Application/PDF,image/*",
+			},
+			want: blinkfile.FileTypePolicy{
+				Mode:         blinkfile.FileTypeAllow,
+				Extensions:   []string{".pdf", ".txt", ".png"},
+				ContentTypes: []string{"application/pdf", "image/*"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := blinkfile.ParseFileTypePolicy(tt.args.mode, tt.args.extensions, tt.args.contentTypes)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("ParseFileTypePolicy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFileTypePolicy() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileTypePolicy_Check(t *testing.T) {
+	blockExecutables := blinkfile.FileTypePolicy{
+		Mode:         blinkfile.FileTypeBlock,
+		Extensions:   []string{".exe", ".bat"},
+		ContentTypes: []string{"application/vnd.microsoft.portable-executable", "application/x-executable"},
+	}
+	allowDocuments := blinkfile.FileTypePolicy{
+		Mode:         blinkfile.FileTypeAllow,
+		Extensions:   []string{".pdf", ".png"},
+		ContentTypes: []string{"application/pdf", "image/*"},
+	}
+	type args struct {
+		filename    string
+		contentType string
+	}
+	tests := []struct {
+		name    string
+		policy  blinkfile.FileTypePolicy
+		args    args
+		wantErr error
+	}{
+		{
+			name:   "should allow anything with an empty policy",
+			policy: blinkfile.FileTypePolicy{},
+			args:   args{filename: "setup.exe", contentType: "application/vnd.microsoft.portable-executable"},
+		},
+		{
+			name:    "should block a listed extension regardless of case",
+			policy:  blockExecutables,
+			args:    args{filename: "Setup.EXE", contentType: "application/octet-stream"},
+			wantErr: &blinkfile.FileTypeError{Extension: ".exe"},
+		},
+		{
+			name:    "should block a renamed file by its content type",
+			policy:  blockExecutables,
+			args:    args{filename: "holiday.jpg", contentType: "application/vnd.microsoft.portable-executable"},
+			wantErr: &blinkfile.FileTypeError{ContentType: "application/vnd.microsoft.portable-executable"},
+		},
+		{
+			name:   "should allow other files in block mode",
+			policy: blockExecutables,
+			args:   args{filename: "notes.txt", contentType: "text/plain; charset=utf-8"},
+		},
+		{
+			name:   "should allow a listed type in allow mode, matching wildcard content types",
+			policy: allowDocuments,
+			args:   args{filename: "photo.png", contentType: "image/png"},
+		},
+		{
+			name:    "should block other extensions in allow mode",
+			policy:  allowDocuments,
+			args:    args{filename: "notes.txt", contentType: "application/pdf"},
+			wantErr: &blinkfile.FileTypeError{Extension: ".txt"},
+		},
+		{
+			name:    "should block files without an extension in allow mode",
+			policy:  allowDocuments,
+			args:    args{filename: "README", contentType: "application/pdf"},
+			wantErr: &blinkfile.FileTypeError{Extension: "(none)"},
+		},
+		{
+			name:    "should block a renamed file in allow mode if its content doesn't match",
+			policy:  allowDocuments,
+			args:    args{filename: "report.pdf", contentType: "application/x-executable"},
+			wantErr: &blinkfile.FileTypeError{ContentType: "application/x-executable"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.args.filename, tt.args.contentType)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
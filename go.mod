@@ -7,6 +7,7 @@ toolchain go1.24.7
 require (
 	github.com/kataras/iris/v12 v12.2.11
 	golang.org/x/crypto v0.45.0
+	golang.org/x/time v0.8.0
 )
 
 require (
@@ -47,7 +48,6 @@ require (
 	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
-	golang.org/x/time v0.8.0 // indirect
 	google.golang.org/protobuf v1.35.2 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,297 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+type (
+	isoBox struct {
+		boxType string
+		start   int // Start of the box header
+		data    int // Start of the box payload
+		end     int
+	}
+
+	heifExtent struct {
+		offset uint64
+		length uint64
+	}
+
+	heifLocation struct {
+		constructionMethod uint16
+		extents            []heifExtent
+	}
+
+	byteReader struct {
+		b   []byte
+		pos int
+		err bool
+	}
+)
+
+// stripHEIF overwrites the Exif and XMP items of a HEIF container with zeros. Only the item data is cleared, so the
+// item and box offsets in the file stay valid. This supports the common "lite" layout of a single top-level meta box
+// with items stored in the file or in its idat box.
+func stripHEIF(data []byte) ([]byte, bool, error) {
+	boxes, err := parseBoxes(data, 0, len(data))
+	if err != nil {
+		return data, false, err
+	}
+	meta, ok := findBox(boxes, "meta")
+	if !ok {
+		return data, false, nil
+	}
+	// meta is a full box, its children start after the version and flags
+	children, err := parseBoxes(data, meta.data+4, meta.end)
+	if err != nil {
+		return data, false, err
+	}
+	iinf, ok := findBox(children, "iinf")
+	if !ok {
+		return data, false, nil
+	}
+	metadataItems, err := parseMetadataItems(data, iinf)
+	if err != nil {
+		return data, false, err
+	}
+	if len(metadataItems) == 0 {
+		return data, false, nil
+	}
+	iloc, ok := findBox(children, "iloc")
+	if !ok {
+		return data, false, ErrMalformed
+	}
+	locations, err := parseItemLocations(data, iloc)
+	if err != nil {
+		return data, false, err
+	}
+	idat, hasIdat := findBox(children, "idat")
+
+	out := bytes.Clone(data)
+	var removed bool
+	for itemID := range metadataItems {
+		loc, found := locations[itemID]
+		if !found {
+			continue
+		}
+		var base, limit uint64
+		switch loc.constructionMethod {
+		case 0:
+			base, limit = 0, uint64(len(out))
+		case 1:
+			if !hasIdat {
+				return data, false, ErrMalformed
+			}
+			base, limit = uint64(idat.data), uint64(idat.end)
+		default:
+			continue
+		}
+		for _, extent := range loc.extents {
+			start := base + extent.offset
+			end := start + extent.length
+			if extent.length == 0 || end < start || end > limit {
+				return data, false, ErrMalformed
+			}
+			clear(out[start:end])
+			removed = true
+		}
+	}
+	return out, removed, nil
+}
+
+func parseBoxes(data []byte, start, end int) ([]isoBox, error) {
+	var boxes []isoBox
+	for i := start; i < end; {
+		if i+8 > end {
+			return nil, ErrMalformed
+		}
+		size := uint64(binary.BigEndian.Uint32(data[i : i+4]))
+		box := isoBox{boxType: string(data[i+4 : i+8]), start: i, data: i + 8}
+		switch size {
+		case 0:
+			size = uint64(end - i)
+		case 1:
+			if i+16 > end {
+				return nil, ErrMalformed
+			}
+			size = binary.BigEndian.Uint64(data[i+8 : i+16])
+			box.data = i + 16
+		}
+		if size < uint64(box.data-i) || size > uint64(end-i) {
+			return nil, ErrMalformed
+		}
+		box.end = i + int(size)
+		boxes = append(boxes, box)
+		i = box.end
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []isoBox, boxType string) (isoBox, bool) {
+	for _, box := range boxes {
+		if box.boxType == boxType {
+			return box, true
+		}
+	}
+	return isoBox{}, false
+}
+
+// parseMetadataItems returns the IDs of Exif and XMP items listed in the item info box.
+func parseMetadataItems(data []byte, iinf isoBox) (map[uint32]struct{}, error) {
+	r := &byteReader{b: data[:iinf.end], pos: iinf.data}
+	version := r.uint(1)
+	r.skip(3)
+	if version == 0 {
+		r.uint(2)
+	} else {
+		r.uint(4)
+	}
+	if r.err {
+		return nil, ErrMalformed
+	}
+	entries, err := parseBoxes(data, r.pos, iinf.end)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[uint32]struct{})
+	for _, infe := range entries {
+		if infe.boxType != "infe" {
+			continue
+		}
+		er := &byteReader{b: data[:infe.end], pos: infe.data}
+		infeVersion := er.uint(1)
+		er.skip(3)
+		var itemID uint32
+		var isMetadata bool
+		if infeVersion >= 2 {
+			if infeVersion == 3 {
+				itemID = uint32(er.uint(4))
+			} else {
+				itemID = uint32(er.uint(2))
+			}
+			er.uint(2) // Protection index
+			itemType := er.fourCC()
+			switch itemType {
+			case "Exif":
+				isMetadata = true
+			case "mime":
+				er.cString() // Item name
+				isMetadata = er.cString() == "application/rdf+xml"
+			}
+		} else {
+			itemID = uint32(er.uint(2))
+			er.uint(2)   // Protection index
+			er.cString() // Item name
+			isMetadata = er.cString() == "application/rdf+xml"
+		}
+		if er.err {
+			return nil, ErrMalformed
+		}
+		if isMetadata {
+			items[itemID] = struct{}{}
+		}
+	}
+	return items, nil
+}
+
+func parseItemLocations(data []byte, iloc isoBox) (map[uint32]heifLocation, error) {
+	r := &byteReader{b: data[:iloc.end], pos: iloc.data}
+	version := r.uint(1)
+	r.skip(3)
+	sizes := r.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0x0f)
+	sizes = r.uint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0x0f)
+	}
+	var itemCount uint64
+	if version < 2 {
+		itemCount = r.uint(2)
+	} else {
+		itemCount = r.uint(4)
+	}
+	locations := make(map[uint32]heifLocation)
+	for n := uint64(0); n < itemCount && !r.err; n++ {
+		var itemID uint32
+		if version < 2 {
+			itemID = uint32(r.uint(2))
+		} else {
+			itemID = uint32(r.uint(4))
+		}
+		var loc heifLocation
+		if version == 1 || version == 2 {
+			loc.constructionMethod = uint16(r.uint(2) & 0x0f)
+		}
+		r.uint(2) // Data reference index
+		baseOffset := r.uint(baseOffsetSize)
+		extentCount := r.uint(2)
+		for e := uint64(0); e < extentCount && !r.err; e++ {
+			if indexSize > 0 {
+				r.uint(indexSize)
+			}
+			offset := r.uint(offsetSize)
+			length := r.uint(lengthSize)
+			loc.extents = append(loc.extents, heifExtent{offset: baseOffset + offset, length: length})
+		}
+		locations[itemID] = loc
+	}
+	if r.err {
+		return nil, ErrMalformed
+	}
+	return locations, nil
+}
+
+func (r *byteReader) skip(n int) {
+	if r.err || r.pos+n > len(r.b) {
+		r.err = true
+		return
+	}
+	r.pos += n
+}
+
+// uint reads a big-endian unsigned integer of 0, 1, 2, 4 or 8 bytes.
+func (r *byteReader) uint(size int) uint64 {
+	if r.err {
+		return 0
+	}
+	if size != 0 && size != 1 && size != 2 && size != 4 && size != 8 {
+		r.err = true
+		return 0
+	}
+	if r.pos+size > len(r.b) {
+		r.err = true
+		return 0
+	}
+	var v uint64
+	for _, b := range r.b[r.pos : r.pos+size] {
+		v = v<<8 | uint64(b)
+	}
+	r.pos += size
+	return v
+}
+
+func (r *byteReader) fourCC() string {
+	if r.err || r.pos+4 > len(r.b) {
+		r.err = true
+		return ""
+	}
+	v := string(r.b[r.pos : r.pos+4])
+	r.pos += 4
+	return v
+}
+
+func (r *byteReader) cString() string {
+	if r.err {
+		return ""
+	}
+	end := bytes.IndexByte(r.b[r.pos:], 0)
+	if end < 0 {
+		r.err = true
+		return ""
+	}
+	v := string(r.b[r.pos : r.pos+end])
+	r.pos += end + 1
+	return v
+}
@@ -0,0 +1,61 @@
+// Package imagemeta removes EXIF and XMP metadata, such as GPS coordinates, from image files without re-encoding the
+// image data.
+package imagemeta
+
+import (
+	"fmt"
+	"mime"
+)
+
+var (
+	ErrUnsupported = fmt.Errorf("unsupported image format")
+	ErrMalformed   = fmt.Errorf("malformed image data")
+)
+
+var stripFuncs = map[string]func([]byte) ([]byte, bool, error){
+	"image/jpeg": stripJPEG,
+	"image/png":  stripPNG,
+	"image/heic": stripHEIF,
+	"image/heif": stripHEIF,
+	"image/avif": stripHEIF,
+}
+
+// Supported returns true if metadata can be stripped from images of the content type.
+func Supported(contentType string) bool {
+	_, ok := stripFuncs[mediaType(contentType)]
+	return ok
+}
+
+// Strip returns the image data with metadata removed, and whether any metadata was found and removed.
+func Strip(contentType string, data []byte) (out []byte, removed bool, err error) {
+	strip, ok := stripFuncs[mediaType(contentType)]
+	if !ok {
+		return data, false, ErrUnsupported
+	}
+	return strip(data)
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// DetectHEIF returns the content type of an ISO base media file with a HEIF image brand, which the standard library
+// content sniffer doesn't recognize.
+func DetectHEIF(data []byte) (contentType string, ok bool) {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return "", false
+	}
+	switch string(data[8:12]) {
+	case "heic", "heix", "heim", "heis", "hevc", "hevx":
+		return "image/heic", true
+	case "mif1", "msf1":
+		return "image/heif", true
+	case "avif", "avis":
+		return "image/avif", true
+	}
+	return "", false
+}
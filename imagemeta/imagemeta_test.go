@@ -0,0 +1,257 @@
+package imagemeta_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"github.com/benjohns1/blinkfile/imagemeta"
+)
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 30), G: uint8(y * 30), B: 100, A: 0xff})
+		}
+	}
+	return img
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// exifPayload returns an APP1 EXIF payload with orientation and GPS latitude reference tags.
+func exifPayload(orientation uint16) []byte {
+	return append([]byte("Exif\x00\x00"),
+		'I', 'I', 0x2a, 0x00,
+		0x08, 0x00, 0x00, 0x00,
+		0x02, 0x00,
+		0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, byte(orientation), byte(orientation>>8), 0x00, 0x00,
+		0x01, 0x00, 0x02, 0x00, 0x02, 0x00, 0x00, 0x00, 'N', 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	)
+}
+
+func testJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// Insert the segments straight after the SOI marker
+	out := append([]byte{}, data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func testPNG(t *testing.T, chunks ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// Insert the chunks straight after the IHDR chunk
+	const ihdrEnd = 8 + 12 + 13
+	out := append([]byte{}, data[:ihdrEnd]...)
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	return append(out, data[ihdrEnd:]...)
+}
+
+func isoBox(boxType string, payload ...[]byte) []byte {
+	box := make([]byte, 4, 8)
+	box = append(box, boxType...)
+	for _, p := range payload {
+		box = append(box, p...)
+	}
+	binary.BigEndian.PutUint32(box, uint32(len(box)))
+	return box
+}
+
+// testHEIF returns a HEIF file with a single item stored in its mdat box, and the position of the item data.
+func testHEIF(itemType string, itemData []byte) (data []byte, itemStart int) {
+	ftyp := isoBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	infe := isoBox("infe", []byte{2, 0, 0, 0, 0, 1, 0, 0}, []byte(itemType), []byte("\x00"))
+	iinf := isoBox("iinf", []byte{0, 0, 0, 0, 0, 1}, infe)
+	ilocFor := func(offset int) []byte {
+		entry := []byte{0, 1, 0, 0, 0, 1}
+		entry = binary.BigEndian.AppendUint32(entry, uint32(offset))
+		entry = binary.BigEndian.AppendUint32(entry, uint32(len(itemData)))
+		return isoBox("iloc", []byte{0, 0, 0, 0, 0x44, 0x00, 0, 1}, entry)
+	}
+	meta := isoBox("meta", []byte{0, 0, 0, 0}, iinf, ilocFor(0))
+	itemStart = len(ftyp) + len(meta) + 8
+	meta = isoBox("meta", []byte{0, 0, 0, 0}, iinf, ilocFor(itemStart))
+	mdat := isoBox("mdat", itemData)
+	return append(append(ftyp, meta...), mdat...), itemStart
+}
+
+func TestStrip(t *testing.T) {
+	plainJPEG := testJPEG(t)
+	plainPNG := testPNG(t)
+	xmp := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), "<x:xmpmeta/>"...)
+	exifHEIF, exifStart := testHEIF("Exif", exifPayload(1))
+	strippedHEIF := append([]byte{}, exifHEIF...)
+	clear(strippedHEIF[exifStart : exifStart+len(exifPayload(1))])
+	imageHEIF, _ := testHEIF("hvc1", []byte("image data"))
+	type args struct {
+		contentType string
+		data        []byte
+	}
+	tests := []struct {
+		name        string
+		args        args
+		want        []byte
+		wantRemoved bool
+		wantErr     error
+	}{
+		{
+			name:    "should fail with an unsupported content type",
+			args:    args{contentType: "image/gif", data: []byte("GIF89a")},
+			want:    []byte("GIF89a"),
+			wantErr: imagemeta.ErrUnsupported,
+		},
+		{
+			name:    "should fail with malformed JPEG data",
+			args:    args{contentType: "image/jpeg", data: []byte("not a jpeg")},
+			want:    []byte("not a jpeg"),
+			wantErr: imagemeta.ErrMalformed,
+		},
+		{
+			name: "should leave a JPEG without metadata unchanged",
+			args: args{contentType: "image/jpeg", data: plainJPEG},
+			want: plainJPEG,
+		},
+		{
+			name:        "should remove EXIF and XMP segments from a JPEG",
+			args:        args{contentType: "image/jpeg", data: testJPEG(t, jpegSegment(0xe1, exifPayload(1)), jpegSegment(0xe1, xmp))},
+			want:        plainJPEG,
+			wantRemoved: true,
+		},
+		{
+			name: "should keep the orientation when removing EXIF from a JPEG",
+			args: args{contentType: "image/jpeg; charset=binary", data: testJPEG(t, jpegSegment(0xe1, exifPayload(6)))},
+			want: testJPEG(t, jpegSegment(0xe1, append([]byte("Exif\x00\x00"),
+				'M', 'M', 0x00, 0x2a, 0x00, 0x00, 0x00, 0x08,
+				0x00, 0x01,
+				0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, 0x06, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00,
+			))),
+			wantRemoved: true,
+		},
+		{
+			name: "should leave a PNG without metadata unchanged",
+			args: args{contentType: "image/png", data: plainPNG},
+			want: plainPNG,
+		},
+		{
+			name: "should remove eXIf and XMP chunks from a PNG and keep other text",
+			args: args{contentType: "image/png", data: testPNG(t,
+				pngChunk("eXIf", exifPayload(1)[6:]),
+				pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>")),
+				pngChunk("tEXt", []byte("Comment\x00hello")),
+			)},
+			want:        testPNG(t, pngChunk("tEXt", []byte("Comment\x00hello"))),
+			wantRemoved: true,
+		},
+		{
+			name:        "should clear the EXIF item data in a HEIF file",
+			args:        args{contentType: "image/heic", data: exifHEIF},
+			want:        strippedHEIF,
+			wantRemoved: true,
+		},
+		{
+			name: "should leave a HEIF file without metadata items unchanged",
+			args: args{contentType: "image/heic", data: imageHEIF},
+			want: imageHEIF,
+		},
+		{
+			name:    "should fail with a truncated HEIF file",
+			args:    args{contentType: "image/heic", data: exifHEIF[:len(exifHEIF)-4]},
+			want:    exifHEIF[:len(exifHEIF)-4],
+			wantErr: imagemeta.ErrMalformed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, removed, err := imagemeta.Strip(tt.args.contentType, tt.args.data)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Strip() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("Strip() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Strip() got:\n\t%q\nwant:\n\t%q", got, tt.want)
+			}
+			if err == nil && tt.args.contentType != "image/heic" {
+				if _, _, err := image.Decode(bytes.NewReader(got)); err != nil {
+					t.Errorf("Strip() result can't be decoded: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectHEIF(t *testing.T) {
+	heic, _ := testHEIF("Exif", nil)
+	tests := []struct {
+		name            string
+		data            []byte
+		wantContentType string
+		wantOK          bool
+	}{
+		{
+			name: "should not detect short data",
+			data: []byte("ftyp"),
+		},
+		{
+			name: "should not detect other ISO base media files",
+			data: isoBox("ftyp", []byte("isom\x00\x00\x00\x00")),
+		},
+		{
+			name:            "should detect a HEIC file",
+			data:            heic,
+			wantContentType: "image/heic",
+			wantOK:          true,
+		},
+		{
+			name:            "should detect an AVIF file",
+			data:            isoBox("ftyp", []byte("avif\x00\x00\x00\x00")),
+			wantContentType: "image/avif",
+			wantOK:          true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotContentType, gotOK := imagemeta.DetectHEIF(tt.data)
+			if gotContentType != tt.wantContentType || gotOK != tt.wantOK {
+				t.Errorf("DetectHEIF() = %q, %v, want %q, %v", gotContentType, gotOK, tt.wantContentType, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	jpegMarkerSOI   = 0xd8
+	jpegMarkerSOS   = 0xda
+	jpegMarkerAPP0  = 0xe0
+	jpegMarkerAPP1  = 0xe1
+	jpegMarkerAPP3  = 0xe3
+	jpegMarkerAPP13 = 0xed
+)
+
+var (
+	exifHeader         = []byte("Exif\x00\x00")
+	xmpHeader          = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtensionHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	photoshopHeader    = []byte("Photoshop 3.0\x00")
+)
+
+// stripJPEG drops EXIF, XMP and Photoshop (IPTC) segments. The EXIF orientation is kept in a minimal replacement EXIF
+// segment so that photos are still displayed the right way up.
+func stripJPEG(data []byte) ([]byte, bool, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != jpegMarkerSOI {
+		return data, false, ErrMalformed
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	var removed bool
+	var orientation uint16
+	insertAt := len(out)
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xff {
+			return data, false, ErrMalformed
+		}
+		if i+1 >= len(data) {
+			return data, false, ErrMalformed
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			// Fill byte
+			out = append(out, data[i])
+			i++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return data, false, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return data, false, ErrMalformed
+		}
+		if marker == jpegMarkerSOS {
+			if removed && orientation > 1 {
+				out = append(out[:insertAt], append(exifOrientationSegment(orientation), out[insertAt:]...)...)
+			}
+			// The rest is entropy-coded image data
+			out = append(out, data[i:]...)
+			return out, removed, nil
+		}
+		payload := data[i+4 : end]
+		if isJPEGMetadata(marker, payload) {
+			if marker == jpegMarkerAPP1 && bytes.HasPrefix(payload, exifHeader) {
+				if o := exifOrientation(payload[len(exifHeader):]); o != 0 {
+					orientation = o
+				}
+			}
+			removed = true
+		} else {
+			out = append(out, data[i:end]...)
+			if marker == jpegMarkerAPP0 && insertAt == 2 {
+				// Keep the JFIF segment first
+				insertAt = len(out)
+			}
+		}
+		i = end
+	}
+	return data, false, ErrMalformed
+}
+
+func isJPEGMetadata(marker byte, payload []byte) bool {
+	switch marker {
+	case jpegMarkerAPP1:
+		return bytes.HasPrefix(payload, exifHeader) || bytes.HasPrefix(payload, xmpHeader) || bytes.HasPrefix(payload, xmpExtensionHeader)
+	case jpegMarkerAPP3:
+		// Some cameras store a copy of the EXIF data in APP3 (Meta) segments.
+		return bytes.HasPrefix(payload, []byte("Meta\x00\x00")) || bytes.HasPrefix(payload, exifHeader)
+	case jpegMarkerAPP13:
+		return bytes.HasPrefix(payload, photoshopHeader)
+	}
+	return false
+}
+
+const tiffTagOrientation = 0x0112
+
+// exifOrientation reads the orientation tag from the first IFD of the TIFF structure in an EXIF segment, returning 0
+// if it isn't found.
+func exifOrientation(tiff []byte) uint16 {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset : offset+2]))
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) == tiffTagOrientation {
+			return order.Uint16(tiff[entry+8 : entry+10])
+		}
+	}
+	return 0
+}
+
+// exifOrientationSegment builds an APP1 EXIF segment that only contains the orientation tag.
+func exifOrientationSegment(orientation uint16) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2a, // Big-endian TIFF header
+		0x00, 0x00, 0x00, 0x08, // Offset to the first IFD
+		0x00, 0x01, // One entry
+		0x01, 0x12, 0x00, 0x03, // Orientation, SHORT
+		0x00, 0x00, 0x00, 0x01, // Count
+		byte(orientation >> 8), byte(orientation), 0x00, 0x00, // Value
+		0x00, 0x00, 0x00, 0x00, // No next IFD
+	}
+	payload := append(append([]byte{}, exifHeader...), tiff...)
+	segment := []byte{0xff, jpegMarkerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
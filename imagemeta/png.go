@@ -0,0 +1,54 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNG drops eXIf chunks and text chunks that hold XMP or raw EXIF profiles. Chunks are copied whole, so their
+// checksums stay valid.
+func stripPNG(data []byte) ([]byte, bool, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return data, false, ErrMalformed
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	var removed bool
+	i := len(pngSignature)
+	for i < len(data) {
+		if i+8 > len(data) {
+			return data, false, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		chunkType := string(data[i+4 : i+8])
+		end := i + 12 + length
+		if length < 0 || end > len(data) || end < i {
+			return data, false, ErrMalformed
+		}
+		if isPNGMetadata(chunkType, data[i+8:i+8+length]) {
+			removed = true
+		} else {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return out, removed, nil
+}
+
+func isPNGMetadata(chunkType string, chunkData []byte) bool {
+	switch chunkType {
+	case "eXIf":
+		return true
+	case "tEXt", "zTXt", "iTXt":
+		keyword, _, _ := bytes.Cut(chunkData, []byte{0})
+		k := string(keyword)
+		return k == "XML:com.adobe.xmp" || strings.HasPrefix(k, "Raw profile type")
+	}
+	return false
+}
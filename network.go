@@ -0,0 +1,47 @@
+package blinkfile
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+var ErrInvalidNetwork = fmt.Errorf("invalid IP address or CIDR range")
+
+// ParseNetworks parses IP addresses and CIDR ranges such as 192.0.2.1 or 10.0.0.0/8, an address is parsed as a range
+// that only contains that address. Blank entries are skipped.
+func ParseNetworks(in []string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("%w %q", ErrInvalidNetwork, s)
+			}
+			addr = addr.Unmap()
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", ErrInvalidNetwork, s)
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks, nil
+}
+
+// NetworksContain returns true if the IP address is in any of the networks.
+func NetworksContain(networks []netip.Prefix, ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package blinkfile_test
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+func TestParseNetworks(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []string
+		want    []netip.Prefix
+		wantErr error
+	}{
+		{
+			name: "should parse nothing",
+		},
+		{
+			name: "should parse addresses and ranges, skipping blank entries",
+			in:   []string{"192.0.2.1", " ", "10.1.2.3/8", "2001:db8::/32", "::ffff:198.51.100.1"},
+			want: []netip.Prefix{
+				netip.MustParsePrefix("192.0.2.1/32"),
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("2001:db8::/32"),
+				netip.MustParsePrefix("198.51.100.1/32"),
+			},
+		},
+		{
+			name:    "should fail for an invalid address",
+			in:      []string{"192.0.2.256"},
+			wantErr: blinkfile.ErrInvalidNetwork,
+		},
+		{
+			name:    "should fail for an invalid range",
+			in:      []string{"10.0.0.0/33"},
+			wantErr: blinkfile.ErrInvalidNetwork,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := blinkfile.ParseNetworks(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseNetworks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseNetworks() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileHeader_AllowsClient(t *testing.T) {
+	restricted := blinkfile.FileHeader{AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	tests := []struct {
+		name string
+		f    blinkfile.FileHeader
+		ip   netip.Addr
+		want bool
+	}{
+		{
+			name: "should allow any client without allowed networks",
+			ip:   netip.MustParseAddr("192.0.2.1"),
+			want: true,
+		},
+		{
+			name: "should allow an unknown client without allowed networks",
+			want: true,
+		},
+		{
+			name: "should allow a client in an allowed network",
+			f:    restricted,
+			ip:   netip.MustParseAddr("10.1.2.3"),
+			want: true,
+		},
+		{
+			name: "should allow a client with an IPv4-mapped address in an allowed network",
+			f:    restricted,
+			ip:   netip.MustParseAddr("::ffff:10.1.2.3"),
+			want: true,
+		},
+		{
+			name: "should not allow a client outside the allowed networks",
+			f:    restricted,
+			ip:   netip.MustParseAddr("192.0.2.1"),
+		},
+		{
+			name: "should not allow an unknown client",
+			f:    restricted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.AllowsClient(tt.ip); got != tt.want {
+				t.Errorf("AllowsClient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+// Package pow issues and verifies proof-of-work challenges. Challenges are signed with HMAC, so only the ones that have
+// been used need to be stored until they expire, and their difficulty rises as failures within a scope become more
+// frequent.
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	Config struct {
+		// Secret signs the challenges, a random secret is used if it's empty so challenges don't survive a restart.
+		Secret []byte
+		// Difficulty is how many leading zero bits the hash of a solution needs when there are few recent failures, each
+		// bit doubles the expected work.
+		Difficulty int
+		// MaxDifficulty caps the difficulty as failures rise.
+		MaxDifficulty int
+		// FailureThreshold is how many failures within the FailureWindow add a bit of difficulty, every time the failures
+		// double after that adds another bit.
+		FailureThreshold int
+		// FailureWindow is how far back failures are counted.
+		FailureWindow time.Duration
+		// TTL is how long a challenge can be solved for.
+		TTL time.Duration
+		Now func() time.Time
+	}
+
+	// Challenge is solved by finding a nonce where the SHA-256 hash of the token followed by the nonce starts with
+	// Difficulty zero bits.
+	Challenge struct {
+		Token      string
+		Difficulty int
+	}
+
+	Challenger struct {
+		cfg      Config
+		mu       sync.Mutex
+		failures map[string]*failureCounter
+		// spent holds when each used challenge expires, so it can't be used again before then.
+		spent map[string]time.Time
+	}
+
+	// failureCounter counts failures in buckets that together span the failure window.
+	failureCounter struct {
+		counts [failureBuckets]int
+		// bucket is the number of the latest bucket since the Unix epoch.
+		bucket int64
+	}
+)
+
+const (
+	DefaultDifficulty       = 16
+	DefaultMaxDifficulty    = 22
+	DefaultFailureThreshold = 10
+	DefaultFailureWindow    = 10 * time.Minute
+	DefaultTTL              = 5 * time.Minute
+
+	failureBuckets = 10
+	// maxNonceLength stops clients from making the server hash arbitrarily large nonces.
+	maxNonceLength = 64
+)
+
+var (
+	ErrInvalid  = fmt.Errorf("proof-of-work challenge is invalid")
+	ErrExpired  = fmt.Errorf("proof-of-work challenge has expired")
+	ErrUnsolved = fmt.Errorf("proof-of-work challenge is not solved")
+	ErrSpent    = fmt.Errorf("proof-of-work challenge was already used")
+)
+
+// New returns a challenger, using the defaults for any settings that aren't configured.
+func New(cfg Config) (*Challenger, error) {
+	if len(cfg.Secret) == 0 {
+		cfg.Secret = make([]byte, 32)
+		if _, err := rand.Read(cfg.Secret); err != nil {
+			return nil, fmt.Errorf("generating proof-of-work secret: %w", err)
+		}
+	}
+	if cfg.Difficulty <= 0 {
+		cfg.Difficulty = DefaultDifficulty
+	}
+	if cfg.MaxDifficulty <= 0 {
+		cfg.MaxDifficulty = max(DefaultMaxDifficulty, cfg.Difficulty)
+	}
+	if cfg.MaxDifficulty < cfg.Difficulty {
+		return nil, fmt.Errorf("proof-of-work max difficulty %d is less than the difficulty %d", cfg.MaxDifficulty, cfg.Difficulty)
+	}
+	if cfg.MaxDifficulty > sha256.Size*8 {
+		return nil, fmt.Errorf("proof-of-work max difficulty %d is more than %d bits", cfg.MaxDifficulty, sha256.Size*8)
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultFailureThreshold
+	}
+	if cfg.FailureWindow <= 0 {
+		cfg.FailureWindow = DefaultFailureWindow
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Challenger{cfg: cfg, failures: make(map[string]*failureCounter), spent: make(map[string]time.Time)}, nil
+}
+
+// Issue returns a new challenge for the scope, at its current difficulty. The challenge only verifies for the same scope
+// and binding, such as the client's IP address and the resource it wants.
+func (c *Challenger) Issue(scope, binding string) Challenge {
+	difficulty := c.Difficulty(scope)
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+	expires := c.cfg.Now().Add(c.cfg.TTL).Unix()
+	payload := fmt.Sprintf("%d.%d.%s", difficulty, expires, base64.RawURLEncoding.EncodeToString(random))
+	return Challenge{
+		Token:      payload + "." + c.sign(scope, binding, payload),
+		Difficulty: difficulty,
+	}
+}
+
+// Verify returns nil if the nonce solves the token, and the token was issued for the scope and binding and hasn't
+// expired or been used already. A solved challenge can only be used once.
+func (c *Challenger) Verify(scope, binding, token, nonce string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return ErrInvalid
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(c.sign(scope, binding, payload))) {
+		return ErrInvalid
+	}
+	difficulty, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return ErrInvalid
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ErrInvalid
+	}
+	now := c.cfg.Now()
+	if !now.Before(time.Unix(expires, 0)) {
+		return ErrExpired
+	}
+	if nonce == "" || len(nonce) > maxNonceLength || !Solves(token, nonce, difficulty) {
+		return ErrUnsolved
+	}
+	return c.spend(payload, time.Unix(expires, 0), now)
+}
+
+// spend records the challenge as used until it expires, and returns ErrSpent if it already was. Expired challenges are
+// dropped, since they fail verification anyway.
+func (c *Challenger) spend(payload string, expires, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for spent, spentExpires := range c.spent {
+		if !now.Before(spentExpires) {
+			delete(c.spent, spent)
+		}
+	}
+	if _, ok := c.spent[payload]; ok {
+		return ErrSpent
+	}
+	c.spent[payload] = expires
+	return nil
+}
+
+func (c *Challenger) sign(scope, binding, payload string) string {
+	mac := hmac.New(sha256.New, c.cfg.Secret)
+	mac.Write([]byte(fmt.Sprintf("%q %q %s", scope, binding, payload)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Solves returns true if the hash of the token followed by the nonce starts with at least difficulty zero bits.
+func Solves(token, nonce string, difficulty int) bool {
+	sum := sha256.Sum256([]byte(token + nonce))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros >= difficulty
+}
+
+// Solve finds a nonce for the challenge by brute force, for clients that aren't browsers.
+func Solve(challenge Challenge) string {
+	for i := uint64(0); ; i++ {
+		nonce := strconv.FormatUint(i, 10)
+		if Solves(challenge.Token, nonce, challenge.Difficulty) {
+			return nonce
+		}
+	}
+}
+
+// RecordFailure counts a failure in the scope, such as a wrong password, towards raising its difficulty.
+func (c *Challenger) RecordFailure(scope string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counter, ok := c.failures[scope]
+	if !ok {
+		counter = &failureCounter{}
+		c.failures[scope] = counter
+	}
+	bucket := c.bucket()
+	counter.advance(bucket)
+	counter.counts[bucket%failureBuckets]++
+}
+
+// Difficulty returns the current difficulty of the scope, adding a bit for every doubling of its recent failures past the
+// failure threshold.
+func (c *Challenger) Difficulty(scope string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counter, ok := c.failures[scope]
+	if !ok {
+		return c.cfg.Difficulty
+	}
+	counter.advance(c.bucket())
+	total := 0
+	for _, count := range counter.counts {
+		total += count
+	}
+	if total == 0 {
+		delete(c.failures, scope)
+		return c.cfg.Difficulty
+	}
+	extra := 0
+	for failures := total / c.cfg.FailureThreshold; failures > 0; failures >>= 1 {
+		extra++
+	}
+	return min(c.cfg.Difficulty+extra, c.cfg.MaxDifficulty)
+}
+
+func (c *Challenger) bucket() int64 {
+	bucketSize := c.cfg.FailureWindow / failureBuckets
+	return c.cfg.Now().UnixNano() / int64(bucketSize)
+}
+
+// advance clears the buckets that have fallen out of the window since the latest bucket.
+func (f *failureCounter) advance(bucket int64) {
+	if bucket <= f.bucket {
+		return
+	}
+	for b := f.bucket + 1; b <= bucket && b <= f.bucket+failureBuckets; b++ {
+		f.counts[b%failureBuckets] = 0
+	}
+	f.bucket = bucket
+}
@@ -0,0 +1,225 @@
+package pow_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile/pow"
+)
+
+func newChallenger(t *testing.T, now *time.Time) *pow.Challenger {
+	c, err := pow.New(pow.Config{
+		Secret:           []byte("secret"),
+		Difficulty:       4,
+		MaxDifficulty:    6,
+		FailureThreshold: 2,
+		FailureWindow:    10 * time.Minute,
+		TTL:              time.Minute,
+		Now:              func() time.Time { return *now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestChallenger_Verify(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newChallenger(t, &now)
+	challenge := c.Issue("login", "127.0.0.1")
+	nonce := pow.Solve(challenge)
+	unsolved := "x"
+	for pow.Solves(challenge.Token, unsolved, challenge.Difficulty) {
+		unsolved += "x"
+	}
+	tests := []struct {
+		name    string
+		scope   string
+		binding string
+		token   string
+		nonce   string
+		after   time.Duration
+		wantErr error
+	}{
+		{
+			name:    "should verify a solved challenge",
+			scope:   "login",
+			binding: "127.0.0.1",
+			token:   challenge.Token,
+			nonce:   nonce,
+		},
+		{
+			name:    "should fail if the nonce doesn't solve the challenge",
+			scope:   "login",
+			binding: "127.0.0.1",
+			token:   challenge.Token,
+			nonce:   unsolved,
+			wantErr: pow.ErrUnsolved,
+		},
+		{
+			name:    "should fail without a nonce",
+			scope:   "login",
+			binding: "127.0.0.1",
+			token:   challenge.Token,
+			wantErr: pow.ErrUnsolved,
+		},
+		{
+			name:    "should fail for another scope",
+			scope:   "file",
+			binding: "127.0.0.1",
+			token:   challenge.Token,
+			nonce:   nonce,
+			wantErr: pow.ErrInvalid,
+		},
+		{
+			name:    "should fail for another binding",
+			scope:   "login",
+			binding: "127.0.0.2",
+			token:   challenge.Token,
+			nonce:   nonce,
+			wantErr: pow.ErrInvalid,
+		},
+		{
+			name:    "should fail if the difficulty was lowered",
+			scope:   "login",
+			binding: "127.0.0.1",
+			token:   "1" + strings.TrimPrefix(challenge.Token, "4"),
+			nonce:   nonce,
+			wantErr: pow.ErrInvalid,
+		},
+		{
+			name:    "should fail for a malformed token",
+			scope:   "login",
+			binding: "127.0.0.1",
+			token:   "token",
+			nonce:   nonce,
+			wantErr: pow.ErrInvalid,
+		},
+		{
+			name:    "should fail once the challenge expires",
+			scope:   "login",
+			binding: "127.0.0.1",
+			token:   challenge.Token,
+			nonce:   nonce,
+			after:   time.Minute,
+			wantErr: pow.ErrExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = time.Unix(1000, 0).Add(tt.after)
+			err := c.Verify(tt.scope, tt.binding, tt.token, tt.nonce)
+			if err != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChallenger_Verify_Replay(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newChallenger(t, &now)
+	challenge := c.Issue("login", "127.0.0.1")
+	nonce := pow.Solve(challenge)
+	otherNonce := ""
+	for i := 0; otherNonce == ""; i++ {
+		if n := strconv.Itoa(i); n != nonce && pow.Solves(challenge.Token, n, challenge.Difficulty) {
+			otherNonce = n
+		}
+	}
+	if err := c.Verify("login", "127.0.0.1", challenge.Token, nonce); err != nil {
+		t.Fatalf("Verify() error = %v, want nil", err)
+	}
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr error
+	}{
+		{
+			name:    "should fail if the challenge was already used",
+			token:   challenge.Token,
+			nonce:   nonce,
+			wantErr: pow.ErrSpent,
+		},
+		{
+			name:    "should fail if the challenge was already used with another nonce",
+			token:   challenge.Token,
+			nonce:   otherNonce,
+			wantErr: pow.ErrSpent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.Verify("login", "127.0.0.1", tt.token, tt.nonce)
+			if err != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	t.Run("should verify another challenge", func(t *testing.T) {
+		other := c.Issue("login", "127.0.0.1")
+		if err := c.Verify("login", "127.0.0.1", other.Token, pow.Solve(other)); err != nil {
+			t.Errorf("Verify() error = %v, want nil", err)
+		}
+	})
+}
+
+func TestChallenger_Difficulty(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		after    time.Duration
+		want     int
+	}{
+		{
+			name: "should use the base difficulty without failures",
+			want: 4,
+		},
+		{
+			name:     "should use the base difficulty below the failure threshold",
+			failures: 1,
+			want:     4,
+		},
+		{
+			name:     "should add a bit at the failure threshold",
+			failures: 2,
+			want:     5,
+		},
+		{
+			name:     "should add a bit when the failures double",
+			failures: 4,
+			want:     6,
+		},
+		{
+			name:     "should not go past the max difficulty",
+			failures: 100,
+			want:     6,
+		},
+		{
+			name:     "should forget failures outside the window",
+			failures: 100,
+			after:    10 * time.Minute,
+			want:     4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1000, 0)
+			c := newChallenger(t, &now)
+			for range tt.failures {
+				c.RecordFailure("login")
+			}
+			c.RecordFailure("file")
+			now = now.Add(tt.after)
+			if got := c.Difficulty("login"); got != tt.want {
+				t.Errorf("Difficulty() = %d, want %d", got, tt.want)
+			}
+			if got := c.Issue("login", "").Difficulty; got != tt.want {
+				t.Errorf("Issue() difficulty = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
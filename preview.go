@@ -0,0 +1,52 @@
+package blinkfile
+
+import (
+	"mime"
+	"strings"
+)
+
+type PreviewKind string
+
+const (
+	PreviewNone  PreviewKind = ""
+	PreviewImage PreviewKind = "image"
+	PreviewText  PreviewKind = "text"
+	PreviewPDF   PreviewKind = "pdf"
+	PreviewAudio PreviewKind = "audio"
+	PreviewVideo PreviewKind = "video"
+)
+
+// Only raster image formats are allowed, SVG and other markup-based types can carry scripts.
+var previewKinds = map[string]PreviewKind{
+	"image/png":          PreviewImage,
+	"image/jpeg":         PreviewImage,
+	"image/gif":          PreviewImage,
+	"image/webp":         PreviewImage,
+	"image/bmp":          PreviewImage,
+	"text/plain":         PreviewText,
+	"application/pdf":    PreviewPDF,
+	"audio/mpeg":         PreviewAudio,
+	"audio/wave":         PreviewAudio,
+	"audio/wav":          PreviewAudio,
+	"audio/ogg":          PreviewAudio,
+	"audio/aac":          PreviewAudio,
+	"audio/flac":         PreviewAudio,
+	"audio/mp4":          PreviewAudio,
+	"application/ogg":    PreviewAudio,
+	"video/mp4":          PreviewVideo,
+	"video/webm":         PreviewVideo,
+	"video/ogg":          PreviewVideo,
+	"video/quicktime":    PreviewVideo,
+	"application/json":   PreviewText,
+	"text/x-shellscript": PreviewText,
+}
+
+// PreviewKindOf returns how a file with the given content type can be previewed, or PreviewNone if it isn't safe to
+// display inline.
+func PreviewKindOf(contentType string) PreviewKind {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return PreviewNone
+	}
+	return previewKinds[strings.ToLower(mediaType)]
+}
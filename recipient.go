@@ -0,0 +1,52 @@
+package blinkfile
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+var (
+	ErrInvalidEmail         = fmt.Errorf("invalid email address")
+	ErrRecipientNotVerified = fmt.Errorf("recipient email address has not been verified")
+)
+
+// ParseEmails parses plain email addresses such as alice@example.com, normalized to lowercase. Blank entries and
+// duplicates are skipped.
+func ParseEmails(in []string) ([]string, error) {
+	var emails []string
+	seen := make(map[string]bool, len(in))
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		address, err := mail.ParseAddress(s)
+		if err != nil || address.Name != "" || address.Address != s {
+			return nil, fmt.Errorf("%w %q", ErrInvalidEmail, s)
+		}
+		email := strings.ToLower(address.Address)
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// RequiresRecipient returns true if only verified recipients can download the file.
+func (f *FileHeader) RequiresRecipient() bool {
+	return len(f.RecipientEmails) > 0
+}
+
+// HasRecipient returns true if the email address, in any case, is one of the file's recipients.
+func (f *FileHeader) HasRecipient(email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	for _, recipient := range f.RecipientEmails {
+		if recipient == email {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package blinkfile_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+func TestParseEmails(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []string
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "should parse nothing",
+		},
+		{
+			name: "should parse addresses in lowercase, skipping blank entries and duplicates",
+			in:   []string{"Alice@Example.com", " ", " bob@example.com ", "alice@example.com"},
+			want: []string{"alice@example.com", "bob@example.com"},
+		},
+		{
+			name:    "should fail for an invalid address",
+			in:      []string{"alice"},
+			wantErr: blinkfile.ErrInvalidEmail,
+		},
+		{
+			name:    "should fail for an address with a name",
+			in:      []string{"Alice <alice@example.com>"},
+			wantErr: blinkfile.ErrInvalidEmail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := blinkfile.ParseEmails(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseEmails() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEmails() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileHeader_HasRecipient(t *testing.T) {
+	f := blinkfile.FileHeader{RecipientEmails: []string{"alice@example.com"}}
+	tests := []struct {
+		name  string
+		email string
+		want  bool
+	}{
+		{
+			name:  "should match a recipient in any case",
+			email: "Alice@Example.com",
+			want:  true,
+		},
+		{
+			name:  "should not match another address",
+			email: "bob@example.com",
+		},
+		{
+			name: "should not match a blank address",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.HasRecipient(tt.email); got != tt.want {
+				t.Errorf("HasRecipient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
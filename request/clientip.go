@@ -0,0 +1,47 @@
+package request
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+func CtxWithClientIP(ctx context.Context, ip netip.Addr) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// GetClientIP returns the IP address of the client that sent the request, or an invalid address if it's unknown.
+func GetClientIP(ctx context.Context) netip.Addr {
+	ip, _ := ctx.Value(clientIPKey{}).(netip.Addr)
+	return ip
+}
+
+// ClientIP returns the IP address of the client that sent a request from remoteAddr. If remoteAddr is a trusted proxy,
+// the X-Forwarded-For header values are followed back from the last one until an address that isn't a trusted proxy.
+func ClientIP(remoteAddr string, forwardedFor []string, trustedProxies []netip.Prefix) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	ip := addrPort.Addr().Unmap()
+	hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+	for i := len(hops) - 1; i >= 0 && isTrusted(trustedProxies, ip); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+	}
+	return ip
+}
+
+func isTrusted(trustedProxies []netip.Prefix, ip netip.Addr) bool {
+	for _, proxy := range trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
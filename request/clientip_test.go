@@ -0,0 +1,68 @@
+package request_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/benjohns1/blinkfile/request"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{
+			name:       "should return an invalid address if the remote address can't be parsed",
+			remoteAddr: "unknown",
+		},
+		{
+			name:       "should use the remote address without a trusted proxy",
+			remoteAddr: "192.0.2.1:1234",
+			want:       "192.0.2.1",
+		},
+		{
+			name:         "should ignore forwarded addresses from a client that isn't a trusted proxy",
+			remoteAddr:   "192.0.2.1:1234",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "192.0.2.1",
+		},
+		{
+			name:         "should use the forwarded address from a trusted proxy",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "should skip trusted proxies in the forwarded addresses",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"203.0.113.1, 198.51.100.1", "10.0.0.2"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "should stop at a forwarded address that can't be parsed",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"198.51.100.1, unknown, 10.0.0.2"},
+			want:         "10.0.0.2",
+		},
+		{
+			name:       "should unmap IPv4 addresses",
+			remoteAddr: "[::ffff:192.0.2.1]:1234",
+			want:       "192.0.2.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want netip.Addr
+			if tt.want != "" {
+				want = netip.MustParseAddr(tt.want)
+			}
+			if got := request.ClientIP(tt.remoteAddr, tt.forwardedFor, trusted); got != want {
+				t.Errorf("ClientIP() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package request
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// Scheme returns the scheme a client used to send a request from remoteAddr, "https" if it was sent with TLS. If
+// remoteAddr is a trusted proxy, its X-Forwarded-Proto header value is used instead.
+func Scheme(remoteAddr string, tls bool, forwardedProto string, trustedProxies []netip.Prefix) string {
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil || !isTrusted(trustedProxies, addrPort.Addr().Unmap()) {
+		return scheme
+	}
+	switch proto := strings.ToLower(strings.TrimSpace(forwardedProto)); proto {
+	case "http", "https":
+		return proto
+	}
+	return scheme
+}
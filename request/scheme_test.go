@@ -0,0 +1,57 @@
+package request_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/benjohns1/blinkfile/request"
+)
+
+func TestScheme(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		tls            bool
+		forwardedProto string
+		want           string
+	}{
+		{
+			name:       "should use http without TLS",
+			remoteAddr: "192.0.2.1:1234",
+			want:       "http",
+		},
+		{
+			name:       "should use https with TLS",
+			remoteAddr: "192.0.2.1:1234",
+			tls:        true,
+			want:       "https",
+		},
+		{
+			name:           "should ignore the forwarded scheme from a client that isn't a trusted proxy",
+			remoteAddr:     "192.0.2.1:1234",
+			forwardedProto: "https",
+			want:           "http",
+		},
+		{
+			name:           "should use the forwarded scheme from a trusted proxy",
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedProto: "HTTPS",
+			want:           "https",
+		},
+		{
+			name:           "should ignore an unknown forwarded scheme",
+			remoteAddr:     "10.0.0.1:1234",
+			tls:            true,
+			forwardedProto: "ftp",
+			want:           "https",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := request.Scheme(tt.remoteAddr, tt.tls, tt.forwardedProto, trusted); got != tt.want {
+				t.Errorf("Scheme() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package request
+
+import "context"
+
+type userAgentKey struct{}
+
+func CtxWithUserAgent(ctx context.Context, userAgent string) context.Context {
+	return context.WithValue(ctx, userAgentKey{}, userAgent)
+}
+
+// GetUserAgent returns the User-Agent header of the request, or an empty string if it's unknown.
+func GetUserAgent(ctx context.Context) string {
+	userAgent, _ := ctx.Value(userAgentKey{}).(string)
+	return userAgent
+}
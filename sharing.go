@@ -0,0 +1,108 @@
+package blinkfile
+
+import (
+	"fmt"
+	"time"
+)
+
+type (
+	// SharingPolicy sets defaults and limits for how long and how widely files can be shared. Zero values don't
+	// restrict anything.
+	SharingPolicy struct {
+		DefaultExpiration    time.Duration `json:",omitempty"`
+		MaxExpiration        time.Duration `json:",omitempty"`
+		DefaultDownloadLimit int64         `json:",omitempty"`
+		MaxDownloadLimit     int64         `json:",omitempty"`
+		RequirePassword      bool          `json:",omitempty"`
+		// DefaultTerms are the terms recipients must accept before downloading files that don't have their own.
+		DefaultTerms string `json:",omitempty"`
+	}
+)
+
+var (
+	ErrInvalidSharingPolicy = fmt.Errorf("invalid sharing policy")
+
+	ErrSharingPasswordRequired     = fmt.Errorf("sharing policy requires a password")
+	ErrSharingExpirationTooLong    = fmt.Errorf("sharing policy limits the expiration")
+	ErrSharingDownloadLimitTooHigh = fmt.Errorf("sharing policy limits the downloads")
+)
+
+// Validate checks that the limits aren't negative and the defaults are within them.
+func (p SharingPolicy) Validate() error {
+	if p.DefaultExpiration < 0 || p.MaxExpiration < 0 {
+		return fmt.Errorf("%w: expiration cannot be negative", ErrInvalidSharingPolicy)
+	}
+	if p.DefaultDownloadLimit < 0 || p.MaxDownloadLimit < 0 {
+		return fmt.Errorf("%w: download limit cannot be negative", ErrInvalidSharingPolicy)
+	}
+	if p.MaxExpiration > 0 && p.DefaultExpiration > p.MaxExpiration {
+		return fmt.Errorf("%w: default expiration is longer than the maximum", ErrInvalidSharingPolicy)
+	}
+	if p.MaxDownloadLimit > 0 && p.DefaultDownloadLimit > p.MaxDownloadLimit {
+		return fmt.Errorf("%w: default download limit is higher than the maximum", ErrInvalidSharingPolicy)
+	}
+	return nil
+}
+
+// IsEmpty returns true if the policy doesn't set any defaults or limits.
+func (p SharingPolicy) IsEmpty() bool {
+	return p == SharingPolicy{}
+}
+
+// Apply sets the default expiration, download limit and terms on a file that doesn't have its own, then checks the file
+// against the limits. A file without an expiration or download limit gets the maximum if there is no default.
+// Expiration is counted from when the file is shared, see FileHeader.SharedFrom.
+func (p SharingPolicy) Apply(file *FileHeader) error {
+	start := file.SharedFrom()
+	if file.Expires.IsZero() {
+		if p.DefaultExpiration > 0 {
+			file.Expires = start.Add(p.DefaultExpiration)
+		} else if p.MaxExpiration > 0 {
+			file.Expires = start.Add(p.MaxExpiration)
+		}
+	}
+	if file.Terms == "" {
+		file.Terms = p.DefaultTerms
+	}
+	if file.DownloadLimit == 0 {
+		if p.DefaultDownloadLimit > 0 {
+			file.DownloadLimit = p.DefaultDownloadLimit
+		} else if p.MaxDownloadLimit > 0 {
+			file.DownloadLimit = p.MaxDownloadLimit
+		}
+	}
+	return p.Check(*file)
+}
+
+// Update restores the default terms on a file whose settings were changed, then checks it against the limits with the
+// expiration counted from now, since files can be changed long after they were shared. The other defaults are only set
+// on new files. A file that was already outside the limits, because the policy was tightened after it was shared, isn't
+// rejected, so its owner can still change its settings and unlock it.
+func (p SharingPolicy) Update(before FileHeader, file *FileHeader, now time.Time) error {
+	if file.Terms == "" {
+		file.Terms = p.DefaultTerms
+	}
+	if p.check(before, now) != nil {
+		return nil
+	}
+	return p.check(*file, now)
+}
+
+// Check returns an error if the file's settings are outside the policy limits.
+func (p SharingPolicy) Check(file FileHeader) error {
+	return p.check(file, file.SharedFrom())
+}
+
+// check counts the maximum expiration from start.
+func (p SharingPolicy) check(file FileHeader, start time.Time) error {
+	if p.RequirePassword && file.PasswordHash == "" {
+		return ErrSharingPasswordRequired
+	}
+	if p.MaxExpiration > 0 && (file.Expires.IsZero() || file.Expires.After(start.Add(p.MaxExpiration))) {
+		return ErrSharingExpirationTooLong
+	}
+	if p.MaxDownloadLimit > 0 && (file.DownloadLimit == 0 || file.DownloadLimit > p.MaxDownloadLimit) {
+		return ErrSharingDownloadLimitTooHigh
+	}
+	return nil
+}
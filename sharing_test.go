@@ -0,0 +1,199 @@
+package blinkfile_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+func TestSharingPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       blinkfile.SharingPolicy
+		wantErr error
+	}{
+		{
+			name: "should allow an empty policy",
+		},
+		{
+			name:    "should fail with a negative expiration",
+			p:       blinkfile.SharingPolicy{MaxExpiration: -time.Hour},
+			wantErr: fmt.Errorf("%w: expiration cannot be negative", blinkfile.ErrInvalidSharingPolicy),
+		},
+		{
+			name:    "should fail with a negative download limit",
+			p:       blinkfile.SharingPolicy{DefaultDownloadLimit: -1},
+			wantErr: fmt.Errorf("%w: download limit cannot be negative", blinkfile.ErrInvalidSharingPolicy),
+		},
+		{
+			name:    "should fail if the default expiration is longer than the maximum",
+			p:       blinkfile.SharingPolicy{DefaultExpiration: 2 * time.Hour, MaxExpiration: time.Hour},
+			wantErr: fmt.Errorf("%w: default expiration is longer than the maximum", blinkfile.ErrInvalidSharingPolicy),
+		},
+		{
+			name:    "should fail if the default download limit is higher than the maximum",
+			p:       blinkfile.SharingPolicy{DefaultDownloadLimit: 2, MaxDownloadLimit: 1},
+			wantErr: fmt.Errorf("%w: default download limit is higher than the maximum", blinkfile.ErrInvalidSharingPolicy),
+		},
+		{
+			name: "should allow a default without a maximum",
+			p:    blinkfile.SharingPolicy{DefaultExpiration: 2 * time.Hour, DefaultDownloadLimit: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Validate()
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSharingPolicy_Apply(t *testing.T) {
+	created := time.Unix(100, 0).UTC()
+	tests := []struct {
+		name    string
+		p       blinkfile.SharingPolicy
+		file    blinkfile.FileHeader
+		want    blinkfile.FileHeader
+		wantErr error
+	}{
+		{
+			name: "should not change a file with an empty policy",
+			file: blinkfile.FileHeader{Created: created},
+			want: blinkfile.FileHeader{Created: created},
+		},
+		{
+			name: "should set the defaults on a file without an expiration or download limit",
+			p:    blinkfile.SharingPolicy{DefaultExpiration: time.Hour, MaxExpiration: 2 * time.Hour, DefaultDownloadLimit: 1, MaxDownloadLimit: 2},
+			file: blinkfile.FileHeader{Created: created},
+			want: blinkfile.FileHeader{Created: created, Expires: created.Add(time.Hour), DownloadLimit: 1},
+		},
+		{
+			name: "should set the maximums on a file without an expiration or download limit if there are no defaults",
+			p:    blinkfile.SharingPolicy{MaxExpiration: 2 * time.Hour, MaxDownloadLimit: 2},
+			file: blinkfile.FileHeader{Created: created},
+			want: blinkfile.FileHeader{Created: created, Expires: created.Add(2 * time.Hour), DownloadLimit: 2},
+		},
+		{
+			name: "should count the expiration from when the file becomes available",
+			p:    blinkfile.SharingPolicy{DefaultExpiration: time.Hour},
+			file: blinkfile.FileHeader{Created: created, AvailableFrom: created.Add(time.Hour)},
+			want: blinkfile.FileHeader{Created: created, AvailableFrom: created.Add(time.Hour), Expires: created.Add(2 * time.Hour)},
+		},
+		{
+			name: "should keep the file's own settings within the maximums",
+			p:    blinkfile.SharingPolicy{DefaultExpiration: time.Hour, MaxExpiration: 2 * time.Hour, DefaultDownloadLimit: 1, MaxDownloadLimit: 2},
+			file: blinkfile.FileHeader{Created: created, Expires: created.Add(2 * time.Hour), DownloadLimit: 2},
+			want: blinkfile.FileHeader{Created: created, Expires: created.Add(2 * time.Hour), DownloadLimit: 2},
+		},
+		{
+			name:    "should fail if the expiration is later than the maximum",
+			p:       blinkfile.SharingPolicy{MaxExpiration: 2 * time.Hour},
+			file:    blinkfile.FileHeader{Created: created, Expires: created.Add(3 * time.Hour)},
+			want:    blinkfile.FileHeader{Created: created, Expires: created.Add(3 * time.Hour)},
+			wantErr: blinkfile.ErrSharingExpirationTooLong,
+		},
+		{
+			name:    "should fail if the download limit is higher than the maximum",
+			p:       blinkfile.SharingPolicy{MaxDownloadLimit: 2},
+			file:    blinkfile.FileHeader{Created: created, DownloadLimit: 3},
+			want:    blinkfile.FileHeader{Created: created, DownloadLimit: 3},
+			wantErr: blinkfile.ErrSharingDownloadLimitTooHigh,
+		},
+		{
+			name:    "should fail if a password is required and the file has none",
+			p:       blinkfile.SharingPolicy{RequirePassword: true},
+			file:    blinkfile.FileHeader{Created: created},
+			want:    blinkfile.FileHeader{Created: created},
+			wantErr: blinkfile.ErrSharingPasswordRequired,
+		},
+		{
+			name: "should allow a password-protected file if a password is required",
+			p:    blinkfile.SharingPolicy{RequirePassword: true},
+			file: blinkfile.FileHeader{Created: created, PasswordHash: "password-hash"},
+			want: blinkfile.FileHeader{Created: created, PasswordHash: "password-hash"},
+		},
+		{
+			name: "should set the default terms on a file without its own",
+			p:    blinkfile.SharingPolicy{DefaultTerms: "Do not share"},
+			file: blinkfile.FileHeader{Created: created},
+			want: blinkfile.FileHeader{Created: created, Terms: "Do not share"},
+		},
+		{
+			name: "should keep the file's own terms",
+			p:    blinkfile.SharingPolicy{DefaultTerms: "Do not share"},
+			file: blinkfile.FileHeader{Created: created, Terms: "Internal use only"},
+			want: blinkfile.FileHeader{Created: created, Terms: "Internal use only"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Apply(&tt.file)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(tt.file, tt.want) {
+				t.Errorf("Apply() changed file to %+v, want %+v", tt.file, tt.want)
+			}
+		})
+	}
+}
+
+func TestSharingPolicy_Update(t *testing.T) {
+	created := time.Unix(100, 0).UTC()
+	now := created.Add(90 * 24 * time.Hour)
+	tests := []struct {
+		name    string
+		p       blinkfile.SharingPolicy
+		before  blinkfile.FileHeader
+		file    blinkfile.FileHeader
+		want    blinkfile.FileHeader
+		wantErr error
+	}{
+		{
+			name:   "should restore the default terms without setting the other defaults",
+			p:      blinkfile.SharingPolicy{DefaultExpiration: time.Hour, DefaultDownloadLimit: 1, DefaultTerms: "Do not share"},
+			before: blinkfile.FileHeader{Created: created, Terms: "Do not share"},
+			file:   blinkfile.FileHeader{Created: created},
+			want:   blinkfile.FileHeader{Created: created, Terms: "Do not share"},
+		},
+		{
+			name:   "should count the maximum expiration from now",
+			p:      blinkfile.SharingPolicy{MaxExpiration: 2 * time.Hour},
+			before: blinkfile.FileHeader{Created: created, Expires: now.Add(time.Hour)},
+			file:   blinkfile.FileHeader{Created: created, Expires: now.Add(time.Hour)},
+			want:   blinkfile.FileHeader{Created: created, Expires: now.Add(time.Hour)},
+		},
+		{
+			name:    "should fail if the update takes the file outside the limits",
+			p:       blinkfile.SharingPolicy{RequirePassword: true},
+			before:  blinkfile.FileHeader{Created: created, PasswordHash: "password-hash"},
+			file:    blinkfile.FileHeader{Created: created},
+			want:    blinkfile.FileHeader{Created: created},
+			wantErr: blinkfile.ErrSharingPasswordRequired,
+		},
+		{
+			name:   "should allow updating a file that was already outside the limits",
+			p:      blinkfile.SharingPolicy{RequirePassword: true, MaxDownloadLimit: 2},
+			before: blinkfile.FileHeader{Created: created, DownloadLimit: 3},
+			file:   blinkfile.FileHeader{Created: created, DownloadLimit: 3, Terms: "Internal use only"},
+			want:   blinkfile.FileHeader{Created: created, DownloadLimit: 3, Terms: "Internal use only"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Update(tt.before, &tt.file, now)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(tt.file, tt.want) {
+				t.Errorf("Update() file = %+v, want %+v", tt.file, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package signedurl_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile/signedurl"
+)
+
+func TestSigner_Verify(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s, err := signedurl.New(signedurl.Config{
+		Secret: []byte("secret"),
+		Now:    func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := s.Sign("file1", "download", now.Add(time.Hour))
+	with := func(param, value string) url.Values {
+		query := url.Values{}
+		for k, v := range signed {
+			query[k] = v
+		}
+		query.Set(param, value)
+		return query
+	}
+	tests := []struct {
+		name     string
+		resource string
+		scope    string
+		query    url.Values
+		after    time.Duration
+		wantErr  error
+	}{
+		{
+			name:     "should verify a signed URL",
+			resource: "file1",
+			scope:    "download",
+			query:    signed,
+		},
+		{
+			name:     "should ignore other query parameters",
+			resource: "file1",
+			scope:    "download",
+			query:    with("other", "value"),
+		},
+		{
+			name:     "should fail for another resource",
+			resource: "file2",
+			scope:    "download",
+			query:    signed,
+			wantErr:  signedurl.ErrInvalid,
+		},
+		{
+			name:     "should fail for another scope",
+			resource: "file1",
+			scope:    "preview",
+			query:    signed,
+			wantErr:  signedurl.ErrInvalid,
+		},
+		{
+			name:     "should fail if the scope was changed",
+			resource: "file1",
+			scope:    "preview",
+			query:    with(signedurl.ScopeParam, "preview"),
+			wantErr:  signedurl.ErrInvalid,
+		},
+		{
+			name:     "should fail if the expiry was extended",
+			resource: "file1",
+			scope:    "download",
+			query:    with(signedurl.ExpiresParam, "999999"),
+			wantErr:  signedurl.ErrInvalid,
+		},
+		{
+			name:     "should fail without a signature",
+			resource: "file1",
+			scope:    "download",
+			query:    with(signedurl.SignatureParam, ""),
+			wantErr:  signedurl.ErrInvalid,
+		},
+		{
+			name:     "should fail for a malformed expiry",
+			resource: "file1",
+			scope:    "download",
+			query:    with(signedurl.ExpiresParam, "soon"),
+			wantErr:  signedurl.ErrInvalid,
+		},
+		{
+			name:     "should fail once the URL expires",
+			resource: "file1",
+			scope:    "download",
+			query:    signed,
+			after:    time.Hour,
+			wantErr:  signedurl.ErrExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = time.Unix(1000, 0).Add(tt.after)
+			err := s.Verify(tt.resource, tt.scope, tt.query)
+			if err != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSigner_Verify_OtherSecret(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	s1, err := signedurl.New(signedurl.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := signedurl.New(signedurl.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s2.Verify("file1", "download", s1.Sign("file1", "download", expires))
+	if err != signedurl.ErrInvalid {
+		t.Errorf("Verify() error = %v, wantErr %v", err, signedurl.ErrInvalid)
+	}
+}
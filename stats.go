@@ -0,0 +1,146 @@
+package blinkfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"time"
+)
+
+type (
+	// DownloadEvent is a download of a file once its data has been sent, as it's added to the download stats.
+	DownloadEvent struct {
+		Time time.Time
+		// Downloader identifies the client without recording who they are, see DownloaderID.
+		Downloader string
+		IP         netip.Addr
+		BytesSent  int64
+		// Completed is set if all the file data was sent, otherwise the client aborted the download.
+		Completed bool
+	}
+
+	// DownloadStats are rollups of a file's downloads. They only keep one entry per day, downloader and network, so they
+	// stay small however many times the file is downloaded.
+	DownloadStats struct {
+		Completed int64 `json:",omitempty"`
+		Aborted   int64 `json:",omitempty"`
+		BytesSent int64 `json:",omitempty"`
+		// Days counts the downloads per UTC day, keyed by date such as 2006-01-02.
+		Days map[string]DayStats `json:",omitempty"`
+		// Downloaders counts the downloads by each distinct downloader.
+		Downloaders map[string]int64 `json:",omitempty"`
+		// Networks counts the downloads from each client network, see NetworkOf.
+		Networks map[string]int64 `json:",omitempty"`
+	}
+
+	DayStats struct {
+		Completed int64 `json:",omitempty"`
+		Aborted   int64 `json:",omitempty"`
+	}
+)
+
+const (
+	// StatsDateLayout formats the days in DownloadStats.Days.
+	StatsDateLayout = time.DateOnly
+	// StatsOther counts the downloads by downloaders or from networks once there are too many to keep track of.
+	StatsOther = "other"
+	// maxStatsKeys caps the distinct downloaders and networks kept in the stats.
+	maxStatsKeys = 10000
+)
+
+// DownloaderID identifies a downloader by a short hash, of their user ID if they're logged in or else of their IP
+// address and user agent.
+func DownloaderID(userID UserID, ip netip.Addr, userAgent string) string {
+	key := "user\x00" + string(userID)
+	if userID == "" {
+		key = "client\x00" + ip.Unmap().String() + "\x00" + userAgent
+	}
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:8])
+}
+
+// NetworkOf returns the network an IP address is in, without needing a geolocation database: the /24 range of an IPv4
+// address or the /48 range of an IPv6 address, or a name for addresses that aren't on the internet.
+func NetworkOf(ip netip.Addr) string {
+	ip = ip.Unmap()
+	switch {
+	case !ip.IsValid():
+		return "unknown"
+	case ip.IsLoopback():
+		return "loopback"
+	case ip.IsPrivate():
+		return "private"
+	case ip.IsLinkLocalUnicast():
+		return "link-local"
+	case ip.Is4():
+		return netip.PrefixFrom(ip, 24).Masked().String()
+	}
+	return netip.PrefixFrom(ip, 48).Masked().String()
+}
+
+// Add counts the download in the stats.
+func (s *DownloadStats) Add(e DownloadEvent) {
+	if s.Days == nil {
+		s.Days = make(map[string]DayStats)
+	}
+	date := e.Time.UTC().Format(StatsDateLayout)
+	day := s.Days[date]
+	if e.Completed {
+		s.Completed++
+		day.Completed++
+	} else {
+		s.Aborted++
+		day.Aborted++
+	}
+	s.Days[date] = day
+	s.BytesSent += e.BytesSent
+	s.Downloaders = addCount(s.Downloaders, e.Downloader, 1)
+	s.Networks = addCount(s.Networks, NetworkOf(e.IP), 1)
+}
+
+// Merge adds the other stats to these, such as to sum the stats of a user's files.
+func (s *DownloadStats) Merge(other DownloadStats) {
+	s.Completed += other.Completed
+	s.Aborted += other.Aborted
+	s.BytesSent += other.BytesSent
+	for date, day := range other.Days {
+		if s.Days == nil {
+			s.Days = make(map[string]DayStats)
+		}
+		sum := s.Days[date]
+		sum.Completed += day.Completed
+		sum.Aborted += day.Aborted
+		s.Days[date] = sum
+	}
+	for downloader, n := range other.Downloaders {
+		s.Downloaders = addCount(s.Downloaders, downloader, n)
+	}
+	for network, n := range other.Networks {
+		s.Networks = addCount(s.Networks, network, n)
+	}
+}
+
+// Downloads returns the number of completed and aborted downloads.
+func (s DownloadStats) Downloads() int64 {
+	return s.Completed + s.Aborted
+}
+
+// DistinctDownloaders returns how many different downloaders downloaded the file, which is a lower bound once there
+// were too many to keep track of.
+func (s DownloadStats) DistinctDownloaders() int {
+	if _, ok := s.Downloaders[StatsOther]; ok {
+		return len(s.Downloaders) - 1
+	}
+	return len(s.Downloaders)
+}
+
+func addCount(counts map[string]int64, key string, n int64) map[string]int64 {
+	if counts == nil {
+		counts = make(map[string]int64)
+	}
+	if _, ok := counts[key]; !ok && len(counts) >= maxStatsKeys {
+		key = StatsOther
+	}
+	counts[key] += n
+	return counts
+}
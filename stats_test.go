@@ -0,0 +1,124 @@
+package blinkfile_test
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benjohns1/blinkfile"
+)
+
+func TestNetworkOf(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   netip.Addr
+		want string
+	}{
+		{
+			name: "should be unknown for an invalid address",
+			want: "unknown",
+		},
+		{
+			name: "should group IPv4 addresses by /24",
+			ip:   netip.MustParseAddr("198.51.100.7"),
+			want: "198.51.100.0/24",
+		},
+		{
+			name: "should group IPv4-mapped IPv6 addresses as IPv4",
+			ip:   netip.MustParseAddr("::ffff:198.51.100.7"),
+			want: "198.51.100.0/24",
+		},
+		{
+			name: "should group IPv6 addresses by /48",
+			ip:   netip.MustParseAddr("2001:db8:1:2::1"),
+			want: "2001:db8:1::/48",
+		},
+		{
+			name: "should name private addresses",
+			ip:   netip.MustParseAddr("10.1.2.3"),
+			want: "private",
+		},
+		{
+			name: "should name loopback addresses",
+			ip:   netip.MustParseAddr("::1"),
+			want: "loopback",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blinkfile.NetworkOf(tt.ip); got != tt.want {
+				t.Errorf("NetworkOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloaderID(t *testing.T) {
+	ip := netip.MustParseAddr("192.0.2.1")
+	client := blinkfile.DownloaderID("", ip, "curl/8.0")
+	if len(client) != 16 {
+		t.Errorf("DownloaderID() = %q, want a 16 character hash", client)
+	}
+	if got := blinkfile.DownloaderID("", netip.MustParseAddr("::ffff:192.0.2.1"), "curl/8.0"); got != client {
+		t.Errorf("DownloaderID() of the mapped address = %q, want %q", got, client)
+	}
+	if got := blinkfile.DownloaderID("", ip, "Mozilla/5.0"); got == client {
+		t.Errorf("DownloaderID() with another user agent = %q, want a different downloader", got)
+	}
+	user := blinkfile.DownloaderID("user1", ip, "curl/8.0")
+	if got := blinkfile.DownloaderID("user1", netip.MustParseAddr("198.51.100.1"), "Mozilla/5.0"); got != user {
+		t.Errorf("DownloaderID() of the same user from another client = %q, want %q", got, user)
+	}
+}
+
+func TestDownloadStats_Add(t *testing.T) {
+	day1 := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+	ip := netip.MustParseAddr("198.51.100.7")
+	var stats blinkfile.DownloadStats
+	stats.Add(blinkfile.DownloadEvent{Time: day1, Downloader: "a", IP: ip, BytesSent: 100, Completed: true})
+	stats.Add(blinkfile.DownloadEvent{Time: day2, Downloader: "a", IP: ip, BytesSent: 100, Completed: true})
+	stats.Add(blinkfile.DownloadEvent{Time: day2, Downloader: "b", IP: netip.MustParseAddr("2001:db8::1"), BytesSent: 10})
+	want := blinkfile.DownloadStats{
+		Completed: 2,
+		Aborted:   1,
+		BytesSent: 210,
+		Days: map[string]blinkfile.DayStats{
+			"2024-05-01": {Completed: 1},
+			"2024-05-02": {Completed: 1, Aborted: 1},
+		},
+		Downloaders: map[string]int64{"a": 2, "b": 1},
+		Networks:    map[string]int64{"198.51.100.0/24": 2, "2001:db8::/48": 1},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("Add() stats = %+v, want %+v", stats, want)
+	}
+	if stats.Downloads() != 3 || stats.DistinctDownloaders() != 2 {
+		t.Errorf("Downloads() = %d, DistinctDownloaders() = %d, want 3 and 2", stats.Downloads(), stats.DistinctDownloaders())
+	}
+
+	var sum blinkfile.DownloadStats
+	sum.Merge(stats)
+	sum.Merge(blinkfile.DownloadStats{
+		Completed:   1,
+		BytesSent:   100,
+		Days:        map[string]blinkfile.DayStats{"2024-05-02": {Completed: 1}},
+		Downloaders: map[string]int64{"c": 1},
+		Networks:    map[string]int64{"198.51.100.0/24": 1},
+	})
+	want = blinkfile.DownloadStats{
+		Completed: 3,
+		Aborted:   1,
+		BytesSent: 310,
+		Days: map[string]blinkfile.DayStats{
+			"2024-05-01": {Completed: 1},
+			"2024-05-02": {Completed: 2, Aborted: 1},
+		},
+		Downloaders: map[string]int64{"a": 2, "b": 1, "c": 1},
+		Networks:    map[string]int64{"198.51.100.0/24": 3, "2001:db8::/48": 1},
+	}
+	if !reflect.DeepEqual(sum, want) {
+		t.Errorf("Merge() stats = %+v, want %+v", sum, want)
+	}
+}
@@ -0,0 +1,115 @@
+package thumbnail
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+type Config struct {
+	// MaxSize is the maximum width and height of a thumbnail in pixels.
+	MaxSize int
+	// MaxSourcePixels limits the decoded image size to protect against decompression bombs.
+	MaxSourcePixels int
+	// MaxSourceBytes limits how much of the image file is read, zero doesn't limit it.
+	MaxSourceBytes int64
+	Quality        int
+}
+
+var (
+	Default = Config{
+		MaxSize:         160,
+		MaxSourcePixels: 50_000_000,
+		MaxSourceBytes:  50 << 20,
+		Quality:         80,
+	}
+
+	ErrImageTooLarge     = fmt.Errorf("image dimensions are too large for a thumbnail")
+	ErrImageFileTooLarge = fmt.Errorf("image file is too large for a thumbnail")
+)
+
+// ContentTypes lists the image content types that thumbnails can be generated for.
+var ContentTypes = map[string]struct{}{
+	"image/jpeg": {},
+	"image/png":  {},
+	"image/gif":  {},
+}
+
+// Generate decodes the image and returns a JPEG-encoded thumbnail that fits within MaxSize, preserving the aspect
+// ratio. The image is streamed rather than read into memory, and its dimensions are checked before it's decoded.
+func (c Config) Generate(r io.Reader) ([]byte, error) {
+	limited := &io.LimitedReader{R: r, N: math.MaxInt64}
+	if c.MaxSourceBytes > 0 {
+		limited.N = c.MaxSourceBytes + 1
+	}
+	// The header that DecodeConfig reads is kept, so the image can be decoded from the start
+	var header bytes.Buffer
+	imgCfg, _, err := image.DecodeConfig(io.TeeReader(limited, &header))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image config: %w", err)
+	}
+	if imgCfg.Width <= 0 || imgCfg.Height <= 0 || imgCfg.Width*imgCfg.Height > c.MaxSourcePixels {
+		return nil, ErrImageTooLarge
+	}
+	src, _, err := image.Decode(io.MultiReader(&header, limited))
+	if c.MaxSourceBytes > 0 && limited.N <= 0 {
+		return nil, ErrImageFileTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	thumb := resize(src, c.MaxSize)
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: c.Quality})
+	if err != nil {
+		return nil, fmt.Errorf("encoding thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// resize scales the image down with a box filter so that every source pixel contributes to the thumbnail. Transparent
+// areas are flattened onto white since JPEG has no alpha channel.
+func resize(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	dw, dh := sw, sh
+	if sw > maxSize || sh > maxSize {
+		if sw >= sh {
+			dw, dh = maxSize, max(1, sh*maxSize/sw)
+		} else {
+			dw, dh = max(1, sw*maxSize/sh), maxSize
+		}
+	}
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, src, bounds.Min, draw.Over)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				offset := flat.PixOffset(bounds.Min.X+x0, bounds.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(flat.Pix[offset])
+					g += uint64(flat.Pix[offset+1])
+					b += uint64(flat.Pix[offset+2])
+					offset += 4
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 0xff})
+		}
+	}
+	return dst
+}
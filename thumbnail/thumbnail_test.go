@@ -0,0 +1,109 @@
+package thumbnail_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benjohns1/blinkfile/thumbnail"
+)
+
+func encodedImage(t *testing.T, w, h int, encode func(io.Writer, image.Image) error) io.Reader {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestConfig_Generate(t *testing.T) {
+	encodeGIF := func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) }
+	encodeJPEG := func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) }
+	tests := []struct {
+		name       string
+		cfg        thumbnail.Config
+		r          io.Reader
+		wantBounds image.Rectangle
+		wantErr    error
+		wantAnyErr bool
+	}{
+		{
+			name:       "should fail if the data is not an image",
+			cfg:        thumbnail.Default,
+			r:          strings.NewReader("not an image"),
+			wantAnyErr: true,
+		},
+		{
+			name:    "should fail if the image has too many pixels",
+			cfg:     thumbnail.Config{MaxSize: 10, MaxSourcePixels: 99},
+			r:       encodedImage(t, 10, 10, png.Encode),
+			wantErr: thumbnail.ErrImageTooLarge,
+		},
+		{
+			name:    "should fail if the image file is too large",
+			cfg:     thumbnail.Config{MaxSize: 10, MaxSourcePixels: 100_000, MaxSourceBytes: 100},
+			r:       encodedImage(t, 100, 100, png.Encode),
+			wantErr: thumbnail.ErrImageFileTooLarge,
+		},
+		{
+			name:       "should scale a wide PNG down to the max width",
+			cfg:        thumbnail.Default,
+			r:          encodedImage(t, 640, 320, png.Encode),
+			wantBounds: image.Rect(0, 0, 160, 80),
+		},
+		{
+			name:       "should scale a tall JPEG down to the max height",
+			cfg:        thumbnail.Default,
+			r:          encodedImage(t, 200, 400, encodeJPEG),
+			wantBounds: image.Rect(0, 0, 80, 160),
+		},
+		{
+			name:       "should not scale up a small GIF",
+			cfg:        thumbnail.Default,
+			r:          encodedImage(t, 20, 10, encodeGIF),
+			wantBounds: image.Rect(0, 0, 20, 10),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cfg.Generate(tt.r)
+			if tt.wantAnyErr {
+				if err == nil {
+					t.Errorf("Generate() expected an error")
+				}
+				return
+			}
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			img, format, err := image.Decode(bytes.NewReader(got))
+			if err != nil {
+				t.Fatalf("decoding thumbnail: %v", err)
+			}
+			if format != "jpeg" {
+				t.Errorf("Generate() format = %q, want jpeg", format)
+			}
+			if img.Bounds() != tt.wantBounds {
+				t.Errorf("Generate() bounds = %v, want %v", img.Bounds(), tt.wantBounds)
+			}
+		})
+	}
+}